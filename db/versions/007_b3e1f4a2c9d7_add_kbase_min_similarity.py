@@ -0,0 +1,32 @@
+"""add kbase min similarity
+
+Revision ID: b3e1f4a2c9d7
+Revises: 6c7b0e93dfac
+Create Date: 2024-10-06 11:12:40.318204
+
+"""
+from typing import Sequence, Union
+from sqlalchemy.engine.reflection import Inspector
+from alembic import op
+from sqlalchemy import Column, FLOAT
+
+
+# revision identifiers, used by Alembic.
+revision: str = 'b3e1f4a2c9d7'
+down_revision: Union[str, None] = '6c7b0e93dfac'
+branch_labels: Union[str, Sequence[str], None] = None
+depends_on: Union[str, Sequence[str], None] = None
+
+def upgrade():
+    conn = op.get_bind()
+    inspector = Inspector.from_engine(conn)
+
+    # minimum cosine similarity a chunk needs to be returned from this kbase, NULL uses the embedding model default
+    columns = [column['name'] for column in inspector.get_columns('kbase')]
+    if 'min_similarity' not in columns:
+        op.add_column('kbase', Column('min_similarity', FLOAT, nullable=True))
+    else:
+        print("Column 'kbase.min_similarity' already exists.")
+
+def downgrade():
+    op.drop_column('kbase', 'min_similarity')
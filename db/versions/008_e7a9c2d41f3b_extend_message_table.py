@@ -0,0 +1,38 @@
+"""extend message table for chat
+
+Revision ID: e7a9c2d41f3b
+Revises: b3e1f4a2c9d7
+Create Date: 2024-10-08 18:42:07.551930
+
+"""
+from typing import Sequence, Union
+from sqlalchemy.engine.reflection import Inspector
+from alembic import op
+from sqlalchemy import Column, ForeignKey, String, Text, JSON, UUID
+
+
+# revision identifiers, used by Alembic.
+revision: str = 'e7a9c2d41f3b'
+down_revision: Union[str, None] = 'b3e1f4a2c9d7'
+branch_labels: Union[str, Sequence[str], None] = None
+depends_on: Union[str, Sequence[str], None] = None
+
+def upgrade():
+    conn = op.get_bind()
+    inspector = Inspector.from_engine(conn)
+    columns = [column['name'] for column in inspector.get_columns('message')]
+
+    # model answers are longer than 500 characters
+    op.alter_column('message', 'user_message', type_=Text, existing_nullable=False)
+    op.alter_column('message', 'ai_message', type_=Text, existing_nullable=False)
+
+    if 'assistant_id' not in columns:
+        op.add_column('message', Column('assistant_id', UUID, ForeignKey("assistant.uuid"), nullable=True))
+    if 'sources' not in columns:
+        op.add_column('message', Column('sources', JSON, nullable=True))
+
+def downgrade():
+    op.drop_column('message', 'sources')
+    op.drop_column('message', 'assistant_id')
+    op.alter_column('message', 'ai_message', type_=String(500), existing_nullable=False)
+    op.alter_column('message', 'user_message', type_=String(500), existing_nullable=False)
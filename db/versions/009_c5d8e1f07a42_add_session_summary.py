@@ -0,0 +1,32 @@
+"""add rolling conversation summary to session
+
+Revision ID: c5d8e1f07a42
+Revises: e7a9c2d41f3b
+Create Date: 2024-10-11 09:15:42.180334
+
+"""
+from typing import Sequence, Union
+from sqlalchemy.engine.reflection import Inspector
+from alembic import op
+from sqlalchemy import Column, DateTime, Text
+
+
+# revision identifiers, used by Alembic.
+revision: str = 'c5d8e1f07a42'
+down_revision: Union[str, None] = 'e7a9c2d41f3b'
+branch_labels: Union[str, Sequence[str], None] = None
+depends_on: Union[str, Sequence[str], None] = None
+
+def upgrade():
+    conn = op.get_bind()
+    inspector = Inspector.from_engine(conn)
+    columns = [column['name'] for column in inspector.get_columns('session')]
+
+    if 'summary' not in columns:
+        op.add_column('session', Column('summary', Text, nullable=True))
+    if 'summarized_until' not in columns:
+        op.add_column('session', Column('summarized_until', DateTime, nullable=True))
+
+def downgrade():
+    op.drop_column('session', 'summarized_until')
+    op.drop_column('session', 'summary')
@@ -0,0 +1,30 @@
+"""add rewritten query to message
+
+Revision ID: f41a6b9d2e85
+Revises: c5d8e1f07a42
+Create Date: 2024-10-12 14:03:26.774190
+
+"""
+from typing import Sequence, Union
+from sqlalchemy.engine.reflection import Inspector
+from alembic import op
+from sqlalchemy import Column, Text
+
+
+# revision identifiers, used by Alembic.
+revision: str = 'f41a6b9d2e85'
+down_revision: Union[str, None] = 'c5d8e1f07a42'
+branch_labels: Union[str, Sequence[str], None] = None
+depends_on: Union[str, Sequence[str], None] = None
+
+def upgrade():
+    conn = op.get_bind()
+    inspector = Inspector.from_engine(conn)
+    columns = [column['name'] for column in inspector.get_columns('message')]
+
+    # the standalone query used for retrieval when the user message was a follow-up
+    if 'rewritten_query' not in columns:
+        op.add_column('message', Column('rewritten_query', Text, nullable=True))
+
+def downgrade():
+    op.drop_column('message', 'rewritten_query')
@@ -0,0 +1,30 @@
+"""add citations to message
+
+Revision ID: a8c3f5e2d914
+Revises: f41a6b9d2e85
+Create Date: 2024-10-13 10:27:51.402698
+
+"""
+from typing import Sequence, Union
+from sqlalchemy.engine.reflection import Inspector
+from alembic import op
+from sqlalchemy import Column, JSON
+
+
+# revision identifiers, used by Alembic.
+revision: str = 'a8c3f5e2d914'
+down_revision: Union[str, None] = 'f41a6b9d2e85'
+branch_labels: Union[str, Sequence[str], None] = None
+depends_on: Union[str, Sequence[str], None] = None
+
+def upgrade():
+    conn = op.get_bind()
+    inspector = Inspector.from_engine(conn)
+    columns = [column['name'] for column in inspector.get_columns('message')]
+
+    # the [n] markers of the answer resolved to kbase, document, chunk and pages for auditing
+    if 'citations' not in columns:
+        op.add_column('message', Column('citations', JSON, nullable=True))
+
+def downgrade():
+    op.drop_column('message', 'citations')
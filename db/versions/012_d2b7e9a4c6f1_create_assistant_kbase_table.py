@@ -0,0 +1,43 @@
+"""create assistant kbase link table
+
+Revision ID: d2b7e9a4c6f1
+Revises: a8c3f5e2d914
+Create Date: 2024-10-14 16:48:09.312557
+
+"""
+from typing import Sequence, Union
+from sqlalchemy.engine.reflection import Inspector
+from alembic import op
+from sqlalchemy import Column, DateTime, Float, ForeignKey, Integer, UUID, UniqueConstraint
+from sqlalchemy.sql import func
+
+
+# revision identifiers, used by Alembic.
+revision: str = 'd2b7e9a4c6f1'
+down_revision: Union[str, None] = 'a8c3f5e2d914'
+branch_labels: Union[str, Sequence[str], None] = None
+depends_on: Union[str, Sequence[str], None] = None
+
+def upgrade():
+    conn = op.get_bind()
+    inspector = Inspector.from_engine(conn)
+    tables = inspector.get_table_names()
+
+    if 'assistant_kbase' not in tables:
+        op.create_table(
+            'assistant_kbase',
+            Column('id', Integer, primary_key=True, autoincrement=True),
+            Column('assistant_id', UUID, ForeignKey("assistant.uuid"), nullable=False),
+            Column('kbase_id', UUID, ForeignKey("kbase.uuid"), nullable=False),
+            Column('top_k', Integer, nullable=False, server_default='5'),
+            Column('min_similarity', Float, nullable=True),
+            Column('weight', Float, nullable=False, server_default='1'),
+            Column('created_at', DateTime, server_default=func.now()),
+            UniqueConstraint('assistant_id', 'kbase_id', name='uq_assistant_kbase')
+        )
+        print("Table 'assistant_kbase' created successfully.")
+    else:
+        print("Table 'assistant_kbase' already exists.")
+
+def downgrade():
+    op.drop_table('assistant_kbase')
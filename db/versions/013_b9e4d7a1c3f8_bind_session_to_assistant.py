@@ -0,0 +1,37 @@
+"""bind session to an assistant and give it a title
+
+Revision ID: b9e4d7a1c3f8
+Revises: d2b7e9a4c6f1
+Create Date: 2024-10-16 11:02:27.513906
+
+"""
+from typing import Sequence, Union
+from sqlalchemy.engine.reflection import Inspector
+from alembic import op
+from sqlalchemy import Column, ForeignKey, String, UUID
+
+
+# revision identifiers, used by Alembic.
+revision: str = 'b9e4d7a1c3f8'
+down_revision: Union[str, None] = 'd2b7e9a4c6f1'
+branch_labels: Union[str, Sequence[str], None] = None
+depends_on: Union[str, Sequence[str], None] = None
+
+def upgrade():
+    conn = op.get_bind()
+    inspector = Inspector.from_engine(conn)
+    columns = [column['name'] for column in inspector.get_columns('session')]
+    indexes = [index['name'] for index in inspector.get_indexes('session')]
+
+    if 'assistant_id' not in columns:
+        op.add_column('session', Column('assistant_id', UUID, ForeignKey("assistant.uuid"), nullable=True))
+    if 'title' not in columns:
+        op.add_column('session', Column('title', String(255), nullable=True))
+    # sessions are listed per user, most recently active first
+    if 'ix_session_user_id_updated_at' not in indexes:
+        op.create_index('ix_session_user_id_updated_at', 'session', ['user_id', 'updated_at'])
+
+def downgrade():
+    op.drop_index('ix_session_user_id_updated_at', table_name='session')
+    op.drop_column('session', 'title')
+    op.drop_column('session', 'assistant_id')
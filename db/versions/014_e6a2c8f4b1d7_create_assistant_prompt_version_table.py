@@ -0,0 +1,57 @@
+"""create assistant prompt version table
+
+Revision ID: e6a2c8f4b1d7
+Revises: b9e4d7a1c3f8
+Create Date: 2024-10-17 14:21:53.804412
+
+"""
+from typing import Sequence, Union
+from sqlalchemy.engine.reflection import Inspector
+from alembic import op
+from sqlalchemy import Column, DateTime, ForeignKey, Integer, Text, UUID, UniqueConstraint
+from sqlalchemy.sql import func
+
+
+# revision identifiers, used by Alembic.
+revision: str = 'e6a2c8f4b1d7'
+down_revision: Union[str, None] = 'b9e4d7a1c3f8'
+branch_labels: Union[str, Sequence[str], None] = None
+depends_on: Union[str, Sequence[str], None] = None
+
+def upgrade():
+    conn = op.get_bind()
+    inspector = Inspector.from_engine(conn)
+    tables = inspector.get_table_names()
+
+    if 'assistant_prompt_version' not in tables:
+        op.create_table(
+            'assistant_prompt_version',
+            Column('id', Integer, primary_key=True, autoincrement=True),
+            Column('assistant_id', UUID, ForeignKey("assistant.uuid"), nullable=False),
+            Column('version', Integer, nullable=False),
+            Column('template', Text, nullable=False),
+            Column('created_at', DateTime, server_default=func.now()),
+            UniqueConstraint('assistant_id', 'version', name='uq_assistant_prompt_version')
+        )
+        print("Table 'assistant_prompt_version' created successfully.")
+    else:
+        print("Table 'assistant_prompt_version' already exists.")
+
+    assistant_columns = [column['name'] for column in inspector.get_columns('assistant')]
+    if 'prompt_version' not in assistant_columns:
+        op.add_column('assistant', Column('prompt_version', Integer, nullable=True))
+        # the current prompt of existing assistants becomes their first version
+        op.execute("""
+            INSERT INTO assistant_prompt_version (assistant_id, version, template)
+            SELECT uuid, 1, system_prompts #>> '{}' FROM assistant
+        """)
+        op.execute("UPDATE assistant SET prompt_version = 1")
+
+    message_columns = [column['name'] for column in inspector.get_columns('message')]
+    if 'prompt_version' not in message_columns:
+        op.add_column('message', Column('prompt_version', Integer, nullable=True))
+
+def downgrade():
+    op.drop_column('message', 'prompt_version')
+    op.drop_column('assistant', 'prompt_version')
+    op.drop_table('assistant_prompt_version')
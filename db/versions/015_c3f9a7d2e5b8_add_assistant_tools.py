@@ -0,0 +1,36 @@
+"""add tools to assistant and tool calls to message
+
+Revision ID: c3f9a7d2e5b8
+Revises: e6a2c8f4b1d7
+Create Date: 2024-10-18 09:42:17.215839
+
+"""
+from typing import Sequence, Union
+from sqlalchemy.engine.reflection import Inspector
+from alembic import op
+from sqlalchemy import Column, JSON
+
+
+# revision identifiers, used by Alembic.
+revision: str = 'c3f9a7d2e5b8'
+down_revision: Union[str, None] = 'e6a2c8f4b1d7'
+branch_labels: Union[str, Sequence[str], None] = None
+depends_on: Union[str, Sequence[str], None] = None
+
+def upgrade():
+    conn = op.get_bind()
+    inspector = Inspector.from_engine(conn)
+
+    # names of the registered tools the assistant's model may call
+    assistant_columns = [column['name'] for column in inspector.get_columns('assistant')]
+    if 'tools' not in assistant_columns:
+        op.add_column('assistant', Column('tools', JSON, nullable=True))
+
+    # the tool calls made while answering, with their input, output and duration for auditing
+    message_columns = [column['name'] for column in inspector.get_columns('message')]
+    if 'tool_calls' not in message_columns:
+        op.add_column('message', Column('tool_calls', JSON, nullable=True))
+
+def downgrade():
+    op.drop_column('message', 'tool_calls')
+    op.drop_column('assistant', 'tools')
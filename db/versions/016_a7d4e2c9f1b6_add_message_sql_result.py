@@ -0,0 +1,30 @@
+"""add the query of text-to-SQL answers to message
+
+Revision ID: a7d4e2c9f1b6
+Revises: c3f9a7d2e5b8
+Create Date: 2024-10-21 14:08:53.402117
+
+"""
+from typing import Sequence, Union
+from sqlalchemy.engine.reflection import Inspector
+from alembic import op
+from sqlalchemy import Column, JSON
+
+
+# revision identifiers, used by Alembic.
+revision: str = 'a7d4e2c9f1b6'
+down_revision: Union[str, None] = 'c3f9a7d2e5b8'
+branch_labels: Union[str, Sequence[str], None] = None
+depends_on: Union[str, Sequence[str], None] = None
+
+def upgrade():
+    conn = op.get_bind()
+    inspector = Inspector.from_engine(conn)
+
+    # the query a text-to-SQL assistant ran with its columns and row count; the rows aren't kept
+    columns = [column['name'] for column in inspector.get_columns('message')]
+    if 'sql_result' not in columns:
+        op.add_column('message', Column('sql_result', JSON, nullable=True))
+
+def downgrade():
+    op.drop_column('message', 'sql_result')
@@ -0,0 +1,36 @@
+"""add guardrail policies to assistant and guardrail results to message
+
+Revision ID: f2b8c6a1d9e3
+Revises: a7d4e2c9f1b6
+Create Date: 2024-10-22 10:17:36.581204
+
+"""
+from typing import Sequence, Union
+from sqlalchemy.engine.reflection import Inspector
+from alembic import op
+from sqlalchemy import Column, JSON
+
+
+# revision identifiers, used by Alembic.
+revision: str = 'f2b8c6a1d9e3'
+down_revision: Union[str, None] = 'a7d4e2c9f1b6'
+branch_labels: Union[str, Sequence[str], None] = None
+depends_on: Union[str, Sequence[str], None] = None
+
+def upgrade():
+    conn = op.get_bind()
+    inspector = Inspector.from_engine(conn)
+
+    # deny-lists, PII detectors, blocked topics and an optional Bedrock guardrail per assistant
+    assistant_columns = [column['name'] for column in inspector.get_columns('assistant')]
+    if 'guardrails' not in assistant_columns:
+        op.add_column('assistant', Column('guardrails', JSON, nullable=True))
+
+    # the checks that masked or blocked a message or its answer, so blocked turns show in the history
+    message_columns = [column['name'] for column in inspector.get_columns('message')]
+    if 'guardrails' not in message_columns:
+        op.add_column('message', Column('guardrails', JSON, nullable=True))
+
+def downgrade():
+    op.drop_column('message', 'guardrails')
+    op.drop_column('assistant', 'guardrails')
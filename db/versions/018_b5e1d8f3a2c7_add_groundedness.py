@@ -0,0 +1,36 @@
+"""add groundedness policies to assistant and groundedness results to message
+
+Revision ID: b5e1d8f3a2c7
+Revises: f2b8c6a1d9e3
+Create Date: 2024-10-23 09:41:12.203518
+
+"""
+from typing import Sequence, Union
+from sqlalchemy.engine.reflection import Inspector
+from alembic import op
+from sqlalchemy import Column, JSON
+
+
+# revision identifiers, used by Alembic.
+revision: str = 'b5e1d8f3a2c7'
+down_revision: Union[str, None] = 'f2b8c6a1d9e3'
+branch_labels: Union[str, Sequence[str], None] = None
+depends_on: Union[str, Sequence[str], None] = None
+
+def upgrade():
+    conn = op.get_bind()
+    inspector = Inspector.from_engine(conn)
+
+    # how an assistant's answers are checked against their sources and what happens when they fall short
+    assistant_columns = [column['name'] for column in inspector.get_columns('assistant')]
+    if 'groundedness' not in assistant_columns:
+        op.add_column('assistant', Column('groundedness', JSON, nullable=True))
+
+    # the score and unsupported sentences of a checked answer
+    message_columns = [column['name'] for column in inspector.get_columns('message')]
+    if 'groundedness' not in message_columns:
+        op.add_column('message', Column('groundedness', JSON, nullable=True))
+
+def downgrade():
+    op.drop_column('message', 'groundedness')
+    op.drop_column('assistant', 'groundedness')
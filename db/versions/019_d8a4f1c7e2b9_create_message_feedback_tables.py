@@ -0,0 +1,69 @@
+"""create message feedback tables
+
+Revision ID: d8a4f1c7e2b9
+Revises: b5e1d8f3a2c7
+Create Date: 2024-10-24 11:05:47.912365
+
+"""
+from typing import Sequence, Union
+from sqlalchemy.engine.reflection import Inspector
+from alembic import op
+from sqlalchemy import Boolean, Column, DateTime, ForeignKey, Index, Integer, String, Text, UUID, UniqueConstraint
+from sqlalchemy.sql import func
+
+
+# revision identifiers, used by Alembic.
+revision: str = 'd8a4f1c7e2b9'
+down_revision: Union[str, None] = 'b5e1d8f3a2c7'
+branch_labels: Union[str, Sequence[str], None] = None
+depends_on: Union[str, Sequence[str], None] = None
+
+def upgrade():
+    conn = op.get_bind()
+    inspector = Inspector.from_engine(conn)
+    tables = inspector.get_table_names()
+
+    # one rating per user and message; rating again updates it
+    if 'message_feedback' not in tables:
+        op.create_table(
+            'message_feedback',
+            Column('id', Integer, primary_key=True, autoincrement=True),
+            Column('uuid', UUID, nullable=False, unique=True),
+            Column('message_id', UUID, ForeignKey("message.uuid", ondelete="CASCADE"), nullable=False),
+            Column('user_id', UUID, nullable=False),
+            Column('session_id', UUID, nullable=False),
+            Column('assistant_id', UUID, nullable=True),
+            Column('rating', String(8), nullable=False),
+            Column('category', String(32), nullable=True),
+            Column('comment', Text, nullable=True),
+            Column('prompt_version', Integer, nullable=True),
+            Column('created_at', DateTime, server_default=func.now()),
+            Column('updated_at', DateTime, server_default=func.now()),
+            UniqueConstraint('message_id', 'user_id', name='uq_message_feedback_user'),
+            Index('ix_message_feedback_assistant', 'assistant_id', 'updated_at'),
+        )
+        print("Table 'message_feedback' created successfully.")
+    else:
+        print("Table 'message_feedback' already exists.")
+
+    # the chunks retrieved for the rated answer, so down votes can be traced back to documents
+    if 'message_feedback_chunk' not in tables:
+        op.create_table(
+            'message_feedback_chunk',
+            Column('id', Integer, primary_key=True, autoincrement=True),
+            Column('feedback_id', UUID, ForeignKey("message_feedback.uuid", ondelete="CASCADE"), nullable=False),
+            Column('kbase_id', UUID, nullable=False),
+            Column('embedding_id', UUID, nullable=True),
+            Column('chunk_id', Integer, nullable=False),
+            Column('source', Text, nullable=False),
+            Column('cited', Boolean, nullable=False, server_default='false'),
+            Index('ix_message_feedback_chunk_feedback', 'feedback_id'),
+            Index('ix_message_feedback_chunk_kbase', 'kbase_id'),
+        )
+        print("Table 'message_feedback_chunk' created successfully.")
+    else:
+        print("Table 'message_feedback_chunk' already exists.")
+
+def downgrade():
+    op.drop_table('message_feedback_chunk')
+    op.drop_table('message_feedback')
@@ -0,0 +1,41 @@
+"""add parent pointer to message so a session's turns form a tree
+
+Revision ID: e3c7a9d5b1f4
+Revises: d8a4f1c7e2b9
+Create Date: 2024-10-25 15:32:08.447120
+
+"""
+from typing import Sequence, Union
+from sqlalchemy.engine.reflection import Inspector
+from alembic import op
+from sqlalchemy import Column, UUID
+
+
+# revision identifiers, used by Alembic.
+revision: str = 'e3c7a9d5b1f4'
+down_revision: Union[str, None] = 'd8a4f1c7e2b9'
+branch_labels: Union[str, Sequence[str], None] = None
+depends_on: Union[str, Sequence[str], None] = None
+
+def upgrade():
+    conn = op.get_bind()
+    inspector = Inspector.from_engine(conn)
+
+    message_columns = [column['name'] for column in inspector.get_columns('message')]
+    if 'parent_id' not in message_columns:
+        # the turn a turn follows; regenerated answers and edited messages share the original's parent
+        op.add_column('message', Column('parent_id', UUID, nullable=True))
+        op.create_index('ix_message_parent_id', 'message', ['parent_id'])
+        # existing sessions are a single branch: every turn follows the one before it
+        op.execute("""
+            UPDATE message m SET parent_id = p.parent_id
+            FROM (
+                SELECT uuid, LAG(uuid) OVER (PARTITION BY session_id ORDER BY created_at, id) AS parent_id
+                FROM message
+            ) p
+            WHERE m.uuid = p.uuid
+        """)
+
+def downgrade():
+    op.drop_index('ix_message_parent_id', 'message')
+    op.drop_column('message', 'parent_id')
@@ -0,0 +1,54 @@
+"""create usage table
+
+Revision ID: c6e2a8f4d1b7
+Revises: e3c7a9d5b1f4
+Create Date: 2024-10-28 10:12:36.518204
+
+"""
+from typing import Sequence, Union
+from sqlalchemy.engine.reflection import Inspector
+from alembic import op
+from sqlalchemy import Column, DateTime, Index, Integer, Numeric, String, UUID
+from sqlalchemy.sql import func
+
+
+# revision identifiers, used by Alembic.
+revision: str = 'c6e2a8f4d1b7'
+down_revision: Union[str, None] = 'e3c7a9d5b1f4'
+branch_labels: Union[str, Sequence[str], None] = None
+depends_on: Union[str, Sequence[str], None] = None
+
+def upgrade():
+    conn = op.get_bind()
+    inspector = Inspector.from_engine(conn)
+    tables = inspector.get_table_names()
+
+    # one row per metered model call or Textract job; the ids have no foreign keys so the costs stay
+    # accounted for after users, sessions, assistants or kbases are deleted
+    if 'usage' not in tables:
+        op.create_table(
+            'usage',
+            Column('id', Integer, primary_key=True, autoincrement=True),
+            Column('uuid', UUID, nullable=False, unique=True),
+            Column('user_id', UUID, nullable=True),
+            Column('session_id', UUID, nullable=True),
+            Column('assistant_id', UUID, nullable=True),
+            Column('kbase_id', UUID, nullable=True),
+            Column('kind', String(16), nullable=False),
+            Column('model_id', String(128), nullable=False),
+            Column('input_tokens', Integer, nullable=False, server_default='0'),
+            Column('output_tokens', Integer, nullable=False, server_default='0'),
+            Column('pages', Integer, nullable=False, server_default='0'),
+            Column('cost', Numeric(14, 8), nullable=False, server_default='0'),
+            Column('created_at', DateTime, server_default=func.now()),
+            Index('ix_usage_created_at', 'created_at'),
+            Index('ix_usage_user', 'user_id', 'created_at'),
+            Index('ix_usage_assistant', 'assistant_id', 'created_at'),
+            Index('ix_usage_kbase', 'kbase_id', 'created_at'),
+        )
+        print("Table 'usage' created successfully.")
+    else:
+        print("Table 'usage' already exists.")
+
+def downgrade():
+    op.drop_table('usage')
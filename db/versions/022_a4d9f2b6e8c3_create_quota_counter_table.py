@@ -0,0 +1,43 @@
+"""create quota counter table
+
+Revision ID: a4d9f2b6e8c3
+Revises: c6e2a8f4d1b7
+Create Date: 2024-10-29 16:41:52.086731
+
+"""
+from typing import Sequence, Union
+from sqlalchemy.engine.reflection import Inspector
+from alembic import op
+from sqlalchemy import BigInteger, Column, DateTime, Index, PrimaryKeyConstraint, String
+
+
+# revision identifiers, used by Alembic.
+revision: str = 'a4d9f2b6e8c3'
+down_revision: Union[str, None] = 'c6e2a8f4d1b7'
+branch_labels: Union[str, Sequence[str], None] = None
+depends_on: Union[str, Sequence[str], None] = None
+
+def upgrade():
+    conn = op.get_bind()
+    inspector = Inspector.from_engine(conn)
+    tables = inspector.get_table_names()
+
+    # one count per subject, counter and window, e.g. the requests of a user in one minute; expired
+    # windows are deleted by the API
+    if 'quota_counter' not in tables:
+        op.create_table(
+            'quota_counter',
+            Column('subject', String(128), nullable=False),
+            Column('name', String(32), nullable=False),
+            Column('window_start', DateTime(timezone=True), nullable=False),
+            Column('expires_at', DateTime(timezone=True), nullable=False),
+            Column('count', BigInteger, nullable=False, server_default='0'),
+            PrimaryKeyConstraint('subject', 'name', 'window_start', name='pk_quota_counter'),
+            Index('ix_quota_counter_expires_at', 'expires_at'),
+        )
+        print("Table 'quota_counter' created successfully.")
+    else:
+        print("Table 'quota_counter' already exists.")
+
+def downgrade():
+    op.drop_table('quota_counter')
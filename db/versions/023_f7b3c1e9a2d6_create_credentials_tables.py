@@ -0,0 +1,58 @@
+"""create credentials and password reset tables
+
+Revision ID: f7b3c1e9a2d6
+Revises: a4d9f2b6e8c3
+Create Date: 2024-10-30 11:27:08.413962
+
+"""
+from typing import Sequence, Union
+from sqlalchemy.engine.reflection import Inspector
+from alembic import op
+from sqlalchemy import Column, DateTime, ForeignKey, Index, Integer, String, UUID
+from sqlalchemy.sql import func
+
+
+# revision identifiers, used by Alembic.
+revision: str = 'f7b3c1e9a2d6'
+down_revision: Union[str, None] = 'a4d9f2b6e8c3'
+branch_labels: Union[str, Sequence[str], None] = None
+depends_on: Union[str, Sequence[str], None] = None
+
+def upgrade():
+    conn = op.get_bind()
+    inspector = Inspector.from_engine(conn)
+    tables = inspector.get_table_names()
+
+    # the email and password login of a user; users created before passwords have no row
+    if 'credentials' not in tables:
+        op.create_table(
+            'credentials',
+            Column('user_id', UUID, ForeignKey("users.uuid", ondelete="CASCADE"), primary_key=True),
+            Column('email', String(254), nullable=False, unique=True),
+            Column('password_hash', String(72), nullable=False),
+            Column('failed_logins', Integer, nullable=False, server_default='0'),
+            Column('locked_until', DateTime(timezone=True), nullable=True),
+            Column('password_changed_at', DateTime(timezone=True), nullable=False, server_default=func.now()),
+            Column('created_at', DateTime(timezone=True), server_default=func.now()),
+        )
+        print("Table 'credentials' created successfully.")
+    else:
+        print("Table 'credentials' already exists.")
+
+    # single use password reset tokens, stored as a sha256 hash of the token sent to the user
+    if 'password_reset' not in tables:
+        op.create_table(
+            'password_reset',
+            Column('token_hash', String(64), primary_key=True),
+            Column('user_id', UUID, ForeignKey("users.uuid", ondelete="CASCADE"), nullable=False),
+            Column('expires_at', DateTime(timezone=True), nullable=False),
+            Column('created_at', DateTime(timezone=True), server_default=func.now()),
+            Index('ix_password_reset_user', 'user_id'),
+        )
+        print("Table 'password_reset' created successfully.")
+    else:
+        print("Table 'password_reset' already exists.")
+
+def downgrade():
+    op.drop_table('password_reset')
+    op.drop_table('credentials')
@@ -0,0 +1,43 @@
+"""create api key table
+
+Revision ID: c2e8a5d1f4b7
+Revises: f7b3c1e9a2d6
+Create Date: 2024-10-31 10:12:44.205817
+
+"""
+from typing import Sequence, Union
+from sqlalchemy.engine.reflection import Inspector
+from alembic import op
+from sqlalchemy import Column, DateTime, ForeignKey, Index, String, UUID
+from sqlalchemy.sql import func
+
+
+# revision identifiers, used by Alembic.
+revision: str = 'c2e8a5d1f4b7'
+down_revision: Union[str, None] = 'f7b3c1e9a2d6'
+branch_labels: Union[str, Sequence[str], None] = None
+depends_on: Union[str, Sequence[str], None] = None
+
+def upgrade():
+    conn = op.get_bind()
+    inspector = Inspector.from_engine(conn)
+    tables = inspector.get_table_names()
+
+    # API keys of users, stored as a sha256 hash of the key handed out once
+    if 'api_key' not in tables:
+        op.create_table(
+            'api_key',
+            Column('id', UUID, primary_key=True),
+            Column('user_id', UUID, ForeignKey("users.uuid", ondelete="CASCADE"), nullable=False),
+            Column('name', String(100), nullable=False),
+            Column('prefix', String(16), nullable=False),
+            Column('key_hash', String(64), nullable=False, unique=True),
+            Column('created_at', DateTime(timezone=True), server_default=func.now()),
+            Index('ix_api_key_user', 'user_id'),
+        )
+        print("Table 'api_key' created successfully.")
+    else:
+        print("Table 'api_key' already exists.")
+
+def downgrade():
+    op.drop_table('api_key')
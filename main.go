@@ -8,12 +8,26 @@ import (
 	"github.com/go-chi/chi/v5/middleware"
 	"github.com/jackc/pgx/v5/pgxpool"
 	"github.com/joho/godotenv"
+	"rag-demo/pkg/assistant"
 	"rag-demo/pkg/auth"
+	"rag-demo/pkg/grounding"
+	"rag-demo/pkg/guardrail"
 	"rag-demo/pkg/message"
 	"rag-demo/pkg/kbase"
+	"rag-demo/pkg/index"
+	"rag-demo/pkg/llm"
+	"rag-demo/pkg/quota"
+	"rag-demo/pkg/search"
+	"rag-demo/pkg/textsql"
+	"rag-demo/pkg/tools"
+	"rag-demo/pkg/usage"
 	"os"
+	"strconv"
+	"strings"
+	"time"
 	"rag-demo/pkg/db"
 	"rag-demo/pkg/handlers"
+	"rag-demo/types"
 )
 
 func main() {
@@ -35,38 +49,163 @@ func main() {
 	// Create user gateway
 	userGateway := db.NewUserTableGateway(dbPool)
 
-	// Create auth service
-	authService := auth.NewAuthService(userGateway)
+	// Create auth service; tokens issued before a password change are refused
+	credentialGateway := db.NewCredentialTableGateway(dbPool)
+	authService := auth.NewAuthService(userGateway, credentialGateway)
+
+	// email and password accounts; reset tokens are only logged until a mail notifier is plugged in
+	accountService := auth.NewAccountService(credentialGateway, userGateway, auth.NewLogNotifier())
+	// API keys authenticate as their user and are limited on their own
+	apiKeyService := auth.NewAPIKeyService(db.NewAPIKeyTableGateway(dbPool), userGateway)
 
 	// Create session gateway
 	sessionGateway := db.NewSessionTableGateway(dbPool)
 
-	// Create session service
-	sessionService := message.NewSessionService(sessionGateway)
-
 	// create kbase service 
-	kbaseService := kbase.NewKbaseService(db.NewKbaseTableGateway(dbPool))
+	kbaseGateway := db.NewKbaseTableGateway(dbPool)
+	kbaseService := kbase.NewKbaseService(kbaseGateway)
+
+	// tools assistants can call; the kbase search tool is built in
+	toolRegistry := tools.NewRegistry()
+
+	// create assistant service
+	assistantGateway := db.NewAssistantTableGateway(dbPool)
+	assistantService := assistant.NewAssistantService(assistantGateway, kbaseGateway, toolRegistry)
+
+	// create retriever for searching kbase embeddings
+	bedrockService, err := index.NewBedrockRuntimeService()
+	if err != nil {
+		log.Fatalf("Error initializing Bedrock service: %v", err)
+	}
+	// every model call is metered and priced with the price table, the defaults overridden by USAGE_PRICES_FILE
+	prices, err := usage.LoadPrices(os.Getenv("USAGE_PRICES_FILE"))
+	if err != nil {
+		log.Fatalf("Error loading usage prices: %v", err)
+	}
+	usageGateway := db.NewUsageTableGateway(dbPool)
+	usageService := usage.NewUsageService(usageGateway)
+	meter := usage.NewMeter(usageGateway, prices)
+	embedder := usage.NewMeteredEmbedder(bedrockService, meter)
+	// users, API keys and anonymous clients are limited to requests per minute and model tokens and
+	// documents per day, counted in Postgres when QUOTA_STORE=postgres so all instances share them
+	var quotaStore types.QuotaStore = quota.NewMemoryStore()
+	if os.Getenv("QUOTA_STORE") == "postgres" {
+		quotaStore = db.NewQuotaStore(dbPool)
+	}
+	limiter := quota.NewLimiter(quotaStore, map[string]quota.Limits{
+		quota.SubjectUser:   quotaLimits("QUOTA_"),
+		quota.SubjectAPIKey: quotaLimits("QUOTA_API_KEY_"),
+	}, handlers.QuotaSubject(authService, apiKeyService))
+	// chat models are called through the Converse API so every supported model family takes the same request
+	chatModel := quota.NewCountedLLM(usage.NewMeteredLLM(llm.NewBedrockLLM(bedrockService.Client), meter), limiter)
+	queryTransformer := search.NewQueryTransformer(chatModel, os.Getenv("QUERY_TRANSFORM_MODEL_ID"))
+	retriever := search.NewRetriever(embedder, db.NewKbaseEmbeddingsTableGateway(dbPool), kbaseGateway, queryTransformer)
+
+	// create session and chat services; answers keep the session history within a token budget
+	messageGateway := db.NewMessageTableGateway(dbPool)
+	sessionService := message.NewSessionService(sessionGateway, messageGateway, assistantGateway)
+	feedbackService := message.NewFeedbackService(db.NewFeedbackTableGateway(dbPool), messageGateway)
+	maxHistoryTokens, _ := strconv.Atoi(os.Getenv("MAX_HISTORY_TOKENS"))
+	memory := message.NewConversationMemory(messageGateway, sessionGateway, chatModel, os.Getenv("MEMORY_SUMMARY_MODEL_ID"), maxHistoryTokens)
+
+	// text-to-SQL assistants query their own database through a separate pool of read-only connections;
+	// its role should only be granted SELECT on the allowed tables
+	var sqlService *textsql.Service
+	if connString := os.Getenv("SQL_ASSISTANT_CONN_STRING"); connString != "" {
+		sqlPool, err := db.NewSQLSandboxPool(context.Background(), connString)
+		if err != nil {
+			log.Fatalf("Unable to connect to text-to-SQL database: %v", err)
+		}
+		defer sqlPool.Close()
+		maxRows, _ := strconv.Atoi(os.Getenv("SQL_ASSISTANT_MAX_ROWS"))
+		timeoutMs, _ := strconv.Atoi(os.Getenv("SQL_ASSISTANT_TIMEOUT_MS"))
+		sqlService = textsql.NewService(chatModel, db.NewSQLSandboxGateway(sqlPool), textsql.Config{
+			Tables:           strings.Split(os.Getenv("SQL_ASSISTANT_TABLES"), ","),
+			MaxRows:          maxRows,
+			StatementTimeout: time.Duration(timeoutMs) * time.Millisecond,
+		})
+	}
+	// assistants' guardrail policies are checked with the local rules first, then with their Bedrock guardrail if set
+	guard := guardrail.NewPipeline(guardrail.NewRules(), guardrail.NewBedrock(bedrockService.Client))
+	// assistants with a groundedness policy have their answers checked by a judge model or by embedding similarity
+	verifier := grounding.NewVerifier(chatModel, embedder)
+	chatService := message.NewChatService(assistantGateway, messageGateway, retriever, chatModel, memory, queryTransformer, userGateway, toolRegistry, sqlService, guard, verifier)
+
+	// tracks open session websockets so typing indicators reach a session's other connections and
+	// notices can be pushed to them
+	sessionHub := handlers.NewSessionHub()
 
 	// Set up router
 	r := chi.NewRouter()
 	r.Use(middleware.Logger)
+	r.Use(limiter.Requests)
 
 	r.Get("/", func(w http.ResponseWriter, r *http.Request) {
 		w.Write([]byte("welcome"))
 	})
 
 	// Use the new handler that takes authService as an argument
-	r.Post("/api/v1/signup", handlers.HandleCreateUser(authService))
+	r.Post("/api/v1/signup", handlers.HandleCreateUser(authService, accountService))
+	r.Post("/api/v1/login", handlers.HandleLogin(authService, accountService))
 	r.Post("/api/v1/validate", handlers.HandleValidateUser(authService))
-	r.Get("/api/v1/user/{userID}", handlers.HandleGetUser(authService))
-	r.Post("/api/v1/session", handlers.HandleCreateSession(sessionService))
-	r.Post("/api/v1/kbase", handlers.HandleCreateKbase(kbaseService))
-	r.Get("/api/v1/kbase", handlers.HandleListKbases(kbaseService))
-	r.Delete("/api/v1/kbase/{id}", handlers.HandleDeleteKbase(kbaseService))
+	r.Post("/api/v1/password/reset", handlers.HandleRequestPasswordReset(accountService))
+	r.Post("/api/v1/password/reset/confirm", handlers.HandleResetPassword(accountService))
+
+	// every other route requires a valid access token or API key and acts as its user
+	r.Group(func(r chi.Router) {
+		r.Use(handlers.RequireAuth(authService, apiKeyService))
+		r.Get("/api/v1/user", handlers.HandleGetUser(authService))
+		r.Put("/api/v1/user/password", handlers.HandleChangePassword(authService, accountService))
+		r.Post("/api/v1/user/apikey", handlers.HandleCreateAPIKey(apiKeyService))
+		r.Get("/api/v1/user/apikey", handlers.HandleListAPIKeys(apiKeyService))
+		r.Delete("/api/v1/user/apikey/{id}", handlers.HandleDeleteAPIKey(apiKeyService))
+		r.Post("/api/v1/session", handlers.HandleCreateSession(sessionService))
+		r.Get("/api/v1/session", handlers.HandleListSessions(sessionService))
+		r.Get("/api/v1/session/{id}", handlers.HandleGetSession(sessionService))
+		r.Post("/api/v1/session/{id}/close", handlers.HandleCloseSession(sessionService))
+		r.Post("/api/v1/message/{id}/feedback", handlers.HandleSubmitFeedback(feedbackService))
+		r.Post("/api/v1/kbase", handlers.HandleCreateKbase(kbaseService))
+		r.Get("/api/v1/kbase", handlers.HandleListKbases(kbaseService))
+		r.Delete("/api/v1/kbase/{id}", handlers.HandleDeleteKbase(kbaseService))
+		r.Get("/api/v1/kbase/{id}/feedback", handlers.HandleKbaseFeedback(feedbackService))
+		r.Post("/api/v1/assistant", handlers.HandleCreateAssistant(assistantService))
+		r.Get("/api/v1/assistant", handlers.HandleListAssistants(assistantService))
+		r.Get("/api/v1/assistant/{id}", handlers.HandleGetAssistant(assistantService))
+		r.Put("/api/v1/assistant/{id}", handlers.HandleUpdateAssistant(assistantService))
+		r.Delete("/api/v1/assistant/{id}", handlers.HandleDeleteAssistant(assistantService))
+		r.Get("/api/v1/assistant/{id}/kbase", handlers.HandleListAssistantKbases(assistantService))
+		r.Put("/api/v1/assistant/{id}/kbase/{kbase_id}", handlers.HandleAttachKbase(assistantService))
+		r.Delete("/api/v1/assistant/{id}/kbase/{kbase_id}", handlers.HandleDetachKbase(assistantService))
+		r.Get("/api/v1/assistant/{id}/prompt", handlers.HandleListPromptVersions(assistantService))
+		r.Post("/api/v1/assistant/{id}/prompt/{version}/rollback", handlers.HandleRollbackPrompt(assistantService))
+		r.Get("/api/v1/assistant/{id}/feedback", handlers.HandleAssistantFeedback(feedbackService))
+		r.Get("/api/v1/tool", handlers.HandleListTools(toolRegistry))
+		r.Get("/api/v1/usage", handlers.HandleUsageReport(usageService))
+
+		// routes that call models are refused once the daily token quota is used up
+		r.Group(func(r chi.Router) {
+			r.Use(limiter.Tokens)
+			r.Post("/api/v1/session/{id}/message", handlers.HandleSendMessage(sessionService, chatService))
+			r.Post("/api/v1/session/{id}/message/stream", handlers.HandleStreamMessage(sessionService, chatService))
+			r.Post("/api/v1/session/{id}/message/{message_id}/regenerate", handlers.HandleRegenerateMessage(sessionService, chatService))
+			r.Post("/api/v1/session/{id}/message/{message_id}/edit", handlers.HandleEditMessage(sessionService, chatService))
+			r.Get("/api/v1/session/{id}/ws", handlers.HandleSessionWebSocket(sessionService, chatService, sessionHub, limiter))
+			r.Post("/api/v1/search", handlers.HandleSearch(retriever))
+		})
+	})
 
 	// Start the server
 	log.Println("Server starting on :8080")
 	if err := http.ListenAndServe(":8080", r); err != nil {
 		log.Fatalf("Error starting server: %v", err)
 	}
-}
\ No newline at end of file
+}
+
+// quotaLimits reads the REQUESTS_PER_MINUTE, TOKENS_PER_DAY and DOCUMENTS_PER_DAY environment variables
+// under prefix; unset ones are unlimited.
+func quotaLimits(prefix string) quota.Limits {
+	requests, _ := strconv.Atoi(os.Getenv(prefix + "REQUESTS_PER_MINUTE"))
+	tokens, _ := strconv.Atoi(os.Getenv(prefix + "TOKENS_PER_DAY"))
+	documents, _ := strconv.Atoi(os.Getenv(prefix + "DOCUMENTS_PER_DAY"))
+	return quota.Limits{RequestsPerMinute: requests, TokensPerDay: tokens, DocumentsPerDay: documents}
+}
@@ -0,0 +1,454 @@
+package assistant
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"rag-demo/pkg/grounding"
+	"rag-demo/pkg/guardrail"
+	"rag-demo/pkg/llm"
+	"rag-demo/pkg/search"
+	"rag-demo/pkg/tools"
+	"rag-demo/types"
+)
+
+const (
+	maxMetadataPrompts      = 10
+	maxMetadataPromptLength = 300
+)
+
+var (
+	ErrNameTaken         = errors.New("an assistant with this name already exists")
+	ErrUnsupportedModel  = errors.New("unsupported model id")
+	ErrInvalidPrompts    = errors.New("invalid metadata prompts")
+	ErrKbaseNotFound     = errors.New("kbase not found")
+	ErrInvalidTools      = errors.New("invalid tools")
+	ErrInvalidGuardrails = errors.New("invalid guardrails")
+
+	ErrInvalidGroundedness = errors.New("invalid groundedness policy")
+
+	ErrPromptVersionNotFound = errors.New("prompt version not found")
+)
+
+// AssistantService defines the interface for assistant-related operations.
+type AssistantService interface {
+	CreateAssistant(ctx context.Context, assistant types.Assistant, resultCh types.ResultChannel, wg *sync.WaitGroup)
+	GetAssistant(ctx context.Context, assistantID uuid.UUID, resultCh types.ResultChannel, wg *sync.WaitGroup)
+	UpdateAssistant(ctx context.Context, assistant types.Assistant, resultCh types.ResultChannel, wg *sync.WaitGroup)
+	DeleteAssistant(ctx context.Context, assistantID uuid.UUID, resultCh types.ResultChannel, wg *sync.WaitGroup)
+	ListAssistants(ctx context.Context, resultCh types.ResultChannel, wg *sync.WaitGroup)
+	AttachKbase(ctx context.Context, link types.AssistantKbase, resultCh types.ResultChannel, wg *sync.WaitGroup)
+	DetachKbase(ctx context.Context, assistantID uuid.UUID, kbaseID uuid.UUID, resultCh types.ResultChannel, wg *sync.WaitGroup)
+	ListKbases(ctx context.Context, assistantID uuid.UUID, resultCh types.ResultChannel, wg *sync.WaitGroup)
+	ListPromptVersions(ctx context.Context, assistantID uuid.UUID, resultCh types.ResultChannel, wg *sync.WaitGroup)
+	RollbackPrompt(ctx context.Context, assistantID uuid.UUID, version int, resultCh types.ResultChannel, wg *sync.WaitGroup)
+}
+
+type AssistantServiceImpl struct {
+	AssistantGateway types.AssistantTableGateway
+	KbaseGateway     types.KbaseTableGateway
+	Tools            *tools.Registry // tools assistants can be configured with besides the built-in ones
+}
+
+func NewAssistantService(assistantGateway types.AssistantTableGateway, kbaseGateway types.KbaseTableGateway, toolRegistry *tools.Registry) AssistantService {
+	return &AssistantServiceImpl{AssistantGateway: assistantGateway, KbaseGateway: kbaseGateway, Tools: toolRegistry}
+}
+
+// CreateAssistant validates and stores a new assistant; its system prompt becomes prompt version 1.
+// Validation failures are reported with ErrNameTaken, ErrUnsupportedModel, ErrInvalidPrompts, ErrInvalidTemplate, ErrInvalidTools, ErrInvalidGuardrails or ErrInvalidGroundedness.
+func (as *AssistantServiceImpl) CreateAssistant(ctx context.Context, assistant types.Assistant, resultCh types.ResultChannel, wg *sync.WaitGroup) {
+	defer wg.Done()
+
+	if err := as.validate(ctx, assistant); err != nil {
+		resultCh <- types.Result{
+			Data:    nil,
+			Error:   err,
+			Success: false,
+		}
+		return
+	}
+
+	success, err := as.AssistantGateway.CreateAssistant(ctx, assistant)
+	if err != nil || !success {
+		resultCh <- types.Result{
+			Data:    nil,
+			Error:   err,
+			Success: false,
+		}
+		return
+	}
+	assistant.PromptVersion = 1
+
+	resultCh <- types.Result{
+		Data:    assistant,
+		Error:   nil,
+		Success: true,
+	}
+}
+
+func (as *AssistantServiceImpl) GetAssistant(ctx context.Context, assistantID uuid.UUID, resultCh types.ResultChannel, wg *sync.WaitGroup) {
+	defer wg.Done()
+
+	assistant, err := as.AssistantGateway.GetAssistant(ctx, assistantID)
+	if err != nil {
+		resultCh <- types.Result{
+			Data:    nil,
+			Error:   err,
+			Success: false,
+		}
+		return
+	}
+
+	resultCh <- types.Result{
+		Data:    assistant,
+		Error:   nil,
+		Success: true,
+	}
+}
+
+// UpdateAssistant validates and replaces an existing assistant; a changed system prompt is stored as
+// a new prompt version. A missing assistant is reported as an unsuccessful result without an error.
+func (as *AssistantServiceImpl) UpdateAssistant(ctx context.Context, assistant types.Assistant, resultCh types.ResultChannel, wg *sync.WaitGroup) {
+	defer wg.Done()
+
+	if err := as.validate(ctx, assistant); err != nil {
+		resultCh <- types.Result{
+			Data:    nil,
+			Error:   err,
+			Success: false,
+		}
+		return
+	}
+
+	success, err := as.AssistantGateway.UpdateAssistant(ctx, assistant)
+	if err != nil || !success {
+		resultCh <- types.Result{
+			Data:    nil,
+			Error:   err,
+			Success: false,
+		}
+		return
+	}
+
+	// reload to return the prompt version the gateway assigned
+	updated, err := as.AssistantGateway.GetAssistant(ctx, assistant.ID)
+	if err != nil {
+		resultCh <- types.Result{
+			Data:    nil,
+			Error:   err,
+			Success: false,
+		}
+		return
+	}
+
+	resultCh <- types.Result{
+		Data:    updated,
+		Error:   nil,
+		Success: true,
+	}
+}
+
+// DeleteAssistant deletes an assistant. A missing assistant is reported as an unsuccessful result without an error.
+func (as *AssistantServiceImpl) DeleteAssistant(ctx context.Context, assistantID uuid.UUID, resultCh types.ResultChannel, wg *sync.WaitGroup) {
+	defer wg.Done()
+
+	success, err := as.AssistantGateway.DeleteAssistant(ctx, assistantID)
+	if err != nil || !success {
+		resultCh <- types.Result{
+			Data:    nil,
+			Error:   err,
+			Success: false,
+		}
+		return
+	}
+
+	resultCh <- types.Result{
+		Data:    nil,
+		Error:   nil,
+		Success: true,
+	}
+}
+
+func (as *AssistantServiceImpl) ListAssistants(ctx context.Context, resultCh types.ResultChannel, wg *sync.WaitGroup) {
+	defer wg.Done()
+
+	assistants, err := as.AssistantGateway.ListAssistants(ctx)
+	if err != nil {
+		resultCh <- types.Result{
+			Data:    nil,
+			Error:   err,
+			Success: false,
+		}
+		return
+	}
+	if assistants.Assistants == nil {
+		assistants.Assistants = []types.Assistant{}
+	}
+
+	resultCh <- types.Result{
+		Data:    assistants,
+		Error:   nil,
+		Success: true,
+	}
+}
+
+// AttachKbase links a kbase to an assistant, or changes the settings of an existing link. A missing
+// assistant is reported with pgx.ErrNoRows and a missing kbase with ErrKbaseNotFound.
+func (as *AssistantServiceImpl) AttachKbase(ctx context.Context, link types.AssistantKbase, resultCh types.ResultChannel, wg *sync.WaitGroup) {
+	defer wg.Done()
+
+	fail := func(err error) {
+		resultCh <- types.Result{
+			Data:    nil,
+			Error:   err,
+			Success: false,
+		}
+	}
+
+	if _, err := as.AssistantGateway.GetAssistant(ctx, link.AssistantID); err != nil {
+		fail(err)
+		return
+	}
+	if _, err := as.KbaseGateway.GetKbase(ctx, link.KbaseID); err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			err = ErrKbaseNotFound
+		}
+		fail(err)
+		return
+	}
+
+	if link.TopK <= 0 {
+		link.TopK = search.DefaultTopK
+	}
+	if link.Weight <= 0 {
+		link.Weight = 1
+	}
+
+	success, err := as.AssistantGateway.AttachKbase(ctx, link)
+	if err != nil || !success {
+		fail(err)
+		return
+	}
+
+	resultCh <- types.Result{
+		Data:    link,
+		Error:   nil,
+		Success: true,
+	}
+}
+
+// DetachKbase removes a kbase from an assistant. A missing link is reported as an unsuccessful result without an error.
+func (as *AssistantServiceImpl) DetachKbase(ctx context.Context, assistantID uuid.UUID, kbaseID uuid.UUID, resultCh types.ResultChannel, wg *sync.WaitGroup) {
+	defer wg.Done()
+
+	success, err := as.AssistantGateway.DetachKbase(ctx, assistantID, kbaseID)
+	if err != nil || !success {
+		resultCh <- types.Result{
+			Data:    nil,
+			Error:   err,
+			Success: false,
+		}
+		return
+	}
+
+	resultCh <- types.Result{
+		Data:    nil,
+		Error:   nil,
+		Success: true,
+	}
+}
+
+// ListKbases returns the kbases linked to an assistant with their retrieval settings.
+func (as *AssistantServiceImpl) ListKbases(ctx context.Context, assistantID uuid.UUID, resultCh types.ResultChannel, wg *sync.WaitGroup) {
+	defer wg.Done()
+
+	fail := func(err error) {
+		resultCh <- types.Result{
+			Data:    nil,
+			Error:   err,
+			Success: false,
+		}
+	}
+
+	if _, err := as.AssistantGateway.GetAssistant(ctx, assistantID); err != nil {
+		fail(err)
+		return
+	}
+
+	links, err := as.AssistantGateway.ListAssistantKbases(ctx, assistantID)
+	if err != nil {
+		fail(err)
+		return
+	}
+
+	resultCh <- types.Result{
+		Data:    links,
+		Error:   nil,
+		Success: true,
+	}
+}
+
+// ListPromptVersions returns the prompt history of an assistant, newest version first.
+func (as *AssistantServiceImpl) ListPromptVersions(ctx context.Context, assistantID uuid.UUID, resultCh types.ResultChannel, wg *sync.WaitGroup) {
+	defer wg.Done()
+
+	fail := func(err error) {
+		resultCh <- types.Result{
+			Data:    nil,
+			Error:   err,
+			Success: false,
+		}
+	}
+
+	if _, err := as.AssistantGateway.GetAssistant(ctx, assistantID); err != nil {
+		fail(err)
+		return
+	}
+
+	versions, err := as.AssistantGateway.ListPromptVersions(ctx, assistantID)
+	if err != nil {
+		fail(err)
+		return
+	}
+
+	resultCh <- types.Result{
+		Data:    versions,
+		Error:   nil,
+		Success: true,
+	}
+}
+
+// RollbackPrompt makes an earlier prompt version the assistant's system prompt again, without creating
+// a new version. A missing assistant is reported with pgx.ErrNoRows and a missing version with ErrPromptVersionNotFound.
+func (as *AssistantServiceImpl) RollbackPrompt(ctx context.Context, assistantID uuid.UUID, version int, resultCh types.ResultChannel, wg *sync.WaitGroup) {
+	defer wg.Done()
+
+	fail := func(err error) {
+		resultCh <- types.Result{
+			Data:    nil,
+			Error:   err,
+			Success: false,
+		}
+	}
+
+	if _, err := as.AssistantGateway.GetAssistant(ctx, assistantID); err != nil {
+		fail(err)
+		return
+	}
+
+	success, err := as.AssistantGateway.RollbackPrompt(ctx, assistantID, version)
+	if err != nil {
+		fail(err)
+		return
+	}
+	if !success {
+		fail(ErrPromptVersionNotFound)
+		return
+	}
+
+	updated, err := as.AssistantGateway.GetAssistant(ctx, assistantID)
+	if err != nil {
+		fail(err)
+		return
+	}
+
+	resultCh <- types.Result{
+		Data:    updated,
+		Error:   nil,
+		Success: true,
+	}
+}
+
+// validate checks the model id, the system prompt template, the tools, the guardrail policy, the metadata prompts and that no other
+// assistant has the same name.
+func (as *AssistantServiceImpl) validate(ctx context.Context, assistant types.Assistant) error {
+	if !llm.IsSupportedModel(assistant.Model) {
+		return fmt.Errorf("%w: %s", ErrUnsupportedModel, assistant.Model)
+	}
+
+	if err := ValidatePromptTemplate(assistant.SystemPrompts); err != nil {
+		return err
+	}
+
+	if err := as.validateTools(assistant); err != nil {
+		return err
+	}
+
+	if assistant.Guardrails != nil {
+		if err := guardrail.ValidatePolicy(*assistant.Guardrails); err != nil {
+			return fmt.Errorf("%w: %v", ErrInvalidGuardrails, err)
+		}
+	}
+
+	if assistant.Groundedness != nil {
+		if err := grounding.ValidatePolicy(*assistant.Groundedness); err != nil {
+			return fmt.Errorf("%w: %v", ErrInvalidGroundedness, err)
+		}
+	}
+
+	if assistant.Metadata != nil {
+		if err := validatePrompts(assistant.Metadata.Prompts); err != nil {
+			return err
+		}
+	}
+
+	existing, err := as.AssistantGateway.GetAssistantByName(ctx, assistant.Name)
+	if err == nil && existing.ID != assistant.ID {
+		return ErrNameTaken
+	}
+	if err != nil && !errors.Is(err, pgx.ErrNoRows) {
+		return err
+	}
+	return nil
+}
+
+// validateTools checks that the assistant's tools exist, are listed once and that its model can call them.
+// Text-to-SQL assistants answer with a query and take no tools.
+func (as *AssistantServiceImpl) validateTools(assistant types.Assistant) error {
+	if len(assistant.Tools) > 0 && assistant.Type == types.AssistantTypeTextToSQL {
+		return fmt.Errorf("%w: %s assistants don't call tools", ErrInvalidTools, types.AssistantTypeTextToSQL)
+	}
+	if len(assistant.Tools) > 0 && !llm.SupportsTools(assistant.Model) {
+		return fmt.Errorf("%w: %s does not support tool use", ErrInvalidTools, assistant.Model)
+	}
+
+	seen := make(map[string]bool)
+	for _, name := range assistant.Tools {
+		if !as.Tools.Known(name) {
+			return fmt.Errorf("%w: unknown tool %q", ErrInvalidTools, name)
+		}
+		if seen[name] {
+			return fmt.Errorf("%w: duplicate tool %q", ErrInvalidTools, name)
+		}
+		seen[name] = true
+	}
+	return nil
+}
+
+// validatePrompts checks the suggested prompts shown in the UI: a few distinct, non-empty, short lines.
+func validatePrompts(prompts []string) error {
+	if len(prompts) > maxMetadataPrompts {
+		return fmt.Errorf("%w: at most %d prompts are allowed", ErrInvalidPrompts, maxMetadataPrompts)
+	}
+
+	seen := make(map[string]bool)
+	for _, prompt := range prompts {
+		prompt = strings.TrimSpace(prompt)
+		if prompt == "" {
+			return fmt.Errorf("%w: prompts must not be empty", ErrInvalidPrompts)
+		}
+		if len([]rune(prompt)) > maxMetadataPromptLength {
+			return fmt.Errorf("%w: prompts must be at most %d characters", ErrInvalidPrompts, maxMetadataPromptLength)
+		}
+		if seen[strings.ToLower(prompt)] {
+			return fmt.Errorf("%w: duplicate prompt %q", ErrInvalidPrompts, prompt)
+		}
+		seen[strings.ToLower(prompt)] = true
+	}
+	return nil
+}
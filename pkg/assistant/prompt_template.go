@@ -0,0 +1,145 @@
+package assistant
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"reflect"
+	"strings"
+	"text/template"
+	"text/template/parse"
+)
+
+var ErrInvalidTemplate = errors.New("invalid system prompt template")
+
+// PromptVariables are the values a system prompt template can refer to, e.g. {{.UserName}}.
+type PromptVariables struct {
+	UserName   string // name of the user the assistant is talking to
+	Today      string // current date as YYYY-MM-DD
+	Context    string // retrieved sources with citation instructions; appended to the prompt when not placed explicitly
+	KbaseNames string // comma separated names of the kbases attached to the assistant
+}
+
+// parsePromptTemplate parses a system prompt as a text/template.
+func parsePromptTemplate(text string) (*template.Template, error) {
+	tmpl, err := template.New("system_prompt").Option("missingkey=error").Parse(text)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidTemplate, err)
+	}
+	return tmpl, nil
+}
+
+// ValidatePromptTemplate checks that a system prompt parses and only refers to PromptVariables,
+// so mistakes are reported when the assistant is saved rather than on every message.
+func ValidatePromptTemplate(text string) error {
+	tmpl, err := parsePromptTemplate(text)
+	if err != nil {
+		return err
+	}
+	// fields are checked in every branch and {{define}} body, as executing the template only reaches the
+	// branches taken
+	var unknown string
+	walkTemplateFields(tmpl, func(ident []string) bool {
+		if !isPromptVariable(ident) {
+			unknown = "." + strings.Join(ident, ".")
+			return true
+		}
+		return false
+	})
+	if unknown != "" {
+		return fmt.Errorf("%w: unknown variable %s", ErrInvalidTemplate, unknown)
+	}
+	sample := PromptVariables{UserName: "user", Today: "2006-01-02", Context: "context", KbaseNames: "kbase"}
+	if err := tmpl.Execute(io.Discard, sample); err != nil {
+		return fmt.Errorf("%w: %v", ErrInvalidTemplate, err)
+	}
+	return nil
+}
+
+// RenderPrompt executes a system prompt template with the variables of the current turn.
+func RenderPrompt(text string, vars PromptVariables) (string, error) {
+	tmpl, err := parsePromptTemplate(text)
+	if err != nil {
+		return "", err
+	}
+	var prompt strings.Builder
+	if err := tmpl.Execute(&prompt, vars); err != nil {
+		return "", fmt.Errorf("%w: %v", ErrInvalidTemplate, err)
+	}
+	return prompt.String(), nil
+}
+
+// UsesVariable reports whether a system prompt template refers to the named variable, so callers can
+// skip looking up values that aren't used. Templates that don't parse use nothing.
+func UsesVariable(text string, name string) bool {
+	tmpl, err := parsePromptTemplate(text)
+	if err != nil {
+		return false
+	}
+	return walkTemplateFields(tmpl, func(ident []string) bool { return ident[0] == name })
+}
+
+// walkTemplateFields walks the fields of the template and of every template it defines with
+// {{define}}, until visit returns true.
+func walkTemplateFields(tmpl *template.Template, visit func(ident []string) bool) bool {
+	for _, t := range tmpl.Templates() {
+		if t.Tree != nil && walkFields(t.Tree.Root, visit) {
+			return true
+		}
+	}
+	return false
+}
+
+// isPromptVariable reports whether a field chain names a PromptVariables field. They are all
+// strings, so the chain can't go any deeper.
+func isPromptVariable(ident []string) bool {
+	if len(ident) != 1 {
+		return false
+	}
+	_, ok := reflect.TypeOf(PromptVariables{}).FieldByName(ident[0])
+	return ok
+}
+
+// walkFields calls visit with the identifiers of every field the node refers to, in all branches,
+// until visit returns true. Fields of the root variable such as {{$.Today}} count as well.
+func walkFields(node parse.Node, visit func(ident []string) bool) bool {
+	switch n := node.(type) {
+	case *parse.ListNode:
+		if n == nil {
+			return false
+		}
+		for _, child := range n.Nodes {
+			if walkFields(child, visit) {
+				return true
+			}
+		}
+	case *parse.ActionNode:
+		return walkFields(n.Pipe, visit)
+	case *parse.PipeNode:
+		if n == nil {
+			return false
+		}
+		for _, cmd := range n.Cmds {
+			for _, arg := range cmd.Args {
+				if walkFields(arg, visit) {
+					return true
+				}
+			}
+		}
+	case *parse.ChainNode:
+		return walkFields(n.Node, visit)
+	case *parse.FieldNode:
+		return len(n.Ident) > 0 && visit(n.Ident)
+	case *parse.VariableNode:
+		return len(n.Ident) > 1 && n.Ident[0] == "$" && visit(n.Ident[1:])
+	case *parse.IfNode:
+		return walkFields(n.Pipe, visit) || walkFields(n.List, visit) || walkFields(n.ElseList, visit)
+	case *parse.RangeNode:
+		return walkFields(n.Pipe, visit) || walkFields(n.List, visit) || walkFields(n.ElseList, visit)
+	case *parse.WithNode:
+		return walkFields(n.Pipe, visit) || walkFields(n.List, visit) || walkFields(n.ElseList, visit)
+	case *parse.TemplateNode:
+		return walkFields(n.Pipe, visit)
+	}
+	return false
+}
@@ -0,0 +1,371 @@
+package auth
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"golang.org/x/crypto/bcrypt"
+	"rag-demo/types"
+)
+
+const (
+	DefaultMaxFailedLogins = 5
+	DefaultLockout         = 15 * time.Minute
+	DefaultResetTTL        = time.Hour
+)
+
+var (
+	ErrEmailTaken         = errors.New("email is already registered")
+	ErrInvalidCredentials = errors.New("invalid email or password")
+	ErrAccountLocked      = errors.New("account is locked")
+	ErrNoPassword         = errors.New("account has no password")
+	ErrInvalidResetToken  = errors.New("invalid or expired reset token")
+	ErrPasswordTooLong    = errors.New("password is longer than 72 bytes")
+)
+
+// AccountService defines the interface for email and password accounts.
+type AccountService interface {
+	Register(ctx context.Context, req types.NewUserRequest, resultCh types.ResultChannel, wg *sync.WaitGroup)
+	Login(ctx context.Context, req types.LoginRequest, resultCh types.ResultChannel, wg *sync.WaitGroup)
+	ChangePassword(ctx context.Context, userID uuid.UUID, req types.ChangePasswordRequest, resultCh types.ResultChannel, wg *sync.WaitGroup)
+	RequestPasswordReset(ctx context.Context, req types.PasswordResetRequest, resultCh types.ResultChannel, wg *sync.WaitGroup)
+	ResetPassword(ctx context.Context, req types.ResetPasswordRequest, resultCh types.ResultChannel, wg *sync.WaitGroup)
+}
+
+// AccountServiceImpl keeps bcrypt hashed passwords and locks an account for Lockout after
+// MaxFailedLogins failed logins in a row.
+type AccountServiceImpl struct {
+	CredentialGateway types.CredentialTableGateway
+	UserGateway       types.UserTableGateway
+	Notifier          Notifier
+	MaxFailedLogins   int
+	Lockout           time.Duration
+	ResetTTL          time.Duration // how long a reset token can be used
+	Cost              int           // bcrypt cost
+	Now               func() time.Time
+
+	dummyOnce sync.Once
+	dummyHash []byte
+}
+
+// NewAccountService creates a new instance of AccountServiceImpl with the default lockout.
+func NewAccountService(credentialGateway types.CredentialTableGateway, userGateway types.UserTableGateway, notifier Notifier) AccountService {
+	return &AccountServiceImpl{
+		CredentialGateway: credentialGateway,
+		UserGateway:       userGateway,
+		Notifier:          notifier,
+		MaxFailedLogins:   DefaultMaxFailedLogins,
+		Lockout:           DefaultLockout,
+		ResetTTL:          DefaultResetTTL,
+		Cost:              bcrypt.DefaultCost,
+		Now:               time.Now,
+	}
+}
+
+// normalizeEmail makes emails match regardless of case and surrounding space.
+func normalizeEmail(email string) string {
+	return strings.ToLower(strings.TrimSpace(email))
+}
+
+func (as *AccountServiceImpl) hashPassword(password string) (string, error) {
+	// bcrypt only looks at the first 72 bytes, so longer passwords are refused rather than cut
+	if len(password) > 72 {
+		return "", ErrPasswordTooLong
+	}
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), as.Cost)
+	if err != nil {
+		return "", fmt.Errorf("error hashing password: %w", err)
+	}
+	return string(hash), nil
+}
+
+// Register creates a user with an email and password. An email that is already registered fails
+// with ErrEmailTaken.
+func (as *AccountServiceImpl) Register(ctx context.Context, req types.NewUserRequest, resultCh types.ResultChannel, wg *sync.WaitGroup) {
+	defer wg.Done()
+
+	fail := func(err error) {
+		resultCh <- types.Result{
+			Data:    nil,
+			Error:   err,
+			Success: false,
+		}
+	}
+
+	hash, err := as.hashPassword(req.Password)
+	if err != nil {
+		fail(err)
+		return
+	}
+
+	user := types.User{UserID: uuid.New(), Name: req.Name}
+	credentials := types.Credentials{
+		UserID:            user.UserID,
+		Email:             normalizeEmail(req.Email),
+		PasswordHash:      hash,
+		PasswordChangedAt: as.Now().UTC(),
+	}
+	err = as.CredentialGateway.CreateAccount(ctx, user, credentials)
+	var pgErr *pgconn.PgError
+	if errors.As(err, &pgErr) && pgErr.Code == "23505" {
+		fail(ErrEmailTaken)
+		return
+	}
+	if err != nil {
+		fail(fmt.Errorf("error creating account: %w", err))
+		return
+	}
+
+	resultCh <- types.Result{
+		Data:    user,
+		Error:   nil,
+		Success: true,
+	}
+}
+
+// Login returns the user of the email if the password is theirs. Wrong emails, wrong passwords and
+// locked accounts all fail with ErrInvalidCredentials, so a login can't tell whether an email is
+// registered; the owner of a locked account learns of it through the Notifier.
+func (as *AccountServiceImpl) Login(ctx context.Context, req types.LoginRequest, resultCh types.ResultChannel, wg *sync.WaitGroup) {
+	defer wg.Done()
+
+	fail := func(err error) {
+		resultCh <- types.Result{
+			Data:    nil,
+			Error:   err,
+			Success: false,
+		}
+	}
+
+	credentials, err := as.CredentialGateway.GetCredentialsByEmail(ctx, normalizeEmail(req.Email))
+	if errors.Is(err, pgx.ErrNoRows) {
+		// compare against a dummy hash so unknown emails take as long as wrong passwords
+		as.dummyOnce.Do(func() {
+			as.dummyHash, _ = bcrypt.GenerateFromPassword([]byte("dummy password"), as.Cost)
+		})
+		bcrypt.CompareHashAndPassword(as.dummyHash, []byte(req.Password))
+		fail(ErrInvalidCredentials)
+		return
+	}
+	if err != nil {
+		fail(fmt.Errorf("error loading credentials: %w", err))
+		return
+	}
+
+	err = as.checkPassword(ctx, credentials, req.Password)
+	if errors.Is(err, ErrAccountLocked) {
+		fail(ErrInvalidCredentials)
+		return
+	}
+	if err != nil {
+		fail(err)
+		return
+	}
+
+	user, err := as.UserGateway.GetUser(ctx, credentials.UserID)
+	if err != nil {
+		fail(fmt.Errorf("error loading user: %w", err))
+		return
+	}
+
+	resultCh <- types.Result{
+		Data:    user,
+		Error:   nil,
+		Success: true,
+	}
+}
+
+// checkPassword verifies the password against the credentials, counting a wrong one towards the lockout.
+// The failure that locks the account sends the owner a notice of when the lock ends.
+func (as *AccountServiceImpl) checkPassword(ctx context.Context, credentials types.Credentials, password string) error {
+	now := as.Now()
+	// the hash is compared for locked accounts as well, so they don't answer faster than the others
+	matches := bcrypt.CompareHashAndPassword([]byte(credentials.PasswordHash), []byte(password)) == nil
+	if credentials.LockedUntil.After(now) {
+		return ErrAccountLocked
+	}
+
+	if !matches {
+		lockedUntil := now.Add(as.Lockout)
+		if err := as.CredentialGateway.RecordFailedLogin(ctx, credentials.UserID, as.MaxFailedLogins, lockedUntil); err != nil {
+			return fmt.Errorf("error recording failed login: %w", err)
+		}
+		if credentials.FailedLogins+1 >= as.MaxFailedLogins {
+			if err := as.Notifier.SendAccountLocked(ctx, credentials.Email, lockedUntil); err != nil {
+				fmt.Println("Error sending account lockout notice: ", err)
+			}
+			return ErrAccountLocked
+		}
+		return ErrInvalidCredentials
+	}
+
+	if credentials.FailedLogins > 0 {
+		if err := as.CredentialGateway.ResetFailedLogins(ctx, credentials.UserID); err != nil {
+			return fmt.Errorf("error resetting failed logins: %w", err)
+		}
+	}
+	return nil
+}
+
+// ChangePassword replaces the user's password once their current one is checked like a login. As the
+// caller is already signed in, a locked account fails with ErrAccountLocked and users created without
+// a password fail with ErrNoPassword.
+func (as *AccountServiceImpl) ChangePassword(ctx context.Context, userID uuid.UUID, req types.ChangePasswordRequest, resultCh types.ResultChannel, wg *sync.WaitGroup) {
+	defer wg.Done()
+
+	fail := func(err error) {
+		resultCh <- types.Result{
+			Data:    nil,
+			Error:   err,
+			Success: false,
+		}
+	}
+
+	credentials, err := as.CredentialGateway.GetCredentials(ctx, userID)
+	if errors.Is(err, pgx.ErrNoRows) {
+		fail(ErrNoPassword)
+		return
+	}
+	if err != nil {
+		fail(fmt.Errorf("error loading credentials: %w", err))
+		return
+	}
+
+	if err := as.checkPassword(ctx, credentials, req.CurrentPassword); err != nil {
+		fail(err)
+		return
+	}
+	hash, err := as.hashPassword(req.NewPassword)
+	if err != nil {
+		fail(err)
+		return
+	}
+	if err := as.CredentialGateway.UpdatePassword(ctx, userID, hash, as.Now().UTC()); err != nil {
+		fail(fmt.Errorf("error updating password: %w", err))
+		return
+	}
+
+	resultCh <- types.Result{
+		Data:    nil,
+		Error:   nil,
+		Success: true,
+	}
+}
+
+// newSecret returns 32 random bytes as URL safe text, for reset tokens and API keys.
+func newSecret() (string, error) {
+	secret := make([]byte, 32)
+	if _, err := rand.Read(secret); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(secret), nil
+}
+
+// hashSecret is what reset tokens and API keys are stored as, so a leaked table can't be used to reset
+// passwords or call the API.
+func hashSecret(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// RequestPasswordReset sends a single use reset token valid for ResetTTL to the email through the
+// Notifier. It succeeds for unknown emails as well, so it can't be used to find out who has an account.
+func (as *AccountServiceImpl) RequestPasswordReset(ctx context.Context, req types.PasswordResetRequest, resultCh types.ResultChannel, wg *sync.WaitGroup) {
+	defer wg.Done()
+
+	fail := func(err error) {
+		resultCh <- types.Result{
+			Data:    nil,
+			Error:   err,
+			Success: false,
+		}
+	}
+
+	email := normalizeEmail(req.Email)
+	credentials, err := as.CredentialGateway.GetCredentialsByEmail(ctx, email)
+	if err != nil && !errors.Is(err, pgx.ErrNoRows) {
+		fail(fmt.Errorf("error loading credentials: %w", err))
+		return
+	}
+
+	if err == nil {
+		token, err := newSecret()
+		if err != nil {
+			fail(fmt.Errorf("error generating reset token: %w", err))
+			return
+		}
+
+		reset := types.PasswordReset{TokenHash: hashSecret(token), UserID: credentials.UserID, ExpiresAt: as.Now().Add(as.ResetTTL).UTC()}
+		if err := as.CredentialGateway.CreatePasswordReset(ctx, reset); err != nil {
+			fail(fmt.Errorf("error storing password reset: %w", err))
+			return
+		}
+		// a failed delivery is only logged, as telling the caller would reveal that the email is known
+		if err := as.Notifier.SendPasswordReset(ctx, email, token); err != nil {
+			fmt.Println("Error sending password reset: ", err)
+		}
+	}
+
+	resultCh <- types.Result{
+		Data:    nil,
+		Error:   nil,
+		Success: true,
+	}
+}
+
+// ResetPassword sets a new password with a token from RequestPasswordReset, which also unlocks the
+// account. Unknown, used and expired tokens fail with ErrInvalidResetToken.
+func (as *AccountServiceImpl) ResetPassword(ctx context.Context, req types.ResetPasswordRequest, resultCh types.ResultChannel, wg *sync.WaitGroup) {
+	defer wg.Done()
+
+	fail := func(err error) {
+		resultCh <- types.Result{
+			Data:    nil,
+			Error:   err,
+			Success: false,
+		}
+	}
+
+	// the new password is hashed first so a password that can't be used doesn't use up the token
+	hash, err := as.hashPassword(req.NewPassword)
+	if err != nil {
+		fail(err)
+		return
+	}
+
+	reset, err := as.CredentialGateway.ConsumePasswordReset(ctx, hashSecret(req.Token))
+	if errors.Is(err, pgx.ErrNoRows) {
+		fail(ErrInvalidResetToken)
+		return
+	}
+	if err != nil {
+		fail(fmt.Errorf("error loading password reset: %w", err))
+		return
+	}
+	if !reset.ExpiresAt.After(as.Now()) {
+		fail(ErrInvalidResetToken)
+		return
+	}
+
+	if err := as.CredentialGateway.UpdatePassword(ctx, reset.UserID, hash, as.Now().UTC()); err != nil {
+		fail(fmt.Errorf("error updating password: %w", err))
+		return
+	}
+
+	resultCh <- types.Result{
+		Data:    nil,
+		Error:   nil,
+		Success: true,
+	}
+}
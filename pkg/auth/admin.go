@@ -0,0 +1,18 @@
+package auth
+
+import (
+	"os"
+	"strings"
+
+	"rag-demo/types"
+)
+
+// IsAdmin reports whether the user is listed in the comma separated ADMIN_USER_IDS environment variable.
+func IsAdmin(user types.User) bool {
+	for _, id := range strings.Split(os.Getenv("ADMIN_USER_IDS"), ",") {
+		if strings.TrimSpace(id) == user.UserID.String() {
+			return true
+		}
+	}
+	return false
+}
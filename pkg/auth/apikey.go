@@ -0,0 +1,151 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"rag-demo/types"
+)
+
+// apiKeyPrefix starts every API key so leaked keys are easy to search for.
+const apiKeyPrefix = "rag_"
+
+var (
+	ErrInvalidAPIKey  = errors.New("invalid API key")
+	ErrAPIKeyNotFound = errors.New("API key not found")
+)
+
+// APIKeyService defines the interface for the API keys of users.
+type APIKeyService interface {
+	CreateAPIKey(ctx context.Context, userID uuid.UUID, req types.NewAPIKeyRequest, resultCh types.ResultChannel, wg *sync.WaitGroup)
+	ListAPIKeys(ctx context.Context, userID uuid.UUID, resultCh types.ResultChannel, wg *sync.WaitGroup)
+	DeleteAPIKey(ctx context.Context, userID uuid.UUID, keyID uuid.UUID, resultCh types.ResultChannel, wg *sync.WaitGroup)
+	// ValidateAPIKey returns the key and its user, or ErrInvalidAPIKey for an unknown or deleted key
+	ValidateAPIKey(ctx context.Context, key string) (types.APIKey, types.User, error)
+}
+
+// APIKeyServiceImpl hands out random API keys and keeps only their hashes.
+type APIKeyServiceImpl struct {
+	APIKeyGateway types.APIKeyTableGateway
+	UserGateway   types.UserTableGateway
+	Now           func() time.Time
+}
+
+// NewAPIKeyService creates a new instance of APIKeyServiceImpl.
+func NewAPIKeyService(apiKeyGateway types.APIKeyTableGateway, userGateway types.UserTableGateway) APIKeyService {
+	return &APIKeyServiceImpl{APIKeyGateway: apiKeyGateway, UserGateway: userGateway, Now: time.Now}
+}
+
+// CreateAPIKey creates a key for the user. The result is a types.NewAPIKey, the only time the key
+// itself is returned.
+func (ks *APIKeyServiceImpl) CreateAPIKey(ctx context.Context, userID uuid.UUID, req types.NewAPIKeyRequest, resultCh types.ResultChannel, wg *sync.WaitGroup) {
+	defer wg.Done()
+
+	fail := func(err error) {
+		resultCh <- types.Result{
+			Data:    nil,
+			Error:   err,
+			Success: false,
+		}
+	}
+
+	secret, err := newSecret()
+	if err != nil {
+		fail(fmt.Errorf("error generating API key: %w", err))
+		return
+	}
+	key := apiKeyPrefix + secret
+	apiKey := types.APIKey{
+		ID:        uuid.New(),
+		UserID:    userID,
+		Name:      req.Name,
+		Prefix:    key[:len(apiKeyPrefix)+6],
+		KeyHash:   hashSecret(key),
+		CreatedAt: ks.Now().UTC(),
+	}
+	if err := ks.APIKeyGateway.CreateAPIKey(ctx, apiKey); err != nil {
+		fail(fmt.Errorf("error storing API key: %w", err))
+		return
+	}
+
+	resultCh <- types.Result{
+		Data:    types.NewAPIKey{APIKey: apiKey, Key: key},
+		Error:   nil,
+		Success: true,
+	}
+}
+
+// ListAPIKeys lists the keys of the user without the keys themselves.
+func (ks *APIKeyServiceImpl) ListAPIKeys(ctx context.Context, userID uuid.UUID, resultCh types.ResultChannel, wg *sync.WaitGroup) {
+	defer wg.Done()
+
+	keys, err := ks.APIKeyGateway.ListAPIKeys(ctx, userID)
+	if err != nil {
+		resultCh <- types.Result{
+			Data:    nil,
+			Error:   fmt.Errorf("error listing API keys: %w", err),
+			Success: false,
+		}
+		return
+	}
+
+	resultCh <- types.Result{
+		Data:    keys,
+		Error:   nil,
+		Success: true,
+	}
+}
+
+// DeleteAPIKey revokes a key of the user. Keys of other users fail with ErrAPIKeyNotFound.
+func (ks *APIKeyServiceImpl) DeleteAPIKey(ctx context.Context, userID uuid.UUID, keyID uuid.UUID, resultCh types.ResultChannel, wg *sync.WaitGroup) {
+	defer wg.Done()
+
+	fail := func(err error) {
+		resultCh <- types.Result{
+			Data:    nil,
+			Error:   err,
+			Success: false,
+		}
+	}
+
+	deleted, err := ks.APIKeyGateway.DeleteAPIKey(ctx, userID, keyID)
+	if err != nil {
+		fail(fmt.Errorf("error deleting API key: %w", err))
+		return
+	}
+	if !deleted {
+		fail(ErrAPIKeyNotFound)
+		return
+	}
+
+	resultCh <- types.Result{
+		Data:    nil,
+		Error:   nil,
+		Success: true,
+	}
+}
+
+// ValidateAPIKey looks a key up by its hash and loads its user.
+func (ks *APIKeyServiceImpl) ValidateAPIKey(ctx context.Context, key string) (types.APIKey, types.User, error) {
+	if !strings.HasPrefix(key, apiKeyPrefix) {
+		return types.APIKey{}, types.User{}, ErrInvalidAPIKey
+	}
+	apiKey, err := ks.APIKeyGateway.GetAPIKeyByHash(ctx, hashSecret(key))
+	if errors.Is(err, pgx.ErrNoRows) {
+		return types.APIKey{}, types.User{}, ErrInvalidAPIKey
+	}
+	if err != nil {
+		return types.APIKey{}, types.User{}, fmt.Errorf("error loading API key: %w", err)
+	}
+	user, err := ks.UserGateway.GetUser(ctx, apiKey.UserID)
+	if err != nil {
+		return types.APIKey{}, types.User{}, fmt.Errorf("error loading user: %w", err)
+	}
+	return apiKey, user, nil
+}
@@ -0,0 +1,33 @@
+package auth
+
+import (
+	"context"
+
+	"rag-demo/types"
+)
+
+type userKey struct{}
+
+// WithUser returns a context carrying the authenticated user of a request.
+func WithUser(ctx context.Context, user types.User) context.Context {
+	return context.WithValue(ctx, userKey{}, user)
+}
+
+// UserFrom returns the authenticated user of ctx, if it has one.
+func UserFrom(ctx context.Context) (types.User, bool) {
+	user, ok := ctx.Value(userKey{}).(types.User)
+	return user, ok
+}
+
+type apiKeyKey struct{}
+
+// WithAPIKey returns a context of a request authenticated with an API key.
+func WithAPIKey(ctx context.Context, key types.APIKey) context.Context {
+	return context.WithValue(ctx, apiKeyKey{}, key)
+}
+
+// APIKeyFrom returns the API key ctx's request was authenticated with, if any.
+func APIKeyFrom(ctx context.Context) (types.APIKey, bool) {
+	key, ok := ctx.Value(apiKeyKey{}).(types.APIKey)
+	return key, ok
+}
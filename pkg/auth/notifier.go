@@ -0,0 +1,32 @@
+package auth
+
+import (
+	"context"
+	"fmt"
+	"time"
+)
+
+// Notifier delivers password reset tokens and lockout notices to the owner of an email address.
+type Notifier interface {
+	SendPasswordReset(ctx context.Context, email string, token string) error
+	// SendAccountLocked tells the owner their account is locked until the given time, which logins
+	// don't reveal.
+	SendAccountLocked(ctx context.Context, email string, lockedUntil time.Time) error
+}
+
+// LogNotifier prints password reset tokens and lockouts to the log instead of sending them, for running locally.
+type LogNotifier struct{}
+
+func NewLogNotifier() Notifier {
+	return LogNotifier{}
+}
+
+func (LogNotifier) SendPasswordReset(ctx context.Context, email string, token string) error {
+	fmt.Printf("Password reset token for %s: %s\n", email, token)
+	return nil
+}
+
+func (LogNotifier) SendAccountLocked(ctx context.Context, email string, lockedUntil time.Time) error {
+	fmt.Printf("Account of %s is locked until %s\n", email, lockedUntil.UTC().Format(time.RFC3339))
+	return nil
+}
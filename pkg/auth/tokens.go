@@ -8,6 +8,9 @@ import (
 	"rag-demo/types"
 	"github.com/google/uuid"
 	"errors"
+	"time"
+
+	"github.com/jackc/pgx/v5"
 )
 
 
@@ -16,6 +19,9 @@ func (as *AuthServiceImpl) GenerateJWT(ctx context.Context, user types.User) (st
         "userID": user.UserID.String(),
         "name":   user.Name,
     }
+    now := as.Now()
+    jwtauth.SetIssuedAt(claims, now)
+    jwtauth.SetExpiry(claims, now.Add(as.TokenTTL))
     _, tokenString, err := as.tokenAuth.Encode(claims)
     if err != nil {
         return "", err
@@ -34,6 +40,12 @@ func (as *AuthServiceImpl) ValidateJWT(ctx context.Context, tokenString string)
 		return types.User{}, errors.New("invalid token")
 	}
 
+	// tokens without an expiry were issued before tokens expired and are no longer accepted
+	if token.Expiration().IsZero() || token.IssuedAt().IsZero() {
+		fmt.Println("Error: token has no expiry")
+		return types.User{}, errors.New("invalid token")
+	}
+
 	// Extract claims from the token
 	claims, err := token.AsMap(ctx)
 	if err != nil {
@@ -62,5 +74,31 @@ func (as *AuthServiceImpl) ValidateJWT(ctx context.Context, tokenString string)
 		return types.User{}, errors.New("user not found in database")
 	}
 
+	if err := as.checkPasswordChange(ctx, user, token.IssuedAt()); err != nil {
+		fmt.Println("Error:", err)
+		return types.User{}, err
+	}
+
 	return user, nil
 }
+
+// checkPasswordChange refuses tokens issued before the user's password last changed, so changing
+// or resetting a password signs out everyone holding an older token. iat only has whole seconds, so
+// tokens issued in the second of the change are still accepted.
+func (as *AuthServiceImpl) checkPasswordChange(ctx context.Context, user types.User, issuedAt time.Time) error {
+	if as.CredentialGateway == nil {
+		return nil
+	}
+	credentials, err := as.CredentialGateway.GetCredentials(ctx, user.UserID)
+	if errors.Is(err, pgx.ErrNoRows) {
+		// users without a password have nothing to change
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("error loading credentials: %w", err)
+	}
+	if issuedAt.Before(credentials.PasswordChangedAt.Truncate(time.Second)) {
+		return errors.New("token was issued before the password was changed")
+	}
+	return nil
+}
@@ -5,6 +5,7 @@ import (
 	"rag-demo/types"
 	"sync"
 	"os"
+	"time"
 	"github.com/google/uuid"
 	"github.com/go-chi/jwtauth/v5"
 )
@@ -17,14 +18,21 @@ type AuthService interface {
 	ValidateJWT(ctx context.Context, token string) (types.User, error)
 }
 
-// AuthServiceImpl is the implementation of AuthService.
+// DefaultTokenTTL is how long an access token is valid unless JWT_TTL says otherwise.
+const DefaultTokenTTL = 24 * time.Hour
+
+// AuthServiceImpl is the implementation of AuthService. Tokens of users with credentials are
+// refused once they were issued before the user's password last changed.
 type AuthServiceImpl struct {
-	UserGateway types.UserTableGateway
+	UserGateway       types.UserTableGateway
+	CredentialGateway types.CredentialTableGateway // nil skips the password change check
+	TokenTTL          time.Duration
+	Now               func() time.Time
 	tokenAuth *jwtauth.JWTAuth
 }
 
 // NewAuthService creates a new instance of AuthServiceImpl.
-func NewAuthService(userGateway types.UserTableGateway) AuthService {
+func NewAuthService(userGateway types.UserTableGateway, credentialGateway types.CredentialTableGateway) AuthService {
 	secret := os.Getenv("JWT_SECRET")
     algorithm := os.Getenv("JWT_ALGORITHM")
 
@@ -35,8 +43,12 @@ func NewAuthService(userGateway types.UserTableGateway) AuthService {
     if algorithm == "" {
         algorithm = "HS256" // Use a default or handle error appropriately
     }
+	ttl, err := time.ParseDuration(os.Getenv("JWT_TTL"))
+	if err != nil || ttl <= 0 {
+		ttl = DefaultTokenTTL
+	}
 	tokenAuth := jwtauth.New(algorithm, []byte(secret), nil)
-	return &AuthServiceImpl{UserGateway: userGateway, tokenAuth: tokenAuth}
+	return &AuthServiceImpl{UserGateway: userGateway, CredentialGateway: credentialGateway, TokenTTL: ttl, Now: time.Now, tokenAuth: tokenAuth}
 }
 
 // CreateUser creates a new user with the given name using the Go handler pattern.
@@ -0,0 +1,69 @@
+package db
+
+import (
+	"context"
+	"rag-demo/types"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// APIKeyTableGatewayImpl is the implementation of APIKeyTableGateway using pgxpool.
+type APIKeyTableGatewayImpl struct {
+	Pool *pgxpool.Pool
+}
+
+// NewAPIKeyTableGateway creates a new instance of APIKeyTableGatewayImpl.
+func NewAPIKeyTableGateway(pool *pgxpool.Pool) types.APIKeyTableGateway {
+	return &APIKeyTableGatewayImpl{Pool: pool}
+}
+
+// CreateAPIKey stores a new key by its hash.
+func (ktg *APIKeyTableGatewayImpl) CreateAPIKey(ctx context.Context, key types.APIKey) error {
+	_, err := ktg.Pool.Exec(ctx,
+		`INSERT INTO api_key (id, user_id, name, prefix, key_hash, created_at)
+         VALUES ($1, $2, $3, $4, $5, $6)`,
+		key.ID, key.UserID, key.Name, key.Prefix, key.KeyHash, key.CreatedAt)
+	return err
+}
+
+const apiKeyColumns = "id, user_id, name, prefix, key_hash, created_at"
+
+func scanAPIKey(row interface{ Scan(dest ...any) error }) (types.APIKey, error) {
+	var key types.APIKey
+	err := row.Scan(&key.ID, &key.UserID, &key.Name, &key.Prefix, &key.KeyHash, &key.CreatedAt)
+	return key, err
+}
+
+// GetAPIKeyByHash retrieves the key of a hash.
+func (ktg *APIKeyTableGatewayImpl) GetAPIKeyByHash(ctx context.Context, keyHash string) (types.APIKey, error) {
+	return scanAPIKey(ktg.Pool.QueryRow(ctx, "SELECT "+apiKeyColumns+" FROM api_key WHERE key_hash = $1", keyHash))
+}
+
+// ListAPIKeys retrieves the keys of a user, newest first.
+func (ktg *APIKeyTableGatewayImpl) ListAPIKeys(ctx context.Context, userID uuid.UUID) ([]types.APIKey, error) {
+	rows, err := ktg.Pool.Query(ctx, "SELECT "+apiKeyColumns+" FROM api_key WHERE user_id = $1 ORDER BY created_at DESC", userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	keys := []types.APIKey{}
+	for rows.Next() {
+		key, err := scanAPIKey(rows)
+		if err != nil {
+			return nil, err
+		}
+		keys = append(keys, key)
+	}
+	return keys, rows.Err()
+}
+
+// DeleteAPIKey deletes a key of a user; keys of other users are left alone.
+func (ktg *APIKeyTableGatewayImpl) DeleteAPIKey(ctx context.Context, userID uuid.UUID, keyID uuid.UUID) (bool, error) {
+	tag, err := ktg.Pool.Exec(ctx, "DELETE FROM api_key WHERE id = $1 AND user_id = $2", keyID, userID)
+	if err != nil {
+		return false, err
+	}
+	return tag.RowsAffected() > 0, nil
+}
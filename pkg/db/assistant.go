@@ -3,8 +3,10 @@ package db
 import (
 	"context"
 	"rag-demo/types"
+	"errors"
 	"fmt"
 	"encoding/json"
+	"github.com/jackc/pgx/v5"
 	"github.com/jackc/pgx/v5/pgxpool"
 	"github.com/google/uuid"
 )
@@ -30,11 +32,42 @@ func (atg *AssistantTableGatewayImpl) CreateAssistant(ctx context.Context, assis
         return false, fmt.Errorf("failed to marshal Metadata: %v", err)
     }
 
-    // Execute the SQL query with marshaled JSON
-    _, err = atg.Pool.Exec(ctx,
-        `INSERT INTO assistant (uuid, name, model, type, system_prompts, metadata)
-         VALUES ($1, $2, $3, $4, $5::jsonb, $6::jsonb)`,
-        assistant.ID,  assistant.Name, assistant.Model, assistant.Type, systemPromptsJSON, metadataJSON)
+    toolsJSON, err := json.Marshal(assistant.Tools)
+    if err != nil {
+        return false, fmt.Errorf("failed to marshal Tools: %v", err)
+    }
+
+    guardrailsJSON, err := json.Marshal(assistant.Guardrails)
+    if err != nil {
+        return false, fmt.Errorf("failed to marshal Guardrails: %v", err)
+    }
+
+    groundednessJSON, err := json.Marshal(assistant.Groundedness)
+    if err != nil {
+        return false, fmt.Errorf("failed to marshal Groundedness: %v", err)
+    }
+
+    tx, err := atg.Pool.Begin(ctx)
+    if err != nil {
+        return false, err
+    }
+    defer tx.Rollback(ctx)
+
+    // Execute the SQL query with marshaled JSON; the prompt becomes version 1 of the assistant's prompt history
+    _, err = tx.Exec(ctx,
+        `INSERT INTO assistant (uuid, name, model, type, system_prompts, prompt_version, tools, guardrails, groundedness, metadata)
+         VALUES ($1, $2, $3, $4, $5::jsonb, 1, $6::json, $7::json, $8::json, $9::jsonb)`,
+        assistant.ID,  assistant.Name, assistant.Model, assistant.Type, systemPromptsJSON, toolsJSON, guardrailsJSON, groundednessJSON, metadataJSON)
+    if err != nil {
+        return false, err
+    }
+
+    _, err = tx.Exec(ctx, "INSERT INTO assistant_prompt_version (assistant_id, version, template) VALUES ($1, 1, $2)", assistant.ID, assistant.SystemPrompts)
+    if err != nil {
+        return false, err
+    }
+
+    err = tx.Commit(ctx)
     if err != nil {
         return false, err
     }
@@ -44,25 +77,68 @@ func (atg *AssistantTableGatewayImpl) CreateAssistant(ctx context.Context, assis
 func (atg *AssistantTableGatewayImpl) GetAssistant(ctx context.Context, assistantId uuid.UUID) (types.Assistant, error) {
 	var assistant types.Assistant
 	var systemPrompts string
-	var metadata string
-	err := atg.Pool.QueryRow(ctx, "SELECT uuid, name, model, type, system_prompts, metadata FROM assistant WHERE uuid = $1", assistantId).Scan(&assistant.ID, &assistant.Name, &assistant.Model, &assistant.Type, &systemPrompts, &metadata)
+	var tools, guardrails, groundedness, metadata *string
+	err := atg.Pool.QueryRow(ctx, "SELECT uuid, name, model, type, system_prompts, COALESCE(prompt_version, 0), tools, guardrails, groundedness, metadata FROM assistant WHERE uuid = $1", assistantId).Scan(&assistant.ID, &assistant.Name, &assistant.Model, &assistant.Type, &systemPrompts, &assistant.PromptVersion, &tools, &guardrails, &groundedness, &metadata)
+	if err != nil {
+		return types.Assistant{}, err
+	}
+
+	return unmarshalAssistant(assistant, systemPrompts, tools, guardrails, groundedness, metadata)
+}
+
+// GetAssistantByName looks up an assistant by its unique name.
+func (atg *AssistantTableGatewayImpl) GetAssistantByName(ctx context.Context, assistantName string) (types.Assistant, error) {
+	var assistant types.Assistant
+	var systemPrompts string
+	var tools, guardrails, groundedness, metadata *string
+	err := atg.Pool.QueryRow(ctx, "SELECT uuid, name, model, type, system_prompts, COALESCE(prompt_version, 0), tools, guardrails, groundedness, metadata FROM assistant WHERE name = $1", assistantName).Scan(&assistant.ID, &assistant.Name, &assistant.Model, &assistant.Type, &systemPrompts, &assistant.PromptVersion, &tools, &guardrails, &groundedness, &metadata)
 	if err != nil {
 		return types.Assistant{}, err
 	}
 
-	err = json.Unmarshal([]byte(systemPrompts), &assistant.SystemPrompts)
+	return unmarshalAssistant(assistant, systemPrompts, tools, guardrails, groundedness, metadata)
+}
+
+// unmarshalAssistant decodes the JSON system_prompts, tools, guardrails, groundedness and metadata columns into the assistant.
+func unmarshalAssistant(assistant types.Assistant, systemPrompts string, tools *string, guardrails *string, groundedness *string, metadata *string) (types.Assistant, error) {
+	err := json.Unmarshal([]byte(systemPrompts), &assistant.SystemPrompts)
 	if err != nil {
 		return types.Assistant{}, fmt.Errorf("failed to unmarshal SystemPrompts: %v", err)
 	}
 
-	err = json.Unmarshal([]byte(metadata), &assistant.Metadata)
-	if err != nil {
-		return types.Assistant{}, fmt.Errorf("failed to unmarshal Metadata: %v", err)
+	if tools != nil {
+		err = json.Unmarshal([]byte(*tools), &assistant.Tools)
+		if err != nil {
+			return types.Assistant{}, fmt.Errorf("failed to unmarshal Tools: %v", err)
+		}
+	}
+
+	if guardrails != nil {
+		err = json.Unmarshal([]byte(*guardrails), &assistant.Guardrails)
+		if err != nil {
+			return types.Assistant{}, fmt.Errorf("failed to unmarshal Guardrails: %v", err)
+		}
+	}
+
+	if groundedness != nil {
+		err = json.Unmarshal([]byte(*groundedness), &assistant.Groundedness)
+		if err != nil {
+			return types.Assistant{}, fmt.Errorf("failed to unmarshal Groundedness: %v", err)
+		}
+	}
+
+	if metadata != nil {
+		err = json.Unmarshal([]byte(*metadata), &assistant.Metadata)
+		if err != nil {
+			return types.Assistant{}, fmt.Errorf("failed to unmarshal Metadata: %v", err)
+		}
 	}
 
 	return assistant, nil
 }
 
+// UpdateAssistant replaces an assistant's configuration. A changed system prompt is stored as the next
+// version of the assistant's prompt history; versions are never modified.
 func (atg *AssistantTableGatewayImpl) UpdateAssistant(ctx context.Context, assistant types.Assistant) (bool, error) {
 	systemPromptsJSON, err := json.Marshal(assistant.SystemPrompts)
 	if err != nil {
@@ -74,10 +150,58 @@ func (atg *AssistantTableGatewayImpl) UpdateAssistant(ctx context.Context, assis
 		return false, fmt.Errorf("failed to marshal Metadata: %v", err)
 	}
 
+	toolsJSON, err := json.Marshal(assistant.Tools)
+	if err != nil {
+		return false, fmt.Errorf("failed to marshal Tools: %v", err)
+	}
+
+	guardrailsJSON, err := json.Marshal(assistant.Guardrails)
+	if err != nil {
+		return false, fmt.Errorf("failed to marshal Guardrails: %v", err)
+	}
+
+	groundednessJSON, err := json.Marshal(assistant.Groundedness)
+	if err != nil {
+		return false, fmt.Errorf("failed to marshal Groundedness: %v", err)
+	}
+
+	tx, err := atg.Pool.Begin(ctx)
+	if err != nil {
+		return false, err
+	}
+	defer tx.Rollback(ctx)
+
+	var currentPrompt string
+	var promptVersion *int
+	err = tx.QueryRow(ctx, "SELECT system_prompts #>> '{}', prompt_version FROM assistant WHERE uuid = $1 FOR UPDATE", assistant.ID).Scan(&currentPrompt, &promptVersion)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+
+	if promptVersion == nil || currentPrompt != assistant.SystemPrompts {
+		promptVersion = new(int)
+		err = tx.QueryRow(ctx,
+			`INSERT INTO assistant_prompt_version (assistant_id, version, template)
+             SELECT $1, COALESCE(MAX(version), 0) + 1, $2 FROM assistant_prompt_version WHERE assistant_id = $1
+             RETURNING version`,
+			assistant.ID, assistant.SystemPrompts).Scan(promptVersion)
+		if err != nil {
+			return false, err
+		}
+	}
+
 	// Execute the SQL query with marshaled JSON
-	_, err = atg.Pool.Exec(ctx,
-		`UPDATE assistant SET name = $2, model = $3, type = $4, system_prompts = $5::jsonb, metadata = $6::jsonb WHERE uuid = $1`,
-		assistant.ID,  assistant.Name, assistant.Model, assistant.Type, systemPromptsJSON, metadataJSON)
+	_, err = tx.Exec(ctx,
+		`UPDATE assistant SET name = $2, model = $3, type = $4, system_prompts = $5::jsonb, prompt_version = $6, tools = $7::json, guardrails = $8::json, groundedness = $9::json, metadata = $10::jsonb, updated_at = now() WHERE uuid = $1`,
+		assistant.ID,  assistant.Name, assistant.Model, assistant.Type, systemPromptsJSON, *promptVersion, toolsJSON, guardrailsJSON, groundednessJSON, metadataJSON)
+	if err != nil {
+		return false, err
+	}
+
+	err = tx.Commit(ctx)
 	if err != nil {
 		return false, err
 	}
@@ -85,7 +209,7 @@ func (atg *AssistantTableGatewayImpl) UpdateAssistant(ctx context.Context, assis
 }
 
 func (atg *AssistantTableGatewayImpl) ListAssistants(ctx context.Context) (types.AssistantList, error) {
-    rows, err := atg.Pool.Query(ctx, "SELECT uuid, name, model, type, system_prompts, metadata FROM assistant")
+    rows, err := atg.Pool.Query(ctx, "SELECT uuid, name, model, type, system_prompts, COALESCE(prompt_version, 0), tools, guardrails, groundedness, metadata FROM assistant ORDER BY name")
     if err != nil {
         return types.AssistantList{}, err
     }
@@ -95,23 +219,17 @@ func (atg *AssistantTableGatewayImpl) ListAssistants(ctx context.Context) (types
     for rows.Next() {
         var assistant types.Assistant
         var systemPrompts string
-        var metadata string
+        var tools, guardrails, groundedness, metadata *string
 
-        err := rows.Scan(&assistant.ID, &assistant.Name, &assistant.Model, &assistant.Type, &systemPrompts, &metadata)
+        err := rows.Scan(&assistant.ID, &assistant.Name, &assistant.Model, &assistant.Type, &systemPrompts, &assistant.PromptVersion, &tools, &guardrails, &groundedness, &metadata)
         if err != nil {
             return types.AssistantList{}, err
         }
 
-        assistant.SystemPrompts = systemPrompts
-
-        // Unmarshal metadata JSON string into assistant.Metadata
-        if metadata != "" {
-            var meta types.Metadata
-            err = json.Unmarshal([]byte(metadata), &meta)
-            if err != nil {
-                return types.AssistantList{}, fmt.Errorf("failed to unmarshal metadata: %v", err)
-            }
-            assistant.Metadata = &meta
+        // decode the same way as GetAssistant, system_prompts is stored as a JSON string
+        assistant, err = unmarshalAssistant(assistant, systemPrompts, tools, guardrails, groundedness, metadata)
+        if err != nil {
+            return types.AssistantList{}, err
         }
 
         assistants = append(assistants, assistant)
@@ -122,4 +240,128 @@ func (atg *AssistantTableGatewayImpl) ListAssistants(ctx context.Context) (types
     }
 
     return types.AssistantList{Assistants: assistants}, nil
-}
\ No newline at end of file
+}
+
+// DeleteAssistant deletes an assistant. Messages it answered and sessions bound to it are kept and lose their assistant reference.
+func (atg *AssistantTableGatewayImpl) DeleteAssistant(ctx context.Context, assistantId uuid.UUID) (bool, error) {
+	tx, err := atg.Pool.Begin(ctx)
+	if err != nil {
+		return false, err
+	}
+	defer tx.Rollback(ctx)
+
+	_, err = tx.Exec(ctx, "UPDATE message SET assistant_id = NULL WHERE assistant_id = $1", assistantId)
+	if err != nil {
+		return false, err
+	}
+
+	_, err = tx.Exec(ctx, "UPDATE session SET assistant_id = NULL WHERE assistant_id = $1", assistantId)
+	if err != nil {
+		return false, err
+	}
+
+	_, err = tx.Exec(ctx, "DELETE FROM assistant_kbase WHERE assistant_id = $1", assistantId)
+	if err != nil {
+		return false, err
+	}
+
+	_, err = tx.Exec(ctx, "DELETE FROM assistant_prompt_version WHERE assistant_id = $1", assistantId)
+	if err != nil {
+		return false, err
+	}
+
+	tag, err := tx.Exec(ctx, "DELETE FROM assistant WHERE uuid = $1", assistantId)
+	if err != nil {
+		return false, err
+	}
+	if tag.RowsAffected() == 0 {
+		return false, nil
+	}
+
+	err = tx.Commit(ctx)
+	if err != nil {
+		return false, err
+	}
+
+	return true, nil
+}
+
+// AttachKbase links a kbase to an assistant, or updates the retrieval settings of an existing link.
+func (atg *AssistantTableGatewayImpl) AttachKbase(ctx context.Context, link types.AssistantKbase) (bool, error) {
+	_, err := atg.Pool.Exec(ctx,
+		`INSERT INTO assistant_kbase (assistant_id, kbase_id, top_k, min_similarity, weight)
+         VALUES ($1, $2, $3, $4, $5)
+         ON CONFLICT (assistant_id, kbase_id) DO UPDATE
+         SET top_k = EXCLUDED.top_k, min_similarity = EXCLUDED.min_similarity, weight = EXCLUDED.weight`,
+		link.AssistantID, link.KbaseID, link.TopK, link.MinSimilarity, link.Weight)
+	if err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// DetachKbase removes the link between an assistant and a kbase, reporting false if there was none.
+func (atg *AssistantTableGatewayImpl) DetachKbase(ctx context.Context, assistantId uuid.UUID, kbaseId uuid.UUID) (bool, error) {
+	tag, err := atg.Pool.Exec(ctx, "DELETE FROM assistant_kbase WHERE assistant_id = $1 AND kbase_id = $2", assistantId, kbaseId)
+	if err != nil {
+		return false, err
+	}
+	return tag.RowsAffected() == 1, nil
+}
+
+// ListAssistantKbases returns the kbases linked to an assistant in the order they were attached.
+func (atg *AssistantTableGatewayImpl) ListAssistantKbases(ctx context.Context, assistantId uuid.UUID) ([]types.AssistantKbase, error) {
+	rows, err := atg.Pool.Query(ctx,
+		`SELECT ak.assistant_id, ak.kbase_id, k.name, ak.top_k, ak.min_similarity, ak.weight
+         FROM assistant_kbase ak JOIN kbase k ON k.uuid = ak.kbase_id
+         WHERE ak.assistant_id = $1 ORDER BY ak.created_at, ak.id`, assistantId)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	links := []types.AssistantKbase{}
+	for rows.Next() {
+		var link types.AssistantKbase
+		if err := rows.Scan(&link.AssistantID, &link.KbaseID, &link.KbaseName, &link.TopK, &link.MinSimilarity, &link.Weight); err != nil {
+			return nil, err
+		}
+		links = append(links, link)
+	}
+	return links, rows.Err()
+}
+
+// ListPromptVersions returns the prompt history of an assistant, newest version first.
+func (atg *AssistantTableGatewayImpl) ListPromptVersions(ctx context.Context, assistantId uuid.UUID) ([]types.PromptVersion, error) {
+	rows, err := atg.Pool.Query(ctx,
+		`SELECT assistant_id, version, template, created_at FROM assistant_prompt_version
+         WHERE assistant_id = $1 ORDER BY version DESC`, assistantId)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	versions := []types.PromptVersion{}
+	for rows.Next() {
+		var version types.PromptVersion
+		if err := rows.Scan(&version.AssistantID, &version.Version, &version.Template, &version.CreatedAt); err != nil {
+			return nil, err
+		}
+		versions = append(versions, version)
+	}
+	return versions, rows.Err()
+}
+
+// RollbackPrompt makes an earlier prompt version the assistant's current system prompt, reporting
+// false if the assistant has no such version.
+func (atg *AssistantTableGatewayImpl) RollbackPrompt(ctx context.Context, assistantId uuid.UUID, version int) (bool, error) {
+	tag, err := atg.Pool.Exec(ctx,
+		`UPDATE assistant a SET system_prompts = to_json(v.template), prompt_version = v.version, updated_at = now()
+         FROM assistant_prompt_version v
+         WHERE a.uuid = $1 AND v.assistant_id = a.uuid AND v.version = $2`,
+		assistantId, version)
+	if err != nil {
+		return false, err
+	}
+	return tag.RowsAffected() == 1, nil
+}
@@ -0,0 +1,135 @@
+package db
+
+import (
+	"context"
+	"rag-demo/types"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// CredentialTableGatewayImpl is the implementation of CredentialTableGateway using pgxpool.
+type CredentialTableGatewayImpl struct {
+	Pool *pgxpool.Pool
+}
+
+// NewCredentialTableGateway creates a new instance of CredentialTableGatewayImpl.
+func NewCredentialTableGateway(pool *pgxpool.Pool) types.CredentialTableGateway {
+	return &CredentialTableGatewayImpl{Pool: pool}
+}
+
+// CreateAccount inserts the user and its credentials in one transaction, so a taken email leaves no
+// user behind.
+func (ctg *CredentialTableGatewayImpl) CreateAccount(ctx context.Context, user types.User, credentials types.Credentials) error {
+	tx, err := ctg.Pool.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	_, err = tx.Exec(ctx, "INSERT INTO users (uuid, name, active) VALUES ($1, $2, $3)", user.UserID, user.Name, true)
+	if err != nil {
+		return err
+	}
+	_, err = tx.Exec(ctx,
+		`INSERT INTO credentials (user_id, email, password_hash, password_changed_at)
+         VALUES ($1, $2, $3, $4)`,
+		credentials.UserID, credentials.Email, credentials.PasswordHash, credentials.PasswordChangedAt)
+	if err != nil {
+		return err
+	}
+	return tx.Commit(ctx)
+}
+
+const credentialColumns = "user_id, email, password_hash, failed_logins, locked_until, password_changed_at"
+
+func scanCredentials(row interface{ Scan(dest ...any) error }) (types.Credentials, error) {
+	var credentials types.Credentials
+	var lockedUntil *time.Time
+	err := row.Scan(&credentials.UserID, &credentials.Email, &credentials.PasswordHash, &credentials.FailedLogins, &lockedUntil, &credentials.PasswordChangedAt)
+	if err != nil {
+		return types.Credentials{}, err
+	}
+	// accounts that were never locked keep the zero time
+	if lockedUntil != nil {
+		credentials.LockedUntil = *lockedUntil
+	}
+	return credentials, nil
+}
+
+// GetCredentials retrieves the credentials of a user.
+func (ctg *CredentialTableGatewayImpl) GetCredentials(ctx context.Context, userID uuid.UUID) (types.Credentials, error) {
+	return scanCredentials(ctg.Pool.QueryRow(ctx, "SELECT "+credentialColumns+" FROM credentials WHERE user_id = $1", userID))
+}
+
+// GetCredentialsByEmail retrieves the credentials of the email, which must already be normalized.
+func (ctg *CredentialTableGatewayImpl) GetCredentialsByEmail(ctx context.Context, email string) (types.Credentials, error) {
+	return scanCredentials(ctg.Pool.QueryRow(ctx, "SELECT "+credentialColumns+" FROM credentials WHERE email = $1", email))
+}
+
+// RecordFailedLogin counts a failed login in a single statement, so concurrent failures are all counted.
+func (ctg *CredentialTableGatewayImpl) RecordFailedLogin(ctx context.Context, userID uuid.UUID, maxFailures int, lockedUntil time.Time) error {
+	_, err := ctg.Pool.Exec(ctx,
+		`UPDATE credentials
+         SET failed_logins = CASE WHEN failed_logins + 1 >= $2 THEN 0 ELSE failed_logins + 1 END,
+             locked_until = CASE WHEN failed_logins + 1 >= $2 THEN $3 ELSE locked_until END
+         WHERE user_id = $1`,
+		userID, maxFailures, lockedUntil)
+	return err
+}
+
+// ResetFailedLogins starts the count of failed logins over after a successful login.
+func (ctg *CredentialTableGatewayImpl) ResetFailedLogins(ctx context.Context, userID uuid.UUID) error {
+	_, err := ctg.Pool.Exec(ctx, "UPDATE credentials SET failed_logins = 0 WHERE user_id = $1 AND failed_logins > 0", userID)
+	return err
+}
+
+// UpdatePassword replaces the password hash, unlocks the account and deletes its outstanding resets.
+func (ctg *CredentialTableGatewayImpl) UpdatePassword(ctx context.Context, userID uuid.UUID, passwordHash string, changedAt time.Time) error {
+	tx, err := ctg.Pool.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	_, err = tx.Exec(ctx,
+		`UPDATE credentials
+         SET password_hash = $2, password_changed_at = $3, failed_logins = 0, locked_until = NULL
+         WHERE user_id = $1`,
+		userID, passwordHash, changedAt)
+	if err != nil {
+		return err
+	}
+	_, err = tx.Exec(ctx, "DELETE FROM password_reset WHERE user_id = $1", userID)
+	if err != nil {
+		return err
+	}
+	return tx.Commit(ctx)
+}
+
+// CreatePasswordReset stores a password reset, dropping resets of any user that have expired.
+func (ctg *CredentialTableGatewayImpl) CreatePasswordReset(ctx context.Context, reset types.PasswordReset) error {
+	_, err := ctg.Pool.Exec(ctx, "DELETE FROM password_reset WHERE expires_at <= now()")
+	if err != nil {
+		return err
+	}
+	_, err = ctg.Pool.Exec(ctx,
+		"INSERT INTO password_reset (token_hash, user_id, expires_at) VALUES ($1, $2, $3)",
+		reset.TokenHash, reset.UserID, reset.ExpiresAt)
+	return err
+}
+
+// ConsumePasswordReset deletes the reset of the token hash and returns it; an unknown hash is
+// pgx.ErrNoRows.
+func (ctg *CredentialTableGatewayImpl) ConsumePasswordReset(ctx context.Context, tokenHash string) (types.PasswordReset, error) {
+	var reset types.PasswordReset
+	err := ctg.Pool.QueryRow(ctx,
+		"DELETE FROM password_reset WHERE token_hash = $1 RETURNING token_hash, user_id, expires_at",
+		tokenHash,
+	).Scan(&reset.TokenHash, &reset.UserID, &reset.ExpiresAt)
+	if err != nil {
+		return types.PasswordReset{}, err
+	}
+	return reset, nil
+}
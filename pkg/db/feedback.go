@@ -0,0 +1,183 @@
+package db
+
+import (
+	"context"
+	"rag-demo/types"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// FeedbackTableGatewayImpl is the implementation of FeedbackTableGateway using pgxpool.
+type FeedbackTableGatewayImpl struct {
+	Pool *pgxpool.Pool
+}
+
+// NewFeedbackTableGateway creates a new instance of FeedbackTableGatewayImpl.
+func NewFeedbackTableGateway(pool *pgxpool.Pool) types.FeedbackTableGateway {
+	return &FeedbackTableGatewayImpl{Pool: pool}
+}
+
+// SaveFeedback upserts the user's rating of the message and replaces the chunks linked to it.
+func (ftg *FeedbackTableGatewayImpl) SaveFeedback(ctx context.Context, feedback types.Feedback) (types.Feedback, error) {
+	tx, err := ftg.Pool.Begin(ctx)
+	if err != nil {
+		return types.Feedback{}, err
+	}
+	defer tx.Rollback(ctx)
+
+	// a second rating of the same message by the same user keeps the first one's uuid and created_at
+	err = tx.QueryRow(ctx,
+		`INSERT INTO message_feedback (uuid, message_id, user_id, session_id, assistant_id, rating, category, comment, prompt_version)
+         VALUES ($1, $2, $3, $4, $5, $6, NULLIF($7, ''), NULLIF($8, ''), NULLIF($9, 0))
+         ON CONFLICT (message_id, user_id) DO UPDATE
+         SET rating = EXCLUDED.rating, category = EXCLUDED.category, comment = EXCLUDED.comment, updated_at = now()
+         RETURNING uuid, created_at, updated_at`,
+		feedback.ID, feedback.MessageID, feedback.UserID, feedback.SessionID, feedback.AssistantID, feedback.Rating, feedback.Category, feedback.Comment, feedback.PromptVersion,
+	).Scan(&feedback.ID, &feedback.CreatedAt, &feedback.UpdatedAt)
+	if err != nil {
+		return types.Feedback{}, err
+	}
+
+	_, err = tx.Exec(ctx, "DELETE FROM message_feedback_chunk WHERE feedback_id = $1", feedback.ID)
+	if err != nil {
+		return types.Feedback{}, err
+	}
+	for _, chunk := range feedback.Chunks {
+		_, err = tx.Exec(ctx,
+			`INSERT INTO message_feedback_chunk (feedback_id, kbase_id, embedding_id, chunk_id, source, cited)
+             VALUES ($1, $2, $3, $4, $5, $6)`,
+			feedback.ID, chunk.KbaseID, chunk.EmbeddingID, chunk.ChunkID, chunk.Source, chunk.Cited)
+		if err != nil {
+			return types.Feedback{}, err
+		}
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return types.Feedback{}, err
+	}
+	return feedback, nil
+}
+
+// feedbackWhere selects the feedback of a filter, given as $1 from, $2 to, $3 assistant and $4 kbase.
+// Feedback is dated by its latest rating.
+const feedbackWhere = `f.updated_at >= $1 AND f.updated_at < $2
+           AND ($3::uuid IS NULL OR f.assistant_id = $3)
+           AND ($4::uuid IS NULL OR EXISTS (SELECT 1 FROM message_feedback_chunk k WHERE k.feedback_id = f.uuid AND k.kbase_id = $4))`
+
+// SummarizeFeedback counts the votes of the filtered feedback per period and lists the questions and
+// documents of the most down-voted answers. With a kbase filter only that kbase's documents are listed.
+func (ftg *FeedbackTableGatewayImpl) SummarizeFeedback(ctx context.Context, filter types.FeedbackFilter) (types.FeedbackSummary, error) {
+	summary := types.FeedbackSummary{
+		From:       filter.From,
+		To:         filter.To,
+		Series:     []types.FeedbackPeriod{},
+		Categories: map[string]int{},
+		Questions:  []types.DownvotedQuestion{},
+		Documents:  []types.DownvotedDocument{},
+	}
+	args := []interface{}{filter.From, filter.To, filter.AssistantID, filter.KbaseID}
+
+	rows, err := ftg.Pool.Query(ctx,
+		`SELECT date_trunc($5::text, f.updated_at) AS period,
+                count(*) FILTER (WHERE f.rating = 'up'), count(*) FILTER (WHERE f.rating = 'down')
+         FROM message_feedback f
+         WHERE `+feedbackWhere+`
+         GROUP BY period
+         ORDER BY period`,
+		append(args, filter.Interval)...)
+	if err != nil {
+		return types.FeedbackSummary{}, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var period types.FeedbackPeriod
+		if err := rows.Scan(&period.Start, &period.Up, &period.Down); err != nil {
+			return types.FeedbackSummary{}, err
+		}
+		period.SatisfactionRate = satisfactionRate(period.Up, period.Down)
+		summary.Series = append(summary.Series, period)
+		summary.Up += period.Up
+		summary.Down += period.Down
+	}
+	if err := rows.Err(); err != nil {
+		return types.FeedbackSummary{}, err
+	}
+	summary.SatisfactionRate = satisfactionRate(summary.Up, summary.Down)
+
+	rows, err = ftg.Pool.Query(ctx,
+		`SELECT COALESCE(f.category, 'uncategorized'), count(*)
+         FROM message_feedback f
+         WHERE `+feedbackWhere+` AND f.rating = 'down'
+         GROUP BY 1`,
+		args...)
+	if err != nil {
+		return types.FeedbackSummary{}, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var category string
+		var count int
+		if err := rows.Scan(&category, &count); err != nil {
+			return types.FeedbackSummary{}, err
+		}
+		summary.Categories[category] = count
+	}
+	if err := rows.Err(); err != nil {
+		return types.FeedbackSummary{}, err
+	}
+
+	rows, err = ftg.Pool.Query(ctx,
+		`SELECT min(btrim(m.user_message)), count(*) FILTER (WHERE f.rating = 'down') AS down,
+                count(*) FILTER (WHERE f.rating = 'up'), max(f.updated_at) AS last_voted_at
+         FROM message_feedback f
+         JOIN message m ON m.uuid = f.message_id
+         WHERE `+feedbackWhere+`
+         GROUP BY lower(btrim(m.user_message))
+         HAVING count(*) FILTER (WHERE f.rating = 'down') > 0
+         ORDER BY down DESC, last_voted_at DESC
+         LIMIT $5`,
+		append(args, filter.Limit)...)
+	if err != nil {
+		return types.FeedbackSummary{}, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var question types.DownvotedQuestion
+		if err := rows.Scan(&question.Question, &question.Down, &question.Up, &question.LastVotedAt); err != nil {
+			return types.FeedbackSummary{}, err
+		}
+		summary.Questions = append(summary.Questions, question)
+	}
+	if err := rows.Err(); err != nil {
+		return types.FeedbackSummary{}, err
+	}
+
+	rows, err = ftg.Pool.Query(ctx,
+		`SELECT c.kbase_id, c.source, count(DISTINCT f.uuid) AS down, count(DISTINCT f.uuid) FILTER (WHERE c.cited) AS cited
+         FROM message_feedback f
+         JOIN message_feedback_chunk c ON c.feedback_id = f.uuid
+         WHERE `+feedbackWhere+` AND f.rating = 'down' AND ($4::uuid IS NULL OR c.kbase_id = $4)
+         GROUP BY c.kbase_id, c.source
+         ORDER BY down DESC, cited DESC, c.source
+         LIMIT $5`,
+		append(args, filter.Limit)...)
+	if err != nil {
+		return types.FeedbackSummary{}, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var document types.DownvotedDocument
+		if err := rows.Scan(&document.KbaseID, &document.Source, &document.Down, &document.Cited); err != nil {
+			return types.FeedbackSummary{}, err
+		}
+		summary.Documents = append(summary.Documents, document)
+	}
+	return summary, rows.Err()
+}
+
+func satisfactionRate(up int, down int) float64 {
+	if up+down == 0 {
+		return 0
+	}
+	return float64(up) / float64(up+down)
+}
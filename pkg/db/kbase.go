@@ -19,7 +19,7 @@ func NewKbaseTableGateway(pool *pgxpool.Pool) types.KbaseTableGateway {
 
 // CreateKbase creates a new knowledge base in the kbase table of the Postgres db
 func (k *KbaseTableGatewayImpl) CreateKbase(ctx context.Context, kbase types.Kbase) (bool, error) {
-	_, err := k.Pool.Exec(ctx, "INSERT INTO kbase (uuid, name, description) VALUES ($1, $2, $3)", kbase.ID, kbase.Name, kbase.Description)
+	_, err := k.Pool.Exec(ctx, "INSERT INTO kbase (uuid, name, description, min_similarity) VALUES ($1, $2, $3, $4)", kbase.ID, kbase.Name, kbase.Description, kbase.MinSimilarity)
 	if err != nil {
 		return false, err
 	}
@@ -28,7 +28,7 @@ func (k *KbaseTableGatewayImpl) CreateKbase(ctx context.Context, kbase types.Kba
 
 // UpdateKbase updates an existing knowledge base in the kbase table of the Postgres db
 func (k *KbaseTableGatewayImpl) UpdateKbase(ctx context.Context, kbase types.Kbase) (bool, error) {
-	_, err := k.Pool.Exec(ctx, "UPDATE kbase SET name = $1, description = $2 WHERE uuid = $3", kbase.Name, kbase.Description, kbase.ID)
+	_, err := k.Pool.Exec(ctx, "UPDATE kbase SET name = $1, description = $2, min_similarity = $3 WHERE uuid = $4", kbase.Name, kbase.Description, kbase.MinSimilarity, kbase.ID)
 	if err != nil {
 		return false, err
 	}
@@ -38,7 +38,7 @@ func (k *KbaseTableGatewayImpl) UpdateKbase(ctx context.Context, kbase types.Kba
 // GetKbase retrieves a knowledge base from the kbase table of the Postgres db
 func (k *KbaseTableGatewayImpl) GetKbase(ctx context.Context, kbaseId uuid.UUID) (types.Kbase, error) {
 	var kbase types.Kbase
-	err := k.Pool.QueryRow(ctx, "SELECT uuid, name, description FROM kbase WHERE uuid = $1", kbaseId).Scan(&kbase.ID, &kbase.Name, &kbase.Description)
+	err := k.Pool.QueryRow(ctx, "SELECT uuid, name, description, min_similarity FROM kbase WHERE uuid = $1", kbaseId).Scan(&kbase.ID, &kbase.Name, &kbase.Description, &kbase.MinSimilarity)
 	if err != nil {
 		return types.Kbase{}, err
 	}
@@ -47,7 +47,7 @@ func (k *KbaseTableGatewayImpl) GetKbase(ctx context.Context, kbaseId uuid.UUID)
 
 // ListKbases retrieves all knowledge bases from the kbase table of the Postgres db
 func (k *KbaseTableGatewayImpl) ListKbases(ctx context.Context) (types.KbaseList, error) {
-	rows, err := k.Pool.Query(ctx, "SELECT uuid, name, description FROM kbase")
+	rows, err := k.Pool.Query(ctx, "SELECT uuid, name, description, min_similarity FROM kbase")
 	if err != nil {
 		return types.KbaseList{}, err
 	}
@@ -56,7 +56,7 @@ func (k *KbaseTableGatewayImpl) ListKbases(ctx context.Context) (types.KbaseList
 	var kbases []types.Kbase
 	for rows.Next() {
 		var kbase types.Kbase
-		err := rows.Scan(&kbase.ID, &kbase.Name, &kbase.Description)
+		err := rows.Scan(&kbase.ID, &kbase.Name, &kbase.Description, &kbase.MinSimilarity)
 		if err != nil {
 			return types.KbaseList{}, err
 		}
@@ -66,7 +66,7 @@ func (k *KbaseTableGatewayImpl) ListKbases(ctx context.Context) (types.KbaseList
 	return types.KbaseList{Kbases: kbases}, nil
 }
 
-// DeleteKbase deletes a knowledge base from the kbase table of the Postgres db and the associated embeddings
+// DeleteKbase deletes a knowledge base from the kbase table of the Postgres db, the associated embeddings and its assistant links
 func (k *KbaseTableGatewayImpl) DeleteKbase(ctx context.Context, kbaseId uuid.UUID) (bool, error) {
 	tx, err := k.Pool.Begin(ctx)
 	if err != nil {
@@ -89,6 +89,12 @@ func (k *KbaseTableGatewayImpl) DeleteKbase(ctx context.Context, kbaseId uuid.UU
 		return false, err
 	}
 
+	// detach the kbase from every assistant using it
+	_, err = tx.Exec(ctx, "DELETE FROM assistant_kbase WHERE kbase_id = $1", kbaseId)
+	if err != nil {
+		return false, err
+	}
+
 	_, err = tx.Exec(ctx, "DELETE FROM kbase WHERE uuid = $1", kbaseId)
 	if err != nil {
 		return false, err
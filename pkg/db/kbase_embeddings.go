@@ -3,12 +3,13 @@ package db
 import (
     "context"
     "encoding/json"
+    "fmt"
     // "time"
 
     "rag-demo/types"
-    // "github.com/pgvector/pgvector-go"
+    "github.com/pgvector/pgvector-go"
     // pgxvector "github.com/pgvector/pgvector-go/pgx"
-    // "github.com/google/uuid"
+    "github.com/google/uuid"
     "github.com/jackc/pgx/v5/pgxpool"
 )
 
@@ -46,4 +47,153 @@ func (k *KbaseEmbeddingsTableGatewayImpl) CreateEmbedding(ctx context.Context, e
     return true, nil
 }
 
-// Implement GetEmbedding and other methods as needed
+const searchEmbeddingsQuery = `
+        SELECT uuid, kbase_id, chunk_id, content, metadata, embedding <=> $1 AS distance
+        FROM kbase_embeddings
+        WHERE kbase_id = ANY($2)
+        ORDER BY distance
+        LIMIT $3
+    `
+
+// SearchEmbeddings returns the chunks closest to the given embedding by cosine distance across the given kbases
+func (k *KbaseEmbeddingsTableGatewayImpl) SearchEmbeddings(ctx context.Context, kbaseIds []uuid.UUID, embedding pgvector.Vector, limit int) ([]types.KbaseEmbeddingMatch, error) {
+    rows, err := k.Pool.Query(ctx, searchEmbeddingsQuery, embedding, kbaseIds, limit)
+    if err != nil {
+        return nil, err
+    }
+    defer rows.Close()
+
+    var matches []types.KbaseEmbeddingMatch
+    for rows.Next() {
+        var match types.KbaseEmbeddingMatch
+        var metadata []byte
+        err := rows.Scan(&match.UUID, &match.KbaseID, &match.ChunkID, &match.Content, &metadata, &match.Distance)
+        if err != nil {
+            return nil, err
+        }
+        if err := unmarshalEmbeddingMetadata(metadata, &match.KbaseEmbedding); err != nil {
+            return nil, err
+        }
+        matches = append(matches, match)
+    }
+    if err := rows.Err(); err != nil {
+        return nil, err
+    }
+
+    return matches, nil
+}
+
+// GetChunkRange returns the chunks of one source document between firstChunk and lastChunk inclusive, in order
+func (k *KbaseEmbeddingsTableGatewayImpl) GetChunkRange(ctx context.Context, kbaseId uuid.UUID, source string, firstChunk int, lastChunk int) ([]types.KbaseEmbedding, error) {
+    rows, err := k.Pool.Query(ctx, `
+        SELECT uuid, kbase_id, chunk_id, content, metadata
+        FROM kbase_embeddings
+        WHERE kbase_id = $1 AND metadata->>'source' = $2 AND chunk_id BETWEEN $3 AND $4
+        ORDER BY chunk_id
+    `, kbaseId, source, firstChunk, lastChunk)
+    if err != nil {
+        return nil, err
+    }
+    defer rows.Close()
+
+    var chunks []types.KbaseEmbedding
+    for rows.Next() {
+        var chunk types.KbaseEmbedding
+        var metadata []byte
+        err := rows.Scan(&chunk.UUID, &chunk.KbaseID, &chunk.ChunkID, &chunk.Content, &metadata)
+        if err != nil {
+            return nil, err
+        }
+        if err := unmarshalEmbeddingMetadata(metadata, &chunk); err != nil {
+            return nil, err
+        }
+        chunks = append(chunks, chunk)
+    }
+    if err := rows.Err(); err != nil {
+        return nil, err
+    }
+
+    return chunks, nil
+}
+
+// KeywordScores returns the full-text ts_rank of each given chunk against the query
+func (k *KbaseEmbeddingsTableGatewayImpl) KeywordScores(ctx context.Context, query string, embeddingIds []uuid.UUID) (map[uuid.UUID]float64, error) {
+    rows, err := k.Pool.Query(ctx, `
+        SELECT uuid, ts_rank(to_tsvector('english', content), plainto_tsquery('english', $1))
+        FROM kbase_embeddings
+        WHERE uuid = ANY($2)
+    `, query, embeddingIds)
+    if err != nil {
+        return nil, err
+    }
+    defer rows.Close()
+
+    scores := make(map[uuid.UUID]float64)
+    for rows.Next() {
+        var id uuid.UUID
+        var score float32
+        if err := rows.Scan(&id, &score); err != nil {
+            return nil, err
+        }
+        scores[id] = float64(score)
+    }
+    if err := rows.Err(); err != nil {
+        return nil, err
+    }
+
+    return scores, nil
+}
+
+type explainNode struct {
+    NodeType  string        `json:"Node Type"`
+    IndexName string        `json:"Index Name"`
+    TotalCost float64       `json:"Total Cost"`
+    PlanRows  int           `json:"Plan Rows"`
+    Plans     []explainNode `json:"Plans"`
+}
+
+// ExplainSearch returns a summary of the plan Postgres chooses for SearchEmbeddings without running it
+func (k *KbaseEmbeddingsTableGatewayImpl) ExplainSearch(ctx context.Context, kbaseIds []uuid.UUID, embedding pgvector.Vector, limit int) (types.SQLPlanSummary, error) {
+    var planJSON []byte
+    err := k.Pool.QueryRow(ctx, "EXPLAIN (FORMAT JSON) "+searchEmbeddingsQuery, embedding, kbaseIds, limit).Scan(&planJSON)
+    if err != nil {
+        return types.SQLPlanSummary{}, err
+    }
+
+    var plans []struct {
+        Plan explainNode `json:"Plan"`
+    }
+    if err := json.Unmarshal(planJSON, &plans); err != nil {
+        return types.SQLPlanSummary{}, err
+    }
+    if len(plans) == 0 {
+        return types.SQLPlanSummary{}, fmt.Errorf("empty query plan")
+    }
+
+    root := plans[0].Plan
+    summary := types.SQLPlanSummary{
+        NodeType:  root.NodeType,
+        TotalCost: root.TotalCost,
+        PlanRows:  root.PlanRows,
+    }
+    var walk func(node explainNode)
+    walk = func(node explainNode) {
+        summary.Nodes = append(summary.Nodes, node.NodeType)
+        if node.IndexName != "" {
+            summary.Indexes = append(summary.Indexes, node.IndexName)
+        }
+        for _, child := range node.Plans {
+            walk(child)
+        }
+    }
+    walk(root)
+
+    return summary, nil
+}
+
+func unmarshalEmbeddingMetadata(metadata []byte, embedding *types.KbaseEmbedding) error {
+    if len(metadata) == 0 {
+        return nil
+    }
+    return json.Unmarshal(metadata, &embedding.Metadata)
+}
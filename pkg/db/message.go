@@ -0,0 +1,159 @@
+package db
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"rag-demo/types"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// MessageTableGatewayImpl is the implementation of MessageTableGateway using pgxpool.
+type MessageTableGatewayImpl struct {
+	Pool *pgxpool.Pool
+}
+
+// NewMessageTableGateway creates a new instance of MessageTableGatewayImpl.
+func NewMessageTableGateway(pool *pgxpool.Pool) types.MessageTableGateway {
+	return &MessageTableGatewayImpl{Pool: pool}
+}
+
+// CreateMessage stores a chat turn and the sources used to answer it in the message table.
+func (mtg *MessageTableGatewayImpl) CreateMessage(ctx context.Context, message types.Message) (bool, error) {
+	sourcesJSON, err := json.Marshal(message.Sources)
+	if err != nil {
+		return false, fmt.Errorf("failed to marshal Sources: %v", err)
+	}
+
+	citationsJSON, err := json.Marshal(message.Citations)
+	if err != nil {
+		return false, fmt.Errorf("failed to marshal Citations: %v", err)
+	}
+
+	toolCallsJSON, err := json.Marshal(message.ToolCalls)
+	if err != nil {
+		return false, fmt.Errorf("failed to marshal ToolCalls: %v", err)
+	}
+
+	guardrailsJSON, err := json.Marshal(message.Guardrails)
+	if err != nil {
+		return false, fmt.Errorf("failed to marshal Guardrails: %v", err)
+	}
+
+	var sqlJSON []byte
+	if message.SQL != nil {
+		sqlJSON, err = json.Marshal(message.SQL)
+		if err != nil {
+			return false, fmt.Errorf("failed to marshal SQL: %v", err)
+		}
+	}
+
+	var groundednessJSON []byte
+	if message.Groundedness != nil {
+		groundednessJSON, err = json.Marshal(message.Groundedness)
+		if err != nil {
+			return false, fmt.Errorf("failed to marshal Groundedness: %v", err)
+		}
+	}
+
+	// first turns have no parent
+	var parentID *uuid.UUID
+	if message.ParentID != uuid.Nil {
+		parentID = &message.ParentID
+	}
+
+	// message_uuid mirrors uuid; both columns are unique per turn. The session's updated_at is
+	// bumped with it so sessions list by last activity.
+	_, err = mtg.Pool.Exec(ctx,
+		`WITH touched AS (UPDATE session SET updated_at = now() WHERE uuid = $3)
+         INSERT INTO message (uuid, message_uuid, user_id, session_id, assistant_id, user_message, rewritten_query, ai_message, sources, citations, prompt_version, tool_calls, sql_result, guardrails, groundedness, parent_id)
+         VALUES ($1, $1, $2, $3, $4, $5, NULLIF($6, ''), $7, $8::json, $9::json, NULLIF($10, 0), $11::json, $12::json, $13::json, $14::json, $15)`,
+		message.ID, message.UserID, message.SessionID, message.AssistantID, message.UserMessage, message.RewrittenQuery, message.AIMessage, sourcesJSON, citationsJSON, message.PromptVersion, toolCallsJSON, sqlJSON, guardrailsJSON, groundednessJSON, parentID)
+	if err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// messageColumns are the columns scanMessage reads, in order.
+const messageColumns = `uuid, session_id, user_id, assistant_id, user_message, COALESCE(rewritten_query, ''), ai_message, sources, citations, COALESCE(prompt_version, 0), tool_calls, sql_result, guardrails, groundedness, parent_id, created_at`
+
+// ListMessages returns the messages of a session created after the given time, oldest first.
+func (mtg *MessageTableGatewayImpl) ListMessages(ctx context.Context, sessionID uuid.UUID, after *time.Time) ([]types.Message, error) {
+	rows, err := mtg.Pool.Query(ctx,
+		`SELECT `+messageColumns+`
+         FROM message
+         WHERE session_id = $1 AND ($2::timestamp IS NULL OR created_at > $2)
+         ORDER BY created_at, id`,
+		sessionID, after)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var messages []types.Message
+	for rows.Next() {
+		message, err := scanMessage(rows)
+		if err != nil {
+			return nil, err
+		}
+		messages = append(messages, message)
+	}
+	return messages, rows.Err()
+}
+
+// GetMessage returns the message with the given id, or pgx.ErrNoRows.
+func (mtg *MessageTableGatewayImpl) GetMessage(ctx context.Context, messageID uuid.UUID) (types.Message, error) {
+	return scanMessage(mtg.Pool.QueryRow(ctx, `SELECT `+messageColumns+` FROM message WHERE uuid = $1`, messageID))
+}
+
+// scanMessage reads a row of messageColumns, decoding its JSON columns.
+func scanMessage(row pgx.Row) (types.Message, error) {
+	var message types.Message
+	var assistantID, parentID *uuid.UUID
+	var sourcesJSON, citationsJSON, toolCallsJSON, sqlJSON, guardrailsJSON, groundednessJSON []byte
+	if err := row.Scan(&message.ID, &message.SessionID, &message.UserID, &assistantID, &message.UserMessage, &message.RewrittenQuery, &message.AIMessage, &sourcesJSON, &citationsJSON, &message.PromptVersion, &toolCallsJSON, &sqlJSON, &guardrailsJSON, &groundednessJSON, &parentID, &message.CreatedAt); err != nil {
+		return types.Message{}, err
+	}
+	if assistantID != nil {
+		message.AssistantID = *assistantID
+	}
+	if parentID != nil {
+		message.ParentID = *parentID
+	}
+	if len(sourcesJSON) > 0 {
+		if err := json.Unmarshal(sourcesJSON, &message.Sources); err != nil {
+			return types.Message{}, fmt.Errorf("failed to unmarshal sources: %v", err)
+		}
+	}
+	if len(citationsJSON) > 0 {
+		if err := json.Unmarshal(citationsJSON, &message.Citations); err != nil {
+			return types.Message{}, fmt.Errorf("failed to unmarshal citations: %v", err)
+		}
+	}
+	if len(toolCallsJSON) > 0 {
+		if err := json.Unmarshal(toolCallsJSON, &message.ToolCalls); err != nil {
+			return types.Message{}, fmt.Errorf("failed to unmarshal tool calls: %v", err)
+		}
+	}
+	if len(sqlJSON) > 0 {
+		if err := json.Unmarshal(sqlJSON, &message.SQL); err != nil {
+			return types.Message{}, fmt.Errorf("failed to unmarshal sql result: %v", err)
+		}
+	}
+	if len(guardrailsJSON) > 0 {
+		if err := json.Unmarshal(guardrailsJSON, &message.Guardrails); err != nil {
+			return types.Message{}, fmt.Errorf("failed to unmarshal guardrails: %v", err)
+		}
+	}
+	if len(groundednessJSON) > 0 {
+		if err := json.Unmarshal(groundednessJSON, &message.Groundedness); err != nil {
+			return types.Message{}, fmt.Errorf("failed to unmarshal groundedness: %v", err)
+		}
+	}
+	return message, nil
+}
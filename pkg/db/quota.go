@@ -0,0 +1,55 @@
+package db
+
+import (
+	"context"
+	"fmt"
+	"rag-demo/types"
+	"sync"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// QuotaStoreImpl is the implementation of QuotaStore using pgxpool, so every instance of the API
+// counts against the same quotas.
+type QuotaStoreImpl struct {
+	Pool *pgxpool.Pool
+
+	mu      sync.Mutex
+	sweptAt time.Time
+}
+
+// NewQuotaStore creates a new instance of QuotaStoreImpl.
+func NewQuotaStore(pool *pgxpool.Pool) types.QuotaStore {
+	return &QuotaStoreImpl{Pool: pool}
+}
+
+// Add upserts the counter and returns its new count.
+func (qs *QuotaStoreImpl) Add(ctx context.Context, counter types.QuotaCounter, n int) (int, error) {
+	qs.sweep(ctx)
+
+	var count int
+	err := qs.Pool.QueryRow(ctx,
+		`INSERT INTO quota_counter (subject, name, window_start, expires_at, count)
+         VALUES ($1, $2, $3, $4, $5)
+         ON CONFLICT (subject, name, window_start) DO UPDATE SET count = quota_counter.count + EXCLUDED.count
+         RETURNING count`,
+		counter.Subject, counter.Name, counter.WindowStart, counter.ExpiresAt, n,
+	).Scan(&count)
+	return count, err
+}
+
+// sweep deletes expired counters at most once an hour per instance.
+func (qs *QuotaStoreImpl) sweep(ctx context.Context) {
+	qs.mu.Lock()
+	if time.Since(qs.sweptAt) < time.Hour {
+		qs.mu.Unlock()
+		return
+	}
+	qs.sweptAt = time.Now()
+	qs.mu.Unlock()
+
+	if _, err := qs.Pool.Exec(ctx, "DELETE FROM quota_counter WHERE expires_at < now()"); err != nil {
+		fmt.Println("Error deleting expired quota counters: ", err)
+	}
+}
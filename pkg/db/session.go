@@ -3,6 +3,7 @@ package db
 import (
 	"context"
 	"rag-demo/types"
+	"time"
 	"github.com/jackc/pgx/v5/pgxpool"
 	"github.com/google/uuid"
 )
@@ -17,8 +18,32 @@ func NewSessionTableGateway(pool *pgxpool.Pool) types.SessionTableGateway {
 	return &SessionTableGatewayImpl{Pool: pool}
 }
 
+const sessionColumns = "uuid, user_id, assistant_id, COALESCE(title, ''), active, summary, summarized_until, created_at, updated_at"
+
+// scanSession reads a row selected with sessionColumns.
+func scanSession(row interface{ Scan(dest ...any) error }) (types.Session, error) {
+	var session types.Session
+	var assistantID *uuid.UUID
+	var summary *string
+	err := row.Scan(&session.ID, &session.UserID, &assistantID, &session.Title, &session.Active, &summary, &session.SummarizedUntil, &session.CreatedAt, &session.UpdatedAt)
+	if err != nil {
+		return types.Session{}, err
+	}
+	if assistantID != nil {
+		session.AssistantID = *assistantID
+	}
+	if summary != nil {
+		session.Summary = *summary
+	}
+	return session, nil
+}
+
 func (stg *SessionTableGatewayImpl) CreateSession(ctx context.Context, session types.Session) (bool, error) {
-	_, err := stg.Pool.Exec(ctx, "INSERT INTO session (uuid, user_id, active) VALUES ($1, $2, $3)", session.ID, session.UserID, true)
+	var assistantID *uuid.UUID
+	if session.AssistantID != uuid.Nil {
+		assistantID = &session.AssistantID
+	}
+	_, err := stg.Pool.Exec(ctx, "INSERT INTO session (uuid, user_id, assistant_id, title, active) VALUES ($1, $2, $3, NULLIF($4, ''), $5)", session.ID, session.UserID, assistantID, session.Title, true)
 	if err != nil {
 		return false, err
 	}
@@ -26,10 +51,51 @@ func (stg *SessionTableGatewayImpl) CreateSession(ctx context.Context, session t
 }
 
 func (stg *SessionTableGatewayImpl) GetSession(ctx context.Context, sessionID uuid.UUID) (types.Session, error) {
-	var session types.Session
-	err := stg.Pool.QueryRow(ctx, "SELECT uuid, user_id FROM session WHERE uuid = $1", sessionID).Scan(&session.ID, &session.UserID)
+	return scanSession(stg.Pool.QueryRow(ctx, "SELECT "+sessionColumns+" FROM session WHERE uuid = $1", sessionID))
+}
+
+// ListSessions returns a page of a user's sessions, most recently active first, and the user's total number of sessions.
+func (stg *SessionTableGatewayImpl) ListSessions(ctx context.Context, userID uuid.UUID, limit int, offset int) ([]types.Session, int, error) {
+	var total int
+	err := stg.Pool.QueryRow(ctx, "SELECT count(*) FROM session WHERE user_id = $1", userID).Scan(&total)
 	if err != nil {
-		return types.Session{}, err
+		return nil, 0, err
 	}
-	return session, nil
-}
\ No newline at end of file
+
+	rows, err := stg.Pool.Query(ctx, "SELECT "+sessionColumns+" FROM session WHERE user_id = $1 ORDER BY updated_at DESC, id DESC LIMIT $2 OFFSET $3", userID, limit, offset)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer rows.Close()
+
+	var sessions []types.Session
+	for rows.Next() {
+		session, err := scanSession(rows)
+		if err != nil {
+			return nil, 0, err
+		}
+		sessions = append(sessions, session)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, 0, err
+	}
+	return sessions, total, nil
+}
+
+// CloseSession marks a session inactive so it no longer accepts messages.
+func (stg *SessionTableGatewayImpl) CloseSession(ctx context.Context, sessionID uuid.UUID) (bool, error) {
+	tag, err := stg.Pool.Exec(ctx, "UPDATE session SET active = false, updated_at = now() WHERE uuid = $1", sessionID)
+	if err != nil {
+		return false, err
+	}
+	return tag.RowsAffected() == 1, nil
+}
+
+// UpdateSessionSummary stores the rolling conversation summary and the creation time of the last message it covers.
+func (stg *SessionTableGatewayImpl) UpdateSessionSummary(ctx context.Context, sessionID uuid.UUID, summary string, summarizedUntil time.Time) (bool, error) {
+	tag, err := stg.Pool.Exec(ctx, "UPDATE session SET summary = $2, summarized_until = $3, updated_at = now() WHERE uuid = $1", sessionID, summary, summarizedUntil)
+	if err != nil {
+		return false, err
+	}
+	return tag.RowsAffected() == 1, nil
+}
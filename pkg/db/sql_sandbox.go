@@ -0,0 +1,134 @@
+package db
+
+import (
+	"context"
+	"database/sql/driver"
+	"fmt"
+	"strconv"
+	"time"
+
+	"rag-demo/types"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// SQLSandboxGatewayImpl is the implementation of SQLSandboxGateway using pgxpool. The pool should
+// connect to the text-to-SQL database as a role that can only read the allowed tables.
+type SQLSandboxGatewayImpl struct {
+	Pool *pgxpool.Pool
+}
+
+// NewSQLSandboxGateway creates a new instance of SQLSandboxGatewayImpl.
+func NewSQLSandboxGateway(pool *pgxpool.Pool) types.SQLSandboxGateway {
+	return &SQLSandboxGatewayImpl{Pool: pool}
+}
+
+// NewSQLSandboxPool connects to the text-to-SQL database with a pool separate from the application's,
+// whose sessions default to read-only transactions.
+func NewSQLSandboxPool(ctx context.Context, connString string) (*pgxpool.Pool, error) {
+	config, err := pgxpool.ParseConfig(connString)
+	if err != nil {
+		return nil, err
+	}
+	config.ConnConfig.RuntimeParams["default_transaction_read_only"] = "on"
+	return pgxpool.NewWithConfig(ctx, config)
+}
+
+// DescribeTables lists the columns of the allowed tables and views the pool's role can see.
+func (g *SQLSandboxGatewayImpl) DescribeTables(ctx context.Context, allowed []string) ([]types.TableSchema, error) {
+	rows, err := g.Pool.Query(ctx,
+		`SELECT table_schema, table_name, column_name, data_type, is_nullable = 'YES'
+         FROM information_schema.columns
+         WHERE table_schema || '.' || table_name = ANY($1) OR table_schema || '.*' = ANY($1)
+         ORDER BY table_schema, table_name, ordinal_position`,
+		allowed)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var tables []types.TableSchema
+	for rows.Next() {
+		var schema, table string
+		var column types.ColumnSchema
+		if err := rows.Scan(&schema, &table, &column.Name, &column.Type, &column.Nullable); err != nil {
+			return nil, err
+		}
+		if n := len(tables); n == 0 || tables[n-1].Schema != schema || tables[n-1].Name != table {
+			tables = append(tables, types.TableSchema{Schema: schema, Name: table})
+		}
+		tables[len(tables)-1].Columns = append(tables[len(tables)-1].Columns, column)
+	}
+	return tables, rows.Err()
+}
+
+// RunReadOnly runs the query in a read-only transaction with a statement timeout and an empty search
+// path, so only schema-qualified tables resolve. One row more than maxRows is fetched to tell whether
+// the result was truncated. The transaction is always rolled back.
+func (g *SQLSandboxGatewayImpl) RunReadOnly(ctx context.Context, query string, maxRows int, timeout time.Duration) (types.SQLResult, error) {
+	start := time.Now()
+	tx, err := g.Pool.BeginTx(ctx, pgx.TxOptions{AccessMode: pgx.ReadOnly})
+	if err != nil {
+		return types.SQLResult{}, err
+	}
+	defer tx.Rollback(ctx)
+
+	_, err = tx.Exec(ctx, `SELECT set_config('statement_timeout', $1, true), set_config('search_path', '', true)`,
+		strconv.FormatInt(timeout.Milliseconds(), 10))
+	if err != nil {
+		return types.SQLResult{}, fmt.Errorf("error configuring transaction: %w", err)
+	}
+
+	rows, err := tx.Query(ctx, fmt.Sprintf("SELECT * FROM (\n%s\n) AS result LIMIT %d", query, maxRows+1))
+	if err != nil {
+		return types.SQLResult{}, err
+	}
+	defer rows.Close()
+
+	result := types.SQLResult{Query: query, Columns: []types.SQLColumn{}, Rows: [][]interface{}{}}
+	typeMap := tx.Conn().TypeMap()
+	for _, field := range rows.FieldDescriptions() {
+		column := types.SQLColumn{Name: field.Name, Type: "unknown"}
+		if t, ok := typeMap.TypeForOID(field.DataTypeOID); ok {
+			column.Type = t.Name
+		}
+		result.Columns = append(result.Columns, column)
+	}
+
+	for rows.Next() {
+		if len(result.Rows) == maxRows {
+			result.Truncated = true
+			break
+		}
+		values, err := rows.Values()
+		if err != nil {
+			return types.SQLResult{}, err
+		}
+		for i, value := range values {
+			values[i] = jsonValue(value)
+		}
+		result.Rows = append(result.Rows, values)
+	}
+	if err := rows.Err(); err != nil {
+		return types.SQLResult{}, err
+	}
+	result.RowCount = len(result.Rows)
+	result.DurationMs = time.Since(start).Milliseconds()
+	return result, nil
+}
+
+// jsonValue converts the pgx values that don't encode to JSON as their SQL text would, such as
+// numerics and uuids.
+func jsonValue(value interface{}) interface{} {
+	switch v := value.(type) {
+	case [16]byte:
+		return uuid.UUID(v).String()
+	case driver.Valuer:
+		if converted, err := v.Value(); err == nil {
+			return converted
+		}
+	}
+	return value
+}
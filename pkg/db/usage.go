@@ -0,0 +1,98 @@
+package db
+
+import (
+	"context"
+	"fmt"
+	"rag-demo/types"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// UsageTableGatewayImpl is the implementation of UsageTableGateway using pgxpool.
+type UsageTableGatewayImpl struct {
+	Pool *pgxpool.Pool
+}
+
+// NewUsageTableGateway creates a new instance of UsageTableGatewayImpl.
+func NewUsageTableGateway(pool *pgxpool.Pool) types.UsageTableGateway {
+	return &UsageTableGatewayImpl{Pool: pool}
+}
+
+// RecordUsage stores a metered call; ids it isn't attributed to are stored as NULL.
+func (utg *UsageTableGatewayImpl) RecordUsage(ctx context.Context, usage types.Usage) error {
+	_, err := utg.Pool.Exec(ctx,
+		`INSERT INTO usage (uuid, user_id, session_id, assistant_id, kbase_id, kind, model_id, input_tokens, output_tokens, pages, cost)
+         VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11)`,
+		usage.ID, optionalID(usage.UserID), optionalID(usage.SessionID), optionalID(usage.AssistantID), optionalID(usage.KbaseID),
+		usage.Kind, usage.ModelID, usage.InputTokens, usage.OutputTokens, usage.Pages, usage.Cost)
+	return err
+}
+
+// usageGroupKeys are the keys usage is grouped by, as text.
+var usageGroupKeys = map[string]string{
+	types.UsageGroupUser:      "user_id::text",
+	types.UsageGroupSession:   "session_id::text",
+	types.UsageGroupAssistant: "assistant_id::text",
+	types.UsageGroupKbase:     "kbase_id::text",
+	types.UsageGroupDay:       "to_char(created_at, 'YYYY-MM-DD')",
+	types.UsageGroupModel:     "model_id",
+}
+
+// ReportUsage sums the filtered usage per group of the filter's grouping.
+func (utg *UsageTableGatewayImpl) ReportUsage(ctx context.Context, filter types.UsageFilter) (types.UsageReport, error) {
+	key, ok := usageGroupKeys[filter.GroupBy]
+	if !ok {
+		return types.UsageReport{}, fmt.Errorf("unknown usage grouping %q", filter.GroupBy)
+	}
+	order := "cost DESC, key"
+	if filter.GroupBy == types.UsageGroupDay {
+		order = "key"
+	}
+
+	report := types.UsageReport{From: filter.From, To: filter.To, GroupBy: filter.GroupBy, Groups: []types.UsageGroup{}}
+	rows, err := utg.Pool.Query(ctx,
+		`SELECT COALESCE(`+key+`, '') AS key, count(*), sum(input_tokens), sum(output_tokens), sum(pages), sum(cost)::float8 AS cost,
+                COALESCE(sum(cost) FILTER (WHERE kind = 'generation'), 0)::float8,
+                COALESCE(sum(cost) FILTER (WHERE kind = 'embedding'), 0)::float8,
+                COALESCE(sum(cost) FILTER (WHERE kind = 'textract'), 0)::float8
+         FROM usage
+         WHERE created_at >= $1 AND created_at < $2
+           AND ($3::uuid IS NULL OR user_id = $3)
+           AND ($4::uuid IS NULL OR session_id = $4)
+           AND ($5::uuid IS NULL OR assistant_id = $5)
+           AND ($6::uuid IS NULL OR kbase_id = $6)
+         GROUP BY 1
+         ORDER BY `+order,
+		filter.From, filter.To, filter.UserID, filter.SessionID, filter.AssistantID, filter.KbaseID)
+	if err != nil {
+		return types.UsageReport{}, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var group types.UsageGroup
+		if err := rows.Scan(&group.Key, &group.Calls, &group.InputTokens, &group.OutputTokens, &group.Pages, &group.Cost,
+			&group.GenerationCost, &group.EmbeddingCost, &group.TextractCost); err != nil {
+			return types.UsageReport{}, err
+		}
+		report.Groups = append(report.Groups, group)
+		report.Total.Calls += group.Calls
+		report.Total.InputTokens += group.InputTokens
+		report.Total.OutputTokens += group.OutputTokens
+		report.Total.Pages += group.Pages
+		report.Total.Cost += group.Cost
+		report.Total.GenerationCost += group.GenerationCost
+		report.Total.EmbeddingCost += group.EmbeddingCost
+		report.Total.TextractCost += group.TextractCost
+	}
+	return report, rows.Err()
+}
+
+// optionalID returns nil for uuid.Nil so it is stored as NULL.
+func optionalID(id uuid.UUID) *uuid.UUID {
+	if id == uuid.Nil {
+		return nil
+	}
+	return &id
+}
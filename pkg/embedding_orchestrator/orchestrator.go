@@ -9,22 +9,42 @@ import (
     "github.com/pgvector/pgvector-go"
     // "github.com/lib/pq"
     "rag-demo/pkg/index"
+    "rag-demo/pkg/quota"
+    "rag-demo/pkg/usage"
     "rag-demo/types"
 )
 
 type Orchestrator struct {
     bedrockService *index.BedrockRuntimeService
     dbService      types.KbaseEmbeddingsTableGateway
+    meter          *usage.Meter // records the kbase's Textract pages and embeddings; nil doesn't
+    limiter        *quota.Limiter // counts each document against the documents per day of the context's subject; nil doesn't
 }
 
-func NewOrchestrator(bedrockService *index.BedrockRuntimeService, dbService types.KbaseEmbeddingsTableGateway) *Orchestrator {
+func NewOrchestrator(bedrockService *index.BedrockRuntimeService, dbService types.KbaseEmbeddingsTableGateway, meter *usage.Meter, limiter *quota.Limiter) *Orchestrator {
     return &Orchestrator{
         bedrockService: bedrockService,
         dbService:      dbService,
+        meter:          meter,
+        limiter:        limiter,
     }
 }
 
 func (o *Orchestrator) ProcessAndStoreEmbeddings(ctx context.Context, docText types.DocumentText, kbaseID uuid.UUID) error {
+    // documents over the quota are refused before any of their chunks are embedded
+    if err := o.limiter.CountDocument(ctx); err != nil {
+        return err
+    }
+
+    if docText.PageCount > 0 {
+        o.meter.Record(ctx, types.Usage{
+            UsageScope: types.UsageScope{KbaseID: kbaseID},
+            Kind:       types.UsageKindTextract,
+            ModelID:    usage.TextractDetectText,
+            Pages:      docText.PageCount,
+        })
+    }
+
     for i, chunk := range docText.Chunks {
         // Prepare input for GetEmbeddings
         chunkDoc := types.DocumentText{
@@ -39,17 +59,27 @@ func (o *Orchestrator) ProcessAndStoreEmbeddings(ctx context.Context, docText ty
         }
 
         // Parse the embedding output
-        var embeddingResponse struct {
-            Embedding []float32 `json:"embedding"`
-        }
+        var embeddingResponse types.TitanEmbeddingOutput
         
         err = json.Unmarshal(embeddingOutput.Body, &embeddingResponse)
         if err != nil {
             return fmt.Errorf("error unmarshaling embedding response: %w", err)
         }
+        o.meter.Record(ctx, types.Usage{
+            UsageScope:  types.UsageScope{KbaseID: kbaseID},
+            Kind:        types.UsageKindEmbedding,
+            ModelID:     index.EmbeddingModelID,
+            InputTokens: embeddingResponse.InputTextTokenCount,
+        })
         
         embeddingVec := pgvector.NewVector(embeddingResponse.Embedding)
         
+        metadata := map[string]interface{}{"source": docText.Name}
+        if i < len(docText.Pages) && docText.Pages[i].Start > 0 {
+            metadata["page_start"] = docText.Pages[i].Start
+            metadata["page_end"] = docText.Pages[i].End
+        }
+
         // Create the embedding record
         embeddingRecord := types.KbaseEmbedding{
             UUID:      uuid.New(),
@@ -57,7 +87,7 @@ func (o *Orchestrator) ProcessAndStoreEmbeddings(ctx context.Context, docText ty
             ChunkID:   i,
             Content:   chunk,
             Embedding: embeddingVec,
-            Metadata:  map[string]interface{}{"source": docText.Name},
+            Metadata:  metadata,
         }
 
         // Store the embedding
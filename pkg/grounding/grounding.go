@@ -0,0 +1,126 @@
+package grounding
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+
+	"rag-demo/pkg/llm"
+	"rag-demo/pkg/search"
+	"rag-demo/types"
+)
+
+const (
+	// DefaultMinSimilarity is the cosine similarity to a passage at which the embedding method counts a
+	// sentence as supported.
+	DefaultMinSimilarity = 0.6
+	DefaultRefusal       = "Sorry, I couldn't find enough support in the sources to answer that reliably."
+)
+
+var (
+	ErrInvalidPolicy = errors.New("invalid groundedness policy")
+	ErrNotConfigured = errors.New("groundedness method is not configured")
+)
+
+// Verifier checks each sentence of an answer against the passages it was generated from, either by
+// having a model judge them or by comparing embeddings.
+type Verifier struct {
+	Model    llm.LLM         // judges with the llm method
+	Embedder search.Embedder // embeds with the embedding method
+}
+
+func NewVerifier(model llm.LLM, embedder search.Embedder) *Verifier {
+	return &Verifier{Model: model, Embedder: embedder}
+}
+
+// Verify scores how well the sources support the answer and lists the sentences they don't support.
+// The judge is the policy's model, or modelID when it has none. The usage is that of the judge.
+func (v *Verifier) Verify(ctx context.Context, policy types.GroundednessPolicy, modelID string, answer string, sources []types.SearchHit) (types.Groundedness, types.TokenUsage, error) {
+	sentences := SplitSentences(answer)
+	var checked []int
+	for i, sentence := range sentences {
+		if checkable(sentence) {
+			checked = append(checked, i)
+		}
+	}
+
+	var unsupported []types.UnsupportedSentence
+	var usage types.TokenUsage
+	var err error
+	if len(checked) > 0 {
+		switch policy.Method {
+		case types.GroundednessMethodJudge:
+			if v.Model == nil {
+				return types.Groundedness{}, types.TokenUsage{}, fmt.Errorf("%w: no judge model", ErrNotConfigured)
+			}
+			if policy.JudgeModel != "" {
+				modelID = policy.JudgeModel
+			}
+			unsupported, usage, err = v.judge(ctx, modelID, sentences, checked, sources)
+		case types.GroundednessMethodEmbedding:
+			if v.Embedder == nil {
+				return types.Groundedness{}, types.TokenUsage{}, fmt.Errorf("%w: no embedder", ErrNotConfigured)
+			}
+			minSimilarity := policy.MinSimilarity
+			if minSimilarity <= 0 {
+				minSimilarity = DefaultMinSimilarity
+			}
+			unsupported, err = v.compare(ctx, minSimilarity, sentences, checked, sources)
+		default:
+			return types.Groundedness{}, types.TokenUsage{}, fmt.Errorf("%w: unknown method %q", ErrInvalidPolicy, policy.Method)
+		}
+		if err != nil {
+			return types.Groundedness{}, types.TokenUsage{}, err
+		}
+	}
+
+	result := types.Groundedness{
+		Method:      policy.Method,
+		Score:       1,
+		Sentences:   len(checked),
+		Unsupported: unsupported,
+	}
+	if len(checked) > 0 {
+		result.Score = float64(len(checked)-len(unsupported)) / float64(len(checked))
+	}
+	result.Passed = result.Score >= policy.Threshold
+	if !result.Passed {
+		result.Action = policy.Action
+	}
+	return result, usage, nil
+}
+
+// Apply returns the answer to give for a verified one: a refusal or the answer followed by the
+// sentences the sources don't support, if it didn't pass, otherwise the answer as is.
+func Apply(policy types.GroundednessPolicy, answer string, result types.Groundedness) string {
+	if result.Passed {
+		return answer
+	}
+	if result.Action == types.GroundednessActionRefuse {
+		if policy.RefusalMessage != "" {
+			return policy.RefusalMessage
+		}
+		return DefaultRefusal
+	}
+
+	var note strings.Builder
+	note.WriteString(strings.TrimRight(answer, "\n "))
+	note.WriteString("\n\nNote: the sources don't support these statements:")
+	for _, sentence := range result.Unsupported {
+		note.WriteString("\n- ")
+		note.WriteString(sentence.Text)
+	}
+	return note.String()
+}
+
+// ValidatePolicy checks what the request validation can't: that the judge model is supported.
+func ValidatePolicy(policy types.GroundednessPolicy) error {
+	if policy.JudgeModel != "" && !llm.IsSupportedModel(policy.JudgeModel) {
+		return fmt.Errorf("%w: unsupported judge model %q", ErrInvalidPolicy, policy.JudgeModel)
+	}
+	if policy.MinSimilarity != 0 && policy.Method != types.GroundednessMethodEmbedding {
+		return fmt.Errorf("%w: min_similarity only applies to the embedding method", ErrInvalidPolicy)
+	}
+	return nil
+}
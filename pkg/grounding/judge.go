@@ -0,0 +1,77 @@
+package grounding
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+
+	"rag-demo/types"
+)
+
+var ErrJudgeReply = errors.New("the groundedness judge's reply could not be read")
+
+const judgeInstructions = `You check whether an answer is supported by the sources it was written from.
+For every numbered sentence of the answer, decide whether the sources state or directly imply it. General phrasing that makes no claim counts as supported.
+Reply with only a JSON array holding one object per sentence, e.g. [{"sentence": 1, "supported": true}, {"sentence": 2, "supported": false, "reason": "the sources don't mention the deductible"}].`
+
+type verdict struct {
+	Sentence  int    `json:"sentence"`
+	Supported bool   `json:"supported"`
+	Reason    string `json:"reason"`
+}
+
+// judge has the model decide which of the checked sentences the sources support, in one call.
+// A sentence the judge gives no verdict for counts as unsupported.
+func (v *Verifier) judge(ctx context.Context, modelID string, sentences []string, checked []int, sources []types.SearchHit) ([]types.UnsupportedSentence, types.TokenUsage, error) {
+	var prompt strings.Builder
+	prompt.WriteString("Sources:\n")
+	for i, source := range sources {
+		fmt.Fprintf(&prompt, "[%d] %s\n", i+1, source.Content)
+	}
+	prompt.WriteString("\nAnswer sentences:\n")
+	for n, i := range checked {
+		fmt.Fprintf(&prompt, "%d. %s\n", n+1, stripCitations(sentences[i]))
+	}
+
+	response, err := v.Model.Converse(ctx, types.LLMRequest{
+		ModelID:  modelID,
+		System:   judgeInstructions,
+		Messages: []types.LLMMessage{{Role: types.LLMRoleUser, Content: prompt.String()}},
+	})
+	if err != nil {
+		return nil, types.TokenUsage{}, fmt.Errorf("error judging groundedness: %w", err)
+	}
+	verdicts, err := parseVerdicts(response.Text)
+	if err != nil {
+		return nil, types.TokenUsage{}, err
+	}
+
+	var unsupported []types.UnsupportedSentence
+	for n, i := range checked {
+		found, ok := verdicts[n+1]
+		if ok && found.Supported {
+			continue
+		}
+		unsupported = append(unsupported, types.UnsupportedSentence{Index: i, Text: sentences[i], Reason: found.Reason})
+	}
+	return unsupported, response.Usage, nil
+}
+
+// parseVerdicts reads the JSON array of the judge's reply, ignoring any text around it.
+func parseVerdicts(reply string) (map[int]verdict, error) {
+	start, end := strings.Index(reply, "["), strings.LastIndex(reply, "]")
+	if start < 0 || end < start {
+		return nil, fmt.Errorf("%w: no JSON array in %q", ErrJudgeReply, reply)
+	}
+	var list []verdict
+	if err := json.Unmarshal([]byte(reply[start:end+1]), &list); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrJudgeReply, err)
+	}
+	verdicts := make(map[int]verdict, len(list))
+	for _, v := range list {
+		verdicts[v.Sentence] = v
+	}
+	return verdicts, nil
+}
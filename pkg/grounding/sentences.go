@@ -0,0 +1,77 @@
+package grounding
+
+import (
+	"regexp"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"rag-demo/pkg/search"
+)
+
+// minWords is how many words a sentence needs to be checked; shorter ones are headings or filler
+// like "In short:".
+const minWords = 3
+
+var citationMarker = regexp.MustCompile(`\s*\[\d+(?:\s*,\s*\d+)*\]`)
+
+// SplitSentences splits an answer into sentences, one per line at least. List markers are dropped
+// and code blocks are left out.
+func SplitSentences(text string) []string {
+	var sentences []string
+	add := func(sentence string) {
+		if sentence = strings.TrimSpace(sentence); sentence != "" {
+			sentences = append(sentences, sentence)
+		}
+	}
+
+	inCode := false
+	for _, line := range strings.Split(text, "\n") {
+		line = strings.TrimSpace(line)
+		if strings.HasPrefix(line, "```") {
+			inCode = !inCode
+			continue
+		}
+		if inCode {
+			continue
+		}
+		line = search.StripListMarker(line)
+
+		start := 0
+		for i := 0; i < len(line); i++ {
+			if c := line[i]; c != '.' && c != '!' && c != '?' {
+				continue
+			}
+			end := i + 1
+			if end < len(line) && line[end] != ' ' {
+				continue // inside a number like 3.5 or an ellipsis
+			}
+			next := end
+			for next < len(line) && line[next] == ' ' {
+				next++
+			}
+			// "e.g. the" doesn't end a sentence
+			if next < len(line) && !startsSentence(line[next:]) {
+				continue
+			}
+			add(line[start:end])
+			start = next
+		}
+		add(line[start:])
+	}
+	return sentences
+}
+
+func startsSentence(text string) bool {
+	r, _ := utf8.DecodeRuneInString(text)
+	return unicode.IsUpper(r) || unicode.IsDigit(r) || strings.ContainsRune(`"'“(*`, r)
+}
+
+// checkable reports whether a sentence is long enough to be checked.
+func checkable(sentence string) bool {
+	return len(strings.Fields(stripCitations(sentence))) >= minWords
+}
+
+func stripCitations(sentence string) string {
+	return strings.TrimSpace(citationMarker.ReplaceAllString(sentence, ""))
+}
@@ -0,0 +1,55 @@
+package grounding
+
+import (
+	"context"
+	"fmt"
+	"math"
+
+	"rag-demo/types"
+)
+
+// compare embeds the sources and the checked sentences and counts a sentence as supported when it is
+// at least minSimilarity similar to one of the sources.
+func (v *Verifier) compare(ctx context.Context, minSimilarity float64, sentences []string, checked []int, sources []types.SearchHit) ([]types.UnsupportedSentence, error) {
+	embedded := make([][]float32, 0, len(sources))
+	for _, source := range sources {
+		embedding, err := v.Embedder.EmbedText(ctx, source.Content)
+		if err != nil {
+			return nil, fmt.Errorf("error embedding source: %w", err)
+		}
+		embedded = append(embedded, embedding)
+	}
+
+	var unsupported []types.UnsupportedSentence
+	for _, i := range checked {
+		embedding, err := v.Embedder.EmbedText(ctx, stripCitations(sentences[i]))
+		if err != nil {
+			return nil, fmt.Errorf("error embedding sentence: %w", err)
+		}
+		best := 0.0
+		for _, source := range embedded {
+			best = math.Max(best, cosine(embedding, source))
+		}
+		if best < minSimilarity {
+			unsupported = append(unsupported, types.UnsupportedSentence{Index: i, Text: sentences[i]})
+		}
+	}
+	return unsupported, nil
+}
+
+// cosine is the cosine similarity of two vectors, 0 if either is zero or their lengths differ.
+func cosine(a []float32, b []float32) float64 {
+	if len(a) != len(b) {
+		return 0
+	}
+	var dot, normA, normB float64
+	for i := range a {
+		dot += float64(a[i]) * float64(b[i])
+		normA += float64(a[i]) * float64(a[i])
+		normB += float64(b[i]) * float64(b[i])
+	}
+	if normA == 0 || normB == 0 {
+		return 0
+	}
+	return dot / (math.Sqrt(normA) * math.Sqrt(normB))
+}
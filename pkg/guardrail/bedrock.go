@@ -0,0 +1,124 @@
+package guardrail
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/bedrockruntime"
+	brtypes "github.com/aws/aws-sdk-go-v2/service/bedrockruntime/types"
+	"rag-demo/types"
+)
+
+// ApplyGuardrailAPI is the part of the Bedrock runtime client the Bedrock guardrail uses.
+type ApplyGuardrailAPI interface {
+	ApplyGuardrail(ctx context.Context, params *bedrockruntime.ApplyGuardrailInput, optFns ...func(*bedrockruntime.Options)) (*bedrockruntime.ApplyGuardrailOutput, error)
+}
+
+// Bedrock checks content with the Bedrock guardrail named by the policy, if any, through the
+// ApplyGuardrail API. The guardrail's own configuration decides what is blocked or masked.
+type Bedrock struct {
+	Client ApplyGuardrailAPI
+}
+
+func NewBedrock(client ApplyGuardrailAPI) *Bedrock {
+	return &Bedrock{Client: client}
+}
+
+func (b *Bedrock) Check(ctx context.Context, policy types.GuardrailPolicy, source string, content string) (types.GuardrailResult, string, error) {
+	result := types.GuardrailResult{Source: source, Action: types.GuardrailActionNone}
+	if policy.BedrockGuardrailID == "" || content == "" {
+		return result, content, nil
+	}
+
+	version := policy.BedrockGuardrailVersion
+	if version == "" {
+		version = "DRAFT"
+	}
+	contentSource := brtypes.GuardrailContentSourceOutput
+	if source == types.GuardrailSourceInput {
+		contentSource = brtypes.GuardrailContentSourceInput
+	}
+	output, err := b.Client.ApplyGuardrail(ctx, &bedrockruntime.ApplyGuardrailInput{
+		GuardrailIdentifier: aws.String(policy.BedrockGuardrailID),
+		GuardrailVersion:    aws.String(version),
+		Source:              contentSource,
+		Content: []brtypes.GuardrailContentBlock{
+			&brtypes.GuardrailContentBlockMemberText{Value: brtypes.GuardrailTextBlock{Text: aws.String(content)}},
+		},
+	})
+	if err != nil {
+		return types.GuardrailResult{}, "", fmt.Errorf("error applying Bedrock guardrail: %w", err)
+	}
+	if output.Action != brtypes.GuardrailActionGuardrailIntervened {
+		return result, content, nil
+	}
+
+	isBlocked := false
+	for _, assessment := range output.Assessments {
+		violations, blocks := assessmentViolations(assessment)
+		result.Violations = append(result.Violations, violations...)
+		isBlocked = isBlocked || blocks
+	}
+
+	var text string
+	for _, out := range output.Outputs {
+		text += aws.ToString(out.Text)
+	}
+	if isBlocked {
+		result.Action = types.GuardrailActionBlocked
+		// the policy's message wins over the one configured in Bedrock, so answers read the same with either guardrail
+		result.Message = policy.BlockedInputMessage
+		if source == types.GuardrailSourceOutput {
+			result.Message = policy.BlockedOutputMessage
+		}
+		if result.Message == "" && text != "" {
+			result.Message = text
+		}
+		if result.Message == "" {
+			result.Message = BlockedMessage(policy, source)
+		}
+		return result, result.Message, nil
+	}
+	result.Action = types.GuardrailActionMasked
+	return result, text, nil
+}
+
+// assessmentViolations lists the policies that acted in an assessment and whether any of them blocked;
+// the others anonymized.
+func assessmentViolations(assessment brtypes.GuardrailAssessment) ([]types.GuardrailViolation, bool) {
+	var violations []types.GuardrailViolation
+	blocks := false
+	add := func(policyType string, name string, action string) {
+		violations = append(violations, types.GuardrailViolation{Type: policyType, Name: name})
+		blocks = blocks || action == "BLOCKED"
+	}
+
+	if policy := assessment.TopicPolicy; policy != nil {
+		for _, topic := range policy.Topics {
+			add("topic", aws.ToString(topic.Name), string(topic.Action))
+		}
+	}
+	if policy := assessment.ContentPolicy; policy != nil {
+		for _, filter := range policy.Filters {
+			add("content_filter", string(filter.Type), string(filter.Action))
+		}
+	}
+	if policy := assessment.WordPolicy; policy != nil {
+		for _, word := range policy.CustomWords {
+			add("denied_word", aws.ToString(word.Match), string(word.Action))
+		}
+		for _, word := range policy.ManagedWordLists {
+			add("managed_word", string(word.Type), string(word.Action))
+		}
+	}
+	if policy := assessment.SensitiveInformationPolicy; policy != nil {
+		for _, entity := range policy.PiiEntities {
+			add("pii", string(entity.Type), string(entity.Action))
+		}
+		for _, regex := range policy.Regexes {
+			add("regex", aws.ToString(regex.Name), string(regex.Action))
+		}
+	}
+	return violations, blocks
+}
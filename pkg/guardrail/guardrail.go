@@ -0,0 +1,98 @@
+package guardrail
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+
+	"rag-demo/types"
+)
+
+const (
+	DefaultBlockedInputMessage  = "Sorry, I can't help with that request."
+	DefaultBlockedOutputMessage = "Sorry, I can't share that answer."
+)
+
+var ErrInvalidPolicy = errors.New("invalid guardrail policy")
+
+// Guardrail checks a user's message or an answer against an assistant's policy. It returns what it
+// found and the content to continue with: the original, or a masked copy when it masked. Content a
+// guardrail doesn't check is returned with GuardrailActionNone.
+type Guardrail interface {
+	Check(ctx context.Context, policy types.GuardrailPolicy, source string, content string) (types.GuardrailResult, string, error)
+}
+
+// Pipeline runs guardrails in order, each checking the content the previous one let through, and
+// stops at the first that blocks. Its result combines the violations of all of them.
+type Pipeline struct {
+	Guardrails []Guardrail
+}
+
+func NewPipeline(guardrails ...Guardrail) *Pipeline {
+	return &Pipeline{Guardrails: guardrails}
+}
+
+func (p *Pipeline) Check(ctx context.Context, policy types.GuardrailPolicy, source string, content string) (types.GuardrailResult, string, error) {
+	combined := types.GuardrailResult{Source: source, Action: types.GuardrailActionNone}
+	for _, guardrail := range p.Guardrails {
+		result, checked, err := guardrail.Check(ctx, policy, source, content)
+		if err != nil {
+			return types.GuardrailResult{}, "", err
+		}
+		combined.Violations = append(combined.Violations, result.Violations...)
+		switch result.Action {
+		case types.GuardrailActionBlocked:
+			combined.Action = types.GuardrailActionBlocked
+			combined.Message = result.Message
+			return combined, result.Message, nil
+		case types.GuardrailActionMasked:
+			combined.Action = types.GuardrailActionMasked
+			content = checked
+		}
+	}
+	return combined, content, nil
+}
+
+// BlockedMessage is what replaces blocked content from the given source.
+func BlockedMessage(policy types.GuardrailPolicy, source string) string {
+	if source == types.GuardrailSourceInput {
+		if policy.BlockedInputMessage != "" {
+			return policy.BlockedInputMessage
+		}
+		return DefaultBlockedInputMessage
+	}
+	if policy.BlockedOutputMessage != "" {
+		return policy.BlockedOutputMessage
+	}
+	return DefaultBlockedOutputMessage
+}
+
+// ValidatePolicy checks what the request validation can't: that the PII detectors exist, that the
+// topics and words aren't blank and that a Bedrock guardrail version comes with its id.
+func ValidatePolicy(policy types.GuardrailPolicy) error {
+	for _, name := range policy.PII {
+		if _, ok := Detectors[name]; !ok {
+			return fmt.Errorf("%w: unknown PII detector %q", ErrInvalidPolicy, name)
+		}
+	}
+	for _, word := range policy.DeniedWords {
+		if strings.TrimSpace(word) == "" {
+			return fmt.Errorf("%w: denied words must not be blank", ErrInvalidPolicy)
+		}
+	}
+	for _, topic := range policy.BlockedTopics {
+		if strings.TrimSpace(topic.Name) == "" || len(topic.Keywords) == 0 {
+			return fmt.Errorf("%w: blocked topics need a name and keywords", ErrInvalidPolicy)
+		}
+		for _, keyword := range topic.Keywords {
+			if strings.TrimSpace(keyword) == "" {
+				return fmt.Errorf("%w: keywords of topic %q must not be blank", ErrInvalidPolicy, topic.Name)
+			}
+		}
+	}
+	if policy.BedrockGuardrailVersion != "" && policy.BedrockGuardrailID == "" {
+		return fmt.Errorf("%w: bedrock_guardrail_version needs bedrock_guardrail_id", ErrInvalidPolicy)
+	}
+	return nil
+}
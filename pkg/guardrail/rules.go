@@ -0,0 +1,155 @@
+package guardrail
+
+import (
+	"context"
+	"regexp"
+	"sort"
+	"strings"
+
+	"rag-demo/types"
+)
+
+// Detector finds one kind of PII. Valid, when set, filters out matches of the pattern that aren't
+// real values, such as digit runs that fail a card checksum.
+type Detector struct {
+	Pattern *regexp.Regexp
+	Valid   func(match string) bool
+	Mask    string // replaces a match when the policy masks PII
+}
+
+// Detectors are the PII detectors policies can enable by name.
+var Detectors = map[string]Detector{
+	"email": {
+		Pattern: regexp.MustCompile(`[A-Za-z0-9._%+-]+@[A-Za-z0-9.-]+\.[A-Za-z]{2,}`),
+		Mask:    "[EMAIL]",
+	},
+	"phone": {
+		Pattern: regexp.MustCompile(`(?:\+\d{1,3}[\s.-]?)?(?:\(\d{1,4}\)[\s.-]?)?\b\d{2,4}[\s.-]\d{3}[\s.-]\d{3,4}\b`),
+		Mask:    "[PHONE]",
+	},
+	"credit_card": {
+		Pattern: regexp.MustCompile(`\b\d(?:[ -]?\d){12,18}\b`),
+		Valid:   luhn,
+		Mask:    "[CREDIT_CARD]",
+	},
+	"us_ssn": {
+		Pattern: regexp.MustCompile(`\b\d{3}-\d{2}-\d{4}\b`),
+		Mask:    "[SSN]",
+	},
+	"iban": {
+		Pattern: regexp.MustCompile(`\b[A-Z]{2}\d{2}(?: ?[A-Z0-9]{4}){2,7}(?: ?[A-Z0-9]{1,3})?\b`),
+		Mask:    "[IBAN]",
+	},
+	"ip_address": {
+		Pattern: regexp.MustCompile(`\b(?:(?:25[0-5]|2[0-4]\d|1?\d?\d)\.){3}(?:25[0-5]|2[0-4]\d|1?\d?\d)\b`),
+		Mask:    "[IP_ADDRESS]",
+	},
+}
+
+// Rules applies a policy's deny-list, blocked topics and PII detectors locally, without calling out.
+type Rules struct{}
+
+func NewRules() *Rules {
+	return &Rules{}
+}
+
+// Check blocks content with a denied word or a blocked topic's keyword, then blocks or masks the PII
+// the policy's detectors find.
+func (r *Rules) Check(ctx context.Context, policy types.GuardrailPolicy, source string, content string) (types.GuardrailResult, string, error) {
+	result := types.GuardrailResult{Source: source, Action: types.GuardrailActionNone}
+
+	for _, word := range policy.DeniedWords {
+		if containsWord(content, word) {
+			result.Violations = append(result.Violations, types.GuardrailViolation{Type: "denied_word", Name: word})
+		}
+	}
+	for _, topic := range policy.BlockedTopics {
+		for _, keyword := range topic.Keywords {
+			if containsWord(content, keyword) {
+				result.Violations = append(result.Violations, types.GuardrailViolation{Type: "topic", Name: topic.Name})
+				break
+			}
+		}
+	}
+	if len(result.Violations) > 0 {
+		return blocked(result, policy), BlockedMessage(policy, source), nil
+	}
+
+	names := append([]string{}, policy.PII...)
+	sort.Strings(names)
+	masked := content
+	for _, name := range names {
+		detector, ok := Detectors[name]
+		if !ok {
+			continue
+		}
+		found := false
+		masked = detector.Pattern.ReplaceAllStringFunc(masked, func(match string) string {
+			if detector.Valid != nil && !detector.Valid(match) {
+				return match
+			}
+			found = true
+			return detector.Mask
+		})
+		if found {
+			result.Violations = append(result.Violations, types.GuardrailViolation{Type: "pii", Name: name})
+		}
+	}
+	switch {
+	case len(result.Violations) == 0:
+		return result, content, nil
+	case !policy.MaskPII:
+		return blocked(result, policy), BlockedMessage(policy, source), nil
+	default:
+		result.Action = types.GuardrailActionMasked
+		return result, masked, nil
+	}
+}
+
+func blocked(result types.GuardrailResult, policy types.GuardrailPolicy) types.GuardrailResult {
+	result.Action = types.GuardrailActionBlocked
+	result.Message = BlockedMessage(policy, result.Source)
+	return result
+}
+
+// containsWord reports whether the phrase occurs in content as whole words, ignoring case.
+func containsWord(content string, phrase string) bool {
+	phrase = strings.TrimSpace(phrase)
+	if phrase == "" {
+		return false
+	}
+	pattern := regexp.QuoteMeta(phrase)
+	// \b only applies next to word characters, e.g. not around "$$$"
+	if isWordChar(phrase[0]) {
+		pattern = `\b` + pattern
+	}
+	if isWordChar(phrase[len(phrase)-1]) {
+		pattern += `\b`
+	}
+	return regexp.MustCompile(`(?i)` + pattern).MatchString(content)
+}
+
+func isWordChar(c byte) bool {
+	return c == '_' || ('0' <= c && c <= '9') || ('a' <= c && c <= 'z') || ('A' <= c && c <= 'Z')
+}
+
+// luhn checks the card number checksum, ignoring separators.
+func luhn(number string) bool {
+	sum, digits := 0, 0
+	for i := len(number) - 1; i >= 0; i-- {
+		c := number[i]
+		if c < '0' || c > '9' {
+			continue
+		}
+		d := int(c - '0')
+		if digits%2 == 1 {
+			d *= 2
+			if d > 9 {
+				d -= 9
+			}
+		}
+		sum += d
+		digits++
+	}
+	return digits >= 13 && sum%10 == 0
+}
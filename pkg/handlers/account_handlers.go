@@ -0,0 +1,150 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"rag-demo/pkg/auth"
+	"rag-demo/types"
+	"sync"
+)
+
+// writeAccountError maps the account service's errors to responses; unexpected ones are logged.
+func writeAccountError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, auth.ErrInvalidCredentials):
+		http.Error(w, err.Error(), http.StatusUnauthorized)
+	case errors.Is(err, auth.ErrAccountLocked):
+		// only the owner changing their password sees this; logins of locked accounts fail like wrong passwords
+		http.Error(w, err.Error(), http.StatusLocked)
+	case errors.Is(err, auth.ErrEmailTaken), errors.Is(err, auth.ErrNoPassword):
+		http.Error(w, err.Error(), http.StatusConflict)
+	case errors.Is(err, auth.ErrInvalidResetToken), errors.Is(err, auth.ErrPasswordTooLong):
+		http.Error(w, err.Error(), http.StatusBadRequest)
+	default:
+		fmt.Println("Error in account request: ", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+	}
+}
+
+// HandleLogin logs a user in with their email and password, issuing an access token like signup.
+// Accounts are locked for a while after repeated failures.
+func HandleLogin(authService auth.AuthService, accountService auth.AccountService) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var loginReq types.LoginRequest
+		err := decodeAndValidateJSON(r.Body, &loginReq)
+		if err != nil {
+			http.Error(w, "Invalid request body", http.StatusBadRequest)
+			return
+		}
+
+		resultCh := make(types.ResultChannel, 1)
+		wg := &sync.WaitGroup{}
+		wg.Add(1)
+
+		go accountService.Login(r.Context(), loginReq, resultCh, wg)
+
+		wg.Wait()
+		result := <-resultCh
+
+		if !result.Success {
+			writeAccountError(w, result.Error)
+			return
+		}
+		user, ok := result.Data.(types.User)
+		if !ok {
+			http.Error(w, "Internal server error", http.StatusInternalServerError)
+			return
+		}
+		writeLogin(w, r, authService, user)
+	}
+}
+
+// HandleChangePassword changes the authenticated user's password after checking their current one and
+// responds with a new token, as tokens issued before the change are no longer accepted.
+func HandleChangePassword(authService auth.AuthService, accountService auth.AccountService) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		user, ok := authenticate(w, r)
+		if !ok {
+			return
+		}
+
+		var changeReq types.ChangePasswordRequest
+		err := decodeAndValidateJSON(r.Body, &changeReq)
+		if err != nil {
+			http.Error(w, "Invalid request body", http.StatusBadRequest)
+			return
+		}
+
+		resultCh := make(types.ResultChannel, 1)
+		wg := &sync.WaitGroup{}
+		wg.Add(1)
+
+		go accountService.ChangePassword(r.Context(), user.UserID, changeReq, resultCh, wg)
+
+		wg.Wait()
+		result := <-resultCh
+
+		if !result.Success {
+			writeAccountError(w, result.Error)
+			return
+		}
+		// the change revokes the token of this request, so the caller gets a new one
+		writeLogin(w, r, authService, user)
+	}
+}
+
+// HandleRequestPasswordReset sends a password reset token to the email if it has an account. The
+// response is the same either way.
+func HandleRequestPasswordReset(accountService auth.AccountService) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var resetReq types.PasswordResetRequest
+		err := decodeAndValidateJSON(r.Body, &resetReq)
+		if err != nil {
+			http.Error(w, "Invalid request body", http.StatusBadRequest)
+			return
+		}
+
+		resultCh := make(types.ResultChannel, 1)
+		wg := &sync.WaitGroup{}
+		wg.Add(1)
+
+		go accountService.RequestPasswordReset(r.Context(), resetReq, resultCh, wg)
+
+		wg.Wait()
+		result := <-resultCh
+
+		if !result.Success {
+			writeAccountError(w, result.Error)
+			return
+		}
+		w.WriteHeader(http.StatusAccepted)
+	}
+}
+
+// HandleResetPassword sets a new password with a reset token.
+func HandleResetPassword(accountService auth.AccountService) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var resetReq types.ResetPasswordRequest
+		err := decodeAndValidateJSON(r.Body, &resetReq)
+		if err != nil {
+			http.Error(w, "Invalid request body", http.StatusBadRequest)
+			return
+		}
+
+		resultCh := make(types.ResultChannel, 1)
+		wg := &sync.WaitGroup{}
+		wg.Add(1)
+
+		go accountService.ResetPassword(r.Context(), resetReq, resultCh, wg)
+
+		wg.Wait()
+		result := <-resultCh
+
+		if !result.Success {
+			writeAccountError(w, result.Error)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+	}
+}
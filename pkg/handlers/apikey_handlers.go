@@ -0,0 +1,116 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"rag-demo/pkg/auth"
+	"rag-demo/types"
+	"sync"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/google/uuid"
+)
+
+// HandleCreateAPIKey creates an API key for the authenticated user and returns it, the only time the
+// key is shown. Keys can't be created with an API key, so a leaked one can't be used to make more.
+func HandleCreateAPIKey(apiKeyService auth.APIKeyService) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		user, ok := authenticate(w, r)
+		if !ok {
+			return
+		}
+		if _, ok := auth.APIKeyFrom(r.Context()); ok {
+			http.Error(w, "API keys can't create API keys", http.StatusForbidden)
+			return
+		}
+
+		var req types.NewAPIKeyRequest
+		if err := decodeAndValidateJSON(r.Body, &req); err != nil {
+			http.Error(w, "Invalid request body", http.StatusBadRequest)
+			return
+		}
+
+		resultCh := make(types.ResultChannel, 1)
+		wg := &sync.WaitGroup{}
+		wg.Add(1)
+
+		go apiKeyService.CreateAPIKey(r.Context(), user.UserID, req, resultCh, wg)
+
+		wg.Wait()
+		result := <-resultCh
+
+		if !result.Success {
+			fmt.Println("Error creating API key: ", result.Error)
+			http.Error(w, "error creating API key", http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusCreated)
+		json.NewEncoder(w).Encode(result.Data)
+	}
+}
+
+// HandleListAPIKeys lists the authenticated user's API keys by name and prefix.
+func HandleListAPIKeys(apiKeyService auth.APIKeyService) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		user, ok := authenticate(w, r)
+		if !ok {
+			return
+		}
+
+		resultCh := make(types.ResultChannel, 1)
+		wg := &sync.WaitGroup{}
+		wg.Add(1)
+
+		go apiKeyService.ListAPIKeys(r.Context(), user.UserID, resultCh, wg)
+
+		wg.Wait()
+		result := <-resultCh
+
+		if !result.Success {
+			fmt.Println("Error listing API keys: ", result.Error)
+			http.Error(w, "error listing API keys", http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(result.Data)
+	}
+}
+
+// HandleDeleteAPIKey revokes the authenticated user's API key named by the {id} URL parameter.
+func HandleDeleteAPIKey(apiKeyService auth.APIKeyService) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		user, ok := authenticate(w, r)
+		if !ok {
+			return
+		}
+
+		keyID, err := uuid.Parse(chi.URLParam(r, "id"))
+		if err != nil {
+			http.Error(w, "Invalid API key id", http.StatusBadRequest)
+			return
+		}
+
+		resultCh := make(types.ResultChannel, 1)
+		wg := &sync.WaitGroup{}
+		wg.Add(1)
+
+		go apiKeyService.DeleteAPIKey(r.Context(), user.UserID, keyID, resultCh, wg)
+
+		wg.Wait()
+		result := <-resultCh
+
+		switch {
+		case result.Success:
+			w.WriteHeader(http.StatusOK)
+			w.Write([]byte("API key deleted successfully"))
+		case errors.Is(result.Error, auth.ErrAPIKeyNotFound):
+			http.Error(w, result.Error.Error(), http.StatusNotFound)
+		default:
+			fmt.Println("Error deleting API key: ", result.Error)
+			http.Error(w, "error deleting API key", http.StatusInternalServerError)
+		}
+	}
+}
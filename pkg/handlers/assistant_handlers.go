@@ -0,0 +1,413 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"rag-demo/pkg/assistant"
+	"rag-demo/types"
+	"strconv"
+	"sync"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+)
+
+// writeAssistantError maps assistant service errors to responses: validation failures are the
+// client's fault, everything else is a server error.
+func writeAssistantError(w http.ResponseWriter, err error, action string) {
+	switch {
+	case errors.Is(err, assistant.ErrNameTaken):
+		http.Error(w, err.Error(), http.StatusConflict)
+	case errors.Is(err, assistant.ErrUnsupportedModel), errors.Is(err, assistant.ErrInvalidPrompts), errors.Is(err, assistant.ErrInvalidTemplate),
+		errors.Is(err, assistant.ErrInvalidTools), errors.Is(err, assistant.ErrInvalidGuardrails),
+		errors.Is(err, assistant.ErrInvalidGroundedness):
+		http.Error(w, err.Error(), http.StatusBadRequest)
+	case errors.Is(err, assistant.ErrKbaseNotFound), errors.Is(err, assistant.ErrPromptVersionNotFound):
+		http.Error(w, err.Error(), http.StatusNotFound)
+	case err == nil, errors.Is(err, pgx.ErrNoRows):
+		http.Error(w, "assistant not found", http.StatusNotFound)
+	default:
+		fmt.Println("Error "+action+" assistant: ", err)
+		http.Error(w, "error "+action+" assistant", http.StatusInternalServerError)
+	}
+}
+
+func assistantFromRequest(id uuid.UUID, req types.NewAssistantRequest) types.Assistant {
+	return types.Assistant{
+		ID:            id,
+		Name:          req.Name,
+		Model:         req.Model,
+		Type:          req.Type,
+		SystemPrompts: req.SystemPrompts,
+		Tools:         req.Tools,
+		Guardrails:    req.Guardrails,
+		Groundedness:  req.Groundedness,
+		Metadata:      req.Metadata,
+	}
+}
+
+func HandleCreateAssistant(assistantService assistant.AssistantService) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var newAssistantReq types.NewAssistantRequest
+		err := decodeAndValidateJSON(r.Body, &newAssistantReq)
+		if err != nil {
+			http.Error(w, "Invalid request body", http.StatusBadRequest)
+			return
+		}
+
+		resultCh := make(types.ResultChannel, 1)
+		wg := &sync.WaitGroup{}
+		wg.Add(1)
+
+		go assistantService.CreateAssistant(r.Context(), assistantFromRequest(uuid.New(), newAssistantReq), resultCh, wg)
+
+		wg.Wait()
+		result := <-resultCh
+
+		if !result.Success {
+			writeAssistantError(w, result.Error, "creating")
+			return
+		}
+
+		created, ok := result.Data.(types.Assistant)
+		if !ok {
+			http.Error(w, "Internal server error", http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusCreated)
+		json.NewEncoder(w).Encode(created)
+	}
+}
+
+func HandleListAssistants(assistantService assistant.AssistantService) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		resultCh := make(types.ResultChannel, 1)
+		wg := &sync.WaitGroup{}
+		wg.Add(1)
+
+		go assistantService.ListAssistants(r.Context(), resultCh, wg)
+
+		wg.Wait()
+		result := <-resultCh
+
+		if !result.Success {
+			fmt.Println("Error: ", result.Error)
+			http.Error(w, "error listing assistants", http.StatusInternalServerError)
+			return
+		}
+
+		assistants, ok := result.Data.(types.AssistantList)
+		if !ok {
+			http.Error(w, "Internal server error", http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(assistants)
+	}
+}
+
+func HandleGetAssistant(assistantService assistant.AssistantService) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		assistantID, err := uuid.Parse(chi.URLParam(r, "id"))
+		if err != nil {
+			http.Error(w, "Invalid assistant id", http.StatusBadRequest)
+			return
+		}
+
+		resultCh := make(types.ResultChannel, 1)
+		wg := &sync.WaitGroup{}
+		wg.Add(1)
+
+		go assistantService.GetAssistant(r.Context(), assistantID, resultCh, wg)
+
+		wg.Wait()
+		result := <-resultCh
+
+		if !result.Success {
+			writeAssistantError(w, result.Error, "loading")
+			return
+		}
+
+		found, ok := result.Data.(types.Assistant)
+		if !ok {
+			http.Error(w, "Internal server error", http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(found)
+	}
+}
+
+// HandleUpdateAssistant replaces the configuration of an assistant.
+func HandleUpdateAssistant(assistantService assistant.AssistantService) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		assistantID, err := uuid.Parse(chi.URLParam(r, "id"))
+		if err != nil {
+			http.Error(w, "Invalid assistant id", http.StatusBadRequest)
+			return
+		}
+
+		var updateReq types.NewAssistantRequest
+		err = decodeAndValidateJSON(r.Body, &updateReq)
+		if err != nil {
+			http.Error(w, "Invalid request body", http.StatusBadRequest)
+			return
+		}
+
+		resultCh := make(types.ResultChannel, 1)
+		wg := &sync.WaitGroup{}
+		wg.Add(1)
+
+		go assistantService.UpdateAssistant(r.Context(), assistantFromRequest(assistantID, updateReq), resultCh, wg)
+
+		wg.Wait()
+		result := <-resultCh
+
+		if !result.Success {
+			writeAssistantError(w, result.Error, "updating")
+			return
+		}
+
+		updated, ok := result.Data.(types.Assistant)
+		if !ok {
+			http.Error(w, "Internal server error", http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(updated)
+	}
+}
+
+func HandleDeleteAssistant(assistantService assistant.AssistantService) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		assistantID, err := uuid.Parse(chi.URLParam(r, "id"))
+		if err != nil {
+			http.Error(w, "Invalid assistant id", http.StatusBadRequest)
+			return
+		}
+
+		resultCh := make(types.ResultChannel, 1)
+		wg := &sync.WaitGroup{}
+		wg.Add(1)
+
+		go assistantService.DeleteAssistant(r.Context(), assistantID, resultCh, wg)
+
+		wg.Wait()
+		result := <-resultCh
+
+		if !result.Success {
+			writeAssistantError(w, result.Error, "deleting")
+			return
+		}
+
+		w.WriteHeader(http.StatusOK)
+		w.Write([]byte("Assistant deleted successfully"))
+	}
+}
+
+// parseAssistantKbaseIDs reads the {id} and {kbase_id} URL parameters and writes an error response if they are invalid.
+func parseAssistantKbaseIDs(w http.ResponseWriter, r *http.Request) (uuid.UUID, uuid.UUID, bool) {
+	assistantID, err := uuid.Parse(chi.URLParam(r, "id"))
+	if err != nil {
+		http.Error(w, "Invalid assistant id", http.StatusBadRequest)
+		return uuid.Nil, uuid.Nil, false
+	}
+	kbaseID, err := uuid.Parse(chi.URLParam(r, "kbase_id"))
+	if err != nil {
+		http.Error(w, "Invalid kbase id", http.StatusBadRequest)
+		return uuid.Nil, uuid.Nil, false
+	}
+	return assistantID, kbaseID, true
+}
+
+// HandleAttachKbase attaches a kbase to an assistant, or updates the retrieval settings of the link.
+func HandleAttachKbase(assistantService assistant.AssistantService) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		assistantID, kbaseID, ok := parseAssistantKbaseIDs(w, r)
+		if !ok {
+			return
+		}
+
+		var attachReq types.AttachKbaseRequest
+		err := decodeAndValidateJSON(r.Body, &attachReq)
+		if err != nil {
+			http.Error(w, "Invalid request body", http.StatusBadRequest)
+			return
+		}
+
+		link := types.AssistantKbase{
+			AssistantID:   assistantID,
+			KbaseID:       kbaseID,
+			TopK:          attachReq.TopK,
+			MinSimilarity: attachReq.MinSimilarity,
+		}
+		if attachReq.Weight != nil {
+			link.Weight = *attachReq.Weight
+		}
+
+		resultCh := make(types.ResultChannel, 1)
+		wg := &sync.WaitGroup{}
+		wg.Add(1)
+
+		go assistantService.AttachKbase(r.Context(), link, resultCh, wg)
+
+		wg.Wait()
+		result := <-resultCh
+
+		if !result.Success {
+			writeAssistantError(w, result.Error, "attaching kbase to")
+			return
+		}
+
+		attached, ok := result.Data.(types.AssistantKbase)
+		if !ok {
+			http.Error(w, "Internal server error", http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(attached)
+	}
+}
+
+func HandleDetachKbase(assistantService assistant.AssistantService) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		assistantID, kbaseID, ok := parseAssistantKbaseIDs(w, r)
+		if !ok {
+			return
+		}
+
+		resultCh := make(types.ResultChannel, 1)
+		wg := &sync.WaitGroup{}
+		wg.Add(1)
+
+		go assistantService.DetachKbase(r.Context(), assistantID, kbaseID, resultCh, wg)
+
+		wg.Wait()
+		result := <-resultCh
+
+		if result.Success {
+			w.WriteHeader(http.StatusOK)
+			w.Write([]byte("Kbase detached successfully"))
+		} else if result.Error == nil {
+			http.Error(w, "kbase is not attached to this assistant", http.StatusNotFound)
+		} else {
+			fmt.Println("Error detaching kbase: ", result.Error)
+			http.Error(w, "error detaching kbase", http.StatusInternalServerError)
+		}
+	}
+}
+
+func HandleListAssistantKbases(assistantService assistant.AssistantService) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		assistantID, err := uuid.Parse(chi.URLParam(r, "id"))
+		if err != nil {
+			http.Error(w, "Invalid assistant id", http.StatusBadRequest)
+			return
+		}
+
+		resultCh := make(types.ResultChannel, 1)
+		wg := &sync.WaitGroup{}
+		wg.Add(1)
+
+		go assistantService.ListKbases(r.Context(), assistantID, resultCh, wg)
+
+		wg.Wait()
+		result := <-resultCh
+
+		if !result.Success {
+			writeAssistantError(w, result.Error, "listing kbases of")
+			return
+		}
+
+		links, ok := result.Data.([]types.AssistantKbase)
+		if !ok {
+			http.Error(w, "Internal server error", http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]interface{}{"kbases": links})
+	}
+}
+
+// HandleListPromptVersions returns the prompt history of an assistant, newest version first.
+func HandleListPromptVersions(assistantService assistant.AssistantService) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		assistantID, err := uuid.Parse(chi.URLParam(r, "id"))
+		if err != nil {
+			http.Error(w, "Invalid assistant id", http.StatusBadRequest)
+			return
+		}
+
+		resultCh := make(types.ResultChannel, 1)
+		wg := &sync.WaitGroup{}
+		wg.Add(1)
+
+		go assistantService.ListPromptVersions(r.Context(), assistantID, resultCh, wg)
+
+		wg.Wait()
+		result := <-resultCh
+
+		if !result.Success {
+			writeAssistantError(w, result.Error, "listing prompt versions of")
+			return
+		}
+
+		versions, ok := result.Data.([]types.PromptVersion)
+		if !ok {
+			http.Error(w, "Internal server error", http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]interface{}{"versions": versions})
+	}
+}
+
+// HandleRollbackPrompt makes the {version} prompt version the assistant's system prompt again.
+func HandleRollbackPrompt(assistantService assistant.AssistantService) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		assistantID, err := uuid.Parse(chi.URLParam(r, "id"))
+		if err != nil {
+			http.Error(w, "Invalid assistant id", http.StatusBadRequest)
+			return
+		}
+		version, err := strconv.Atoi(chi.URLParam(r, "version"))
+		if err != nil || version < 1 {
+			http.Error(w, "Invalid prompt version", http.StatusBadRequest)
+			return
+		}
+
+		resultCh := make(types.ResultChannel, 1)
+		wg := &sync.WaitGroup{}
+		wg.Add(1)
+
+		go assistantService.RollbackPrompt(r.Context(), assistantID, version, resultCh, wg)
+
+		wg.Wait()
+		result := <-resultCh
+
+		if !result.Success {
+			writeAssistantError(w, result.Error, "rolling back prompt of")
+			return
+		}
+
+		updated, ok := result.Data.(types.Assistant)
+		if !ok {
+			http.Error(w, "Internal server error", http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(updated)
+	}
+}
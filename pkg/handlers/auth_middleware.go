@@ -0,0 +1,53 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"rag-demo/pkg/auth"
+	"rag-demo/types"
+)
+
+// apiKeyHeader carries the API key of requests made with one instead of an access token.
+const apiKeyHeader = "x-api-key"
+
+// RequireAuth is chi middleware that rejects requests without a valid access token or API key with 401
+// and puts their user into the request's context for the handlers behind it. Requests made with an API
+// key carry the key in the context as well. A nil apiKeyService accepts access tokens only.
+func RequireAuth(authService auth.AuthService, apiKeyService auth.APIKeyService) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if apiKeyService != nil && r.Header.Get(apiKeyHeader) != "" {
+				key, user, err := validateAPIKey(r, apiKeyService)
+				if err != nil {
+					http.Error(w, "Invalid API key", http.StatusUnauthorized)
+					return
+				}
+				ctx := auth.WithAPIKey(auth.WithUser(r.Context(), user), key)
+				next.ServeHTTP(w, r.WithContext(ctx))
+				return
+			}
+
+			token, err := ExtractAccessToken(r)
+			if err != nil {
+				http.Error(w, "Invalid access-token", http.StatusUnauthorized)
+				return
+			}
+			user, err := authService.ValidateJWT(r.Context(), token)
+			if err != nil {
+				http.Error(w, "Invalid access-token", http.StatusUnauthorized)
+				return
+			}
+			next.ServeHTTP(w, r.WithContext(auth.WithUser(r.Context(), user)))
+		})
+	}
+}
+
+// validateAPIKey checks the API key of the request's x-api-key header.
+func validateAPIKey(r *http.Request, apiKeyService auth.APIKeyService) (types.APIKey, types.User, error) {
+	key, user, err := apiKeyService.ValidateAPIKey(r.Context(), r.Header.Get(apiKeyHeader))
+	if err != nil && !errors.Is(err, auth.ErrInvalidAPIKey) {
+		fmt.Println("Error validating API key: ", err)
+	}
+	return key, user, err
+}
@@ -0,0 +1,145 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"rag-demo/pkg/auth"
+	"rag-demo/pkg/message"
+	"rag-demo/types"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/google/uuid"
+)
+
+// HandleSubmitFeedback stores the authenticated user's rating of the answer named by the {id} URL parameter.
+func HandleSubmitFeedback(feedbackService message.FeedbackService) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		user, ok := authenticate(w, r)
+		if !ok {
+			return
+		}
+
+		messageID, err := uuid.Parse(chi.URLParam(r, "id"))
+		if err != nil {
+			http.Error(w, "Invalid message id", http.StatusBadRequest)
+			return
+		}
+
+		var req types.NewFeedbackRequest
+		if err := decodeAndValidateJSON(r.Body, &req); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		resultCh := make(types.ResultChannel, 1)
+		wg := &sync.WaitGroup{}
+		wg.Add(1)
+
+		go feedbackService.SubmitFeedback(r.Context(), user.UserID, messageID, req, resultCh, wg)
+
+		wg.Wait()
+		result := <-resultCh
+
+		switch {
+		case result.Success:
+			w.Header().Set("Content-Type", "application/json")
+			json.NewEncoder(w).Encode(result.Data)
+		case errors.Is(result.Error, message.ErrMessageNotFound):
+			http.Error(w, result.Error.Error(), http.StatusNotFound)
+		case errors.Is(result.Error, message.ErrNotMessageOwner):
+			http.Error(w, "Forbidden", http.StatusForbidden)
+		default:
+			fmt.Println("Error storing feedback: ", result.Error)
+			http.Error(w, "error storing feedback", http.StatusInternalServerError)
+		}
+	}
+}
+
+// HandleAssistantFeedback summarises the feedback on the answers of the assistant named by the {id} URL parameter.
+func HandleAssistantFeedback(feedbackService message.FeedbackService) http.HandlerFunc {
+	return handleFeedbackSummary(feedbackService, func(filter *types.FeedbackFilter, id uuid.UUID) {
+		filter.AssistantID = &id
+	})
+}
+
+// HandleKbaseFeedback summarises the feedback on answers that used chunks of the kbase named by the {id} URL parameter.
+func HandleKbaseFeedback(feedbackService message.FeedbackService) http.HandlerFunc {
+	return handleFeedbackSummary(feedbackService, func(filter *types.FeedbackFilter, id uuid.UUID) {
+		filter.KbaseID = &id
+	})
+}
+
+// handleFeedbackSummary reads the ?from=&to=&interval=&limit= filter of a summary; from and to are
+// RFC 3339 times or dates. Summaries cover every user's feedback, so only admins may read them.
+func handleFeedbackSummary(feedbackService message.FeedbackService, scope func(filter *types.FeedbackFilter, id uuid.UUID)) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		user, ok := authenticate(w, r)
+		if !ok {
+			return
+		}
+		if !auth.IsAdmin(user) {
+			http.Error(w, "Forbidden", http.StatusForbidden)
+			return
+		}
+
+		id, err := uuid.Parse(chi.URLParam(r, "id"))
+		if err != nil {
+			http.Error(w, "Invalid id", http.StatusBadRequest)
+			return
+		}
+
+		query := r.URL.Query()
+		filter := types.FeedbackFilter{Interval: query.Get("interval")}
+		scope(&filter, id)
+		if filter.From, err = parseFeedbackTime(query.Get("from")); err != nil {
+			http.Error(w, "invalid from", http.StatusBadRequest)
+			return
+		}
+		if filter.To, err = parseFeedbackTime(query.Get("to")); err != nil {
+			http.Error(w, "invalid to", http.StatusBadRequest)
+			return
+		}
+		if value := query.Get("limit"); value != "" {
+			if filter.Limit, err = strconv.Atoi(value); err != nil {
+				http.Error(w, "invalid limit", http.StatusBadRequest)
+				return
+			}
+		}
+
+		resultCh := make(types.ResultChannel, 1)
+		wg := &sync.WaitGroup{}
+		wg.Add(1)
+
+		go feedbackService.SummarizeFeedback(r.Context(), filter, resultCh, wg)
+
+		wg.Wait()
+		result := <-resultCh
+
+		switch {
+		case result.Success:
+			w.Header().Set("Content-Type", "application/json")
+			json.NewEncoder(w).Encode(result.Data)
+		case errors.Is(result.Error, message.ErrInvalidFeedbackFilter):
+			http.Error(w, result.Error.Error(), http.StatusBadRequest)
+		default:
+			fmt.Println("Error summarizing feedback: ", result.Error)
+			http.Error(w, "error summarizing feedback", http.StatusInternalServerError)
+		}
+	}
+}
+
+// parseFeedbackTime parses an RFC 3339 time or a date; an empty value is the zero time.
+func parseFeedbackTime(value string) (time.Time, error) {
+	if value == "" {
+		return time.Time{}, nil
+	}
+	if t, err := time.Parse(time.RFC3339, value); err == nil {
+		return t.UTC(), nil
+	}
+	return time.Parse(time.DateOnly, value)
+}
@@ -31,6 +31,7 @@ func HandleCreateKbase(kbaseService kbase.KbaseService) http.HandlerFunc {
 			ID: uuid.New(),
 			Name: newKbaseReq.Name,
 			Description: newKbaseReq.Description,
+			MinSimilarity: newKbaseReq.MinSimilarity,
 		}
 
 	
@@ -0,0 +1,228 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"rag-demo/pkg/message"
+	"rag-demo/pkg/textsql"
+	"rag-demo/types"
+	"sync"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+)
+
+// loadSession looks up the session named by the {id} URL parameter and writes an error response if it can't.
+func loadSession(w http.ResponseWriter, r *http.Request, sessionService message.SessionService) (types.Session, bool) {
+	sessionID, err := uuid.Parse(chi.URLParam(r, "id"))
+	if err != nil {
+		http.Error(w, "Invalid session id", http.StatusBadRequest)
+		return types.Session{}, false
+	}
+
+	resultCh := make(types.ResultChannel, 1)
+	wg := &sync.WaitGroup{}
+	wg.Add(1)
+
+	go sessionService.GetSession(r.Context(), sessionID, resultCh, wg)
+
+	wg.Wait()
+	result := <-resultCh
+
+	if !result.Success {
+		if errors.Is(result.Error, pgx.ErrNoRows) {
+			http.Error(w, "session not found", http.StatusNotFound)
+		} else {
+			http.Error(w, "error loading session", http.StatusInternalServerError)
+		}
+		return types.Session{}, false
+	}
+
+	session, ok := result.Data.(types.Session)
+	if !ok {
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return types.Session{}, false
+	}
+	return session, true
+}
+
+func HandleSendMessage(sessionService message.SessionService, chatService message.ChatService) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		session, ok := loadOwnedSession(w, r, sessionService)
+		if !ok || !requireActiveSession(w, session) {
+			return
+		}
+
+		var messageReq types.MessageRequest
+		err := decodeAndValidateJSON(r.Body, &messageReq)
+		if err != nil {
+			http.Error(w, "Invalid request body", http.StatusBadRequest)
+			return
+		}
+		messageReq.Session_id = session.ID
+
+		answerMessage(w, r, chatService, session, messageReq)
+	}
+}
+
+// HandleRegenerateMessage answers the user's message of the turn named by the {message_id} URL
+// parameter again. The new answer starts a branch beside the original turn.
+func HandleRegenerateMessage(sessionService message.SessionService, chatService message.ChatService) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		session, ok := loadOwnedSession(w, r, sessionService)
+		if !ok || !requireActiveSession(w, session) {
+			return
+		}
+		original, ok := loadSessionMessage(w, r, sessionService, session)
+		if !ok {
+			return
+		}
+
+		answerMessage(w, r, chatService, session, types.MessageRequest{
+			Message:     original.UserMessage,
+			Session_id:  session.ID,
+			AssistantID: original.AssistantID,
+			ParentID:    &original.ParentID,
+		})
+	}
+}
+
+// HandleEditMessage answers a corrected version of the user's message of the turn named by the
+// {message_id} URL parameter. The edited message starts a branch beside the original turn.
+func HandleEditMessage(sessionService message.SessionService, chatService message.ChatService) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		session, ok := loadOwnedSession(w, r, sessionService)
+		if !ok || !requireActiveSession(w, session) {
+			return
+		}
+		original, ok := loadSessionMessage(w, r, sessionService, session)
+		if !ok {
+			return
+		}
+
+		var editReq types.EditMessageRequest
+		if err := decodeAndValidateJSON(r.Body, &editReq); err != nil {
+			http.Error(w, "Invalid request body", http.StatusBadRequest)
+			return
+		}
+
+		answerMessage(w, r, chatService, session, types.MessageRequest{
+			Message:     editReq.Message,
+			Session_id:  session.ID,
+			AssistantID: original.AssistantID,
+			ParentID:    &original.ParentID,
+		})
+	}
+}
+
+// loadSessionMessage looks up the session's message named by the {message_id} URL parameter and writes
+// an error response if it can't.
+func loadSessionMessage(w http.ResponseWriter, r *http.Request, sessionService message.SessionService, session types.Session) (types.Message, bool) {
+	messageID, err := uuid.Parse(chi.URLParam(r, "message_id"))
+	if err != nil {
+		http.Error(w, "Invalid message id", http.StatusBadRequest)
+		return types.Message{}, false
+	}
+
+	resultCh := make(types.ResultChannel, 1)
+	wg := &sync.WaitGroup{}
+	wg.Add(1)
+
+	go sessionService.GetMessage(r.Context(), session.ID, messageID, resultCh, wg)
+
+	wg.Wait()
+	result := <-resultCh
+
+	if !result.Success {
+		if errors.Is(result.Error, message.ErrMessageNotFound) {
+			http.Error(w, result.Error.Error(), http.StatusNotFound)
+		} else {
+			http.Error(w, "error loading message", http.StatusInternalServerError)
+		}
+		return types.Message{}, false
+	}
+
+	original, ok := result.Data.(types.Message)
+	if !ok {
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return types.Message{}, false
+	}
+	return original, true
+}
+
+// answerMessage has the chat service answer the message and writes the response.
+func answerMessage(w http.ResponseWriter, r *http.Request, chatService message.ChatService, session types.Session, messageReq types.MessageRequest) {
+	resultCh := make(types.ResultChannel, 1)
+	wg := &sync.WaitGroup{}
+	wg.Add(1)
+
+	go chatService.SendMessage(r.Context(), session, messageReq, resultCh, wg)
+
+	wg.Wait()
+	result := <-resultCh
+
+	if result.Success {
+		response, ok := result.Data.(types.ChatResponse)
+		if !ok {
+			http.Error(w, "Internal server error", http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(response)
+	} else if errors.Is(result.Error, textsql.ErrQueryRejected) {
+		http.Error(w, result.Error.Error(), http.StatusUnprocessableEntity)
+	} else if errors.Is(result.Error, message.ErrMessageNotFound) {
+		http.Error(w, "parent message not found", http.StatusNotFound)
+	} else {
+		fmt.Println("Error sending message: ", result.Error)
+		http.Error(w, "error answering message", http.StatusInternalServerError)
+	}
+}
+
+// HandleStreamMessage answers a message like HandleSendMessage but relays the answer as server-sent events.
+func HandleStreamMessage(sessionService message.SessionService, chatService message.ChatService) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		flusher, ok := w.(http.Flusher)
+		if !ok {
+			http.Error(w, "streaming not supported", http.StatusInternalServerError)
+			return
+		}
+
+		session, ok := loadOwnedSession(w, r, sessionService)
+		if !ok || !requireActiveSession(w, session) {
+			return
+		}
+
+		var messageReq types.MessageRequest
+		err := decodeAndValidateJSON(r.Body, &messageReq)
+		if err != nil {
+			http.Error(w, "Invalid request body", http.StatusBadRequest)
+			return
+		}
+		messageReq.Session_id = session.ID
+
+		w.Header().Set("Content-Type", "text/event-stream")
+		w.Header().Set("Cache-Control", "no-cache")
+		w.Header().Set("Connection", "keep-alive")
+		w.WriteHeader(http.StatusOK)
+		flusher.Flush()
+
+		// the request context is cancelled when the client disconnects, which aborts the model call
+		eventCh := make(chan types.ChatEvent)
+		go chatService.StreamMessage(r.Context(), session, messageReq, eventCh)
+
+		// keep draining until the service closes the channel so it never blocks on a gone client
+		for event := range eventCh {
+			if r.Context().Err() != nil {
+				continue
+			}
+			if err := writeSSE(w, flusher, event.Event, event.Data); err != nil {
+				fmt.Println("Error writing event: ", err)
+			}
+		}
+	}
+}
@@ -0,0 +1,38 @@
+package handlers
+
+import (
+	"net"
+	"net/http"
+	"rag-demo/pkg/auth"
+	"rag-demo/pkg/quota"
+)
+
+// QuotaSubject identifies who a request counts against: the API key the request was authenticated
+// with, else its authenticated user, else the client address. Only verified API keys and tokens count;
+// a made up x-api-key header is counted against the client address like any anonymous request. A nil
+// apiKeyService ignores API keys.
+func QuotaSubject(authService auth.AuthService, apiKeyService auth.APIKeyService) quota.SubjectFunc {
+	return func(r *http.Request) quota.Subject {
+		if key, ok := auth.APIKeyFrom(r.Context()); ok {
+			return quota.Subject{Kind: quota.SubjectAPIKey, ID: key.ID.String()}
+		}
+		if user, ok := auth.UserFrom(r.Context()); ok {
+			return quota.Subject{Kind: quota.SubjectUser, ID: user.UserID.String()}
+		}
+		// the global request limit runs before RequireAuth, so the key or token is checked here as well
+		if apiKeyService != nil && r.Header.Get(apiKeyHeader) != "" {
+			if key, _, err := validateAPIKey(r, apiKeyService); err == nil {
+				return quota.Subject{Kind: quota.SubjectAPIKey, ID: key.ID.String()}
+			}
+		} else if token, err := ExtractAccessToken(r); err == nil {
+			if user, err := authService.ValidateJWT(r.Context(), token); err == nil {
+				return quota.Subject{Kind: quota.SubjectUser, ID: user.UserID.String()}
+			}
+		}
+		host, _, err := net.SplitHostPort(r.RemoteAddr)
+		if err != nil {
+			host = r.RemoteAddr
+		}
+		return quota.Subject{Kind: quota.SubjectAnonymous, ID: host}
+	}
+}
@@ -0,0 +1,46 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"rag-demo/pkg/auth"
+	"rag-demo/pkg/search"
+	"rag-demo/pkg/usage"
+	"rag-demo/types"
+)
+
+func HandleSearch(retriever *search.Retriever) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var searchReq types.SearchRequest
+		err := decodeAndValidateJSON(r.Body, &searchReq)
+		if err != nil {
+			http.Error(w, "Invalid request body", http.StatusBadRequest)
+			return
+		}
+
+		if r.URL.Query().Get("explain") == "true" {
+			searchReq.Explain = true
+		}
+		// the SQL plan exposes schema details, so it is only returned to admins
+		if user, ok := auth.UserFrom(r.Context()); ok && searchReq.Explain {
+			searchReq.IncludeSQLPlan = auth.IsAdmin(user)
+		}
+
+		// searching a single kbase is accounted to it
+		ctx := r.Context()
+		if len(searchReq.KbaseIDs) == 1 {
+			ctx = usage.WithScope(ctx, types.UsageScope{KbaseID: searchReq.KbaseIDs[0]})
+		}
+
+		result, err := retriever.Search(ctx, searchReq)
+		if err != nil {
+			fmt.Println("Error searching kbases: ", err)
+			http.Error(w, "error searching kbases", http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(result)
+	}
+}
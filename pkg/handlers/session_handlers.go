@@ -2,50 +2,228 @@ package handlers
 
 import (
 	"encoding/json"
+	"errors"
+	"fmt"
 	"net/http"
+	"rag-demo/pkg/auth"
 	"rag-demo/pkg/message"
 	"rag-demo/types"
+	"strconv"
 	"sync"
-	// "strings"
-	// "github.com/go-chi/chi/v5"
-	// "github.com/go-playground/validator/v10"
-	// "github.com/google/uuid"
-)
 
+	"github.com/google/uuid"
+)
 
 func HandleCreateSession(sessionService message.SessionService) http.HandlerFunc {
-    return func(w http.ResponseWriter, r *http.Request) {
-        var newSession types.NewSessionRequest
-        err := decodeAndValidateJSON(r.Body, &newSession)
+	return func(w http.ResponseWriter, r *http.Request) {
+		user, ok := authenticate(w, r)
+		if !ok {
+			return
+		}
+
+		var newSession types.NewSessionRequest
+		err := decodeAndValidateJSON(r.Body, &newSession)
 		if err != nil {
 			http.Error(w, "Invalid request body", http.StatusBadRequest)
 			return
 		}
 
-        // Parse userID from string to uuid.UUID
-        parsedUserID := newSession.UserID
+		resultCh := make(types.ResultChannel, 1) // Buffered channel to prevent deadlock
+		wg := &sync.WaitGroup{}
+		wg.Add(1)
+
+		go sessionService.CreateSession(r.Context(), user.UserID, newSession, resultCh, wg)
+
+		wg.Wait()            // Wait for the goroutine to finish
+		result := <-resultCh // Read the result from the channel
 
-        resultCh := make(types.ResultChannel, 1) // Buffered channel to prevent deadlock
-        wg := &sync.WaitGroup{}
-        wg.Add(1)
+		if result.Success {
+			session, ok := result.Data.(types.Session)
+			if !ok {
+				http.Error(w, "Internal server error", http.StatusInternalServerError)
+				return
+			}
 
-        // Call CreateSession with resultCh and wg
-        go sessionService.CreateSession(r.Context(), parsedUserID, resultCh, wg)
+			w.Header().Set("Content-Type", "application/json")
+			json.NewEncoder(w).Encode(session)
+		} else if errors.Is(result.Error, message.ErrAssistantNotFound) {
+			http.Error(w, result.Error.Error(), http.StatusNotFound)
+		} else {
+			http.Error(w, result.Error.Error(), http.StatusInternalServerError)
+		}
+	}
+}
+
+// authenticate returns the user RequireAuth put into the request's context and writes a 401 response
+// if there is none.
+func authenticate(w http.ResponseWriter, r *http.Request) (types.User, bool) {
+	user, ok := auth.UserFrom(r.Context())
+	if !ok {
+		http.Error(w, "Invalid access-token", http.StatusUnauthorized)
+		return types.User{}, false
+	}
+	return user, true
+}
 
-        wg.Wait()             // Wait for the goroutine to finish
-        result := <-resultCh  // Read the result from the channel
+// loadOwnedSession loads the session named by the {id} URL parameter on behalf of the authenticated
+// user and writes an error response if it can't or if the session belongs to someone else.
+func loadOwnedSession(w http.ResponseWriter, r *http.Request, sessionService message.SessionService) (types.Session, bool) {
+	user, ok := authenticate(w, r)
+	if !ok {
+		return types.Session{}, false
+	}
+	session, ok := loadSession(w, r, sessionService)
+	if !ok {
+		return types.Session{}, false
+	}
+	if session.UserID != user.UserID {
+		http.Error(w, "Forbidden", http.StatusForbidden)
+		return types.Session{}, false
+	}
+	return session, true
+}
 
-        if result.Success {
-            session, ok := result.Data.(types.Session)
-            if !ok {
-                http.Error(w, "Internal server error", http.StatusInternalServerError)
-                return
-            }
+// requireActiveSession writes a 409 response if the session has been closed.
+func requireActiveSession(w http.ResponseWriter, session types.Session) bool {
+	if !session.Active {
+		http.Error(w, message.ErrSessionClosed.Error(), http.StatusConflict)
+		return false
+	}
+	return true
+}
 
-            w.Header().Set("Content-Type", "application/json")
-            json.NewEncoder(w).Encode(session)
-        } else {
-            http.Error(w, result.Error.Error(), http.StatusInternalServerError)
-        }
-    }
-}
\ No newline at end of file
+// parsePagination reads the limit and offset query parameters; missing ones are 0.
+func parsePagination(r *http.Request) (int, int, error) {
+	var limit, offset int
+	var err error
+	if value := r.URL.Query().Get("limit"); value != "" {
+		limit, err = strconv.Atoi(value)
+		if err != nil || limit < 0 {
+			return 0, 0, fmt.Errorf("invalid limit")
+		}
+	}
+	if value := r.URL.Query().Get("offset"); value != "" {
+		offset, err = strconv.Atoi(value)
+		if err != nil || offset < 0 {
+			return 0, 0, fmt.Errorf("invalid offset")
+		}
+	}
+	return limit, offset, nil
+}
+
+// HandleListSessions lists the authenticated user's sessions, most recently active first, paginated with ?limit=&offset=.
+func HandleListSessions(sessionService message.SessionService) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		user, ok := authenticate(w, r)
+		if !ok {
+			return
+		}
+
+		limit, offset, err := parsePagination(r)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		resultCh := make(types.ResultChannel, 1)
+		wg := &sync.WaitGroup{}
+		wg.Add(1)
+
+		go sessionService.ListSessions(r.Context(), user.UserID, limit, offset, resultCh, wg)
+
+		wg.Wait()
+		result := <-resultCh
+
+		if !result.Success {
+			fmt.Println("Error listing sessions: ", result.Error)
+			http.Error(w, "error listing sessions", http.StatusInternalServerError)
+			return
+		}
+
+		sessions, ok := result.Data.(types.SessionList)
+		if !ok {
+			http.Error(w, "Internal server error", http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(sessions)
+	}
+}
+
+// HandleGetSession returns one of the authenticated user's sessions with the message history of the
+// branch of its latest message, or of the branch through the message given with ?leaf=.
+func HandleGetSession(sessionService message.SessionService) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		session, ok := loadOwnedSession(w, r, sessionService)
+		if !ok {
+			return
+		}
+
+		var leafID uuid.UUID
+		if value := r.URL.Query().Get("leaf"); value != "" {
+			var err error
+			if leafID, err = uuid.Parse(value); err != nil {
+				http.Error(w, "Invalid leaf message id", http.StatusBadRequest)
+				return
+			}
+		}
+
+		resultCh := make(types.ResultChannel, 1)
+		wg := &sync.WaitGroup{}
+		wg.Add(1)
+
+		go sessionService.GetSessionHistory(r.Context(), session.ID, leafID, resultCh, wg)
+
+		wg.Wait()
+		result := <-resultCh
+
+		if errors.Is(result.Error, message.ErrMessageNotFound) {
+			http.Error(w, result.Error.Error(), http.StatusNotFound)
+			return
+		}
+		if !result.Success {
+			fmt.Println("Error loading session history: ", result.Error)
+			http.Error(w, "error loading session history", http.StatusInternalServerError)
+			return
+		}
+
+		history, ok := result.Data.(types.SessionHistory)
+		if !ok {
+			http.Error(w, "Internal server error", http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(history)
+	}
+}
+
+// HandleCloseSession closes one of the authenticated user's sessions; it accepts no new messages afterwards.
+func HandleCloseSession(sessionService message.SessionService) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		session, ok := loadOwnedSession(w, r, sessionService)
+		if !ok {
+			return
+		}
+
+		resultCh := make(types.ResultChannel, 1)
+		wg := &sync.WaitGroup{}
+		wg.Add(1)
+
+		go sessionService.CloseSession(r.Context(), session.ID, resultCh, wg)
+
+		wg.Wait()
+		result := <-resultCh
+
+		if result.Success {
+			w.WriteHeader(http.StatusOK)
+			w.Write([]byte("Session closed successfully"))
+		} else if result.Error == nil {
+			http.Error(w, "session not found", http.StatusNotFound)
+		} else {
+			fmt.Println("Error closing session: ", result.Error)
+			http.Error(w, "error closing session", http.StatusInternalServerError)
+		}
+	}
+}
@@ -0,0 +1,20 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+)
+
+// writeSSE writes one server-sent event with a JSON payload and flushes it to the client.
+func writeSSE(w http.ResponseWriter, flusher http.Flusher, event string, data interface{}) error {
+	payload, err := json.Marshal(data)
+	if err != nil {
+		return err
+	}
+	if _, err := fmt.Fprintf(w, "event: %s\ndata: %s\n\n", event, payload); err != nil {
+		return err
+	}
+	flusher.Flush()
+	return nil
+}
@@ -0,0 +1,15 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"rag-demo/pkg/tools"
+)
+
+// HandleListTools returns the tools assistants can be configured with, including the built-in ones.
+func HandleListTools(toolRegistry *tools.Registry) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]interface{}{"tools": toolRegistry.Specs()})
+	}
+}
@@ -0,0 +1,81 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"rag-demo/pkg/auth"
+	"rag-demo/pkg/usage"
+	"rag-demo/types"
+	"sync"
+
+	"github.com/google/uuid"
+)
+
+// HandleUsageReport reports the usage and cost of model calls and Textract jobs, filtered by
+// ?user_id=&session_id=&assistant_id=&kbase_id=&from=&to= and grouped by ?group_by=. Admins can report
+// anyone's usage; other users only their own.
+func HandleUsageReport(usageService usage.UsageService) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		user, ok := authenticate(w, r)
+		if !ok {
+			return
+		}
+
+		query := r.URL.Query()
+		filter := types.UsageFilter{GroupBy: query.Get("group_by")}
+		for param, id := range map[string]**uuid.UUID{
+			"user_id":      &filter.UserID,
+			"session_id":   &filter.SessionID,
+			"assistant_id": &filter.AssistantID,
+			"kbase_id":     &filter.KbaseID,
+		} {
+			if value := query.Get(param); value != "" {
+				parsed, err := uuid.Parse(value)
+				if err != nil {
+					http.Error(w, "invalid "+param, http.StatusBadRequest)
+					return
+				}
+				*id = &parsed
+			}
+		}
+		var err error
+		if filter.From, err = parseFeedbackTime(query.Get("from")); err != nil {
+			http.Error(w, "invalid from", http.StatusBadRequest)
+			return
+		}
+		if filter.To, err = parseFeedbackTime(query.Get("to")); err != nil {
+			http.Error(w, "invalid to", http.StatusBadRequest)
+			return
+		}
+
+		if !auth.IsAdmin(user) {
+			if filter.UserID != nil && *filter.UserID != user.UserID {
+				http.Error(w, "Forbidden", http.StatusForbidden)
+				return
+			}
+			filter.UserID = &user.UserID
+		}
+
+		resultCh := make(types.ResultChannel, 1)
+		wg := &sync.WaitGroup{}
+		wg.Add(1)
+
+		go usageService.ReportUsage(r.Context(), filter, resultCh, wg)
+
+		wg.Wait()
+		result := <-resultCh
+
+		switch {
+		case result.Success:
+			w.Header().Set("Content-Type", "application/json")
+			json.NewEncoder(w).Encode(result.Data)
+		case errors.Is(result.Error, usage.ErrInvalidUsageFilter):
+			http.Error(w, result.Error.Error(), http.StatusBadRequest)
+		default:
+			fmt.Println("Error reporting usage: ", result.Error)
+			http.Error(w, "error reporting usage", http.StatusInternalServerError)
+		}
+	}
+}
@@ -6,12 +6,11 @@ import (
 	"rag-demo/pkg/auth"
 	"rag-demo/types"
 	"sync"
-	"github.com/go-chi/chi/v5"
-	"github.com/google/uuid"
 )
 
 
-func HandleCreateUser(authService auth.AuthService) http.HandlerFunc {
+// HandleCreateUser signs up a user with an email and password and logs them in.
+func HandleCreateUser(authService auth.AuthService, accountService auth.AccountService) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		var newUser types.NewUserRequest
 		err := decodeAndValidateJSON(r.Body, &newUser)
@@ -24,7 +23,7 @@ func HandleCreateUser(authService auth.AuthService) http.HandlerFunc {
 		wg := &sync.WaitGroup{}
 		wg.Add(1)
 
-		go authService.CreateUser(r.Context(), newUser.Name, resultCh, wg)
+		go accountService.Register(r.Context(), newUser, resultCh, wg)
 
 		result := <-resultCh
 		wg.Wait()
@@ -35,52 +34,49 @@ func HandleCreateUser(authService auth.AuthService) http.HandlerFunc {
 				http.Error(w, "Internal server error", http.StatusInternalServerError)
 				return
 			}
-			token, err := authService.GenerateJWT(r.Context(), user)
-			if err != nil {
-				http.Error(w, "Internal server error", http.StatusInternalServerError)
-				return
-			}
+			writeLogin(w, r, authService, user)
+		} else {
+			writeAccountError(w, result.Error)
+		}
+	}
+}
 
+// writeLogin issues an access token for the user in the access-token header and cookie and writes the user.
+func writeLogin(w http.ResponseWriter, r *http.Request, authService auth.AuthService, user types.User) {
+	token, err := authService.GenerateJWT(r.Context(), user)
+	if err != nil {
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
 
-			w.Header().Set("Content-Type", "application/json")
-			w.Header().Set("access-token", "Bearer "+ token)
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("access-token", "Bearer "+token)
 
-            http.SetCookie(w, &http.Cookie{
-                Name:     "access-token",
-                Value:    token,
-                Path:     "/",
-                HttpOnly: true,
-                Secure:   true, 
-                SameSite: http.SameSiteLaxMode,
-            })
+	http.SetCookie(w, &http.Cookie{
+		Name:     "access-token",
+		Value:    token,
+		Path:     "/",
+		HttpOnly: true,
+		Secure:   true,
+		SameSite: http.SameSiteLaxMode,
+	})
 
-			json.NewEncoder(w).Encode(user)
-		} else {
-			http.Error(w, result.Error.Error(), http.StatusInternalServerError)
-		}
-	}
+	json.NewEncoder(w).Encode(user)
 }
 
+// HandleGetUser returns the record of the authenticated user.
 func HandleGetUser(authService auth.AuthService) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
-		userID := chi.URLParam(r, "userID")
-		if userID == "" {
-			http.Error(w, "Missing user_id", http.StatusBadRequest)
+		current, ok := authenticate(w, r)
+		if !ok {
 			return
 		}
 
-		parsedUserID, err := uuid.Parse(userID)
-		if err != nil {
-			http.Error(w, "Invalid user_id", http.StatusBadRequest)
-			return
-		}
-
-
 		resultCh := make(types.ResultChannel)
 		wg := &sync.WaitGroup{}
 		wg.Add(1)
 
-		go authService.GetUser(r.Context(), parsedUserID, resultCh, wg)
+		go authService.GetUser(r.Context(), current.UserID, resultCh, wg)
 
 		result := <-resultCh
 		wg.Wait()
@@ -16,7 +16,10 @@ func decodeAndValidateJSON(body io.Reader, v interface{}) error {
         return fmt.Errorf("invalid JSON: %v", err)
     }
 
-    // Validate struct
+    return validateStruct(v)
+}
+
+func validateStruct(v interface{}) error {
     validate := validator.New()
     if err := validate.Struct(v); err != nil {
         return fmt.Errorf("validation error: %v", err)
@@ -0,0 +1,222 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"math"
+	"net/http"
+	"os"
+	"rag-demo/pkg/message"
+	"rag-demo/pkg/quota"
+	"rag-demo/types"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/gorilla/websocket"
+)
+
+const wsReadLimit = 64 * 1024
+
+// generation is an answer being streamed over a WebSocket.
+type generation struct {
+	id        string
+	cancel    context.CancelFunc
+	cancelled bool
+}
+
+func newUpgrader() websocket.Upgrader {
+	upgrader := websocket.Upgrader{}
+
+	// the UI dev server runs on another origin, so allowed origins can be configured; by default only same-origin is accepted
+	allowed := os.Getenv("WS_ALLOWED_ORIGINS")
+	if allowed != "" {
+		origins := strings.Split(allowed, ",")
+		upgrader.CheckOrigin = func(r *http.Request) bool {
+			origin := r.Header.Get("Origin")
+			for _, o := range origins {
+				if strings.TrimSpace(o) == origin {
+					return true
+				}
+			}
+			return false
+		}
+	}
+	return upgrader
+}
+
+// HandleSessionWebSocket upgrades to a WebSocket carrying the chat protocol of one session:
+// the client sends messages, typing indicators and cancel requests; the server streams
+// answers as token/sources/usage/done/error frames, relays typing to the session's other connections
+// and pushes the notices sent through the hub.
+// Every message counts against the quotas of the subject the limiter's middleware found when the socket
+// was opened, as if it were a request of its own.
+func HandleSessionWebSocket(sessionService message.SessionService, chatService message.ChatService, hub *SessionHub, limiter *quota.Limiter) http.HandlerFunc {
+	upgrader := newUpgrader()
+
+	return func(w http.ResponseWriter, r *http.Request) {
+		session, ok := loadOwnedSession(w, r, sessionService)
+		if !ok || !requireActiveSession(w, session) {
+			return
+		}
+
+		ws, err := upgrader.Upgrade(w, r, nil)
+		if err != nil {
+			// Upgrade has already written the error response
+			fmt.Println("Error upgrading websocket: ", err)
+			return
+		}
+		conn := &wsConn{conn: ws}
+		conn.conn.SetReadLimit(wsReadLimit)
+
+		hub.add(session.ID, conn)
+		defer hub.remove(session.ID, conn)
+		defer ws.Close()
+
+		ctx, cancel := context.WithCancel(r.Context())
+		defer cancel()
+
+		var mu sync.Mutex
+		var inflight *generation
+		var relays sync.WaitGroup
+		defer relays.Wait()
+
+		conn.send(types.WSServerMessage{Type: types.WSTypeReady, Data: map[string]interface{}{"session_id": session.ID}})
+
+		for {
+			_, payload, err := ws.ReadMessage()
+			if err != nil {
+				// client went away, abort any generation before returning
+				cancel()
+				return
+			}
+
+			var msg types.WSClientMessage
+			if err := json.Unmarshal(payload, &msg); err != nil {
+				conn.send(wsError("", "invalid message"))
+				continue
+			}
+
+			switch msg.Type {
+			case types.WSTypeMessage:
+				req := types.MessageRequest{
+					Message:     msg.Message,
+					Session_id:  session.ID,
+					AssistantID: msg.AssistantID,
+				}
+				if err := validateStruct(&req); err != nil {
+					conn.send(wsError(msg.ID, "invalid message"))
+					continue
+				}
+				if subject, ok := quota.SubjectFrom(ctx); ok {
+					if allowed, reason, retryAfter := limiter.Allow(ctx, subject); !allowed {
+						conn.send(wsQuotaError(msg.ID, reason, retryAfter))
+						continue
+					}
+				}
+				// the session may have been closed since the socket was opened
+				if err := checkSessionActive(ctx, sessionService, session.ID); err != nil {
+					conn.send(wsError(msg.ID, err.Error()))
+					continue
+				}
+
+				mu.Lock()
+				if inflight != nil {
+					mu.Unlock()
+					conn.send(wsError(msg.ID, "a generation is already in progress"))
+					continue
+				}
+				genCtx, genCancel := context.WithCancel(ctx)
+				gen := &generation{id: msg.ID, cancel: genCancel}
+				inflight = gen
+				mu.Unlock()
+
+				relays.Add(1)
+				go func() {
+					defer relays.Done()
+					defer genCancel()
+					relayGeneration(genCtx, conn, chatService, session, req, gen, &mu, func() {
+						inflight = nil
+					})
+				}()
+
+			case types.WSTypeCancel:
+				mu.Lock()
+				if inflight != nil && (msg.ID == "" || msg.ID == inflight.id) {
+					inflight.cancelled = true
+					inflight.cancel()
+				}
+				mu.Unlock()
+
+			case types.WSTypeTyping:
+				// let the user's other tabs on this session show the indicator
+				hub.send(session.ID, conn, types.WSServerMessage{Type: types.WSTypeTyping, Data: map[string]interface{}{"typing": msg.Typing, "role": "user"}})
+
+			default:
+				conn.send(wsError(msg.ID, "unknown message type"))
+			}
+		}
+	}
+}
+
+// relayGeneration streams one answer to the connection, bracketed by assistant typing indicators.
+// finish is called with mu held once the answer has ended, before the closing frames are sent.
+func relayGeneration(ctx context.Context, conn *wsConn, chatService message.ChatService, session types.Session, req types.MessageRequest, gen *generation, mu *sync.Mutex, finish func()) {
+	conn.send(types.WSServerMessage{Type: types.WSTypeTyping, ID: gen.id, Data: map[string]interface{}{"typing": true, "role": "assistant"}})
+
+	eventCh := make(chan types.ChatEvent)
+	go chatService.StreamMessage(ctx, session, req, eventCh)
+
+	for event := range eventCh {
+		mu.Lock()
+		cancelled := gen.cancelled
+		mu.Unlock()
+		// the error caused by a requested cancel is reported as cancelled instead
+		if cancelled && event.Event == types.ChatEventError {
+			continue
+		}
+		conn.send(types.WSServerMessage{Type: event.Event, ID: gen.id, Data: event.Data})
+	}
+
+	mu.Lock()
+	cancelled := gen.cancelled
+	finish()
+	mu.Unlock()
+	if cancelled {
+		conn.send(types.WSServerMessage{Type: types.WSTypeCancelled, ID: gen.id})
+	}
+	conn.send(types.WSServerMessage{Type: types.WSTypeTyping, ID: gen.id, Data: map[string]interface{}{"typing": false, "role": "assistant"}})
+}
+
+// checkSessionActive reloads a session and returns message.ErrSessionClosed if it has been closed.
+func checkSessionActive(ctx context.Context, sessionService message.SessionService, sessionID uuid.UUID) error {
+	resultCh := make(types.ResultChannel, 1)
+	wg := &sync.WaitGroup{}
+	wg.Add(1)
+
+	go sessionService.GetSession(ctx, sessionID, resultCh, wg)
+
+	wg.Wait()
+	result := <-resultCh
+
+	if !result.Success {
+		return fmt.Errorf("error loading session")
+	}
+	if session, ok := result.Data.(types.Session); !ok || !session.Active {
+		return message.ErrSessionClosed
+	}
+	return nil
+}
+
+func wsError(id string, message string) types.WSServerMessage {
+	return types.WSServerMessage{Type: types.ChatEventError, ID: id, Data: map[string]string{"error": message}}
+}
+
+// wsQuotaError is the error frame of a message over a quota; retry_after is in seconds like the
+// Retry-After header.
+func wsQuotaError(id string, message string, retryAfter time.Duration) types.WSServerMessage {
+	data := map[string]interface{}{"error": message, "retry_after": int(math.Ceil(retryAfter.Seconds()))}
+	return types.WSServerMessage{Type: types.ChatEventError, ID: id, Data: data}
+}
@@ -0,0 +1,73 @@
+package handlers
+
+import (
+	"sync"
+
+	"github.com/google/uuid"
+	"github.com/gorilla/websocket"
+	"rag-demo/types"
+)
+
+// wsConn serialises writes to a WebSocket connection, which only supports one concurrent writer.
+type wsConn struct {
+	conn *websocket.Conn
+	mu   sync.Mutex
+}
+
+func (c *wsConn) send(msg types.WSServerMessage) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.conn.WriteJSON(msg)
+}
+
+// SessionHub tracks the open WebSocket connections of every session so frames such as typing
+// indicators reach the session's other connections and the server can push notices to them.
+type SessionHub struct {
+	mu    sync.Mutex
+	conns map[uuid.UUID]map[*wsConn]bool
+}
+
+func NewSessionHub() *SessionHub {
+	return &SessionHub{conns: make(map[uuid.UUID]map[*wsConn]bool)}
+}
+
+func (h *SessionHub) add(sessionID uuid.UUID, c *wsConn) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if h.conns[sessionID] == nil {
+		h.conns[sessionID] = make(map[*wsConn]bool)
+	}
+	h.conns[sessionID][c] = true
+}
+
+func (h *SessionHub) remove(sessionID uuid.UUID, c *wsConn) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	delete(h.conns[sessionID], c)
+	if len(h.conns[sessionID]) == 0 {
+		delete(h.conns, sessionID)
+	}
+}
+
+// Notify pushes a notice, such as a document of the session's kbases finishing ingestion, to every
+// connection of a session.
+func (h *SessionHub) Notify(sessionID uuid.UUID, data interface{}) {
+	h.send(sessionID, nil, types.WSServerMessage{Type: types.WSTypeNotice, Data: data})
+}
+
+// send writes msg to the connections of a session, skipping except.
+func (h *SessionHub) send(sessionID uuid.UUID, except *wsConn, msg types.WSServerMessage) {
+	h.mu.Lock()
+	conns := make([]*wsConn, 0, len(h.conns[sessionID]))
+	for c := range h.conns[sessionID] {
+		if c != except {
+			conns = append(conns, c)
+		}
+	}
+	h.mu.Unlock()
+
+	for _, c := range conns {
+		// a failed write means the connection is closing; its reader will clean up
+		c.send(msg)
+	}
+}
@@ -11,6 +11,9 @@ import (
 	"fmt"
 )
 
+// EmbeddingModelID is the Titan model used to embed kbase chunks and search queries.
+const EmbeddingModelID = "amazon.titan-embed-g1-text-02"
+
 type BedrockRuntimeService struct {
 	Client *bedrockruntime.Client
 }
@@ -45,7 +48,7 @@ func (b *BedrockRuntimeService) GetEmbeddings(ctx context.Context, doctext types
 	}
 
 	input := &bedrockruntime.InvokeModelInput{
-		ModelId:     aws.String("amazon.titan-embed-g1-text-02"),
+		ModelId:     aws.String(EmbeddingModelID),
 		Body:        inputJSON,
 		ContentType: aws.String("application/json"),
 	}
@@ -59,4 +62,29 @@ func (b *BedrockRuntimeService) GetEmbeddings(ctx context.Context, doctext types
 	return output, nil
 }
 
+// EmbedText returns the Titan embedding vector for a single piece of text.
+func (b *BedrockRuntimeService) EmbedText(ctx context.Context, text string) ([]float32, error) {
+	embedding, _, err := b.EmbedTextTokens(ctx, text)
+	return embedding, err
+}
+
+// EmbedTextTokens works like EmbedText and also returns the number of input tokens Titan counted.
+func (b *BedrockRuntimeService) EmbedTextTokens(ctx context.Context, text string) ([]float32, int, error) {
+	output, err := b.GetEmbeddings(ctx, types.DocumentText{Chunks: []string{text}})
+	if err != nil {
+		return nil, 0, err
+	}
 
+	var embeddingResponse types.TitanEmbeddingOutput
+	err = json.Unmarshal(output.Body, &embeddingResponse)
+	if err != nil {
+		return nil, 0, fmt.Errorf("error unmarshaling embedding response: %w", err)
+	}
+
+	return embeddingResponse.Embedding, embeddingResponse.InputTextTokenCount, nil
+}
+
+// EmbeddingModelID returns the model used by EmbedText.
+func (b *BedrockRuntimeService) EmbeddingModelID() string {
+	return EmbeddingModelID
+}
@@ -70,6 +70,9 @@ func (t *TextractService) StartTextDetection(ctx context.Context, bucket, docume
 func (t *TextractService) GetTextFromPDF(ctx context.Context, jobID string, documentName string) (*types.DocumentText, error) {
     var fullText strings.Builder
     var blockCount int
+    var pageCount int
+    // pageStarts holds the offset in fullText at which each page begins, in page order
+    var pageStarts []pageOffset
 
     // Poll for job completion
     for {
@@ -111,9 +114,16 @@ func (t *TextractService) GetTextFromPDF(ctx context.Context, jobID string, docu
         }
 
         fmt.Printf("Number of blocks in this response: %d\n", len(output.Blocks))
+        if output.DocumentMetadata != nil {
+            pageCount = int(aws.ToInt32(output.DocumentMetadata.Pages))
+        }
 
         for _, block := range output.Blocks {
             if block.BlockType == textractTypes.BlockTypeLine {
+                page := int(aws.ToInt32(block.Page))
+                if len(pageStarts) == 0 || pageStarts[len(pageStarts)-1].page != page {
+                    pageStarts = append(pageStarts, pageOffset{page: page, offset: fullText.Len()})
+                }
                 fullText.WriteString(aws.ToString(block.Text))
                 fullText.WriteString(" ")
                 blockCount++
@@ -141,12 +151,14 @@ func (t *TextractService) GetTextFromPDF(ctx context.Context, jobID string, docu
     const charsPerPage = 3000
     text := fullText.String()
     var chunks []string
+    var pages []types.PageRange
     for i := 0; i < len(text); i += charsPerPage {
         end := i + charsPerPage
         if end > len(text) {
             end = len(text)
         }
         chunks = append(chunks, text[i:end])
+        pages = append(pages, pageRange(pageStarts, i, end))
     }
 
     fmt.Printf("Number of chunks created: %d\n", len(chunks))
@@ -154,9 +166,31 @@ func (t *TextractService) GetTextFromPDF(ctx context.Context, jobID string, docu
     return &types.DocumentText{
         Name:   documentName,
         Chunks: chunks,
+        Pages:  pages,
+        PageCount: pageCount,
     }, nil
 }
 
+type pageOffset struct {
+    page   int
+    offset int
+}
+
+// pageRange returns the pages spanned by the text between start and end.
+func pageRange(pageStarts []pageOffset, start, end int) types.PageRange {
+    var r types.PageRange
+    for _, p := range pageStarts {
+        if p.offset >= end {
+            break
+        }
+        if p.offset <= start || r.Start == 0 {
+            r.Start = p.page
+        }
+        r.End = p.page
+    }
+    return r
+}
+
 // Helper function to get job status
 func (t *TextractService) getJobStatus(ctx context.Context, jobID string) (textractTypes.JobStatus, error) {
     input := &textract.GetDocumentTextDetectionInput{
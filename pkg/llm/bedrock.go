@@ -0,0 +1,280 @@
+package llm
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/bedrockruntime"
+	"github.com/aws/aws-sdk-go-v2/service/bedrockruntime/document"
+	brtypes "github.com/aws/aws-sdk-go-v2/service/bedrockruntime/types"
+	"rag-demo/types"
+)
+
+// BedrockLLM calls Bedrock text models through the Converse API, which gives Claude, Llama, Mistral
+// and Titan models one request format.
+type BedrockLLM struct {
+	Client *bedrockruntime.Client
+}
+
+func NewBedrockLLM(client *bedrockruntime.Client) LLM {
+	return &BedrockLLM{Client: client}
+}
+
+func (b *BedrockLLM) Converse(ctx context.Context, req types.LLMRequest) (types.LLMResponse, error) {
+	input, err := BuildConverseInput(req)
+	if err != nil {
+		return types.LLMResponse{}, err
+	}
+
+	output, err := b.Client.Converse(ctx, input)
+	if err != nil {
+		return types.LLMResponse{}, fmt.Errorf("error invoking model: %w", err)
+	}
+
+	message, ok := output.Output.(*brtypes.ConverseOutputMemberMessage)
+	if !ok {
+		return types.LLMResponse{}, fmt.Errorf("unexpected converse output type %T", output.Output)
+	}
+
+	response := types.LLMResponse{StopReason: string(output.StopReason), Usage: tokenUsage(output.Usage)}
+	var text strings.Builder
+	for _, block := range message.Value.Content {
+		switch b := block.(type) {
+		case *brtypes.ContentBlockMemberText:
+			text.WriteString(b.Value)
+		case *brtypes.ContentBlockMemberToolUse:
+			input, err := b.Value.Input.MarshalSmithyDocument()
+			if err != nil {
+				return types.LLMResponse{}, fmt.Errorf("error decoding tool input: %w", err)
+			}
+			response.ToolCalls = append(response.ToolCalls, types.ToolCall{
+				ID:    aws.ToString(b.Value.ToolUseId),
+				Name:  aws.ToString(b.Value.Name),
+				Input: input,
+			})
+		}
+	}
+	response.Text = text.String()
+	return response, nil
+}
+
+func (b *BedrockLLM) ConverseStream(ctx context.Context, req types.LLMRequest, onToken func(token string) error) (types.LLMResponse, error) {
+	input, err := BuildConverseInput(req)
+	if err != nil {
+		return types.LLMResponse{}, err
+	}
+
+	output, err := b.Client.ConverseStream(ctx, &bedrockruntime.ConverseStreamInput{
+		ModelId:         input.ModelId,
+		System:          input.System,
+		Messages:        input.Messages,
+		InferenceConfig: input.InferenceConfig,
+		ToolConfig:      input.ToolConfig,
+	})
+	if err != nil {
+		return types.LLMResponse{}, fmt.Errorf("error invoking model: %w", err)
+	}
+	stream := output.GetStream()
+	defer stream.Close()
+
+	var response types.LLMResponse
+	var text strings.Builder
+	// tool calls arrive as a start event with the id and name followed by fragments of the JSON input
+	var toolInputs []string
+	for event := range stream.Events() {
+		switch e := event.(type) {
+		case *brtypes.ConverseStreamOutputMemberContentBlockStart:
+			if start, ok := e.Value.Start.(*brtypes.ContentBlockStartMemberToolUse); ok {
+				response.ToolCalls = append(response.ToolCalls, types.ToolCall{
+					ID:   aws.ToString(start.Value.ToolUseId),
+					Name: aws.ToString(start.Value.Name),
+				})
+				toolInputs = append(toolInputs, "")
+			}
+		case *brtypes.ConverseStreamOutputMemberContentBlockDelta:
+			switch delta := e.Value.Delta.(type) {
+			case *brtypes.ContentBlockDeltaMemberText:
+				text.WriteString(delta.Value)
+				if err := onToken(delta.Value); err != nil {
+					response.Text = text.String()
+					return response, err
+				}
+			case *brtypes.ContentBlockDeltaMemberToolUse:
+				if len(toolInputs) > 0 {
+					toolInputs[len(toolInputs)-1] += aws.ToString(delta.Value.Input)
+				}
+			}
+		case *brtypes.ConverseStreamOutputMemberMessageStop:
+			response.StopReason = string(e.Value.StopReason)
+		case *brtypes.ConverseStreamOutputMemberMetadata:
+			response.Usage = tokenUsage(e.Value.Usage)
+		}
+	}
+	response.Text = text.String()
+	for i := range response.ToolCalls {
+		input := toolInputs[i]
+		if input == "" {
+			input = "{}"
+		}
+		response.ToolCalls[i].Input = json.RawMessage(input)
+	}
+
+	if err := stream.Err(); err != nil {
+		return response, fmt.Errorf("error reading model stream: %w", err)
+	}
+	if err := ctx.Err(); err != nil {
+		return response, err
+	}
+	return response, nil
+}
+
+// BuildConverseInput adapts a request to the model it is for: consecutive messages of the same role
+// are merged because Converse requires alternating turns, the system prompt is folded into the first
+// user message for models that don't accept one, and MaxTokens is capped at the model's output limit.
+// Models missing from SupportedModels are called as if they accepted everything.
+func BuildConverseInput(req types.LLMRequest) (*bedrockruntime.ConverseInput, error) {
+	model, ok := LookupModel(req.ModelID)
+	if !ok {
+		model = Model{ID: req.ModelID, System: true, Tools: true}
+	}
+
+	var messages []brtypes.Message
+	for _, message := range req.Messages {
+		var role brtypes.ConversationRole
+		switch message.Role {
+		case types.LLMRoleUser:
+			role = brtypes.ConversationRoleUser
+		case types.LLMRoleAssistant:
+			role = brtypes.ConversationRoleAssistant
+		default:
+			return nil, fmt.Errorf("unknown message role %q", message.Role)
+		}
+
+		blocks, err := contentBlocks(message)
+		if err != nil {
+			return nil, err
+		}
+		if len(blocks) == 0 {
+			continue
+		}
+		if len(messages) > 0 && messages[len(messages)-1].Role == role {
+			last := &messages[len(messages)-1]
+			last.Content = appendBlocks(last.Content, blocks)
+			continue
+		}
+		messages = append(messages, brtypes.Message{Role: role, Content: blocks})
+	}
+	if len(messages) == 0 || messages[0].Role != brtypes.ConversationRoleUser {
+		return nil, fmt.Errorf("a conversation must start with a user message")
+	}
+
+	input := &bedrockruntime.ConverseInput{ModelId: aws.String(req.ModelID)}
+	if req.System != "" {
+		if model.System {
+			input.System = []brtypes.SystemContentBlock{&brtypes.SystemContentBlockMemberText{Value: req.System}}
+		} else {
+			system := []brtypes.ContentBlock{&brtypes.ContentBlockMemberText{Value: req.System}}
+			messages[0].Content = appendBlocks(system, messages[0].Content)
+		}
+	}
+	input.Messages = messages
+
+	if req.Temperature != nil || req.MaxTokens > 0 || len(req.StopSequences) > 0 {
+		config := &brtypes.InferenceConfiguration{StopSequences: req.StopSequences, Temperature: req.Temperature}
+		if req.MaxTokens > 0 {
+			maxTokens := req.MaxTokens
+			if model.MaxOutputTokens > 0 && maxTokens > model.MaxOutputTokens {
+				maxTokens = model.MaxOutputTokens
+			}
+			config.MaxTokens = aws.Int32(int32(maxTokens))
+		}
+		input.InferenceConfig = config
+	}
+
+	if len(req.Tools) > 0 {
+		if !model.Tools {
+			return nil, fmt.Errorf("%w: %s", ErrToolsUnsupported, req.ModelID)
+		}
+		config := &brtypes.ToolConfiguration{}
+		for _, tool := range req.Tools {
+			var schema map[string]interface{}
+			if err := json.Unmarshal(tool.InputSchema, &schema); err != nil {
+				return nil, fmt.Errorf("invalid input schema of tool %s: %w", tool.Name, err)
+			}
+			config.Tools = append(config.Tools, &brtypes.ToolMemberToolSpec{Value: brtypes.ToolSpecification{
+				Name:        aws.String(tool.Name),
+				Description: aws.String(tool.Description),
+				InputSchema: &brtypes.ToolInputSchemaMemberJson{Value: document.NewLazyDocument(schema)},
+			}})
+		}
+		input.ToolConfig = config
+	}
+
+	return input, nil
+}
+
+// contentBlocks converts a message to Converse content blocks, leaving out empty text.
+func contentBlocks(message types.LLMMessage) ([]brtypes.ContentBlock, error) {
+	var blocks []brtypes.ContentBlock
+	if strings.TrimSpace(message.Content) != "" {
+		blocks = append(blocks, &brtypes.ContentBlockMemberText{Value: message.Content})
+	}
+	for _, call := range message.ToolCalls {
+		var input map[string]interface{}
+		if len(call.Input) > 0 {
+			if err := json.Unmarshal(call.Input, &input); err != nil {
+				return nil, fmt.Errorf("invalid input of tool call %s: %w", call.ID, err)
+			}
+		}
+		if input == nil {
+			input = map[string]interface{}{}
+		}
+		blocks = append(blocks, &brtypes.ContentBlockMemberToolUse{Value: brtypes.ToolUseBlock{
+			ToolUseId: aws.String(call.ID),
+			Name:      aws.String(call.Name),
+			Input:     document.NewLazyDocument(input),
+		}})
+	}
+	for _, result := range message.ToolResults {
+		status := brtypes.ToolResultStatusSuccess
+		if result.IsError {
+			status = brtypes.ToolResultStatusError
+		}
+		blocks = append(blocks, &brtypes.ContentBlockMemberToolResult{Value: brtypes.ToolResultBlock{
+			ToolUseId: aws.String(result.ToolCallID),
+			Content:   []brtypes.ToolResultContentBlock{&brtypes.ToolResultContentBlockMemberText{Value: result.Content}},
+			Status:    status,
+		}})
+	}
+	return blocks, nil
+}
+
+// appendBlocks appends blocks to content, joining adjacent text blocks with a blank line.
+func appendBlocks(content []brtypes.ContentBlock, blocks []brtypes.ContentBlock) []brtypes.ContentBlock {
+	for _, block := range blocks {
+		if len(content) > 0 {
+			last, lastIsText := content[len(content)-1].(*brtypes.ContentBlockMemberText)
+			text, isText := block.(*brtypes.ContentBlockMemberText)
+			if lastIsText && isText {
+				content[len(content)-1] = &brtypes.ContentBlockMemberText{Value: last.Value + "\n\n" + text.Value}
+				continue
+			}
+		}
+		content = append(content, block)
+	}
+	return content
+}
+
+func tokenUsage(usage *brtypes.TokenUsage) types.TokenUsage {
+	if usage == nil {
+		return types.TokenUsage{}
+	}
+	return types.TokenUsage{
+		InputTokens:  int(aws.ToInt32(usage.InputTokens)),
+		OutputTokens: int(aws.ToInt32(usage.OutputTokens)),
+		TotalTokens:  int(aws.ToInt32(usage.TotalTokens)),
+	}
+}
@@ -0,0 +1,88 @@
+package llm
+
+import (
+	"context"
+	"errors"
+
+	"rag-demo/types"
+)
+
+// LLM calls a chat model. Implementations accept the same request for every supported model and
+// adapt it to what the model family understands.
+type LLM interface {
+	// Converse returns the complete reply of the model.
+	Converse(ctx context.Context, req types.LLMRequest) (types.LLMResponse, error)
+	// ConverseStream calls onToken with every text delta as it arrives and returns the complete reply
+	// once the model has finished. Cancelling ctx, or onToken returning an error, aborts the call.
+	ConverseStream(ctx context.Context, req types.LLMRequest, onToken func(token string) error) (types.LLMResponse, error)
+}
+
+// ErrToolsUnsupported is returned for requests with tools to a model that can't call them.
+var ErrToolsUnsupported = errors.New("model does not support tool use")
+
+const (
+	FamilyClaude  = "claude"
+	FamilyLlama   = "llama"
+	FamilyMistral = "mistral"
+	FamilyTitan   = "titan"
+)
+
+// Model describes a supported Bedrock text model and the constraints requests to it are adapted to.
+type Model struct {
+	ID              string
+	Family          string
+	System          bool // accepts a separate system prompt; otherwise it is prepended to the first user message
+	MaxOutputTokens int  // larger MaxTokens requests are lowered to this
+	Tools           bool // can call tools through the Converse toolConfig
+}
+
+// SupportedModels are the Bedrock text generation models an assistant can be configured with.
+var SupportedModels = []Model{
+	{ID: "anthropic.claude-3-5-sonnet-20240620-v1:0", Family: FamilyClaude, System: true, MaxOutputTokens: 4096, Tools: true},
+	{ID: "anthropic.claude-3-sonnet-20240229-v1:0", Family: FamilyClaude, System: true, MaxOutputTokens: 4096, Tools: true},
+	{ID: "anthropic.claude-3-haiku-20240307-v1:0", Family: FamilyClaude, System: true, MaxOutputTokens: 4096, Tools: true},
+	{ID: "anthropic.claude-3-opus-20240229-v1:0", Family: FamilyClaude, System: true, MaxOutputTokens: 4096, Tools: true},
+	{ID: "meta.llama3-8b-instruct-v1:0", Family: FamilyLlama, System: true, MaxOutputTokens: 2048},
+	{ID: "meta.llama3-70b-instruct-v1:0", Family: FamilyLlama, System: true, MaxOutputTokens: 2048},
+	{ID: "mistral.mistral-7b-instruct-v0:2", Family: FamilyMistral, System: false, MaxOutputTokens: 8192},
+	{ID: "mistral.mixtral-8x7b-instruct-v0:1", Family: FamilyMistral, System: false, MaxOutputTokens: 4096},
+	{ID: "mistral.mistral-large-2402-v1:0", Family: FamilyMistral, System: true, MaxOutputTokens: 8192, Tools: true},
+	{ID: "amazon.titan-text-express-v1", Family: FamilyTitan, System: false, MaxOutputTokens: 8192},
+	{ID: "amazon.titan-text-lite-v1", Family: FamilyTitan, System: false, MaxOutputTokens: 4096},
+}
+
+// LookupModel returns the supported model with the given Bedrock model id.
+func LookupModel(modelID string) (Model, bool) {
+	for _, model := range SupportedModels {
+		if model.ID == modelID {
+			return model, true
+		}
+	}
+	return Model{}, false
+}
+
+// SupportsTools reports whether modelID is a supported model that can call tools.
+func SupportsTools(modelID string) bool {
+	model, ok := LookupModel(modelID)
+	return ok && model.Tools
+}
+
+// IsSupportedModel reports whether modelID is one of SupportedModels.
+func IsSupportedModel(modelID string) bool {
+	_, ok := LookupModel(modelID)
+	return ok
+}
+
+// Generate sends a single-turn prompt and returns the reply text; a shorthand for the internal calls
+// that rewrite queries or summarise conversations.
+func Generate(ctx context.Context, model LLM, modelID string, system string, prompt string) (string, error) {
+	response, err := model.Converse(ctx, types.LLMRequest{
+		ModelID:  modelID,
+		System:   system,
+		Messages: []types.LLMMessage{{Role: types.LLMRoleUser, Content: prompt}},
+	})
+	if err != nil {
+		return "", err
+	}
+	return response.Text, nil
+}
@@ -0,0 +1,119 @@
+package llm
+
+import (
+	"context"
+	"strings"
+	"sync"
+
+	"rag-demo/types"
+)
+
+// ScriptedLLM is an in-process LLM that answers from a script instead of calling a model, for tests
+// and for running the service without AWS credentials. It records every request it receives.
+type ScriptedLLM struct {
+	Script []types.LLMResponse // returned in order, e.g. tool calls followed by an answer, before falling back to Reply
+	Reply  string              // returned when the script is used up and no route matches
+	Routes map[string]string   // replies keyed by a phrase of the system prompt, so one fake can play several roles
+	Err    error               // returned instead of a reply when set
+
+	mu       sync.Mutex
+	requests []types.LLMRequest
+}
+
+func (s *ScriptedLLM) Converse(ctx context.Context, req types.LLMRequest) (types.LLMResponse, error) {
+	response, err := s.record(req)
+	if err != nil {
+		return types.LLMResponse{}, err
+	}
+	response.Usage = scriptedUsage(req, len(strings.Fields(response.Text)))
+	return response, nil
+}
+
+// ConverseStream replays the reply word by word.
+func (s *ScriptedLLM) ConverseStream(ctx context.Context, req types.LLMRequest, onToken func(token string) error) (types.LLMResponse, error) {
+	response, err := s.record(req)
+	if err != nil {
+		return types.LLMResponse{}, err
+	}
+
+	var words []string
+	if response.Text != "" {
+		words = strings.SplitAfter(response.Text, " ")
+	}
+	var text strings.Builder
+	for _, word := range words {
+		text.WriteString(word)
+		if err := onToken(word); err != nil {
+			return types.LLMResponse{Text: text.String()}, err
+		}
+	}
+	response.Usage = scriptedUsage(req, len(words))
+	return response, nil
+}
+
+func (s *ScriptedLLM) record(req types.LLMRequest) (types.LLMResponse, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.requests = append(s.requests, req)
+	if s.Err != nil {
+		return types.LLMResponse{}, s.Err
+	}
+	if len(s.Script) > 0 {
+		response := s.Script[0]
+		s.Script = s.Script[1:]
+		if response.StopReason == "" {
+			response.StopReason = "end_turn"
+			if len(response.ToolCalls) > 0 {
+				response.StopReason = "tool_use"
+			}
+		}
+		return response, nil
+	}
+	for phrase, reply := range s.Routes {
+		if strings.Contains(req.System, phrase) {
+			return types.LLMResponse{Text: reply, StopReason: "end_turn"}, nil
+		}
+	}
+	return types.LLMResponse{Text: s.Reply, StopReason: "end_turn"}, nil
+}
+
+// Requests returns the requests received so far.
+func (s *ScriptedLLM) Requests() []types.LLMRequest {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]types.LLMRequest{}, s.requests...)
+}
+
+// Systems returns the system prompt of every request received so far.
+func (s *ScriptedLLM) Systems() []string {
+	var systems []string
+	for _, req := range s.Requests() {
+		systems = append(systems, req.System)
+	}
+	return systems
+}
+
+// Prompts returns the last user message of every request received so far.
+func (s *ScriptedLLM) Prompts() []string {
+	var prompts []string
+	for _, req := range s.Requests() {
+		prompt := ""
+		for _, message := range req.Messages {
+			if message.Role == types.LLMRoleUser {
+				prompt = message.Content
+			}
+		}
+		prompts = append(prompts, prompt)
+	}
+	return prompts
+}
+
+// scriptedUsage counts words as tokens.
+func scriptedUsage(req types.LLMRequest, outputTokens int) types.TokenUsage {
+	inputTokens := len(strings.Fields(req.System))
+	for _, message := range req.Messages {
+		inputTokens += len(strings.Fields(message.Content))
+	}
+	return types.TokenUsage{InputTokens: inputTokens, OutputTokens: outputTokens, TotalTokens: inputTokens + outputTokens}
+}
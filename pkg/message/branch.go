@@ -0,0 +1,74 @@
+package message
+
+import (
+	"rag-demo/types"
+
+	"github.com/google/uuid"
+)
+
+// A session's turns form a tree: each turn follows its parent, and regenerating an answer or editing a
+// message adds a sibling of the original turn. The helpers below take a session's turns oldest first.
+
+// ancestry returns the turns from the first one of the branch up to leaf, or nil if leaf isn't among
+// the turns.
+func ancestry(turns []types.Message, leaf uuid.UUID) []types.Message {
+	byID := make(map[uuid.UUID]types.Message, len(turns))
+	for _, turn := range turns {
+		byID[turn.ID] = turn
+	}
+
+	var branch []types.Message
+	for id := leaf; id != uuid.Nil; {
+		turn, ok := byID[id]
+		if !ok || len(branch) > len(turns) {
+			// an unknown leaf, or a cycle that only corrupt data could produce
+			return nil
+		}
+		branch = append(branch, turn)
+		id = turn.ParentID
+	}
+	for i, j := 0, len(branch)-1; i < j; i, j = i+1, j-1 {
+		branch[i], branch[j] = branch[j], branch[i]
+	}
+	return branch
+}
+
+// activeBranch returns the branch through the given turn, continued with the latest child of each turn
+// after it. A nil through picks the branch of the latest turn.
+func activeBranch(turns []types.Message, through uuid.UUID) []types.Message {
+	if len(turns) == 0 {
+		return nil
+	}
+	if through == uuid.Nil {
+		through = turns[len(turns)-1].ID
+	}
+	branch := ancestry(turns, through)
+	if branch == nil {
+		return nil
+	}
+
+	latestChild := make(map[uuid.UUID]types.Message)
+	for _, turn := range turns {
+		latestChild[turn.ParentID] = turn
+	}
+	for {
+		child, ok := latestChild[branch[len(branch)-1].ID]
+		if !ok {
+			return branch
+		}
+		branch = append(branch, child)
+	}
+}
+
+// withSiblings sets the sibling ids and counts of the branch's turns.
+func withSiblings(branch []types.Message, turns []types.Message) []types.Message {
+	children := make(map[uuid.UUID][]uuid.UUID)
+	for _, turn := range turns {
+		children[turn.ParentID] = append(children[turn.ParentID], turn.ID)
+	}
+	for i := range branch {
+		branch[i].SiblingIDs = children[branch[i].ParentID]
+		branch[i].SiblingCount = len(branch[i].SiblingIDs)
+	}
+	return branch
+}
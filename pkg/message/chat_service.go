@@ -0,0 +1,433 @@
+package message
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"rag-demo/pkg/grounding"
+	"rag-demo/pkg/guardrail"
+	"rag-demo/pkg/llm"
+	"rag-demo/pkg/search"
+	"rag-demo/pkg/textsql"
+	"rag-demo/pkg/tools"
+	"rag-demo/pkg/usage"
+	"rag-demo/types"
+)
+
+// rewriteTurns is how many recent turns are given to the model when rewriting a follow-up question.
+const rewriteTurns = 3
+
+// ChatService defines the interface for answering chat messages.
+type ChatService interface {
+	SendMessage(ctx context.Context, session types.Session, req types.MessageRequest, resultCh types.ResultChannel, wg *sync.WaitGroup)
+	StreamMessage(ctx context.Context, session types.Session, req types.MessageRequest, eventCh chan<- types.ChatEvent)
+}
+
+type ChatServiceImpl struct {
+	AssistantGateway  types.AssistantTableGateway
+	MessageGateway    types.MessageTableGateway
+	Retriever         *search.Retriever
+	Model             llm.LLM
+	Memory            *ConversationMemory      // nil answers every message without history
+	Transformer       *search.QueryTransformer // nil searches with the message as typed
+	UserGateway       types.UserTableGateway   // nil renders {{.UserName}} empty
+	Tools             *tools.Registry          // tools assistants can call besides the built-in ones
+	MaxToolIterations int                      // model calls per answer when the assistant uses tools
+	SQL               *textsql.Service         // nil fails messages to text-to-SQL assistants
+	Guardrail         guardrail.Guardrail      // applies the assistants' guardrail policies; nil skips them
+	Verifier          *grounding.Verifier      // checks answers of assistants with a groundedness policy; nil skips it
+}
+
+func NewChatService(assistantGateway types.AssistantTableGateway, messageGateway types.MessageTableGateway, retriever *search.Retriever, model llm.LLM, memory *ConversationMemory, transformer *search.QueryTransformer, userGateway types.UserTableGateway, toolRegistry *tools.Registry, sqlService *textsql.Service, guard guardrail.Guardrail, verifier *grounding.Verifier) ChatService {
+	return &ChatServiceImpl{
+		AssistantGateway:  assistantGateway,
+		MessageGateway:    messageGateway,
+		Retriever:         retriever,
+		Model:             model,
+		Memory:            memory,
+		Transformer:       transformer,
+		UserGateway:       userGateway,
+		Tools:             toolRegistry,
+		MaxToolIterations: tools.DefaultMaxIterations,
+		SQL:               sqlService,
+		Guardrail:         guard,
+		Verifier:          verifier,
+	}
+}
+
+// SendMessage retrieves context for the message from the assistant's kbases, asks the assistant's
+// model for an answer and stores the turn in the message table.
+func (cs *ChatServiceImpl) SendMessage(ctx context.Context, session types.Session, req types.MessageRequest, resultCh types.ResultChannel, wg *sync.WaitGroup) {
+	defer wg.Done()
+
+	response, err := cs.answer(ctx, session, req)
+	if err != nil {
+		resultCh <- types.Result{
+			Data:    nil,
+			Error:   err,
+			Success: false,
+		}
+		return
+	}
+
+	resultCh <- types.Result{
+		Data:    response,
+		Error:   nil,
+		Success: true,
+	}
+}
+
+// StreamMessage works like SendMessage but emits the sources, every generated token, the tool calls or
+// the query result of a text-to-SQL assistant, the token usage, the resolved citations and finally the
+// stored response as events. The channel is closed when the stream ends. If ctx is cancelled mid-stream
+// the upstream model call is aborted and nothing is stored. An assistant with guardrails doesn't stream
+// its tokens: the answer is emitted as a single token once the output guardrail has checked it.
+// Guardrail interventions are emitted as they happen, and the groundedness event of an answer that was
+// refused or annotated carries the answer that replaces the streamed tokens.
+func (cs *ChatServiceImpl) StreamMessage(ctx context.Context, session types.Session, req types.MessageRequest, eventCh chan<- types.ChatEvent) {
+	defer close(eventCh)
+	ctx = usage.WithScope(ctx, usageScope(session, req))
+
+	fail := func(err error) {
+		eventCh <- types.ChatEvent{Event: types.ChatEventError, Data: map[string]string{"error": err.Error()}}
+	}
+	sources := func(response types.ChatResponse) types.ChatEvent {
+		return types.ChatEvent{Event: types.ChatEventSources, Data: map[string]interface{}{
+			"outcome":         response.Outcome,
+			"rewritten_query": response.RewrittenQuery,
+			"sources":         response.Sources,
+		}}
+	}
+
+	t, err := cs.retrieve(ctx, session, req)
+	if err != nil {
+		fail(err)
+		return
+	}
+	for _, result := range t.response.Guardrails {
+		eventCh <- types.ChatEvent{Event: types.ChatEventGuardrail, Data: map[string]interface{}{"guardrail": result}}
+	}
+	eventCh <- sources(t.response)
+
+	if t.blocked {
+		eventCh <- types.ChatEvent{Event: types.ChatEventToken, Data: map[string]string{"text": t.response.Answer}}
+	} else if t.response.Outcome == types.SearchOutcomeNoRelevantContext {
+		t.response.Answer = types.NoRelevantContextAnswer
+		eventCh <- types.ChatEvent{Event: types.ChatEventToken, Data: map[string]string{"text": t.response.Answer}}
+	} else {
+		// tokens can't be taken back, so an answer under guardrails is held until it has been checked
+		guarded := cs.Guardrail != nil && t.assistant.Guardrails != nil
+		err := cs.generate(ctx, &t, tools.RunOptions{
+			OnToken: func(token string) error {
+				if !guarded {
+					eventCh <- types.ChatEvent{Event: types.ChatEventToken, Data: map[string]string{"text": token}}
+				}
+				return ctx.Err()
+			},
+			OnToolCall: func(call types.ToolCallRecord) {
+				eventCh <- types.ChatEvent{Event: types.ChatEventToolCall, Data: call}
+			},
+		}, func(result types.SQLResult) {
+			eventCh <- types.ChatEvent{Event: types.ChatEventSQL, Data: result}
+		})
+		if err != nil {
+			fail(err)
+			return
+		}
+		if err := cs.verify(ctx, &t); err != nil {
+			fail(err)
+			return
+		}
+		checked := len(t.response.Guardrails)
+		if err := cs.guard(ctx, &t, types.GuardrailSourceOutput); err != nil {
+			fail(err)
+			return
+		}
+		if guarded {
+			eventCh <- types.ChatEvent{Event: types.ChatEventToken, Data: map[string]string{"text": t.response.Answer}}
+		}
+		if t.found != nil {
+			// the passages found by the model's searches
+			eventCh <- sources(t.response)
+		}
+		if t.response.Groundedness != nil {
+			eventCh <- types.ChatEvent{Event: types.ChatEventGroundedness, Data: map[string]interface{}{
+				"groundedness": t.response.Groundedness,
+				"answer":       t.response.Answer,
+			}}
+		}
+		for _, result := range t.response.Guardrails[checked:] {
+			eventCh <- types.ChatEvent{Event: types.ChatEventGuardrail, Data: map[string]interface{}{"guardrail": result}}
+		}
+		eventCh <- types.ChatEvent{Event: types.ChatEventUsage, Data: *t.response.Usage}
+		eventCh <- types.ChatEvent{Event: types.ChatEventCitations, Data: map[string]interface{}{
+			"citations":         t.response.Citations,
+			"invalid_citations": t.response.InvalidCitations,
+		}}
+	}
+
+	if err := cs.store(ctx, session, t); err != nil {
+		fail(err)
+		return
+	}
+
+	// the client already has the sources and the answer, so done only carries the ids
+	eventCh <- types.ChatEvent{Event: types.ChatEventDone, Data: map[string]interface{}{
+		"message_id": t.response.MessageID,
+		"session_id": t.response.SessionID,
+	}}
+}
+
+func (cs *ChatServiceImpl) answer(ctx context.Context, session types.Session, req types.MessageRequest) (types.ChatResponse, error) {
+	ctx = usage.WithScope(ctx, usageScope(session, req))
+	t, err := cs.retrieve(ctx, session, req)
+	if err != nil {
+		return types.ChatResponse{}, err
+	}
+
+	switch {
+	case t.blocked:
+		// the input guardrail already answered
+	case t.response.Outcome == types.SearchOutcomeNoRelevantContext:
+		// don't let the model answer from its own knowledge when the kbases had nothing relevant
+		t.response.Answer = types.NoRelevantContextAnswer
+	default:
+		if err := cs.generate(ctx, &t, tools.RunOptions{}, nil); err != nil {
+			return types.ChatResponse{}, err
+		}
+		if err := cs.verify(ctx, &t); err != nil {
+			return types.ChatResponse{}, err
+		}
+		if err := cs.guard(ctx, &t, types.GuardrailSourceOutput); err != nil {
+			return types.ChatResponse{}, err
+		}
+	}
+
+	if err := cs.store(ctx, session, t); err != nil {
+		return types.ChatResponse{}, err
+	}
+	return t.response, nil
+}
+
+// turn is a message being answered.
+type turn struct {
+	assistant types.Assistant
+	message   string // the user's message, masked by the input guardrail if it masked
+	blocked   bool   // a guardrail blocked the message or answer; response.Answer is its blocked message
+	response  types.ChatResponse
+	request   types.LLMRequest
+	toolset   []tools.Tool
+	found     *foundSources // passages found by the kbase search tool, nil when the assistant doesn't use it
+}
+
+// generate has the assistant's model answer the turn, running the tools it calls, and resolves the citations.
+// Text-to-SQL assistants answer with a query and a summary of its result, which is passed to onSQL first.
+func (cs *ChatServiceImpl) generate(ctx context.Context, t *turn, opts tools.RunOptions, onSQL func(types.SQLResult)) error {
+	t.response.PromptVersion = t.assistant.PromptVersion
+	if t.assistant.Type == types.AssistantTypeTextToSQL {
+		if cs.SQL == nil {
+			return textsql.ErrNotConfigured
+		}
+		result, summary, err := cs.SQL.Answer(ctx, t.request, onSQL, opts.OnToken)
+		if err != nil {
+			return err
+		}
+		t.response.Answer = summary.Text
+		t.response.Usage = &summary.Usage
+		t.response.SQL = &result
+		return nil
+	}
+
+	reply, calls, err := tools.NewAgent(cs.Model, cs.MaxToolIterations).Run(ctx, t.request, t.toolset, opts)
+	if err != nil {
+		return err
+	}
+
+	t.response.Answer = reply.Text
+	t.response.Usage = &reply.Usage
+	t.response.ToolCalls = calls
+	if t.found != nil {
+		t.response.Sources = append(t.response.Sources, t.found.list()...)
+	}
+	t.response.Citations, t.response.InvalidCitations = extractCitations(t.response.Answer, t.response.Sources)
+	return nil
+}
+
+// retrieve loads the assistant and the conversation history, searches the assistant's kbases for context
+// and builds the model request and toolset for the turn. The session's assistant answers if it is bound
+// to one, otherwise the one named in the request. Assistants with the kbase search tool search while
+// answering instead, and text-to-SQL assistants don't search. A message the input guardrail blocks is
+// returned as a blocked turn before anything else is done.
+func (cs *ChatServiceImpl) retrieve(ctx context.Context, session types.Session, req types.MessageRequest) (turn, error) {
+	assistantID := selectedAssistant(session, req)
+	if assistantID == uuid.Nil {
+		return turn{}, fmt.Errorf("no assistant selected for the session")
+	}
+
+	assistant, err := cs.AssistantGateway.GetAssistant(ctx, assistantID)
+	if err != nil {
+		return turn{}, fmt.Errorf("error loading assistant: %w", err)
+	}
+
+	parentID, err := cs.parent(ctx, session, req)
+	if err != nil {
+		return turn{}, err
+	}
+
+	t := turn{assistant: assistant, message: req.Message}
+	t.response = types.ChatResponse{
+		MessageID: uuid.New(),
+		SessionID: session.ID,
+		ParentID:  parentID,
+		Sources:   []types.SearchHit{},
+		Citations: []types.Citation{},
+	}
+	if err := cs.guard(ctx, &t, types.GuardrailSourceInput); err != nil {
+		return turn{}, err
+	}
+	if t.blocked {
+		return t, nil
+	}
+
+	var history History
+	if cs.Memory != nil {
+		history, err = cs.Memory.Load(ctx, session, parentID, assistant.Model)
+		if err != nil {
+			return turn{}, err
+		}
+	}
+
+	links, err := cs.AssistantGateway.ListAssistantKbases(ctx, assistant.ID)
+	if err != nil {
+		return turn{}, fmt.Errorf("error loading assistant kbases: %w", err)
+	}
+
+	searched := links
+	if assistant.Type == types.AssistantTypeTextToSQL {
+		searched = nil
+	}
+
+	t.toolset, t.found, err = cs.toolset(assistant, searched)
+	if err != nil {
+		return turn{}, err
+	}
+
+	if len(searched) > 0 && t.found == nil {
+		query := t.message
+		// a follow-up like "and for children?" embeds poorly on its own, so it is rewritten using the history
+		if cs.Transformer != nil && !history.Empty() {
+			query, err = cs.Transformer.Standalone(ctx, t.message, history.recent(rewriteTurns))
+			if err != nil {
+				return turn{}, err
+			}
+			t.response.RewrittenQuery = query
+		}
+
+		result, err := cs.Retriever.SearchLinked(ctx, query, searched)
+		if err != nil {
+			return turn{}, err
+		}
+		t.response.Outcome = result.Outcome
+		t.response.Sources = result.Hits
+	}
+
+	vars, err := cs.promptVariables(ctx, session, assistant.SystemPrompts, links)
+	if err != nil {
+		return turn{}, err
+	}
+	system, err := buildSystemPrompt(assistant.SystemPrompts, vars, t.response.Sources, history)
+	if err != nil {
+		return turn{}, err
+	}
+
+	t.request = types.LLMRequest{
+		ModelID:  assistant.Model,
+		System:   system,
+		Messages: buildMessages(history, t.message),
+	}
+	return t, nil
+}
+
+// selectedAssistant returns the id of the assistant that answers the message: the session's if it is
+// bound to one, otherwise the one named in the request.
+func selectedAssistant(session types.Session, req types.MessageRequest) uuid.UUID {
+	if session.AssistantID != uuid.Nil {
+		return session.AssistantID
+	}
+	return req.AssistantID
+}
+
+// usageScope attributes the model calls made to answer the message to its user, session and assistant.
+func usageScope(session types.Session, req types.MessageRequest) types.UsageScope {
+	return types.UsageScope{UserID: session.UserID, SessionID: session.ID, AssistantID: selectedAssistant(session, req)}
+}
+
+// parent returns the turn the message follows: the one the request names, which must be in the
+// session, or the session's latest turn. It is uuid.Nil for a first turn.
+func (cs *ChatServiceImpl) parent(ctx context.Context, session types.Session, req types.MessageRequest) (uuid.UUID, error) {
+	if req.ParentID != nil {
+		if *req.ParentID == uuid.Nil {
+			return uuid.Nil, nil
+		}
+		parent, err := cs.MessageGateway.GetMessage(ctx, *req.ParentID)
+		if errors.Is(err, pgx.ErrNoRows) || (err == nil && parent.SessionID != session.ID) {
+			return uuid.Nil, ErrMessageNotFound
+		}
+		if err != nil {
+			return uuid.Nil, fmt.Errorf("error loading parent message: %w", err)
+		}
+		return parent.ID, nil
+	}
+
+	turns, err := cs.MessageGateway.ListMessages(ctx, session.ID, nil)
+	if err != nil {
+		return uuid.Nil, fmt.Errorf("error loading messages: %w", err)
+	}
+	if len(turns) == 0 {
+		return uuid.Nil, nil
+	}
+	return turns[len(turns)-1].ID, nil
+}
+
+// store persists the answered turn in the message table.
+func (cs *ChatServiceImpl) store(ctx context.Context, session types.Session, t turn) error {
+	response := t.response
+	success, err := cs.MessageGateway.CreateMessage(ctx, types.Message{
+		ID:             response.MessageID,
+		SessionID:      session.ID,
+		ParentID:       response.ParentID,
+		UserID:         session.UserID,
+		AssistantID:    t.assistant.ID,
+		UserMessage:    t.message,
+		RewrittenQuery: response.RewrittenQuery,
+		AIMessage:      response.Answer,
+		Sources:        response.Sources,
+		Citations:      response.Citations,
+		PromptVersion:  response.PromptVersion,
+		ToolCalls:      response.ToolCalls,
+		SQL:            withoutRows(response.SQL),
+		Guardrails:     response.Guardrails,
+		Groundedness:   response.Groundedness,
+	})
+	if err != nil {
+		return fmt.Errorf("error storing message: %w", err)
+	}
+	if !success {
+		return fmt.Errorf("failed to store message")
+	}
+	return nil
+}
+
+// withoutRows drops the rows of a query result before it is stored; the query can be run again.
+func withoutRows(result *types.SQLResult) *types.SQLResult {
+	if result == nil {
+		return nil
+	}
+	stored := *result
+	stored.Rows = nil
+	return &stored
+}
@@ -0,0 +1,109 @@
+package message
+
+import (
+	"regexp"
+	"strconv"
+	"strings"
+	"unicode"
+
+	"rag-demo/types"
+)
+
+const maxQuoteLength = 200
+
+// citationPattern matches the markers the model is asked to write: [1], and [1, 3] for several sources.
+var citationPattern = regexp.MustCompile(`\[(\d+(?:\s*,\s*\d+)*)\]`)
+
+var sentencePattern = regexp.MustCompile(`[^.!?\n]+[.!?]?`)
+
+// extractCitations resolves the [n] markers of an answer against the numbered sources the model was
+// given. Each source cited is returned once, in order of first citation, with a quote from the passage
+// that best supports the sentence citing it. Markers that don't name a provided source are returned
+// separately so the caller can flag them.
+func extractCitations(answer string, hits []types.SearchHit) ([]types.Citation, []int) {
+	citations := []types.Citation{}
+	var invalid []int
+	seen := make(map[int]bool)
+
+	for _, loc := range citationPattern.FindAllStringSubmatchIndex(answer, -1) {
+		claim := citingSentence(answer, loc[0])
+		for _, field := range strings.Split(answer[loc[2]:loc[3]], ",") {
+			marker, err := strconv.Atoi(strings.TrimSpace(field))
+			if err != nil || seen[marker] {
+				continue
+			}
+			seen[marker] = true
+
+			if marker < 1 || marker > len(hits) {
+				invalid = append(invalid, marker)
+				continue
+			}
+			hit := hits[marker-1]
+			citations = append(citations, types.Citation{
+				Marker:     marker,
+				KbaseID:    hit.KbaseID,
+				Document:   hit.Source,
+				ChunkID:    hit.ChunkID,
+				ChunkStart: hit.ChunkStart,
+				ChunkEnd:   hit.ChunkEnd,
+				PageStart:  hit.PageStart,
+				PageEnd:    hit.PageEnd,
+				Quote:      bestQuote(hit.Content, claim),
+			})
+		}
+	}
+	return citations, invalid
+}
+
+// citingSentence returns the text of the sentence that ends at a citation marker.
+func citingSentence(answer string, markerStart int) string {
+	before := citationPattern.ReplaceAllString(answer[:markerStart], "")
+	before = strings.TrimRight(before, " ")
+	start := strings.LastIndexAny(strings.TrimRight(before, ".!?"), ".!?\n")
+	return strings.TrimSpace(before[start+1:])
+}
+
+// bestQuote picks the sentence of the passage sharing the most words with the claim, shortened to maxQuoteLength.
+func bestQuote(content string, claim string) string {
+	claimWords := make(map[string]bool)
+	for _, word := range quoteWords(claim) {
+		claimWords[word] = true
+	}
+
+	best := ""
+	bestScore := -1
+	for _, sentence := range sentencePattern.FindAllString(content, -1) {
+		sentence = strings.TrimSpace(sentence)
+		if sentence == "" {
+			continue
+		}
+		score := 0
+		for _, word := range quoteWords(sentence) {
+			if claimWords[word] {
+				score++
+			}
+		}
+		if score > bestScore {
+			best, bestScore = sentence, score
+		}
+	}
+
+	runes := []rune(best)
+	if len(runes) > maxQuoteLength {
+		return strings.TrimSpace(string(runes[:maxQuoteLength])) + "…"
+	}
+	return best
+}
+
+// quoteWords lowercases text and splits it into words, skipping short ones that match everywhere.
+func quoteWords(text string) []string {
+	var words []string
+	for _, word := range strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	}) {
+		if len([]rune(word)) > 3 {
+			words = append(words, word)
+		}
+	}
+	return words
+}
@@ -0,0 +1,170 @@
+package message
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"rag-demo/types"
+)
+
+const (
+	DefaultFeedbackPeriod = 30 * 24 * time.Hour
+	DefaultFeedbackLimit  = 10
+	MaxFeedbackLimit      = 100
+)
+
+var (
+	ErrMessageNotFound       = errors.New("message not found")
+	ErrNotMessageOwner       = errors.New("message belongs to another user")
+	ErrInvalidFeedbackFilter = errors.New("invalid feedback filter")
+)
+
+// FeedbackService defines the interface for rating answers and summarising the ratings.
+type FeedbackService interface {
+	SubmitFeedback(ctx context.Context, userID uuid.UUID, messageID uuid.UUID, req types.NewFeedbackRequest, resultCh types.ResultChannel, wg *sync.WaitGroup)
+	SummarizeFeedback(ctx context.Context, filter types.FeedbackFilter, resultCh types.ResultChannel, wg *sync.WaitGroup)
+}
+
+type FeedbackServiceImpl struct {
+	FeedbackGateway types.FeedbackTableGateway
+	MessageGateway  types.MessageTableGateway
+}
+
+func NewFeedbackService(feedbackGateway types.FeedbackTableGateway, messageGateway types.MessageTableGateway) FeedbackService {
+	return &FeedbackServiceImpl{FeedbackGateway: feedbackGateway, MessageGateway: messageGateway}
+}
+
+// SubmitFeedback stores the user's rating of an answer in their session together with the prompt
+// version and the chunks that produced it. It fails with ErrMessageNotFound or ErrNotMessageOwner.
+func (fs *FeedbackServiceImpl) SubmitFeedback(ctx context.Context, userID uuid.UUID, messageID uuid.UUID, req types.NewFeedbackRequest, resultCh types.ResultChannel, wg *sync.WaitGroup) {
+	defer wg.Done()
+
+	fail := func(err error) {
+		resultCh <- types.Result{
+			Data:    nil,
+			Error:   err,
+			Success: false,
+		}
+	}
+
+	message, err := fs.MessageGateway.GetMessage(ctx, messageID)
+	if errors.Is(err, pgx.ErrNoRows) {
+		fail(ErrMessageNotFound)
+		return
+	}
+	if err != nil {
+		fail(fmt.Errorf("error loading message: %w", err))
+		return
+	}
+	if message.UserID != userID {
+		fail(ErrNotMessageOwner)
+		return
+	}
+
+	feedback, err := fs.FeedbackGateway.SaveFeedback(ctx, types.Feedback{
+		ID:            uuid.New(),
+		MessageID:     message.ID,
+		UserID:        userID,
+		SessionID:     message.SessionID,
+		AssistantID:   message.AssistantID,
+		Rating:        req.Rating,
+		Category:      req.Category,
+		Comment:       req.Comment,
+		PromptVersion: message.PromptVersion,
+		Chunks:        feedbackChunks(message),
+	})
+	if err != nil {
+		fail(fmt.Errorf("error storing feedback: %w", err))
+		return
+	}
+
+	resultCh <- types.Result{
+		Data:    feedback,
+		Error:   nil,
+		Success: true,
+	}
+}
+
+// SummarizeFeedback aggregates the feedback selected by the filter. The filter defaults to the last
+// DefaultFeedbackPeriod by day and DefaultFeedbackLimit questions and documents; a range that ends
+// before it starts, an unknown interval or a limit over MaxFeedbackLimit fail with ErrInvalidFeedbackFilter.
+func (fs *FeedbackServiceImpl) SummarizeFeedback(ctx context.Context, filter types.FeedbackFilter, resultCh types.ResultChannel, wg *sync.WaitGroup) {
+	defer wg.Done()
+
+	filter, err := feedbackFilterDefaults(filter, time.Now().UTC())
+	if err != nil {
+		resultCh <- types.Result{
+			Data:    nil,
+			Error:   err,
+			Success: false,
+		}
+		return
+	}
+
+	summary, err := fs.FeedbackGateway.SummarizeFeedback(ctx, filter)
+	if err != nil {
+		resultCh <- types.Result{
+			Data:    nil,
+			Error:   fmt.Errorf("error summarizing feedback: %w", err),
+			Success: false,
+		}
+		return
+	}
+
+	resultCh <- types.Result{
+		Data:    summary,
+		Error:   nil,
+		Success: true,
+	}
+}
+
+func feedbackFilterDefaults(filter types.FeedbackFilter, now time.Time) (types.FeedbackFilter, error) {
+	if filter.To.IsZero() {
+		filter.To = now
+	}
+	if filter.From.IsZero() {
+		filter.From = filter.To.Add(-DefaultFeedbackPeriod)
+	}
+	if !filter.From.Before(filter.To) {
+		return filter, fmt.Errorf("%w: from must be before to", ErrInvalidFeedbackFilter)
+	}
+	switch filter.Interval {
+	case "":
+		filter.Interval = types.FeedbackIntervalDay
+	case types.FeedbackIntervalDay, types.FeedbackIntervalWeek:
+	default:
+		return filter, fmt.Errorf("%w: interval must be day or week", ErrInvalidFeedbackFilter)
+	}
+	if filter.Limit < 0 || filter.Limit > MaxFeedbackLimit {
+		return filter, fmt.Errorf("%w: limit must be between 1 and %d", ErrInvalidFeedbackFilter, MaxFeedbackLimit)
+	}
+	if filter.Limit == 0 {
+		filter.Limit = DefaultFeedbackLimit
+	}
+	return filter, nil
+}
+
+// feedbackChunks lists the best matching chunk of every source of the answer; citation markers count
+// the sources from 1.
+func feedbackChunks(message types.Message) []types.FeedbackChunk {
+	cited := map[int]bool{}
+	for _, citation := range message.Citations {
+		cited[citation.Marker] = true
+	}
+	var chunks []types.FeedbackChunk
+	for i, source := range message.Sources {
+		chunks = append(chunks, types.FeedbackChunk{
+			KbaseID:     source.KbaseID,
+			EmbeddingID: source.EmbeddingID,
+			ChunkID:     source.ChunkID,
+			Source:      source.Source,
+			Cited:       cited[i+1],
+		})
+	}
+	return chunks
+}
@@ -0,0 +1,37 @@
+package message
+
+import (
+	"context"
+	"fmt"
+
+	"rag-demo/pkg/grounding"
+	"rag-demo/types"
+)
+
+// verify checks the turn's answer against its sources when the assistant has a groundedness policy
+// and records the result on the response. An answer below the policy's threshold is refused, losing
+// its citations, or annotated with the sentences the sources don't support. Answers given without
+// sources aren't checked.
+func (cs *ChatServiceImpl) verify(ctx context.Context, t *turn) error {
+	policy := t.assistant.Groundedness
+	if cs.Verifier == nil || policy == nil || len(t.response.Sources) == 0 {
+		return nil
+	}
+
+	result, usage, err := cs.Verifier.Verify(ctx, *policy, t.assistant.Model, t.response.Answer, t.response.Sources)
+	if err != nil {
+		return fmt.Errorf("error verifying groundedness: %w", err)
+	}
+	t.response.Groundedness = &result
+	if t.response.Usage != nil {
+		total := t.response.Usage.Add(usage)
+		t.response.Usage = &total
+	}
+
+	t.response.Answer = grounding.Apply(*policy, t.response.Answer, result)
+	if result.Action == types.GroundednessActionRefuse {
+		t.response.Citations = []types.Citation{}
+		t.response.InvalidCitations = nil
+	}
+	return nil
+}
@@ -0,0 +1,58 @@
+package message
+
+import (
+	"context"
+	"fmt"
+
+	"rag-demo/types"
+)
+
+// guard applies the assistant's guardrail policy to the turn's message or answer and records an
+// intervention on the response. Masked content replaces the original. A blocked message or answer
+// is replaced by the policy's blocked message, and a blocked answer loses its citations and query
+// result, which may hold what was blocked.
+func (cs *ChatServiceImpl) guard(ctx context.Context, t *turn, source string) error {
+	if cs.Guardrail == nil || t.assistant.Guardrails == nil {
+		return nil
+	}
+
+	content := t.message
+	if source == types.GuardrailSourceOutput {
+		content = t.response.Answer
+	}
+	result, checked, err := cs.Guardrail.Check(ctx, *t.assistant.Guardrails, source, content)
+	if err != nil {
+		return fmt.Errorf("error applying guardrails: %w", err)
+	}
+	if result.Action == types.GuardrailActionNone {
+		return nil
+	}
+	t.response.Guardrails = append(t.response.Guardrails, result)
+
+	if result.Action == types.GuardrailActionBlocked {
+		t.blocked = true
+		t.response.Answer = result.Message
+		if source == types.GuardrailSourceOutput {
+			t.response.Citations = []types.Citation{}
+			t.response.InvalidCitations = nil
+			t.response.SQL = nil
+		}
+		return nil
+	}
+	if source == types.GuardrailSourceInput {
+		t.message = checked
+	} else {
+		t.response.Answer = checked
+	}
+	return nil
+}
+
+// blockedInput reports whether the input guardrail blocked the message of a stored turn.
+func blockedInput(message types.Message) bool {
+	for _, result := range message.Guardrails {
+		if result.Source == types.GuardrailSourceInput && result.Action == types.GuardrailActionBlocked {
+			return true
+		}
+	}
+	return false
+}
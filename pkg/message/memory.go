@@ -0,0 +1,217 @@
+package message
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/google/uuid"
+	"rag-demo/pkg/llm"
+	"rag-demo/types"
+)
+
+const (
+	defaultSummaryModelID   = "anthropic.claude-3-haiku-20240307-v1:0"
+	defaultMaxHistoryTokens = 4000
+)
+
+const summarySystemPrompt = `You maintain a running summary of a conversation between a user and an assistant.
+Update the summary with the new turns. Keep names, numbers, products, policies and any open questions the user
+may refer back to later. Write plain prose of at most a few short paragraphs and reply with the summary only.`
+
+// modelTokenLimits describes how a model family tokenizes text and how large its context window is.
+type modelTokenLimits struct {
+	contextWindow int
+	charsPerToken float64
+}
+
+// tokenLimits are keyed by Bedrock model id prefix; token counts are estimates from the
+// average characters per token of each family's tokenizer on English text.
+var tokenLimits = []struct {
+	prefix string
+	limits modelTokenLimits
+}{
+	{"anthropic.claude-3", modelTokenLimits{contextWindow: 200000, charsPerToken: 3.5}},
+	{"anthropic.", modelTokenLimits{contextWindow: 100000, charsPerToken: 3.5}},
+	{"meta.llama3", modelTokenLimits{contextWindow: 8000, charsPerToken: 4.0}},
+	{"meta.", modelTokenLimits{contextWindow: 4000, charsPerToken: 3.6}},
+	{"mistral.", modelTokenLimits{contextWindow: 32000, charsPerToken: 3.8}},
+	{"amazon.titan", modelTokenLimits{contextWindow: 8000, charsPerToken: 4.2}},
+}
+
+var fallbackTokenLimits = modelTokenLimits{contextWindow: 4000, charsPerToken: 3.5}
+
+func limitsFor(modelID string) modelTokenLimits {
+	for _, l := range tokenLimits {
+		if strings.HasPrefix(modelID, l.prefix) {
+			return l.limits
+		}
+	}
+	return fallbackTokenLimits
+}
+
+// CountTokens estimates how many tokens text takes up in the given model's context.
+func CountTokens(modelID string, text string) int {
+	if text == "" {
+		return 0
+	}
+	limits := limitsFor(modelID)
+	return int(float64(len([]rune(text)))/limits.charsPerToken) + 1
+}
+
+// History is the part of a conversation a new turn gets to see: a summary of the older turns
+// and the most recent turns verbatim, oldest first.
+type History struct {
+	Summary string
+	Turns   []types.Message
+}
+
+// Empty reports whether there is no earlier conversation.
+func (h History) Empty() bool {
+	return h.Summary == "" && len(h.Turns) == 0
+}
+
+// recent renders the summary and the last n turns as a transcript.
+func (h History) recent(n int) string {
+	turns := h.Turns
+	if len(turns) > n {
+		turns = turns[len(turns)-n:]
+	}
+
+	var b strings.Builder
+	if h.Summary != "" {
+		fmt.Fprintf(&b, "Summary of earlier turns: %s\n", h.Summary)
+	}
+	writeTurns(&b, turns)
+	return b.String()
+}
+
+// ConversationMemory loads session history from the message table and keeps it within a token
+// budget by folding the oldest turns into a rolling summary stored on the session.
+type ConversationMemory struct {
+	messageGateway   types.MessageTableGateway
+	sessionGateway   types.SessionTableGateway
+	model            llm.LLM
+	summaryModelID   string
+	maxHistoryTokens int
+}
+
+func NewConversationMemory(messageGateway types.MessageTableGateway, sessionGateway types.SessionTableGateway, model llm.LLM, summaryModelID string, maxHistoryTokens int) *ConversationMemory {
+	if summaryModelID == "" {
+		summaryModelID = defaultSummaryModelID
+	}
+	if maxHistoryTokens <= 0 {
+		maxHistoryTokens = defaultMaxHistoryTokens
+	}
+	return &ConversationMemory{
+		messageGateway:   messageGateway,
+		sessionGateway:   sessionGateway,
+		model:            model,
+		summaryModelID:   summaryModelID,
+		maxHistoryTokens: maxHistoryTokens,
+	}
+}
+
+// budget is the number of history tokens allowed for a model: the configured maximum, but never
+// more than a quarter of the model's context window so the retrieved context and answer still fit.
+func (cm *ConversationMemory) budget(modelID string) int {
+	budget := limitsFor(modelID).contextWindow / 4
+	if budget > cm.maxHistoryTokens {
+		budget = cm.maxHistoryTokens
+	}
+	return budget
+}
+
+// Load returns the history of the session's branch ending at the parent turn as seen by modelID; a
+// uuid.Nil parent has no history. When the unsummarised turns don't fit the budget, the oldest ones
+// are summarised and the new summary is saved on the session. The session's summary only applies to
+// the branches through the last turn it covers, on others the branch is summarised anew.
+func (cm *ConversationMemory) Load(ctx context.Context, session types.Session, parentID uuid.UUID, modelID string) (History, error) {
+	if parentID == uuid.Nil {
+		return History{}, nil
+	}
+	all, err := cm.messageGateway.ListMessages(ctx, session.ID, nil)
+	if err != nil {
+		return History{}, fmt.Errorf("error loading history: %w", err)
+	}
+
+	turns := ancestry(all, parentID)
+	history := History{Turns: turns}
+	if session.SummarizedUntil != nil {
+		for i, turn := range turns {
+			if turn.CreatedAt.Equal(*session.SummarizedUntil) {
+				history = History{Summary: session.Summary, Turns: turns[i+1:]}
+				break
+			}
+		}
+	}
+	turns = history.Turns
+
+	budget := cm.budget(modelID)
+	if historyTokens(modelID, history) <= budget {
+		return history, nil
+	}
+
+	// keep as many recent turns as fit in half the budget, the rest of it is left for the summary
+	keep := 0
+	used := 0
+	for i := len(turns) - 1; i >= 0; i-- {
+		tokens := turnTokens(modelID, turns[i])
+		if used+tokens > budget/2 {
+			break
+		}
+		used += tokens
+		keep++
+	}
+	folded := turns[:len(turns)-keep]
+	if len(folded) == 0 {
+		// only the summary is over budget; it is rewritten along with the next folded turn
+		return history, nil
+	}
+
+	summary, err := cm.summarize(ctx, history.Summary, folded)
+	if err != nil {
+		return History{}, err
+	}
+	until := folded[len(folded)-1].CreatedAt
+	if _, err := cm.sessionGateway.UpdateSessionSummary(ctx, session.ID, summary, until); err != nil {
+		return History{}, fmt.Errorf("error storing summary: %w", err)
+	}
+
+	return History{Summary: summary, Turns: turns[len(folded):]}, nil
+}
+
+func (cm *ConversationMemory) summarize(ctx context.Context, previous string, turns []types.Message) (string, error) {
+	var prompt strings.Builder
+	if previous != "" {
+		prompt.WriteString("Current summary:\n")
+		prompt.WriteString(previous)
+		prompt.WriteString("\n\n")
+	}
+	prompt.WriteString("New turns:\n")
+	writeTurns(&prompt, turns)
+
+	summary, err := llm.Generate(ctx, cm.model, cm.summaryModelID, summarySystemPrompt, prompt.String())
+	if err != nil {
+		return "", fmt.Errorf("error summarising history: %w", err)
+	}
+	return strings.TrimSpace(summary), nil
+}
+
+func turnTokens(modelID string, turn types.Message) int {
+	return CountTokens(modelID, turn.UserMessage) + CountTokens(modelID, turn.AIMessage)
+}
+
+func historyTokens(modelID string, history History) int {
+	tokens := CountTokens(modelID, history.Summary)
+	for _, turn := range history.Turns {
+		tokens += turnTokens(modelID, turn)
+	}
+	return tokens
+}
+
+func writeTurns(b *strings.Builder, turns []types.Message) {
+	for _, turn := range turns {
+		fmt.Fprintf(b, "User: %s\nAssistant: %s\n", strings.TrimSpace(turn.UserMessage), strings.TrimSpace(turn.AIMessage))
+	}
+}
@@ -0,0 +1,106 @@
+package message
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"rag-demo/pkg/assistant"
+	"rag-demo/types"
+)
+
+const contextInstructions = `Answer the user's question using only the information in the context below.
+If the context does not contain the answer, say that you don't know instead of guessing.
+Cite the sources that support each statement by writing their id in square brackets right after it, for example [1] or [2, 3].
+Only cite ids of sources in the context.`
+
+const summaryInstructions = `Earlier turns of this conversation are summarised below. Use the summary to resolve references such as "that" or "it" in the user's question.`
+
+// buildSystemPrompt renders the assistant's prompt template for this turn and adds the retrieved passages,
+// unless the template placed them itself with {{.Context}}, and the summary of older turns. Recent turns
+// are sent as messages by buildMessages.
+func buildSystemPrompt(promptTemplate string, vars assistant.PromptVariables, hits []types.SearchHit, history History) (string, error) {
+	vars.Context = buildContext(hits)
+	rendered, err := assistant.RenderPrompt(promptTemplate, vars)
+	if err != nil {
+		return "", err
+	}
+
+	var sections []string
+	if rendered != "" {
+		sections = append(sections, rendered)
+	}
+	if vars.Context != "" && !assistant.UsesVariable(promptTemplate, "Context") {
+		sections = append(sections, vars.Context)
+	}
+	if history.Summary != "" {
+		sections = append(sections, fmt.Sprintf("%s\n\n<summary>\n%s\n</summary>", summaryInstructions, history.Summary))
+	}
+	return strings.Join(sections, "\n\n"), nil
+}
+
+// buildMessages lays out the recent turns as alternating user and assistant messages followed by the
+// user's new message. Answers of text-to-SQL assistants include their query, which follow-up questions
+// often refine. Turns whose message a guardrail blocked are left out.
+func buildMessages(history History, message string) []types.LLMMessage {
+	messages := make([]types.LLMMessage, 0, 2*len(history.Turns)+1)
+	for _, turn := range history.Turns {
+		if blockedInput(turn) {
+			continue
+		}
+		answer := strings.TrimSpace(turn.AIMessage)
+		if turn.SQL != nil {
+			answer = fmt.Sprintf("```sql\n%s\n```\n\n%s", turn.SQL.Query, answer)
+		}
+		messages = append(messages,
+			types.LLMMessage{Role: types.LLMRoleUser, Content: strings.TrimSpace(turn.UserMessage)},
+			types.LLMMessage{Role: types.LLMRoleAssistant, Content: answer},
+		)
+	}
+	return append(messages, types.LLMMessage{Role: types.LLMRoleUser, Content: message})
+}
+
+// buildContext numbers the retrieved passages for the model, empty when there are none.
+func buildContext(hits []types.SearchHit) string {
+	if len(hits) == 0 {
+		return ""
+	}
+
+	return contextInstructions + "\n\n" + formatSources(hits, 0)
+}
+
+// formatSources lists passages for the model, numbered after the first offset sources of the turn.
+func formatSources(hits []types.SearchHit, offset int) string {
+	var block strings.Builder
+	block.WriteString("<context>\n")
+	// sources are numbered from 1 in search order; extractCitations resolves markers the same way
+	for i, hit := range hits {
+		fmt.Fprintf(&block, "<source id=\"%d\" name=%q chunks=\"%d-%d\">\n%s\n</source>\n", offset+i+1, hit.Source, hit.ChunkStart, hit.ChunkEnd, strings.TrimSpace(hit.Content))
+	}
+	block.WriteString("</context>")
+	return block.String()
+}
+
+// promptVariables collects the values the assistant's prompt template can use, looking up the
+// user's name only when the template asks for it.
+func (cs *ChatServiceImpl) promptVariables(ctx context.Context, session types.Session, promptTemplate string, links []types.AssistantKbase) (assistant.PromptVariables, error) {
+	vars := assistant.PromptVariables{Today: time.Now().Format("2006-01-02")}
+
+	var names []string
+	for _, link := range links {
+		if link.KbaseName != "" {
+			names = append(names, link.KbaseName)
+		}
+	}
+	vars.KbaseNames = strings.Join(names, ", ")
+
+	if cs.UserGateway != nil && assistant.UsesVariable(promptTemplate, "UserName") {
+		user, err := cs.UserGateway.GetUser(ctx, session.UserID)
+		if err != nil {
+			return assistant.PromptVariables{}, fmt.Errorf("error loading user: %w", err)
+		}
+		vars.UserName = user.Name
+	}
+	return vars, nil
+}
@@ -1,68 +1,238 @@
-package message 
+package message
 
 import (
 	"context"
-	"rag-demo/types"
-	// google uuid
+	"errors"
+	"strings"
 	"sync"
+	"time"
+
 	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"rag-demo/types"
+)
+
+const (
+	DefaultSessionPageSize = 20
+	MaxSessionPageSize     = 100
+)
+
+var (
+	ErrSessionClosed     = errors.New("session is closed")
+	ErrAssistantNotFound = errors.New("assistant not found")
 )
 
 // SessionService defines the interface for session-related operations.
 type SessionService interface {
-	CreateSession(ctx context.Context, userID uuid.UUID, resultCh types.ResultChannel, wg *sync.WaitGroup) 
-	GetSession(ctx context.Context, sessionID uuid.UUID, resultCh types.ResultChannel, wg *sync.WaitGroup) 
+	CreateSession(ctx context.Context, userID uuid.UUID, req types.NewSessionRequest, resultCh types.ResultChannel, wg *sync.WaitGroup)
+	GetSession(ctx context.Context, sessionID uuid.UUID, resultCh types.ResultChannel, wg *sync.WaitGroup)
+	GetSessionHistory(ctx context.Context, sessionID uuid.UUID, leafID uuid.UUID, resultCh types.ResultChannel, wg *sync.WaitGroup)
+	GetMessage(ctx context.Context, sessionID uuid.UUID, messageID uuid.UUID, resultCh types.ResultChannel, wg *sync.WaitGroup)
+	ListSessions(ctx context.Context, userID uuid.UUID, limit int, offset int, resultCh types.ResultChannel, wg *sync.WaitGroup)
+	CloseSession(ctx context.Context, sessionID uuid.UUID, resultCh types.ResultChannel, wg *sync.WaitGroup)
 }
 
 type SessionServiceImpl struct {
-	SessionGateway types.SessionTableGateway
+	SessionGateway   types.SessionTableGateway
+	MessageGateway   types.MessageTableGateway
+	AssistantGateway types.AssistantTableGateway
 }
 
-func NewSessionService(sessionGateway types.SessionTableGateway) SessionService {
-	return &SessionServiceImpl{SessionGateway: sessionGateway}
+func NewSessionService(sessionGateway types.SessionTableGateway, messageGateway types.MessageTableGateway, assistantGateway types.AssistantTableGateway) SessionService {
+	return &SessionServiceImpl{
+		SessionGateway:   sessionGateway,
+		MessageGateway:   messageGateway,
+		AssistantGateway: assistantGateway,
+	}
 }
 
-func (ss *SessionServiceImpl) CreateSession(ctx context.Context, userID uuid.UUID, resultCh types.ResultChannel, wg *sync.WaitGroup) {
-    defer wg.Done()
-
-    newSession := types.Session{
-        ID:     uuid.New(),
-        UserID: userID,
-    }
-
-    success, err := ss.SessionGateway.CreateSession(ctx, newSession)
-    if err != nil || !success {
-        resultCh <- types.Result{
-            Data:    nil,
-            Error:   err,
-            Success: false,
-        }
-        return
-    }
-
-    resultCh <- types.Result{
-        Data:    newSession,
-        Error:   nil,
-        Success: true,
-    }
+// CreateSession starts an active session for a user, bound to the requested assistant if one is
+// given. An unknown assistant is reported with ErrAssistantNotFound.
+func (ss *SessionServiceImpl) CreateSession(ctx context.Context, userID uuid.UUID, req types.NewSessionRequest, resultCh types.ResultChannel, wg *sync.WaitGroup) {
+	defer wg.Done()
+
+	fail := func(err error) {
+		resultCh <- types.Result{
+			Data:    nil,
+			Error:   err,
+			Success: false,
+		}
+	}
+
+	if req.AssistantID != uuid.Nil {
+		if _, err := ss.AssistantGateway.GetAssistant(ctx, req.AssistantID); err != nil {
+			if errors.Is(err, pgx.ErrNoRows) {
+				err = ErrAssistantNotFound
+			}
+			fail(err)
+			return
+		}
+	}
+
+	now := time.Now().UTC()
+	newSession := types.Session{
+		ID:          uuid.New(),
+		UserID:      userID,
+		AssistantID: req.AssistantID,
+		Title:       strings.TrimSpace(req.Title),
+		Active:      true,
+		CreatedAt:   now,
+		UpdatedAt:   now,
+	}
+
+	success, err := ss.SessionGateway.CreateSession(ctx, newSession)
+	if err != nil || !success {
+		fail(err)
+		return
+	}
+
+	resultCh <- types.Result{
+		Data:    newSession,
+		Error:   nil,
+		Success: true,
+	}
 }
 
 func (ss *SessionServiceImpl) GetSession(ctx context.Context, sessionID uuid.UUID, resultCh types.ResultChannel, wg *sync.WaitGroup) {
-    defer wg.Done()
-
-    session, err := ss.SessionGateway.GetSession(ctx, sessionID)
-    if err != nil {
-        resultCh <- types.Result{
-            Data:    nil,
-            Error:   err,
-            Success: false,
-        }
-        return
-    }
-
-    resultCh <- types.Result{
-        Data:    session,
-        Error:   nil,
-        Success: true,
-    }
-}
\ No newline at end of file
+	defer wg.Done()
+
+	session, err := ss.SessionGateway.GetSession(ctx, sessionID)
+	if err != nil {
+		resultCh <- types.Result{
+			Data:    nil,
+			Error:   err,
+			Success: false,
+		}
+		return
+	}
+
+	resultCh <- types.Result{
+		Data:    session,
+		Error:   nil,
+		Success: true,
+	}
+}
+
+// GetSessionHistory returns a session together with the messages of the branch through leafID,
+// oldest first, each with its siblings. A uuid.Nil leafID picks the branch of the latest message; a
+// leafID that isn't in the session fails with ErrMessageNotFound.
+func (ss *SessionServiceImpl) GetSessionHistory(ctx context.Context, sessionID uuid.UUID, leafID uuid.UUID, resultCh types.ResultChannel, wg *sync.WaitGroup) {
+	defer wg.Done()
+
+	fail := func(err error) {
+		resultCh <- types.Result{
+			Data:    nil,
+			Error:   err,
+			Success: false,
+		}
+	}
+
+	session, err := ss.SessionGateway.GetSession(ctx, sessionID)
+	if err != nil {
+		fail(err)
+		return
+	}
+
+	turns, err := ss.MessageGateway.ListMessages(ctx, sessionID, nil)
+	if err != nil {
+		fail(err)
+		return
+	}
+	branch := activeBranch(turns, leafID)
+	if branch == nil && leafID != uuid.Nil {
+		fail(ErrMessageNotFound)
+		return
+	}
+	messages := withSiblings(branch, turns)
+	if messages == nil {
+		messages = []types.Message{}
+	}
+
+	resultCh <- types.Result{
+		Data:    types.SessionHistory{Session: session, Messages: messages},
+		Error:   nil,
+		Success: true,
+	}
+}
+
+// GetMessage returns a message of the session; one that doesn't exist or belongs to another session
+// fails with ErrMessageNotFound.
+func (ss *SessionServiceImpl) GetMessage(ctx context.Context, sessionID uuid.UUID, messageID uuid.UUID, resultCh types.ResultChannel, wg *sync.WaitGroup) {
+	defer wg.Done()
+
+	message, err := ss.MessageGateway.GetMessage(ctx, messageID)
+	if errors.Is(err, pgx.ErrNoRows) || (err == nil && message.SessionID != sessionID) {
+		err = ErrMessageNotFound
+	}
+	if err != nil {
+		resultCh <- types.Result{
+			Data:    nil,
+			Error:   err,
+			Success: false,
+		}
+		return
+	}
+
+	resultCh <- types.Result{
+		Data:    message,
+		Error:   nil,
+		Success: true,
+	}
+}
+
+// ListSessions returns a page of a user's sessions, most recently active first. The limit is
+// clamped to MaxSessionPageSize and defaults to DefaultSessionPageSize.
+func (ss *SessionServiceImpl) ListSessions(ctx context.Context, userID uuid.UUID, limit int, offset int, resultCh types.ResultChannel, wg *sync.WaitGroup) {
+	defer wg.Done()
+
+	if limit <= 0 {
+		limit = DefaultSessionPageSize
+	}
+	if limit > MaxSessionPageSize {
+		limit = MaxSessionPageSize
+	}
+	if offset < 0 {
+		offset = 0
+	}
+
+	sessions, total, err := ss.SessionGateway.ListSessions(ctx, userID, limit, offset)
+	if err != nil {
+		resultCh <- types.Result{
+			Data:    nil,
+			Error:   err,
+			Success: false,
+		}
+		return
+	}
+	if sessions == nil {
+		sessions = []types.Session{}
+	}
+
+	resultCh <- types.Result{
+		Data:    types.SessionList{Sessions: sessions, Total: total, Limit: limit, Offset: offset},
+		Error:   nil,
+		Success: true,
+	}
+}
+
+// CloseSession marks a session inactive; closing a closed session succeeds. A missing session is
+// reported as an unsuccessful result without an error.
+func (ss *SessionServiceImpl) CloseSession(ctx context.Context, sessionID uuid.UUID, resultCh types.ResultChannel, wg *sync.WaitGroup) {
+	defer wg.Done()
+
+	success, err := ss.SessionGateway.CloseSession(ctx, sessionID)
+	if err != nil || !success {
+		resultCh <- types.Result{
+			Data:    nil,
+			Error:   err,
+			Success: false,
+		}
+		return
+	}
+
+	resultCh <- types.Result{
+		Data:    nil,
+		Error:   nil,
+		Success: true,
+	}
+}
@@ -0,0 +1,92 @@
+package message
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"sync"
+
+	"rag-demo/pkg/llm"
+	"rag-demo/pkg/tools"
+	"rag-demo/types"
+)
+
+// foundSources collects the passages the kbase search tool returned while answering a message.
+type foundSources struct {
+	mu   sync.Mutex
+	hits []types.SearchHit
+}
+
+// add appends hits and returns how many passages were found before them.
+func (f *foundSources) add(hits []types.SearchHit) int {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	offset := len(f.hits)
+	f.hits = append(f.hits, hits...)
+	return offset
+}
+
+func (f *foundSources) list() []types.SearchHit {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return append([]types.SearchHit{}, f.hits...)
+}
+
+// toolset resolves the assistant's tools for one message. The kbase search tool is bound to the
+// assistant's kbases here and returns the collector of the passages it finds.
+func (cs *ChatServiceImpl) toolset(assistant types.Assistant, links []types.AssistantKbase) ([]tools.Tool, *foundSources, error) {
+	if len(assistant.Tools) > 0 && !llm.SupportsTools(assistant.Model) {
+		return nil, nil, fmt.Errorf("%w: %s", llm.ErrToolsUnsupported, assistant.Model)
+	}
+
+	var toolset []tools.Tool
+	var found *foundSources
+	for _, name := range assistant.Tools {
+		if name == tools.KbaseSearch {
+			found = &foundSources{}
+			toolset = append(toolset, cs.kbaseSearchTool(links, found))
+			continue
+		}
+		tool, ok := cs.Tools.Get(name)
+		if !ok {
+			return nil, nil, fmt.Errorf("%w: %s", tools.ErrUnknownTool, name)
+		}
+		toolset = append(toolset, tool)
+	}
+	return toolset, found, nil
+}
+
+// kbaseSearchTool searches the given kbases for the model. Passages are numbered after the ones found
+// by earlier searches of the same message, so [n] citations resolve against the message's sources.
+func (cs *ChatServiceImpl) kbaseSearchTool(links []types.AssistantKbase, found *foundSources) tools.Tool {
+	return tools.Tool{
+		Name:        tools.KbaseSearch,
+		Description: tools.KbaseSearchDescription,
+		Schema:      json.RawMessage(tools.KbaseSearchSchema),
+		Handler: func(ctx context.Context, input json.RawMessage) (string, error) {
+			var args struct {
+				Query string `json:"query"`
+			}
+			if err := json.Unmarshal(input, &args); err != nil {
+				return "", err
+			}
+			if strings.TrimSpace(args.Query) == "" {
+				return "", fmt.Errorf("query must not be empty")
+			}
+			if len(links) == 0 {
+				return "The assistant has no knowledge bases to search.", nil
+			}
+
+			result, err := cs.Retriever.SearchLinked(ctx, args.Query, links)
+			if err != nil {
+				return "", err
+			}
+			if len(result.Hits) == 0 {
+				return "No relevant passages found.", nil
+			}
+			offset := found.add(result.Hits)
+			return formatSources(result.Hits, offset), nil
+		},
+	}
+}
@@ -0,0 +1,44 @@
+package quota
+
+import (
+	"context"
+	"fmt"
+
+	"rag-demo/pkg/llm"
+	"rag-demo/types"
+)
+
+// CountedLLM counts the tokens of every call to the chat model it wraps against the token quota of the
+// subject of the call's context. Calls without a subject aren't counted.
+type CountedLLM struct {
+	LLM     llm.LLM
+	Limiter *Limiter
+}
+
+func NewCountedLLM(model llm.LLM, limiter *Limiter) llm.LLM {
+	return &CountedLLM{LLM: model, Limiter: limiter}
+}
+
+func (c *CountedLLM) Converse(ctx context.Context, req types.LLMRequest) (types.LLMResponse, error) {
+	response, err := c.LLM.Converse(ctx, req)
+	c.count(ctx, response.Usage)
+	return response, err
+}
+
+func (c *CountedLLM) ConverseStream(ctx context.Context, req types.LLMRequest, onToken func(token string) error) (types.LLMResponse, error) {
+	response, err := c.LLM.ConverseStream(ctx, req, onToken)
+	c.count(ctx, response.Usage)
+	return response, err
+}
+
+func (c *CountedLLM) count(ctx context.Context, usage types.TokenUsage) {
+	subject, ok := SubjectFrom(ctx)
+	tokens := usage.InputTokens + usage.OutputTokens
+	if !ok || tokens == 0 {
+		return
+	}
+	// the tokens were used even if the request that used them was cancelled
+	if err := c.Limiter.AddTokens(context.WithoutCancel(ctx), subject, tokens); err != nil {
+		fmt.Println("Error counting tokens: ", err)
+	}
+}
@@ -0,0 +1,40 @@
+package quota
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"rag-demo/types"
+)
+
+// MemoryStore keeps the quota counters in memory. Its counts are per process, so it only enforces
+// quotas exactly when a single instance serves the API.
+type MemoryStore struct {
+	mu      sync.Mutex
+	counts  map[types.QuotaCounter]int
+	sweptAt time.Time
+}
+
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{counts: make(map[types.QuotaCounter]int)}
+}
+
+func (s *MemoryStore) Add(ctx context.Context, counter types.QuotaCounter, n int) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	// expired counters are dropped at most once a minute
+	now := time.Now()
+	if now.Sub(s.sweptAt) >= time.Minute {
+		for c := range s.counts {
+			if !c.ExpiresAt.After(now) {
+				delete(s.counts, c)
+			}
+		}
+		s.sweptAt = now
+	}
+
+	s.counts[counter] += n
+	return s.counts[counter], nil
+}
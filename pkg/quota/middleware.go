@@ -0,0 +1,68 @@
+package quota
+
+import (
+	"fmt"
+	"math"
+	"net/http"
+	"strconv"
+)
+
+// Requests is chi middleware that rejects requests over the subject's requests per minute with 429.
+// Every limited response carries the X-RateLimit-Limit, -Remaining and -Reset headers.
+func (l *Limiter) Requests(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		r, subject := l.subject(r)
+		decision, err := l.AllowRequest(r.Context(), subject)
+		if !l.enforce(w, decision, err, "X-RateLimit", "rate limit exceeded") {
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// Tokens is chi middleware that rejects requests with 429 once the subject has used its tokens per day.
+// The model calls made while serving the request count against the subject's tokens through a
+// CountedLLM. Limited responses carry the X-Quota-Tokens-Limit and -Remaining headers.
+func (l *Limiter) Tokens(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		r, subject := l.subject(r)
+		decision, err := l.CheckTokens(r.Context(), subject)
+		if !l.enforce(w, decision, err, "X-Quota-Tokens", "daily token quota exceeded") {
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// subject identifies the subject of the request once and keeps it in the request's context.
+func (l *Limiter) subject(r *http.Request) (*http.Request, Subject) {
+	if subject, ok := SubjectFrom(r.Context()); ok {
+		return r, subject
+	}
+	subject := l.Subject(r)
+	return r.WithContext(WithSubject(r.Context(), subject)), subject
+}
+
+// enforce sets the quota headers of the decision and reports whether the request may go on. Requests
+// over the quota get a 429 with Retry-After. Quotas fail open: a request whose counter can't be
+// read is served.
+func (l *Limiter) enforce(w http.ResponseWriter, decision Decision, err error, header string, message string) bool {
+	if err != nil {
+		fmt.Println("Error checking quota: ", err)
+		return true
+	}
+	if decision.Limit == 0 {
+		return true
+	}
+
+	retryAfter := int(math.Ceil(decision.Reset.Sub(l.Now()).Seconds()))
+	w.Header().Set(header+"-Limit", strconv.Itoa(decision.Limit))
+	w.Header().Set(header+"-Remaining", strconv.Itoa(decision.Remaining))
+	w.Header().Set(header+"-Reset", strconv.Itoa(retryAfter))
+	if !decision.Allowed {
+		w.Header().Set("Retry-After", strconv.Itoa(retryAfter))
+		http.Error(w, message, http.StatusTooManyRequests)
+		return false
+	}
+	return true
+}
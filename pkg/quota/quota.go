@@ -0,0 +1,184 @@
+package quota
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"rag-demo/types"
+)
+
+// ErrDocumentQuotaExceeded is returned for a document ingested over the subject's documents per day.
+var ErrDocumentQuotaExceeded = errors.New("daily document quota exceeded")
+
+// Kinds of subjects quotas are counted for.
+const (
+	SubjectUser      = "user"
+	SubjectAPIKey    = "api_key"
+	SubjectAnonymous = "ip" // requests without credentials are counted per client address
+)
+
+// Counters kept per subject.
+const (
+	CounterRequests  = "requests"
+	CounterTokens    = "tokens"
+	CounterDocuments = "documents"
+)
+
+// Limits are the quotas of a kind of subject; 0 is unlimited.
+type Limits struct {
+	RequestsPerMinute int
+	TokensPerDay      int // model tokens, input and output
+	DocumentsPerDay   int // documents ingested
+}
+
+// Subject is who a quota is counted for.
+type Subject struct {
+	Kind string
+	ID   string
+}
+
+func (s Subject) String() string {
+	return s.Kind + ":" + s.ID
+}
+
+// SubjectFunc identifies the subject of a request.
+type SubjectFunc func(r *http.Request) Subject
+
+// Decision is the outcome of checking a quota. Limit is 0 for an unlimited quota.
+type Decision struct {
+	Allowed   bool
+	Limit     int
+	Remaining int
+	Reset     time.Time // when the window ends and the count starts over
+}
+
+// Limiter enforces the quotas of each kind of subject with counters in fixed windows: requests per
+// minute and tokens and documents per UTC day.
+type Limiter struct {
+	Store   types.QuotaStore
+	Limits  map[string]Limits // by subject kind; kinds without limits of their own use those of SubjectUser
+	Subject SubjectFunc
+	Now     func() time.Time // the clock windows are taken from
+}
+
+func NewLimiter(store types.QuotaStore, limits map[string]Limits, subject SubjectFunc) *Limiter {
+	return &Limiter{Store: store, Limits: limits, Subject: subject, Now: time.Now}
+}
+
+func (l *Limiter) limits(subject Subject) Limits {
+	if limits, ok := l.Limits[subject.Kind]; ok {
+		return limits
+	}
+	return l.Limits[SubjectUser]
+}
+
+// AllowRequest counts a request of the subject against its requests per minute.
+func (l *Limiter) AllowRequest(ctx context.Context, subject Subject) (Decision, error) {
+	return l.take(ctx, subject, CounterRequests, l.limits(subject).RequestsPerMinute, time.Minute, 1, false)
+}
+
+// CheckTokens reports whether the subject has tokens left today. Tokens are counted with AddTokens once
+// the model has used them, so the call that exhausts the quota may exceed it.
+func (l *Limiter) CheckTokens(ctx context.Context, subject Subject) (Decision, error) {
+	return l.take(ctx, subject, CounterTokens, l.limits(subject).TokensPerDay, 24*time.Hour, 0, false)
+}
+
+// AddTokens counts tokens the subject's model calls used against its tokens per day.
+func (l *Limiter) AddTokens(ctx context.Context, subject Subject, tokens int) error {
+	_, err := l.take(ctx, subject, CounterTokens, l.limits(subject).TokensPerDay, 24*time.Hour, tokens, false)
+	return err
+}
+
+// AllowDocuments counts documents the subject ingests against its documents per day. Documents over the
+// quota aren't counted.
+func (l *Limiter) AllowDocuments(ctx context.Context, subject Subject, documents int) (Decision, error) {
+	return l.take(ctx, subject, CounterDocuments, l.limits(subject).DocumentsPerDay, 24*time.Hour, documents, true)
+}
+
+// CountDocument counts a document ingested by the subject of ctx, returning ErrDocumentQuotaExceeded
+// once the subject has used its documents per day. Contexts without a subject aren't counted; like the
+// middleware it fails open, and a nil Limiter allows everything.
+func (l *Limiter) CountDocument(ctx context.Context) error {
+	subject, ok := SubjectFrom(ctx)
+	if l == nil || !ok {
+		return nil
+	}
+	decision, err := l.AllowDocuments(ctx, subject, 1)
+	if err != nil {
+		fmt.Println("Error checking quota: ", err)
+		return nil
+	}
+	if !decision.Allowed {
+		return ErrDocumentQuotaExceeded
+	}
+	return nil
+}
+
+// Allow runs the checks of the Requests and Tokens middleware for work that doesn't arrive as a request
+// of its own, such as a message sent over an open WebSocket. Over either quota it returns false with the
+// reason and how long until the quota resets. Like the middleware it fails open, and a nil Limiter
+// allows everything.
+func (l *Limiter) Allow(ctx context.Context, subject Subject) (bool, string, time.Duration) {
+	if l == nil {
+		return true, "", 0
+	}
+	decision, err := l.AllowRequest(ctx, subject)
+	if err == nil && !decision.Allowed {
+		return false, "rate limit exceeded", decision.Reset.Sub(l.Now())
+	}
+	if err != nil {
+		fmt.Println("Error checking quota: ", err)
+	}
+	decision, err = l.CheckTokens(ctx, subject)
+	if err == nil && !decision.Allowed {
+		return false, "daily token quota exceeded", decision.Reset.Sub(l.Now())
+	}
+	if err != nil {
+		fmt.Println("Error checking quota: ", err)
+	}
+	return true, "", 0
+}
+
+// take adds n to the subject's counter in the current window. With n 0 the quota is allowed while the
+// count is below the limit, otherwise while it is within it; refund takes n back off a count that
+// exceeds the limit.
+func (l *Limiter) take(ctx context.Context, subject Subject, name string, limit int, window time.Duration, n int, refund bool) (Decision, error) {
+	if limit <= 0 {
+		return Decision{Allowed: true}, nil
+	}
+
+	// windows of a day are truncated to midnight UTC
+	start := l.Now().UTC().Truncate(window)
+	counter := types.QuotaCounter{Subject: subject.String(), Name: name, WindowStart: start, ExpiresAt: start.Add(window)}
+	count, err := l.Store.Add(ctx, counter, n)
+	if err != nil {
+		return Decision{}, err
+	}
+
+	allowed := count <= limit
+	if n == 0 {
+		allowed = count < limit
+	}
+	if !allowed && refund {
+		if count, err = l.Store.Add(ctx, counter, -n); err != nil {
+			return Decision{}, err
+		}
+	}
+	return Decision{Allowed: allowed, Limit: limit, Remaining: max(limit-count, 0), Reset: counter.ExpiresAt}, nil
+}
+
+type subjectKey struct{}
+
+// WithSubject returns a context whose model calls count against the subject's token quota.
+func WithSubject(ctx context.Context, subject Subject) context.Context {
+	return context.WithValue(ctx, subjectKey{}, subject)
+}
+
+// SubjectFrom returns the subject of ctx, if it has one.
+func SubjectFrom(ctx context.Context) (Subject, bool) {
+	subject, ok := ctx.Value(subjectKey{}).(Subject)
+	return subject, ok
+}
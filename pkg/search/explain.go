@@ -0,0 +1,98 @@
+package search
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/pgvector/pgvector-go"
+	"rag-demo/types"
+)
+
+// stageTimings accumulates the wall time of each search stage in milliseconds.
+type stageTimings map[string]float64
+
+func (s stageTimings) add(stage string, start time.Time) {
+	s[stage] += float64(time.Since(start).Microseconds()) / 1000
+}
+
+// explain builds the debugging breakdown of a search: per hit scores, the filters that were
+// applied and, for admins, the Postgres plan of the vector query.
+func (r *Retriever) explain(ctx context.Context, req types.SearchRequest, texts []searchText, lists [][]types.KbaseEmbeddingMatch, embedding pgvector.Vector, topK int, thresholds map[uuid.UUID]float64, hits []types.SearchHit, timings stageTimings) (*types.SearchExplanation, error) {
+	start := time.Now()
+	embeddingIDs := make([]uuid.UUID, 0, len(hits))
+	for _, hit := range hits {
+		embeddingIDs = append(embeddingIDs, hit.EmbeddingID)
+	}
+	keywordScores, err := r.embeddings.KeywordScores(ctx, req.Query, embeddingIDs)
+	if err != nil {
+		return nil, fmt.Errorf("error scoring keywords: %w", err)
+	}
+	timings.add("keyword_scoring", start)
+
+	for i := range hits {
+		contributions, fused := rankContributions(hits[i].EmbeddingID, texts, lists)
+		hits[i].Explain = &types.HitExplanation{
+			VectorDistance:    hits[i].Distance,
+			KeywordScore:      keywordScores[hits[i].EmbeddingID],
+			RankContributions: contributions,
+			FusedScore:        fused,
+		}
+	}
+
+	filters := map[string]interface{}{
+		"kbase_ids": req.KbaseIDs,
+		"top_k":     topK,
+		"window":    req.Window,
+		"hyde":      req.HyDE,
+		// minimum similarity applied per kbase
+		"min_similarity": thresholds,
+	}
+	if req.MultiQuery {
+		filters["multi_query"] = len(texts) - 1
+	}
+
+	explanation := &types.SearchExplanation{
+		EmbeddingModel: r.embedder.EmbeddingModelID(),
+		DistanceMetric: distanceMetric,
+		Reranker:       "none",
+		Filters:        filters,
+		TimingsMs:      timings,
+	}
+
+	if req.IncludeSQLPlan {
+		start := time.Now()
+		plan, err := r.embeddings.ExplainSearch(ctx, req.KbaseIDs, embedding, topK)
+		if err != nil {
+			return nil, fmt.Errorf("error explaining search query: %w", err)
+		}
+		timings.add("sql_plan", start)
+		explanation.SQLPlan = &plan
+	}
+
+	return explanation, nil
+}
+
+// rankContributions returns the RRF score each searched text contributed to a chunk and their sum.
+func rankContributions(embeddingID uuid.UUID, texts []searchText, lists [][]types.KbaseEmbeddingMatch) ([]types.RankContribution, float64) {
+	var contributions []types.RankContribution
+	var fused float64
+	for i, list := range lists {
+		for rank, match := range list {
+			if match.UUID != embeddingID {
+				continue
+			}
+			score := 1.0 / float64(rrfK+rank+1)
+			contributions = append(contributions, types.RankContribution{
+				Kind:  texts[i].kind,
+				Query: texts[i].text,
+				Rank:  rank + 1,
+				Score: score,
+			})
+			fused += score
+			break
+		}
+	}
+	return contributions, fused
+}
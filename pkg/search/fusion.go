@@ -0,0 +1,45 @@
+package search
+
+import (
+	"sort"
+
+	"github.com/google/uuid"
+	"rag-demo/types"
+)
+
+// rrfK dampens the weight of top ranks in reciprocal rank fusion; 60 is the value from the original paper.
+const rrfK = 60
+
+// FuseRRF merges several ranked match lists with reciprocal rank fusion, scoring every chunk
+// by the sum of 1/(k + rank) over the lists it appears in. The fused list is best first.
+func FuseRRF(lists [][]types.KbaseEmbeddingMatch, k int) []types.KbaseEmbeddingMatch {
+	if k <= 0 {
+		k = rrfK
+	}
+
+	scores := make(map[uuid.UUID]float64)
+	best := make(map[uuid.UUID]types.KbaseEmbeddingMatch)
+	var order []uuid.UUID
+	for _, list := range lists {
+		for rank, match := range list {
+			if _, ok := scores[match.UUID]; !ok {
+				order = append(order, match.UUID)
+				best[match.UUID] = match
+			}
+			scores[match.UUID] += 1.0 / float64(k+rank+1)
+			if match.Distance < best[match.UUID].Distance {
+				best[match.UUID] = match
+			}
+		}
+	}
+
+	sort.SliceStable(order, func(i, j int) bool {
+		return scores[order[i]] > scores[order[j]]
+	})
+
+	fused := make([]types.KbaseEmbeddingMatch, 0, len(order))
+	for _, id := range order {
+		fused = append(fused, best[id])
+	}
+	return fused
+}
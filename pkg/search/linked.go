@@ -0,0 +1,62 @@
+package search
+
+import (
+	"context"
+	"fmt"
+	"sort"
+
+	"github.com/google/uuid"
+	"github.com/pgvector/pgvector-go"
+	"rag-demo/types"
+)
+
+// SearchLinked searches the kbases attached to an assistant, each with the top-k and threshold of
+// its link, and ranks the relevant chunks of all kbases by similarity times the link's weight.
+func (r *Retriever) SearchLinked(ctx context.Context, query string, links []types.AssistantKbase) (types.SearchResult, error) {
+	result := types.SearchResult{Query: query, Outcome: types.SearchOutcomeOK}
+
+	embedding, err := r.embedder.EmbedText(ctx, query)
+	if err != nil {
+		return types.SearchResult{}, fmt.Errorf("error embedding query: %w", err)
+	}
+	vector := pgvector.NewVector(embedding)
+
+	var matches []types.KbaseEmbeddingMatch
+	weights := make(map[uuid.UUID]float64, len(links))
+	for _, link := range links {
+		topK := link.TopK
+		if topK <= 0 {
+			topK = DefaultTopK
+		}
+		weights[link.KbaseID] = link.Weight
+		if link.Weight <= 0 {
+			weights[link.KbaseID] = 1
+		}
+
+		// the link's threshold takes the place of a request threshold
+		thresholds, err := r.thresholds(ctx, types.SearchRequest{KbaseIDs: []uuid.UUID{link.KbaseID}, MinSimilarity: link.MinSimilarity})
+		if err != nil {
+			return types.SearchResult{}, err
+		}
+
+		linkMatches, err := r.embeddings.SearchEmbeddings(ctx, []uuid.UUID{link.KbaseID}, vector, topK)
+		if err != nil {
+			return types.SearchResult{}, fmt.Errorf("error searching embeddings: %w", err)
+		}
+		matches = append(matches, filterRelevant(linkMatches, thresholds)...)
+	}
+
+	sort.SliceStable(matches, func(i, j int) bool {
+		return weights[matches[i].KbaseID]*Similarity(matches[i].Distance) > weights[matches[j].KbaseID]*Similarity(matches[j].Distance)
+	})
+	if len(matches) == 0 {
+		result.Outcome = types.SearchOutcomeNoRelevantContext
+	}
+
+	hits, err := r.expand(ctx, matches, 0)
+	if err != nil {
+		return types.SearchResult{}, err
+	}
+	result.Hits = hits
+	return result, nil
+}
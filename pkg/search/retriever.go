@@ -0,0 +1,239 @@
+package search
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/pgvector/pgvector-go"
+	"rag-demo/types"
+)
+
+// DefaultTopK is the number of chunks retrieved when a request or assistant link doesn't set one.
+const DefaultTopK = 5
+
+// Embedder turns a piece of text into an embedding vector.
+type Embedder interface {
+	EmbedText(ctx context.Context, text string) ([]float32, error)
+	EmbeddingModelID() string
+}
+
+// Retriever finds the chunks of one or more knowledge bases that are most similar to a query.
+type Retriever struct {
+	embedder    Embedder
+	embeddings  types.KbaseEmbeddingsTableGateway
+	kbases      types.KbaseTableGateway
+	transformer *QueryTransformer
+}
+
+// NewRetriever creates a retriever. The transformer may be nil, in which case multi-query and HyDE requests are rejected.
+func NewRetriever(embedder Embedder, embeddings types.KbaseEmbeddingsTableGateway, kbases types.KbaseTableGateway, transformer *QueryTransformer) *Retriever {
+	return &Retriever{
+		embedder:    embedder,
+		embeddings:  embeddings,
+		kbases:      kbases,
+		transformer: transformer,
+	}
+}
+
+// searchText is one text that is embedded and searched for a request.
+type searchText struct {
+	kind string
+	text string
+}
+
+// Search embeds the query, finds the top-k matching chunks and, when a window is requested,
+// expands every match to the neighbouring chunks of the same document. With multi-query or
+// HyDE enabled the query is transformed first and the result lists are fused with RRF.
+// Chunks below the relevance threshold are dropped; if none remain the outcome is
+// types.SearchOutcomeNoRelevantContext.
+func (r *Retriever) Search(ctx context.Context, req types.SearchRequest) (types.SearchResult, error) {
+	topK := req.TopK
+	if topK <= 0 {
+		topK = DefaultTopK
+	}
+	result := types.SearchResult{Query: req.Query}
+	timings := stageTimings{}
+	searchStart := time.Now()
+
+	if (req.MultiQuery || req.HyDE) && r.transformer == nil {
+		return types.SearchResult{}, fmt.Errorf("query transformation is not configured")
+	}
+
+	thresholds, err := r.thresholds(ctx, req)
+	if err != nil {
+		return types.SearchResult{}, err
+	}
+
+	// the text embedded for the original question, replaced by a hypothetical answer with HyDE
+	texts := []searchText{{kind: "query", text: req.Query}}
+	if req.HyDE {
+		start := time.Now()
+		document, err := r.transformer.HypotheticalDocument(ctx, req.Query)
+		if err != nil {
+			return types.SearchResult{}, err
+		}
+		timings.add("hyde", start)
+		result.HypotheticalDocument = document
+		texts[0] = searchText{kind: "hyde", text: document}
+	}
+	if req.MultiQuery {
+		start := time.Now()
+		queries, err := r.transformer.Paraphrase(ctx, req.Query, req.NumQueries)
+		if err != nil {
+			return types.SearchResult{}, err
+		}
+		timings.add("multi_query", start)
+		result.GeneratedQueries = queries
+		for _, query := range queries {
+			texts = append(texts, searchText{kind: "paraphrase", text: query})
+		}
+	}
+
+	var lists [][]types.KbaseEmbeddingMatch
+	var firstEmbedding pgvector.Vector
+	for i, text := range texts {
+		start := time.Now()
+		embedding, err := r.embedder.EmbedText(ctx, text.text)
+		if err != nil {
+			return types.SearchResult{}, fmt.Errorf("error embedding query: %w", err)
+		}
+		timings.add("embedding", start)
+		vector := pgvector.NewVector(embedding)
+		if i == 0 {
+			firstEmbedding = vector
+		}
+
+		start = time.Now()
+		matches, err := r.embeddings.SearchEmbeddings(ctx, req.KbaseIDs, vector, topK)
+		if err != nil {
+			return types.SearchResult{}, fmt.Errorf("error searching embeddings: %w", err)
+		}
+		timings.add("vector_search", start)
+		lists = append(lists, matches)
+	}
+
+	matches := lists[0]
+	if len(lists) > 1 {
+		start := time.Now()
+		matches = FuseRRF(lists, rrfK)
+		if len(matches) > topK {
+			matches = matches[:topK]
+		}
+		timings.add("fusion", start)
+	}
+
+	matches = filterRelevant(matches, thresholds)
+	result.Outcome = types.SearchOutcomeOK
+	if len(matches) == 0 {
+		result.Outcome = types.SearchOutcomeNoRelevantContext
+	}
+
+	start := time.Now()
+	hits, err := r.expand(ctx, matches, req.Window)
+	if err != nil {
+		return types.SearchResult{}, err
+	}
+	timings.add("window_expansion", start)
+	result.Hits = hits
+
+	if req.Explain {
+		explanation, err := r.explain(ctx, req, texts, lists, firstEmbedding, topK, thresholds, result.Hits, timings)
+		if err != nil {
+			return types.SearchResult{}, err
+		}
+		timings.add("total", searchStart)
+		result.Explain = explanation
+	}
+
+	return result, nil
+}
+
+// expand merges the matches into windows and loads the text of each window.
+func (r *Retriever) expand(ctx context.Context, matches []types.KbaseEmbeddingMatch, window int) ([]types.SearchHit, error) {
+	byChunk := make(map[sourceKey]map[int]types.KbaseEmbeddingMatch)
+	for _, match := range matches {
+		key := sourceKey{kbaseID: match.KbaseID, source: matchSource(match.KbaseEmbedding)}
+		if byChunk[key] == nil {
+			byChunk[key] = make(map[int]types.KbaseEmbeddingMatch)
+		}
+		if existing, ok := byChunk[key][match.ChunkID]; !ok || match.Distance < existing.Distance {
+			byChunk[key][match.ChunkID] = match
+		}
+	}
+
+	hits := make([]types.SearchHit, 0, len(matches))
+	for _, w := range MergeWindows(matches, window) {
+		key := sourceKey{kbaseID: w.KbaseID, source: w.Source}
+		hit := types.SearchHit{ChunkWindow: w, ChunkID: bestChunk(w, byChunk[key])}
+		hit.EmbeddingID = byChunk[key][hit.ChunkID].UUID
+		hit.Similarity = Similarity(hit.Distance)
+
+		if window == 0 {
+			hit.ChunkStart, hit.ChunkEnd = hit.ChunkID, hit.ChunkID
+			hit.Content = byChunk[key][hit.ChunkID].Content
+			hit.PageStart, hit.PageEnd = chunkPages(byChunk[key][hit.ChunkID].Metadata)
+			hits = append(hits, hit)
+			continue
+		}
+
+		chunks, err := r.embeddings.GetChunkRange(ctx, w.KbaseID, w.Source, w.ChunkStart, w.ChunkEnd)
+		if err != nil {
+			return nil, fmt.Errorf("error loading neighbouring chunks: %w", err)
+		}
+
+		var content strings.Builder
+		seen := make(map[int]bool)
+		for _, chunk := range chunks {
+			// the same document may have been indexed more than once
+			if seen[chunk.ChunkID] {
+				continue
+			}
+			seen[chunk.ChunkID] = true
+			content.WriteString(chunk.Content)
+
+			start, end := chunkPages(chunk.Metadata)
+			if start > 0 && (hit.PageStart == 0 || start < hit.PageStart) {
+				hit.PageStart = start
+			}
+			if end > hit.PageEnd {
+				hit.PageEnd = end
+			}
+		}
+		if len(chunks) > 0 {
+			hit.ChunkStart = chunks[0].ChunkID
+			hit.ChunkEnd = chunks[len(chunks)-1].ChunkID
+		}
+		hit.Content = content.String()
+		hits = append(hits, hit)
+	}
+
+	return hits, nil
+}
+
+// chunkPages reads the page range the extractor recorded in a chunk's metadata, 0 when there is none.
+func chunkPages(metadata map[string]interface{}) (int, int) {
+	return metadataInt(metadata, "page_start"), metadataInt(metadata, "page_end")
+}
+
+func metadataInt(metadata map[string]interface{}, key string) int {
+	// metadata is decoded from JSON, so numbers arrive as float64
+	switch v := metadata[key].(type) {
+	case float64:
+		return int(v)
+	case int:
+		return v
+	}
+	return 0
+}
+
+func bestChunk(w types.ChunkWindow, matches map[int]types.KbaseEmbeddingMatch) int {
+	best := w.MatchedChunks[0]
+	for _, chunkID := range w.MatchedChunks[1:] {
+		if matches[chunkID].Distance < matches[best].Distance {
+			best = chunkID
+		}
+	}
+	return best
+}
@@ -0,0 +1,69 @@
+package search
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/google/uuid"
+	"rag-demo/types"
+)
+
+// distanceMetric is the pgvector operator used by SearchEmbeddings (<=>).
+const distanceMetric = "cosine"
+
+// fallbackMinSimilarity is used for embedding models without a default of their own.
+const fallbackMinSimilarity = 0.3
+
+// defaultMinSimilarity holds, per embedding model and distance metric, the similarity below which
+// chunks are dropped. The values are uncalibrated starting points, not measured against labelled
+// questions; kbases and requests that need another cut-off set their own.
+var defaultMinSimilarity = map[string]float64{
+	"amazon.titan-embed-g1-text-02/cosine": 0.35,
+}
+
+// DefaultMinSimilarity returns the default relevance threshold for an embedding model and metric.
+func DefaultMinSimilarity(modelID string, metric string) float64 {
+	if threshold, ok := defaultMinSimilarity[modelID+"/"+metric]; ok {
+		return threshold
+	}
+	return fallbackMinSimilarity
+}
+
+// Similarity converts a cosine distance into a similarity where 1 is identical.
+func Similarity(distance float64) float64 {
+	return 1 - distance
+}
+
+// thresholds returns the minimum similarity for each searched kbase. A request threshold wins over
+// the kbase's own threshold, which wins over the embedding model default.
+func (r *Retriever) thresholds(ctx context.Context, req types.SearchRequest) (map[uuid.UUID]float64, error) {
+	thresholds := make(map[uuid.UUID]float64, len(req.KbaseIDs))
+	for _, kbaseID := range req.KbaseIDs {
+		if req.MinSimilarity != nil {
+			thresholds[kbaseID] = *req.MinSimilarity
+			continue
+		}
+
+		kbase, err := r.kbases.GetKbase(ctx, kbaseID)
+		if err != nil {
+			return nil, fmt.Errorf("error loading kbase %s: %w", kbaseID, err)
+		}
+		if kbase.MinSimilarity != nil {
+			thresholds[kbaseID] = *kbase.MinSimilarity
+			continue
+		}
+		thresholds[kbaseID] = DefaultMinSimilarity(r.embedder.EmbeddingModelID(), distanceMetric)
+	}
+	return thresholds, nil
+}
+
+// filterRelevant drops the matches that are less similar than their kbase's threshold.
+func filterRelevant(matches []types.KbaseEmbeddingMatch, thresholds map[uuid.UUID]float64) []types.KbaseEmbeddingMatch {
+	relevant := make([]types.KbaseEmbeddingMatch, 0, len(matches))
+	for _, match := range matches {
+		if Similarity(match.Distance) >= thresholds[match.KbaseID] {
+			relevant = append(relevant, match)
+		}
+	}
+	return relevant
+}
@@ -0,0 +1,125 @@
+package search
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"strings"
+
+	"rag-demo/pkg/llm"
+)
+
+const (
+	defaultTransformModelID = "anthropic.claude-3-haiku-20240307-v1:0"
+	defaultNumQueries       = 3
+	maxNumQueries           = 5
+)
+
+// listMarker matches a bullet or "1." / "1)" numbering a model puts before a line, but not numbers
+// that are part of the line such as "2023 tax rules".
+var listMarker = regexp.MustCompile(`^(?:[-*•]|\d+[.)])\s+`)
+
+// StripListMarker removes the bullet or numbering a model put before a line of its output.
+func StripListMarker(line string) string {
+	return listMarker.ReplaceAllString(line, "")
+}
+
+const multiQuerySystemPrompt = `You rewrite search queries for a document retrieval system.
+Given a user question, write alternative phrasings that keep the same meaning but use different wording,
+synonyms or a more specific form. Reply with one query per line and nothing else.`
+
+const hydeSystemPrompt = `You write passages for a document retrieval system.
+Given a user question, write a short factual passage (at most one paragraph) that could appear in a document answering it.
+Reply with the passage only.`
+
+const standaloneSystemPrompt = `You rewrite follow-up questions for a document retrieval system.
+Given the conversation so far and the user's latest message, write a single standalone search query that
+contains everything needed to understand the message without the conversation: replace pronouns and
+references like "that" or "for children" with what they refer to. Do not answer the question.
+Reply with the query only.`
+
+// QueryTransformer rewrites a user question into forms that embed better: paraphrases for
+// multi-query retrieval and hypothetical answers for HyDE.
+type QueryTransformer struct {
+	model   llm.LLM
+	modelID string
+}
+
+func NewQueryTransformer(model llm.LLM, modelID string) *QueryTransformer {
+	if modelID == "" {
+		modelID = defaultTransformModelID
+	}
+	return &QueryTransformer{
+		model:   model,
+		modelID: modelID,
+	}
+}
+
+// Paraphrase returns up to n alternative phrasings of the query, excluding the query itself.
+func (qt *QueryTransformer) Paraphrase(ctx context.Context, query string, n int) ([]string, error) {
+	if n <= 0 {
+		n = defaultNumQueries
+	}
+	if n > maxNumQueries {
+		n = maxNumQueries
+	}
+
+	prompt := fmt.Sprintf("Write %d alternative search queries for this question:\n\n%s", n, query)
+	output, err := llm.Generate(ctx, qt.model, qt.modelID, multiQuerySystemPrompt, prompt)
+	if err != nil {
+		return nil, fmt.Errorf("error generating query paraphrases: %w", err)
+	}
+
+	return parseQueries(output, query, n), nil
+}
+
+// HypotheticalDocument returns a generated answer to the query whose embedding is used in place of the query's.
+func (qt *QueryTransformer) HypotheticalDocument(ctx context.Context, query string) (string, error) {
+	output, err := llm.Generate(ctx, qt.model, qt.modelID, hydeSystemPrompt, query)
+	if err != nil {
+		return "", fmt.Errorf("error generating hypothetical document: %w", err)
+	}
+
+	document := strings.TrimSpace(output)
+	if document == "" {
+		return "", fmt.Errorf("model returned an empty hypothetical document")
+	}
+	return document, nil
+}
+
+// Standalone condenses the latest message and the conversation before it into a self-contained
+// search query. The message is returned unchanged when the model gives no usable query.
+func (qt *QueryTransformer) Standalone(ctx context.Context, message string, conversation string) (string, error) {
+	prompt := fmt.Sprintf("<conversation>\n%s</conversation>\n\nLatest message: %s", conversation, message)
+	output, err := llm.Generate(ctx, qt.model, qt.modelID, standaloneSystemPrompt, prompt)
+	if err != nil {
+		return "", fmt.Errorf("error rewriting question: %w", err)
+	}
+
+	queries := parseQueries(output, "", 1)
+	if len(queries) == 0 {
+		return message, nil
+	}
+	return queries[0], nil
+}
+
+// parseQueries splits the model output into one query per line, stripping list markers and duplicates.
+func parseQueries(output string, original string, n int) []string {
+	seen := map[string]bool{strings.ToLower(strings.TrimSpace(original)): true}
+
+	var queries []string
+	for _, line := range strings.Split(output, "\n") {
+		line = strings.TrimSpace(line)
+		line = StripListMarker(line)
+		line = strings.Trim(line, "\"")
+		if line == "" || seen[strings.ToLower(line)] {
+			continue
+		}
+		seen[strings.ToLower(line)] = true
+		queries = append(queries, line)
+		if len(queries) == n {
+			break
+		}
+	}
+	return queries
+}
@@ -0,0 +1,114 @@
+package search
+
+import (
+	"sort"
+
+	"github.com/google/uuid"
+	"rag-demo/types"
+)
+
+type sourceKey struct {
+	kbaseID uuid.UUID
+	source  string
+}
+
+type rankedWindow struct {
+	types.ChunkWindow
+	rank int
+}
+
+// MergeWindows expands each match to chunk_id ± window within its source document, merges
+// overlapping windows and de-duplicates repeated chunks. Matches are expected best first and
+// windows are returned in the order of their best-ranked match.
+func MergeWindows(matches []types.KbaseEmbeddingMatch, window int) []types.ChunkWindow {
+	if window < 0 {
+		window = 0
+	}
+
+	grouped := make(map[sourceKey][]rankedWindow)
+	var order []sourceKey
+	for rank, match := range matches {
+		key := sourceKey{kbaseID: match.KbaseID, source: matchSource(match.KbaseEmbedding)}
+		if _, ok := grouped[key]; !ok {
+			order = append(order, key)
+		}
+
+		start := match.ChunkID - window
+		if start < 0 {
+			start = 0
+		}
+		grouped[key] = append(grouped[key], rankedWindow{
+			ChunkWindow: types.ChunkWindow{
+				KbaseID:       match.KbaseID,
+				Source:        key.source,
+				ChunkStart:    start,
+				ChunkEnd:      match.ChunkID + window,
+				MatchedChunks: []int{match.ChunkID},
+				Distance:      match.Distance,
+			},
+			rank: rank,
+		})
+	}
+
+	var merged []rankedWindow
+	for _, key := range order {
+		windows := grouped[key]
+		sort.Slice(windows, func(i, j int) bool {
+			return windows[i].ChunkStart < windows[j].ChunkStart
+		})
+
+		current := windows[0]
+		for _, next := range windows[1:] {
+			if next.ChunkStart <= current.ChunkEnd {
+				current.ChunkWindow = mergeWindow(current.ChunkWindow, next.ChunkWindow)
+				if next.rank < current.rank {
+					current.rank = next.rank
+				}
+				continue
+			}
+			merged = append(merged, current)
+			current = next
+		}
+		merged = append(merged, current)
+	}
+
+	sort.SliceStable(merged, func(i, j int) bool {
+		return merged[i].rank < merged[j].rank
+	})
+
+	result := make([]types.ChunkWindow, 0, len(merged))
+	for _, w := range merged {
+		result = append(result, w.ChunkWindow)
+	}
+	return result
+}
+
+func mergeWindow(a, b types.ChunkWindow) types.ChunkWindow {
+	if b.ChunkEnd > a.ChunkEnd {
+		a.ChunkEnd = b.ChunkEnd
+	}
+	if b.Distance < a.Distance {
+		a.Distance = b.Distance
+	}
+	for _, chunkID := range b.MatchedChunks {
+		if !containsInt(a.MatchedChunks, chunkID) {
+			a.MatchedChunks = append(a.MatchedChunks, chunkID)
+		}
+	}
+	sort.Ints(a.MatchedChunks)
+	return a
+}
+
+func matchSource(embedding types.KbaseEmbedding) string {
+	source, _ := embedding.Metadata["source"].(string)
+	return source
+}
+
+func containsInt(values []int, value int) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
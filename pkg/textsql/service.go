@@ -0,0 +1,266 @@
+package textsql
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgconn"
+	"rag-demo/pkg/llm"
+	"rag-demo/types"
+)
+
+const (
+	DefaultMaxRows          = 200
+	DefaultStatementTimeout = 5 * time.Second
+
+	// schemaTTL is how long the introspected tables are reused before they are described again.
+	schemaTTL = 5 * time.Minute
+	// maxAttempts is how many queries the model may write per question; a rejected or failed query is
+	// shown to it with the error so it can correct it.
+	maxAttempts = 2
+	// summaryRows is how many result rows the model sees when summarising the result.
+	summaryRows = 50
+)
+
+var (
+	ErrNotConfigured = errors.New("text-to-SQL is not configured")
+	ErrNoTables      = errors.New("none of the allowed tables exist")
+	ErrQueryRejected = errors.New("no valid read-only query could be written for the question")
+)
+
+const queryInstructions = `Answer the user's question by writing a single PostgreSQL SELECT statement over the tables below.
+Reply with only the query in a ` + "```sql" + ` code block.
+Qualify every table with its schema, and only use the tables and columns listed.
+Never write statements that change data or settings.`
+
+const summaryInstructions = `The user's question was answered by running the SQL query below. Summarise what the result says in answer to the question, in a few sentences.
+Mention if the result was truncated or empty. Don't repeat the query or the full table.`
+
+var sqlBlock = regexp.MustCompile("(?s)```(?:sql|SQL|postgresql)?\\s*\\n(.*?)```")
+
+var plainIdentifier = regexp.MustCompile(`^[a-z_][a-z0-9_$]*$`)
+
+// Config is the part of the text-to-SQL database assistants may read and the limits on every query.
+type Config struct {
+	Tables           []string      // "schema.table" or "schema.*"
+	MaxRows          int           // rows returned per query; 0 uses DefaultMaxRows
+	StatementTimeout time.Duration // 0 uses DefaultStatementTimeout
+}
+
+// Service answers questions by having a model write a SELECT over the allowed tables, running it in
+// the read-only sandbox and having the model summarise the rows.
+type Service struct {
+	Model   llm.LLM
+	Gateway types.SQLSandboxGateway
+	Config  Config
+
+	mu       sync.Mutex
+	tables   []types.TableSchema
+	loadedAt time.Time
+}
+
+func NewService(model llm.LLM, gateway types.SQLSandboxGateway, config Config) *Service {
+	var tables []string
+	for _, table := range config.Tables {
+		if table = strings.TrimSpace(table); table != "" {
+			tables = append(tables, table)
+		}
+	}
+	config.Tables = tables
+	if config.MaxRows <= 0 {
+		config.MaxRows = DefaultMaxRows
+	}
+	if config.StatementTimeout <= 0 {
+		config.StatementTimeout = DefaultStatementTimeout
+	}
+	return &Service{Model: model, Gateway: gateway, Config: config}
+}
+
+// Tables describes the allowed tables, reusing the last description for schemaTTL.
+func (s *Service) Tables(ctx context.Context) ([]types.TableSchema, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.tables != nil && time.Since(s.loadedAt) < schemaTTL {
+		return s.tables, nil
+	}
+
+	tables, err := s.Gateway.DescribeTables(ctx, s.Config.Tables)
+	if err != nil {
+		return nil, fmt.Errorf("error describing tables: %w", err)
+	}
+	if len(tables) == 0 {
+		return nil, fmt.Errorf("%w: %s", ErrNoTables, strings.Join(s.Config.Tables, ", "))
+	}
+	s.tables, s.loadedAt = tables, time.Now()
+	return tables, nil
+}
+
+// Answer has the model write a query for the conversation in req, whose last message is the question,
+// runs it and summarises the result, streaming the summary to onToken when it is set. onResult, when
+// set, receives the result before the summary is written. The usage adds up all model calls. Queries
+// that fail validation or are rejected by Postgres are retried once with the error; if that fails too
+// ErrQueryRejected is returned.
+func (s *Service) Answer(ctx context.Context, req types.LLMRequest, onResult func(types.SQLResult), onToken func(token string) error) (types.SQLResult, types.LLMResponse, error) {
+	tables, err := s.Tables(ctx)
+	if err != nil {
+		return types.SQLResult{}, types.LLMResponse{}, err
+	}
+
+	queryReq := req
+	queryReq.System = joinSections(req.System, queryInstructions, describeTables(tables))
+	queryReq.Messages = append([]types.LLMMessage{}, req.Messages...)
+
+	var usage types.TokenUsage
+	var result types.SQLResult
+	for attempt := 1; ; attempt++ {
+		reply, err := s.Model.Converse(ctx, queryReq)
+		if err != nil {
+			return types.SQLResult{}, types.LLMResponse{}, err
+		}
+		usage = usage.Add(reply.Usage)
+
+		query := extractQuery(reply.Text)
+		err = ValidateSelect(query, tables)
+		if err == nil {
+			result, err = s.Gateway.RunReadOnly(ctx, query, s.Config.MaxRows, s.Config.StatementTimeout)
+		}
+		if err == nil {
+			break
+		}
+		var pgErr *pgconn.PgError
+		if !errors.Is(err, ErrNotReadOnly) && !errors.Is(err, ErrTableNotAllowed) && !errors.As(err, &pgErr) {
+			return types.SQLResult{}, types.LLMResponse{}, fmt.Errorf("error running query: %w", err)
+		}
+		if attempt == maxAttempts {
+			return types.SQLResult{}, types.LLMResponse{}, fmt.Errorf("%w: %v", ErrQueryRejected, err)
+		}
+		queryReq.Messages = append(queryReq.Messages,
+			types.LLMMessage{Role: types.LLMRoleAssistant, Content: reply.Text},
+			types.LLMMessage{Role: types.LLMRoleUser, Content: fmt.Sprintf("The query failed: %v\nReply with a corrected query.", err)},
+		)
+	}
+	if onResult != nil {
+		onResult(result)
+	}
+
+	summaryReq := types.LLMRequest{
+		ModelID: req.ModelID,
+		System:  joinSections(req.System, summaryInstructions),
+		Messages: []types.LLMMessage{{
+			Role:    types.LLMRoleUser,
+			Content: fmt.Sprintf("<question>\n%s\n</question>\n\n<query>\n%s\n</query>\n\n<result>\n%s\n</result>", question(req.Messages), result.Query, formatResult(result)),
+		}},
+		Temperature: req.Temperature,
+		MaxTokens:   req.MaxTokens,
+	}
+	var summary types.LLMResponse
+	if onToken != nil {
+		summary, err = s.Model.ConverseStream(ctx, summaryReq, onToken)
+	} else {
+		summary, err = s.Model.Converse(ctx, summaryReq)
+	}
+	if err != nil {
+		return types.SQLResult{}, types.LLMResponse{}, err
+	}
+	summary.Usage = usage.Add(summary.Usage)
+	return result, summary, nil
+}
+
+// extractQuery takes the query out of the model's reply: the first code block, or the whole reply
+// without one. Trailing semicolons are dropped as the query is run as a subquery.
+func extractQuery(reply string) string {
+	query := reply
+	if match := sqlBlock.FindStringSubmatch(reply); match != nil {
+		query = match[1]
+	}
+	return strings.TrimRight(strings.TrimSpace(query), "; \n\t")
+}
+
+// describeTables lists the allowed tables and their columns for the model.
+func describeTables(tables []types.TableSchema) string {
+	var block strings.Builder
+	block.WriteString("<tables>\n")
+	for _, table := range tables {
+		columns := make([]string, 0, len(table.Columns))
+		for _, column := range table.Columns {
+			definition := quoteIdent(column.Name) + " " + column.Type
+			if !column.Nullable {
+				definition += " NOT NULL"
+			}
+			columns = append(columns, definition)
+		}
+		fmt.Fprintf(&block, "%s.%s (%s)\n", quoteIdent(table.Schema), quoteIdent(table.Name), strings.Join(columns, ", "))
+	}
+	block.WriteString("</tables>")
+	return block.String()
+}
+
+// formatResult lays out the first summaryRows rows as a pipe-separated table.
+func formatResult(result types.SQLResult) string {
+	var table strings.Builder
+	names := make([]string, len(result.Columns))
+	for i, column := range result.Columns {
+		names[i] = column.Name
+	}
+	table.WriteString(strings.Join(names, " | "))
+
+	for i, row := range result.Rows {
+		if i == summaryRows {
+			break
+		}
+		cells := make([]string, len(row))
+		for j, value := range row {
+			if value == nil {
+				cells[j] = "NULL"
+			} else {
+				cells[j] = fmt.Sprint(value)
+			}
+		}
+		table.WriteString("\n" + strings.Join(cells, " | "))
+	}
+
+	switch {
+	case result.RowCount == 0:
+		table.WriteString("\n(no rows)")
+	case result.Truncated:
+		fmt.Fprintf(&table, "\n(%d rows shown; the query returned more than %d rows and was truncated)", min(result.RowCount, summaryRows), result.RowCount)
+	case result.RowCount > summaryRows:
+		fmt.Fprintf(&table, "\n(%d of %d rows shown)", summaryRows, result.RowCount)
+	default:
+		fmt.Fprintf(&table, "\n(%d rows)", result.RowCount)
+	}
+	return table.String()
+}
+
+// quoteIdent double-quotes names Postgres would otherwise fold or reject.
+func quoteIdent(name string) string {
+	if plainIdentifier.MatchString(name) {
+		return name
+	}
+	return `"` + strings.ReplaceAll(name, `"`, `""`) + `"`
+}
+
+// question is the content of the last user message.
+func question(messages []types.LLMMessage) string {
+	for i := len(messages) - 1; i >= 0; i-- {
+		if messages[i].Role == types.LLMRoleUser {
+			return messages[i].Content
+		}
+	}
+	return ""
+}
+
+func joinSections(sections ...string) string {
+	var nonEmpty []string
+	for _, section := range sections {
+		if strings.TrimSpace(section) != "" {
+			nonEmpty = append(nonEmpty, section)
+		}
+	}
+	return strings.Join(nonEmpty, "\n\n")
+}
@@ -0,0 +1,410 @@
+package textsql
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"unicode"
+
+	"rag-demo/types"
+)
+
+var (
+	ErrNotReadOnly     = errors.New("query is not a read-only SELECT")
+	ErrTableNotAllowed = errors.New("table is not allowed")
+)
+
+// writeKeywords modify data or create tables. Utility statements such as COPY or SET are rejected by
+// requiring the query to start with SELECT or WITH; these can also appear further in, e.g. in a CTE.
+var writeKeywords = map[string]bool{
+	"insert": true, "update": true, "delete": true, "merge": true, "into": true,
+}
+
+// deniedFunctions reach outside the allowed tables, change settings or have side effects.
+var deniedFunctions = map[string]bool{
+	"set_config": true, "current_setting": true, "nextval": true, "setval": true, "currval": true, "lastval": true,
+	"query_to_xml": true, "query_to_xml_and_xmlschema": true, "query_to_xmlschema": true,
+	"table_to_xml": true, "table_to_xml_and_xmlschema": true, "cursor_to_xml": true,
+	"schema_to_xml": true, "database_to_xml": true, "txid_current": true,
+}
+
+var deniedFunctionPrefixes = []string{"pg_", "lo_", "dblink"}
+
+// clauseKeywords end the list of tables of a FROM clause.
+var clauseKeywords = map[string]bool{
+	"where": true, "group": true, "having": true, "order": true, "limit": true, "offset": true, "fetch": true,
+	"union": true, "intersect": true, "except": true, "window": true, "for": true, "on": true, "using": true,
+	"join": true, "inner": true, "left": true, "right": true, "full": true, "cross": true, "natural": true,
+	"outer": true, "lateral": true, "tablesample": true, "returning": true,
+}
+
+type tokenKind int
+
+const (
+	tokenWord   tokenKind = iota // unquoted identifier or keyword, lower-cased
+	tokenQuoted                  // "quoted identifier"
+	tokenString                  // string literal, including dollar-quoted and E'' strings
+	tokenNumber
+	tokenSymbol
+)
+
+type token struct {
+	kind tokenKind
+	text string
+}
+
+func (t token) is(word string) bool {
+	return t.kind == tokenWord && t.text == word
+}
+
+func (t token) isName() bool {
+	return t.kind == tokenWord || t.kind == tokenQuoted
+}
+
+// ValidateSelect checks that query is a single SELECT, optionally with CTEs, that neither writes nor
+// locks, calls no function that escapes the sandbox, and only reads the given tables. Tables must be
+// qualified with their schema.
+func ValidateSelect(query string, tables []types.TableSchema) error {
+	tokens, err := lex(query)
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrNotReadOnly, err)
+	}
+	for len(tokens) > 0 && tokens[len(tokens)-1].text == ";" {
+		tokens = tokens[:len(tokens)-1]
+	}
+	if len(tokens) == 0 {
+		return fmt.Errorf("%w: the query is empty", ErrNotReadOnly)
+	}
+
+	first := 0
+	for first < len(tokens) && tokens[first].text == "(" {
+		first++
+	}
+	if first == len(tokens) || !(tokens[first].is("select") || tokens[first].is("with")) {
+		return fmt.Errorf("%w: the query must start with SELECT or WITH", ErrNotReadOnly)
+	}
+
+	depth := 0
+	for i, t := range tokens {
+		switch {
+		case t.text == ";":
+			return fmt.Errorf("%w: only a single statement is allowed", ErrNotReadOnly)
+		case t.text == "(":
+			depth++
+		case t.text == ")":
+			depth--
+			if depth < 0 {
+				return fmt.Errorf("%w: unbalanced parentheses", ErrNotReadOnly)
+			}
+		case t.kind == tokenSymbol && strings.HasPrefix(t.text, "$"):
+			return fmt.Errorf("%w: parameters are not supported", ErrNotReadOnly)
+		case t.kind == tokenWord && writeKeywords[t.text]:
+			return fmt.Errorf("%w: %s is not allowed", ErrNotReadOnly, strings.ToUpper(t.text))
+		case t.is("for") && i+1 < len(tokens) && (tokens[i+1].is("share") || tokens[i+1].is("no") || tokens[i+1].is("key")):
+			return fmt.Errorf("%w: row locks are not allowed", ErrNotReadOnly)
+		case t.isName() && i+1 < len(tokens) && tokens[i+1].text == "(" && deniedFunction(t.text):
+			return fmt.Errorf("%w: function %s is not allowed", ErrNotReadOnly, t.text)
+		}
+	}
+	if depth != 0 {
+		return fmt.Errorf("%w: unbalanced parentheses", ErrNotReadOnly)
+	}
+
+	allowed := make(map[string]bool, len(tables))
+	for _, table := range tables {
+		allowed[table.Schema+"."+table.Name] = true
+	}
+	ctes := cteNames(tokens)
+	for _, ref := range tableRefs(tokens) {
+		switch {
+		case len(ref) == 1 && ctes[ref[0]]:
+		case len(ref) == 1:
+			return fmt.Errorf("%w: %s must be qualified with its schema", ErrTableNotAllowed, ref[0])
+		case len(ref) == 2 && allowed[ref[0]+"."+ref[1]]:
+		default:
+			return fmt.Errorf("%w: %s", ErrTableNotAllowed, strings.Join(ref, "."))
+		}
+	}
+	return nil
+}
+
+func deniedFunction(name string) bool {
+	name = strings.ToLower(name)
+	if deniedFunctions[name] {
+		return true
+	}
+	for _, prefix := range deniedFunctionPrefixes {
+		if strings.HasPrefix(name, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// cteNames collects the names defined by WITH clauses: a name after WITH, RECURSIVE or a comma that is
+// followed, optionally after a column list, by AS and the CTE's parenthesis. Requiring the parenthesis
+// keeps an aliased select list column from passing as a CTE.
+func cteNames(tokens []token) map[string]bool {
+	names := make(map[string]bool)
+	for i := 1; i < len(tokens); i++ {
+		prev := tokens[i-1]
+		if !tokens[i].isName() || !(prev.is("with") || prev.is("recursive") || prev.text == ",") {
+			continue
+		}
+		next := i + 1
+		if next < len(tokens) && tokens[next].text == "(" {
+			next = skipParens(tokens, next)
+		}
+		if next < len(tokens) && tokens[next].is("as") {
+			next++
+			for next < len(tokens) && (tokens[next].is("not") || tokens[next].is("materialized")) {
+				next++
+			}
+			if next < len(tokens) && tokens[next].text == "(" {
+				names[tokens[i].text] = true
+			}
+		}
+	}
+	return names
+}
+
+// startsQuery reports whether t opens a query: SELECT, WITH, VALUES or TABLE, the shorthand for
+// SELECT * FROM a table.
+func startsQuery(t token) bool {
+	return t.is("select") || t.is("with") || t.is("values") || t.is("table")
+}
+
+// tableRefs lists the relations read by FROM and JOIN clauses and TABLE queries as their dotted name
+// parts. FROM only starts a table list where a query is being parsed, not in EXTRACT(... FROM ...) or
+// IS DISTINCT FROM. Subqueries are skipped here; their own FROM clauses are found as the scan reaches
+// them.
+func tableRefs(tokens []token) [][]string {
+	// whether each open parenthesis holds a query rather than an expression
+	queryLevel := []bool{true}
+	var refs [][]string
+	for i := 0; i < len(tokens); i++ {
+		t := tokens[i]
+		switch {
+		case t.text == "(":
+			queryLevel = append(queryLevel, i+1 < len(tokens) && startsQuery(tokens[i+1]))
+		case t.text == ")":
+			queryLevel = queryLevel[:len(queryLevel)-1]
+		case t.is("from") && queryLevel[len(queryLevel)-1] && !(i > 0 && tokens[i-1].is("distinct")):
+			refs = append(refs, fromList(tokens, i+1)...)
+		case t.is("join"), t.is("table"):
+			// TABLE is reserved, so unquoted it can only be a TABLE query such as WITH q AS (TABLE x)
+			found, _ := relation(tokens, i+1)
+			refs = append(refs, found...)
+		}
+	}
+	return refs
+}
+
+// fromList reads the comma-separated relations of a FROM clause starting at i.
+func fromList(tokens []token, i int) [][]string {
+	var refs [][]string
+	for i < len(tokens) {
+		found, next := relation(tokens, i)
+		refs = append(refs, found...)
+		i = skipAlias(tokens, next)
+		if i >= len(tokens) || tokens[i].text != "," {
+			break
+		}
+		i++
+	}
+	return refs
+}
+
+// relation reads one FROM item at i and returns the tables it names and the index after it. A
+// subquery or function names none; a parenthesised join such as (a JOIN b ON ...) names its first
+// relation here, the joined ones are found at their JOIN.
+func relation(tokens []token, i int) ([][]string, int) {
+	for i < len(tokens) && (tokens[i].is("lateral") || tokens[i].is("only")) {
+		i++
+	}
+	if i >= len(tokens) {
+		return nil, i
+	}
+	if tokens[i].text == "(" {
+		if i+1 < len(tokens) && startsQuery(tokens[i+1]) {
+			return nil, skipParens(tokens, i)
+		}
+		return fromList(tokens, i+1), skipParens(tokens, i)
+	}
+	if !tokens[i].isName() {
+		return nil, i
+	}
+
+	name := []string{tokens[i].text}
+	i++
+	for i+1 < len(tokens) && tokens[i].text == "." && tokens[i+1].isName() {
+		name = append(name, tokens[i+1].text)
+		i += 2
+	}
+	if i < len(tokens) && tokens[i].text == "(" {
+		// a set-returning function such as generate_series(1, 10)
+		return nil, skipParens(tokens, i)
+	}
+	return [][]string{name}, i
+}
+
+// skipAlias skips [AS] alias [(columns)] after a FROM item.
+func skipAlias(tokens []token, i int) int {
+	if i < len(tokens) && tokens[i].is("as") {
+		i++
+	}
+	if i < len(tokens) && tokens[i].isName() && !clauseKeywords[tokens[i].text] {
+		i++
+		if i < len(tokens) && tokens[i].text == "(" {
+			i = skipParens(tokens, i)
+		}
+	}
+	return i
+}
+
+// skipParens returns the index after the parenthesis closing the one at i.
+func skipParens(tokens []token, i int) int {
+	depth := 0
+	for ; i < len(tokens); i++ {
+		switch tokens[i].text {
+		case "(":
+			depth++
+		case ")":
+			depth--
+			if depth == 0 {
+				return i + 1
+			}
+		}
+	}
+	return i
+}
+
+// lex splits a Postgres query into tokens, dropping comments and whitespace. Unquoted words are
+// lower-cased as Postgres folds them.
+func lex(query string) ([]token, error) {
+	src := []rune(query)
+	var tokens []token
+	for i := 0; i < len(src); {
+		c := src[i]
+		switch {
+		case unicode.IsSpace(c):
+			i++
+		case c == '-' && i+1 < len(src) && src[i+1] == '-':
+			for i < len(src) && src[i] != '\n' {
+				i++
+			}
+		case c == '/' && i+1 < len(src) && src[i+1] == '*':
+			// block comments nest in Postgres
+			depth := 0
+			for {
+				if i+1 >= len(src) {
+					return nil, fmt.Errorf("unterminated comment")
+				}
+				if src[i] == '/' && src[i+1] == '*' {
+					depth++
+					i += 2
+				} else if src[i] == '*' && src[i+1] == '/' {
+					depth--
+					i += 2
+					if depth == 0 {
+						break
+					}
+				} else {
+					i++
+				}
+			}
+		case c == '\'':
+			end, err := quoted(src, i, '\'', false)
+			if err != nil {
+				return nil, err
+			}
+			tokens = append(tokens, token{kind: tokenString, text: string(src[i:end])})
+			i = end
+		case (c == 'e' || c == 'E') && i+1 < len(src) && src[i+1] == '\'':
+			end, err := quoted(src, i+1, '\'', true)
+			if err != nil {
+				return nil, err
+			}
+			tokens = append(tokens, token{kind: tokenString, text: string(src[i:end])})
+			i = end
+		case c == '"':
+			end, err := quoted(src, i, '"', false)
+			if err != nil {
+				return nil, err
+			}
+			name := strings.ReplaceAll(string(src[i+1:end-1]), `""`, `"`)
+			tokens = append(tokens, token{kind: tokenQuoted, text: name})
+			i = end
+		case c == '$':
+			end, ok := dollarQuoted(src, i)
+			if ok {
+				if end < 0 {
+					return nil, fmt.Errorf("unterminated dollar-quoted string")
+				}
+				tokens = append(tokens, token{kind: tokenString, text: string(src[i:end])})
+				i = end
+				continue
+			}
+			// a positional parameter such as $1
+			end = i + 1
+			for end < len(src) && unicode.IsDigit(src[end]) {
+				end++
+			}
+			tokens = append(tokens, token{kind: tokenSymbol, text: string(src[i:end])})
+			i = end
+		case unicode.IsLetter(c) || c == '_':
+			end := i
+			for end < len(src) && (unicode.IsLetter(src[end]) || unicode.IsDigit(src[end]) || src[end] == '_' || src[end] == '$') {
+				end++
+			}
+			tokens = append(tokens, token{kind: tokenWord, text: strings.ToLower(string(src[i:end]))})
+			i = end
+		case unicode.IsDigit(c):
+			end := i
+			for end < len(src) && (unicode.IsDigit(src[end]) || src[end] == '.' || src[end] == 'e' || src[end] == 'E') {
+				end++
+			}
+			tokens = append(tokens, token{kind: tokenNumber, text: string(src[i:end])})
+			i = end
+		default:
+			tokens = append(tokens, token{kind: tokenSymbol, text: string(c)})
+			i++
+		}
+	}
+	return tokens, nil
+}
+
+// quoted returns the index after the literal or identifier opened by the quote at i. A doubled quote
+// is an escaped quote, as is a backslash-escaped one in E'...' strings.
+func quoted(src []rune, i int, quote rune, backslashes bool) (int, error) {
+	for j := i + 1; j < len(src); j++ {
+		switch {
+		case backslashes && src[j] == '\\':
+			j++
+		case src[j] == quote && j+1 < len(src) && src[j+1] == quote:
+			j++
+		case src[j] == quote:
+			return j + 1, nil
+		}
+	}
+	return 0, fmt.Errorf("unterminated %c", quote)
+}
+
+// dollarQuoted reports whether a $tag$ string starts at i and returns the index after it, or -1 if it
+// is never closed.
+func dollarQuoted(src []rune, i int) (int, bool) {
+	j := i + 1
+	for j < len(src) && (unicode.IsLetter(src[j]) || src[j] == '_' || (j > i+1 && unicode.IsDigit(src[j]))) {
+		j++
+	}
+	if j >= len(src) || src[j] != '$' {
+		return 0, false
+	}
+	tag := src[i : j+1]
+	for k := j + 1; k+len(tag) <= len(src); k++ {
+		if string(src[k:k+len(tag)]) == string(tag) {
+			return k + len(tag), true
+		}
+	}
+	return -1, true
+}
@@ -0,0 +1,178 @@
+package tools
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"rag-demo/pkg/llm"
+	"rag-demo/types"
+)
+
+// DefaultMaxIterations is how many times the model is called per answer when the agent doesn't set a limit.
+const DefaultMaxIterations = 5
+
+var ErrMaxIterations = errors.New("tool call limit reached")
+
+// Agent answers with a model that may call tools: tool calls the model requests are run and their
+// results fed back until the model answers without calling a tool.
+type Agent struct {
+	Model         llm.LLM
+	MaxIterations int // model calls per answer; 0 uses DefaultMaxIterations
+}
+
+func NewAgent(model llm.LLM, maxIterations int) *Agent {
+	if maxIterations <= 0 {
+		maxIterations = DefaultMaxIterations
+	}
+	return &Agent{Model: model, MaxIterations: maxIterations}
+}
+
+// RunOptions observe a run while it happens.
+type RunOptions struct {
+	OnToken    func(token string) error        // streams the model's text when set; otherwise the model is called with Converse
+	OnToolCall func(call types.ToolCallRecord) // called after each tool call
+}
+
+// Run calls the model with the request and the toolset until it stops requesting tools, at most
+// MaxIterations times. The returned text joins what the model wrote in every iteration, which is also
+// what was streamed, and the usage adds up all calls. Failed or timed out tool calls are reported to
+// the model as errors rather than ending the run. When the limit is reached the response so far is
+// returned with ErrMaxIterations.
+func (a *Agent) Run(ctx context.Context, req types.LLMRequest, toolset []Tool, opts RunOptions) (types.LLMResponse, []types.ToolCallRecord, error) {
+	byName := make(map[string]Tool, len(toolset))
+	req.Tools = nil
+	for _, tool := range toolset {
+		byName[tool.Name] = tool
+		req.Tools = append(req.Tools, tool.Spec())
+	}
+	// the caller's slice must not be appended to
+	req.Messages = append([]types.LLMMessage{}, req.Messages...)
+
+	var response types.LLMResponse
+	var usage types.TokenUsage
+	var answer strings.Builder
+	var records []types.ToolCallRecord
+	for i := 0; i < a.MaxIterations; i++ {
+		var err error
+		response, err = a.call(ctx, req, answer.Len() > 0, opts.OnToken)
+		usage = usage.Add(response.Usage)
+		if response.Text != "" {
+			if answer.Len() > 0 {
+				answer.WriteString("\n\n")
+			}
+			answer.WriteString(response.Text)
+		}
+		if err != nil {
+			return types.LLMResponse{Text: answer.String(), Usage: usage}, records, err
+		}
+		if len(response.ToolCalls) == 0 {
+			response.Text = answer.String()
+			response.Usage = usage
+			return response, records, nil
+		}
+
+		req.Messages = append(req.Messages, types.LLMMessage{Role: types.LLMRoleAssistant, Content: response.Text, ToolCalls: response.ToolCalls})
+		results := make([]types.ToolResult, 0, len(response.ToolCalls))
+		for _, call := range response.ToolCalls {
+			record, result := execute(ctx, byName, call)
+			records = append(records, record)
+			results = append(results, result)
+			if opts.OnToolCall != nil {
+				opts.OnToolCall(record)
+			}
+		}
+		if err := ctx.Err(); err != nil {
+			return types.LLMResponse{Text: answer.String(), Usage: usage}, records, err
+		}
+		req.Messages = append(req.Messages, types.LLMMessage{Role: types.LLMRoleUser, ToolResults: results})
+	}
+
+	return types.LLMResponse{Text: answer.String(), StopReason: response.StopReason, Usage: usage}, records,
+		fmt.Errorf("%w: the model still requested tools after %d calls", ErrMaxIterations, a.MaxIterations)
+}
+
+// call makes one model call, streaming its text if onToken is set. Text following an earlier
+// iteration's text is separated from it by a blank line, as in the joined answer.
+func (a *Agent) call(ctx context.Context, req types.LLMRequest, continued bool, onToken func(token string) error) (types.LLMResponse, error) {
+	if onToken == nil {
+		return a.Model.Converse(ctx, req)
+	}
+	first := true
+	return a.Model.ConverseStream(ctx, req, func(token string) error {
+		if first && continued {
+			if err := onToken("\n\n"); err != nil {
+				return err
+			}
+		}
+		first = false
+		return onToken(token)
+	})
+}
+
+// execute runs one tool call and returns its record and the result for the model.
+func execute(ctx context.Context, byName map[string]Tool, call types.ToolCall) (types.ToolCallRecord, types.ToolResult) {
+	start := time.Now()
+	record := types.ToolCallRecord{Name: call.Name, Input: call.Input}
+	if len(record.Input) == 0 {
+		record.Input = json.RawMessage("{}")
+	}
+
+	var output string
+	var err error
+	tool, ok := byName[call.Name]
+	switch {
+	case !ok:
+		err = fmt.Errorf("%w: %s", ErrUnknownTool, call.Name)
+	case !json.Valid(record.Input):
+		// keep what the model sent, as a string, so the record can still be stored
+		record.Input, _ = json.Marshal(string(record.Input))
+		err = fmt.Errorf("%w: input is not valid JSON", ErrInvalidArgs)
+	default:
+		if err = validateInput(tool, record.Input); err == nil {
+			output, err = runTool(ctx, tool, record.Input)
+		}
+	}
+	record.DurationMs = time.Since(start).Milliseconds()
+
+	if err != nil {
+		record.Error = err.Error()
+		return record, types.ToolResult{ToolCallID: call.ID, Content: record.Error, IsError: true}
+	}
+	record.Output = output
+	return record, types.ToolResult{ToolCallID: call.ID, Content: output}
+}
+
+// runTool calls the tool's handler within its timeout. A handler that ignores the cancelled context
+// is abandoned rather than waited for.
+func runTool(ctx context.Context, tool Tool, input json.RawMessage) (string, error) {
+	timeout := tool.Timeout
+	if timeout <= 0 {
+		timeout = DefaultTimeout
+	}
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	type result struct {
+		output string
+		err    error
+	}
+	done := make(chan result, 1)
+	go func() {
+		output, err := tool.Handler(ctx, input)
+		done <- result{output: output, err: err}
+	}()
+
+	select {
+	case r := <-done:
+		return r.output, r.err
+	case <-ctx.Done():
+		if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+			return "", fmt.Errorf("%s timed out after %s", tool.Name, timeout)
+		}
+		return "", ctx.Err()
+	}
+}
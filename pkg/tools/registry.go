@@ -0,0 +1,196 @@
+package tools
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"regexp"
+	"sort"
+	"sync"
+	"time"
+
+	"rag-demo/types"
+)
+
+// KbaseSearch is the built-in tool that searches the kbases attached to the assistant. It is bound to
+// the assistant's kbases per message, so it is never registered and is always known.
+const KbaseSearch = "search_kbase"
+
+const (
+	KbaseSearchDescription = `Search the knowledge bases attached to this assistant for passages relevant to a query.
+Use it before answering questions about their documents, and again with a different query if the passages don't answer the question.
+Cite the passages that support each statement by writing their id in square brackets right after it, for example [1] or [2, 3].`
+	KbaseSearchSchema = `{"type":"object","properties":{"query":{"type":"string","description":"A standalone search query"}},"required":["query"]}`
+)
+
+// DefaultTimeout bounds a tool call that doesn't set its own timeout.
+const DefaultTimeout = 30 * time.Second
+
+var (
+	ErrInvalidTool = errors.New("invalid tool")
+	ErrUnknownTool = errors.New("unknown tool")
+	ErrInvalidArgs = errors.New("invalid tool input")
+)
+
+// tool names are restricted to what every Converse model accepts
+var toolNamePattern = regexp.MustCompile(`^[a-zA-Z][a-zA-Z0-9_-]{0,63}$`)
+
+// Handler runs a tool with the input the model provided and returns the text shown to the model.
+type Handler func(ctx context.Context, input json.RawMessage) (string, error)
+
+// Tool is a Go function a model can call, described by a JSON schema of its input object.
+type Tool struct {
+	Name        string
+	Description string          // tells the model what the tool does and when to use it
+	Schema      json.RawMessage // JSON schema of the input, e.g. {"type":"object","properties":{...},"required":[...]}
+	Timeout     time.Duration   // 0 uses DefaultTimeout
+	Handler     Handler
+}
+
+// Spec returns the description of the tool sent to the model.
+func (t Tool) Spec() types.ToolSpec {
+	return types.ToolSpec{Name: t.Name, Description: t.Description, InputSchema: t.Schema}
+}
+
+// Registry holds the tools assistants can be configured with.
+type Registry struct {
+	mu    sync.RWMutex
+	tools map[string]Tool
+}
+
+func NewRegistry() *Registry {
+	return &Registry{tools: make(map[string]Tool)}
+}
+
+// Register adds a tool after checking its name, schema and handler.
+func (r *Registry) Register(tool Tool) error {
+	if err := validateTool(tool); err != nil {
+		return err
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if _, exists := r.tools[tool.Name]; exists || tool.Name == KbaseSearch {
+		return fmt.Errorf("%w: %s is already registered", ErrInvalidTool, tool.Name)
+	}
+	r.tools[tool.Name] = tool
+	return nil
+}
+
+// Get returns the registered tool with the given name.
+func (r *Registry) Get(name string) (Tool, bool) {
+	if r == nil {
+		return Tool{}, false
+	}
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	tool, ok := r.tools[name]
+	return tool, ok
+}
+
+// Known reports whether an assistant can be configured with the named tool.
+func (r *Registry) Known(name string) bool {
+	if name == KbaseSearch {
+		return true
+	}
+	_, ok := r.Get(name)
+	return ok
+}
+
+// Specs describes the tools assistants can use, including the built-in ones, sorted by name.
+func (r *Registry) Specs() []types.ToolSpec {
+	specs := []types.ToolSpec{{Name: KbaseSearch, Description: KbaseSearchDescription, InputSchema: json.RawMessage(KbaseSearchSchema)}}
+	if r != nil {
+		r.mu.RLock()
+		for _, tool := range r.tools {
+			specs = append(specs, tool.Spec())
+		}
+		r.mu.RUnlock()
+	}
+	sort.Slice(specs, func(i, j int) bool { return specs[i].Name < specs[j].Name })
+	return specs
+}
+
+func validateTool(tool Tool) error {
+	if !toolNamePattern.MatchString(tool.Name) {
+		return fmt.Errorf("%w: name %q must be a letter followed by up to 63 letters, digits, _ or -", ErrInvalidTool, tool.Name)
+	}
+	if tool.Description == "" {
+		return fmt.Errorf("%w: %s has no description", ErrInvalidTool, tool.Name)
+	}
+	if tool.Handler == nil {
+		return fmt.Errorf("%w: %s has no handler", ErrInvalidTool, tool.Name)
+	}
+
+	var schema inputSchema
+	if err := json.Unmarshal(tool.Schema, &schema); err != nil {
+		return fmt.Errorf("%w: schema of %s: %v", ErrInvalidTool, tool.Name, err)
+	}
+	if schema.Type != "object" {
+		return fmt.Errorf("%w: schema of %s must describe an object", ErrInvalidTool, tool.Name)
+	}
+	for _, name := range schema.Required {
+		if _, ok := schema.Properties[name]; !ok {
+			return fmt.Errorf("%w: schema of %s requires undeclared property %s", ErrInvalidTool, tool.Name, name)
+		}
+	}
+	return nil
+}
+
+// inputSchema is the part of a JSON schema the input of a call is checked against before the handler
+// runs: the input is an object with the required properties, and properties have the declared type.
+type inputSchema struct {
+	Type       string `json:"type"`
+	Properties map[string]struct {
+		Type string `json:"type"`
+	} `json:"properties"`
+	Required []string `json:"required"`
+}
+
+// validateInput checks the model's input against the tool's schema, so handlers can decode it without
+// repeating the checks and the model gets a useful error to correct its call.
+func validateInput(tool Tool, input json.RawMessage) error {
+	var schema inputSchema
+	if err := json.Unmarshal(tool.Schema, &schema); err != nil {
+		return err
+	}
+
+	var values map[string]interface{}
+	if err := json.Unmarshal(input, &values); err != nil || values == nil {
+		return fmt.Errorf("%w: expected a JSON object", ErrInvalidArgs)
+	}
+	for _, name := range schema.Required {
+		if _, ok := values[name]; !ok {
+			return fmt.Errorf("%w: missing required property %s", ErrInvalidArgs, name)
+		}
+	}
+	for name, value := range values {
+		property, ok := schema.Properties[name]
+		if !ok || property.Type == "" {
+			continue
+		}
+		if !hasType(value, property.Type) {
+			return fmt.Errorf("%w: property %s must be of type %s", ErrInvalidArgs, name, property.Type)
+		}
+	}
+	return nil
+}
+
+func hasType(value interface{}, schemaType string) bool {
+	switch v := value.(type) {
+	case string:
+		return schemaType == "string"
+	case float64:
+		return schemaType == "number" || (schemaType == "integer" && v == float64(int64(v)))
+	case bool:
+		return schemaType == "boolean"
+	case []interface{}:
+		return schemaType == "array"
+	case map[string]interface{}:
+		return schemaType == "object"
+	case nil:
+		return schemaType == "null"
+	}
+	return false
+}
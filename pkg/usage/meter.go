@@ -0,0 +1,62 @@
+package usage
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/google/uuid"
+	"rag-demo/types"
+)
+
+// Meter prices metered calls and records them. Accounting never fails a call: errors recording usage
+// are only logged.
+type Meter struct {
+	Gateway types.UsageTableGateway
+	Prices  PriceTable
+}
+
+func NewMeter(gateway types.UsageTableGateway, prices PriceTable) *Meter {
+	return &Meter{Gateway: gateway, Prices: prices}
+}
+
+// Record prices and stores the usage, attributing it to the scope of ctx where its own scope has no id.
+// A nil Meter records nothing.
+func (m *Meter) Record(ctx context.Context, usage types.Usage) {
+	if m == nil {
+		return
+	}
+
+	scope := ScopeFrom(ctx)
+	if usage.UserID == uuid.Nil {
+		usage.UserID = scope.UserID
+	}
+	if usage.SessionID == uuid.Nil {
+		usage.SessionID = scope.SessionID
+	}
+	if usage.AssistantID == uuid.Nil {
+		usage.AssistantID = scope.AssistantID
+	}
+	if usage.KbaseID == uuid.Nil {
+		usage.KbaseID = scope.KbaseID
+	}
+	usage.ID = uuid.New()
+	usage.Cost = m.Prices.Cost(usage)
+
+	// the call already happened, so it is recorded even if the request that made it was cancelled
+	if err := m.Gateway.RecordUsage(context.WithoutCancel(ctx), usage); err != nil {
+		fmt.Println("Error recording usage: ", err)
+	}
+}
+
+type scopeKey struct{}
+
+// WithScope returns a context whose metered calls are attributed to scope.
+func WithScope(ctx context.Context, scope types.UsageScope) context.Context {
+	return context.WithValue(ctx, scopeKey{}, scope)
+}
+
+// ScopeFrom returns the scope of ctx, the zero scope if it has none.
+func ScopeFrom(ctx context.Context) types.UsageScope {
+	scope, _ := ctx.Value(scopeKey{}).(types.UsageScope)
+	return scope
+}
@@ -0,0 +1,77 @@
+package usage
+
+import (
+	"context"
+
+	"rag-demo/pkg/llm"
+	"rag-demo/pkg/search"
+	"rag-demo/types"
+)
+
+// MeteredLLM records the token usage of every call to the chat model it wraps.
+type MeteredLLM struct {
+	LLM   llm.LLM
+	Meter *Meter
+}
+
+func NewMeteredLLM(model llm.LLM, meter *Meter) llm.LLM {
+	return &MeteredLLM{LLM: model, Meter: meter}
+}
+
+func (m *MeteredLLM) Converse(ctx context.Context, req types.LLMRequest) (types.LLMResponse, error) {
+	response, err := m.LLM.Converse(ctx, req)
+	m.record(ctx, req.ModelID, response.Usage)
+	return response, err
+}
+
+func (m *MeteredLLM) ConverseStream(ctx context.Context, req types.LLMRequest, onToken func(token string) error) (types.LLMResponse, error) {
+	response, err := m.LLM.ConverseStream(ctx, req, onToken)
+	m.record(ctx, req.ModelID, response.Usage)
+	return response, err
+}
+
+// record skips calls that failed before the model reported any usage.
+func (m *MeteredLLM) record(ctx context.Context, modelID string, tokens types.TokenUsage) {
+	if tokens.InputTokens == 0 && tokens.OutputTokens == 0 {
+		return
+	}
+	m.Meter.Record(ctx, types.Usage{
+		Kind:         types.UsageKindGeneration,
+		ModelID:      modelID,
+		InputTokens:  tokens.InputTokens,
+		OutputTokens: tokens.OutputTokens,
+	})
+}
+
+// TokenEmbedder is an embedder that reports the input tokens of each embedding.
+type TokenEmbedder interface {
+	search.Embedder
+	EmbedTextTokens(ctx context.Context, text string) ([]float32, int, error)
+}
+
+// MeteredEmbedder records the token usage of every embedding made with the embedder it wraps.
+type MeteredEmbedder struct {
+	Embedder TokenEmbedder
+	Meter    *Meter
+}
+
+func NewMeteredEmbedder(embedder TokenEmbedder, meter *Meter) search.Embedder {
+	return &MeteredEmbedder{Embedder: embedder, Meter: meter}
+}
+
+func (m *MeteredEmbedder) EmbedText(ctx context.Context, text string) ([]float32, error) {
+	embedding, tokens, err := m.Embedder.EmbedTextTokens(ctx, text)
+	if err != nil {
+		return nil, err
+	}
+	m.Meter.Record(ctx, types.Usage{
+		Kind:        types.UsageKindEmbedding,
+		ModelID:     m.Embedder.EmbeddingModelID(),
+		InputTokens: tokens,
+	})
+	return embedding, nil
+}
+
+func (m *MeteredEmbedder) EmbeddingModelID() string {
+	return m.Embedder.EmbeddingModelID()
+}
@@ -0,0 +1,73 @@
+package usage
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+
+	"rag-demo/types"
+)
+
+// TextractDetectText is the ModelID of the page usage of Textract text detection jobs.
+const TextractDetectText = "textract.detect-document-text"
+
+// Price is what a model or API charges in US dollars.
+type Price struct {
+	InputPer1K  float64 `json:"input_per_1k"`  // per 1000 input tokens
+	OutputPer1K float64 `json:"output_per_1k"` // per 1000 output tokens
+	PerPage     float64 `json:"per_page"`
+}
+
+// PriceTable maps model ids, and TextractDetectText, to their price.
+type PriceTable map[string]Price
+
+// DefaultPrices are the on-demand prices in us-east-1 of the supported models, the embedding model and
+// Textract text detection.
+var DefaultPrices = PriceTable{
+	"anthropic.claude-3-5-sonnet-20240620-v1:0": {InputPer1K: 0.003, OutputPer1K: 0.015},
+	"anthropic.claude-3-sonnet-20240229-v1:0":   {InputPer1K: 0.003, OutputPer1K: 0.015},
+	"anthropic.claude-3-haiku-20240307-v1:0":    {InputPer1K: 0.00025, OutputPer1K: 0.00125},
+	"anthropic.claude-3-opus-20240229-v1:0":     {InputPer1K: 0.015, OutputPer1K: 0.075},
+	"meta.llama3-8b-instruct-v1:0":              {InputPer1K: 0.0003, OutputPer1K: 0.0006},
+	"meta.llama3-70b-instruct-v1:0":             {InputPer1K: 0.00265, OutputPer1K: 0.0035},
+	"mistral.mistral-7b-instruct-v0:2":          {InputPer1K: 0.00015, OutputPer1K: 0.0002},
+	"mistral.mixtral-8x7b-instruct-v0:1":        {InputPer1K: 0.00045, OutputPer1K: 0.0007},
+	"mistral.mistral-large-2402-v1:0":           {InputPer1K: 0.004, OutputPer1K: 0.012},
+	"amazon.titan-text-express-v1":              {InputPer1K: 0.0002, OutputPer1K: 0.0006},
+	"amazon.titan-text-lite-v1":                 {InputPer1K: 0.00015, OutputPer1K: 0.0002},
+	"amazon.titan-embed-g1-text-02":             {InputPer1K: 0.0001},
+	TextractDetectText:                          {PerPage: 0.0015},
+}
+
+// LoadPrices returns the default prices overridden by the prices in the JSON file at path, an object
+// of model ids to prices. An empty path returns the defaults.
+func LoadPrices(path string) (PriceTable, error) {
+	prices := PriceTable{}
+	for modelID, price := range DefaultPrices {
+		prices[modelID] = price
+	}
+	if path == "" {
+		return prices, nil
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("error reading price table: %w", err)
+	}
+	var overrides PriceTable
+	if err := json.Unmarshal(data, &overrides); err != nil {
+		return nil, fmt.Errorf("error parsing price table: %w", err)
+	}
+	for modelID, price := range overrides {
+		prices[modelID] = price
+	}
+	return prices, nil
+}
+
+// Cost prices the usage; usage of a model that isn't in the table costs nothing.
+func (p PriceTable) Cost(usage types.Usage) float64 {
+	price := p[usage.ModelID]
+	return float64(usage.InputTokens)/1000*price.InputPer1K +
+		float64(usage.OutputTokens)/1000*price.OutputPer1K +
+		float64(usage.Pages)*price.PerPage
+}
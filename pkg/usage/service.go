@@ -0,0 +1,80 @@
+package usage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"rag-demo/types"
+)
+
+const DefaultReportPeriod = 30 * 24 * time.Hour
+
+var ErrInvalidUsageFilter = errors.New("invalid usage filter")
+
+// UsageService defines the interface for reporting the recorded usage.
+type UsageService interface {
+	ReportUsage(ctx context.Context, filter types.UsageFilter, resultCh types.ResultChannel, wg *sync.WaitGroup)
+}
+
+type UsageServiceImpl struct {
+	UsageGateway types.UsageTableGateway
+}
+
+func NewUsageService(usageGateway types.UsageTableGateway) UsageService {
+	return &UsageServiceImpl{UsageGateway: usageGateway}
+}
+
+// ReportUsage sums the usage the filter selects, by default that of the last 30 days per day. It fails
+// with ErrInvalidUsageFilter for an empty period or an unknown grouping.
+func (us *UsageServiceImpl) ReportUsage(ctx context.Context, filter types.UsageFilter, resultCh types.ResultChannel, wg *sync.WaitGroup) {
+	defer wg.Done()
+
+	filter, err := usageFilterDefaults(filter, time.Now().UTC())
+	if err != nil {
+		resultCh <- types.Result{
+			Data:    nil,
+			Error:   err,
+			Success: false,
+		}
+		return
+	}
+
+	report, err := us.UsageGateway.ReportUsage(ctx, filter)
+	if err != nil {
+		resultCh <- types.Result{
+			Data:    nil,
+			Error:   fmt.Errorf("error reporting usage: %w", err),
+			Success: false,
+		}
+		return
+	}
+
+	resultCh <- types.Result{
+		Data:    report,
+		Error:   nil,
+		Success: true,
+	}
+}
+
+func usageFilterDefaults(filter types.UsageFilter, now time.Time) (types.UsageFilter, error) {
+	if filter.To.IsZero() {
+		filter.To = now
+	}
+	if filter.From.IsZero() {
+		filter.From = filter.To.Add(-DefaultReportPeriod)
+	}
+	if !filter.From.Before(filter.To) {
+		return filter, fmt.Errorf("%w: from must be before to", ErrInvalidUsageFilter)
+	}
+	switch filter.GroupBy {
+	case "":
+		filter.GroupBy = types.UsageGroupDay
+	case types.UsageGroupUser, types.UsageGroupSession, types.UsageGroupAssistant, types.UsageGroupKbase, types.UsageGroupDay, types.UsageGroupModel:
+	default:
+		return filter, fmt.Errorf("%w: group_by must be user, session, assistant, kbase, day or model", ErrInvalidUsageFilter)
+	}
+	return filter, nil
+}
@@ -0,0 +1,166 @@
+package tests
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"rag-demo/pkg/auth"
+	"rag-demo/pkg/handlers"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/crypto/bcrypt"
+)
+
+type accountTestAPI struct {
+	router      *chi.Mux
+	credentials *fakeCredentialGateway
+	notifier    *fakeNotifier
+	now         time.Time
+}
+
+func newAccountTestAPI(t *testing.T) *accountTestAPI {
+	users := newFakeUserGateway()
+	api := &accountTestAPI{
+		credentials: newFakeCredentialGateway(users),
+		notifier:    &fakeNotifier{tokens: make(map[string]string), locked: make(map[string]time.Time)},
+		// the clock starts in the past as tokens are checked for expiry against the real time
+		now: time.Now().UTC().Add(-2 * time.Hour).Truncate(time.Minute),
+	}
+	authService := auth.NewAuthService(users, api.credentials).(*auth.AuthServiceImpl)
+	authService.Now = func() time.Time { return api.now }
+	accounts := auth.NewAccountService(api.credentials, users, api.notifier).(*auth.AccountServiceImpl)
+	accounts.Cost = bcrypt.MinCost
+	accounts.MaxFailedLogins = 3
+	accounts.Now = func() time.Time { return api.now }
+
+	router := chi.NewRouter()
+	router.Post("/api/v1/signup", handlers.HandleCreateUser(authService, accounts))
+	router.Post("/api/v1/login", handlers.HandleLogin(authService, accounts))
+	router.Post("/api/v1/password/reset", handlers.HandleRequestPasswordReset(accounts))
+	router.Post("/api/v1/password/reset/confirm", handlers.HandleResetPassword(accounts))
+	router.With(handlers.RequireAuth(authService, nil)).Put("/api/v1/user/password", handlers.HandleChangePassword(authService, accounts))
+	api.router = router
+	return api
+}
+
+func (api *accountTestAPI) serve(method string, url string, token string, body string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(method, url, strings.NewReader(body))
+	if token != "" {
+		req.Header.Set("access-token", token)
+	}
+	rr := httptest.NewRecorder()
+	api.router.ServeHTTP(rr, req)
+	return rr
+}
+
+func (api *accountTestAPI) login(email string, password string) *httptest.ResponseRecorder {
+	return api.serve("POST", "/api/v1/login", "", `{"email": "`+email+`", "password": "`+password+`"}`)
+}
+
+func TestSignupAndLogin(t *testing.T) {
+	api := newAccountTestAPI(t)
+
+	rr := api.serve("POST", "/api/v1/signup", "", `{"name": "Pete", "email": "Pete@Example.com", "password": "correct horse"}`)
+	assert.Equal(t, http.StatusOK, rr.Code, rr.Body.String())
+	assert.NotEmpty(t, rr.Header().Get("access-token"))
+	assert.NotContains(t, rr.Body.String(), "password", "the hash is never returned")
+	for _, credentials := range api.credentials.credentials {
+		assert.Equal(t, "pete@example.com", credentials.Email)
+		assert.NotEqual(t, "correct horse", credentials.PasswordHash)
+	}
+
+	rr = api.serve("POST", "/api/v1/signup", "", `{"name": "Other Pete", "email": "pete@example.com", "password": "another horse"}`)
+	assert.Equal(t, http.StatusConflict, rr.Code, "emails are unique regardless of case")
+	assert.Equal(t, http.StatusBadRequest, api.serve("POST", "/api/v1/signup", "", `{"name": "Sue", "email": "sue@example.com", "password": "short"}`).Code)
+	assert.Equal(t, http.StatusBadRequest, api.serve("POST", "/api/v1/signup", "", `{"name": "Sue"}`).Code, "signing up takes an email and password")
+
+	rr = api.login("PETE@example.com", "correct horse")
+	assert.Equal(t, http.StatusOK, rr.Code, rr.Body.String())
+	assert.True(t, strings.HasPrefix(rr.Header().Get("access-token"), "Bearer "))
+	assert.Contains(t, rr.Body.String(), "Pete")
+
+	wrongPassword := api.login("pete@example.com", "wrong horse")
+	unknownEmail := api.login("nobody@example.com", "correct horse")
+	assert.Equal(t, http.StatusUnauthorized, wrongPassword.Code)
+	assert.Equal(t, http.StatusUnauthorized, unknownEmail.Code)
+	assert.Equal(t, wrongPassword.Body.String(), unknownEmail.Body.String(), "unknown emails can't be told apart from wrong passwords")
+}
+
+func TestLoginLockout(t *testing.T) {
+	api := newAccountTestAPI(t)
+	api.serve("POST", "/api/v1/signup", "", `{"name": "Pete", "email": "pete@example.com", "password": "correct horse"}`)
+
+	assert.Equal(t, http.StatusUnauthorized, api.login("pete@example.com", "wrong horse").Code)
+	assert.Equal(t, http.StatusOK, api.login("pete@example.com", "correct horse").Code, "a login starts the count over")
+
+	assert.Equal(t, http.StatusUnauthorized, api.login("pete@example.com", "wrong horse").Code)
+	assert.Equal(t, http.StatusUnauthorized, api.login("pete@example.com", "wrong horse").Code)
+	rr := api.login("pete@example.com", "wrong horse")
+	assert.Equal(t, http.StatusUnauthorized, rr.Code, "the third failure in a row locks the account")
+	assert.Equal(t, api.now.Add(auth.DefaultLockout), api.notifier.locked["pete@example.com"], "the owner is told until when")
+
+	rr = api.login("pete@example.com", "correct horse")
+	assert.Equal(t, http.StatusUnauthorized, rr.Code, "locked accounts refuse even the right password")
+	assert.Equal(t, api.login("nobody@example.com", "correct horse").Body.String(), rr.Body.String(), "a lockout can't be told apart from an unknown email")
+
+	api.now = api.now.Add(auth.DefaultLockout)
+	assert.Equal(t, http.StatusOK, api.login("pete@example.com", "correct horse").Code)
+}
+
+func TestChangePassword(t *testing.T) {
+	api := newAccountTestAPI(t)
+	token := api.serve("POST", "/api/v1/signup", "", `{"name": "Pete", "email": "pete@example.com", "password": "correct horse"}`).Header().Get("access-token")
+
+	assert.Equal(t, http.StatusUnauthorized, api.serve("PUT", "/api/v1/user/password", "", `{"current_password": "correct horse", "new_password": "battery staple"}`).Code)
+	assert.Equal(t, http.StatusUnauthorized, api.serve("PUT", "/api/v1/user/password", token, `{"current_password": "wrong horse", "new_password": "battery staple"}`).Code)
+	assert.Equal(t, http.StatusBadRequest, api.serve("PUT", "/api/v1/user/password", token, `{"current_password": "correct horse", "new_password": "short"}`).Code)
+
+	api.now = api.now.Add(time.Minute)
+	rr := api.serve("PUT", "/api/v1/user/password", token, `{"current_password": "correct horse", "new_password": "battery staple"}`)
+	assert.Equal(t, http.StatusOK, rr.Code, rr.Body.String())
+	assert.Equal(t, http.StatusUnauthorized, api.login("pete@example.com", "correct horse").Code)
+	assert.Equal(t, http.StatusOK, api.login("pete@example.com", "battery staple").Code)
+
+	// tokens issued before the change are revoked; the one returned by the change is not
+	newToken := rr.Header().Get("access-token")
+	assert.NotEmpty(t, newToken)
+	assert.Equal(t, http.StatusUnauthorized, api.serve("PUT", "/api/v1/user/password", token, `{"current_password": "battery staple", "new_password": "another staple"}`).Code)
+	assert.Equal(t, http.StatusOK, api.serve("PUT", "/api/v1/user/password", newToken, `{"current_password": "battery staple", "new_password": "another staple"}`).Code)
+}
+
+func TestPasswordReset(t *testing.T) {
+	api := newAccountTestAPI(t)
+	signupToken := api.serve("POST", "/api/v1/signup", "", `{"name": "Pete", "email": "pete@example.com", "password": "correct horse"}`).Header().Get("access-token")
+	api.now = api.now.Add(time.Minute)
+
+	assert.Equal(t, http.StatusAccepted, api.serve("POST", "/api/v1/password/reset", "", `{"email": "nobody@example.com"}`).Code, "unknown emails get the same response")
+	assert.Empty(t, api.notifier.tokens)
+
+	// a locked account can be reset as well
+	for i := 0; i < 3; i++ {
+		api.login("pete@example.com", "wrong horse")
+	}
+	assert.Equal(t, http.StatusAccepted, api.serve("POST", "/api/v1/password/reset", "", `{"email": "Pete@example.com"}`).Code)
+	token := api.notifier.tokens["pete@example.com"]
+	assert.NotEmpty(t, token)
+	for hash := range api.credentials.resets {
+		assert.NotEqual(t, token, hash, "only a hash of the token is stored")
+	}
+
+	assert.Equal(t, http.StatusBadRequest, api.serve("POST", "/api/v1/password/reset/confirm", "", `{"token": "guess", "new_password": "battery staple"}`).Code)
+	assert.Equal(t, http.StatusBadRequest, api.serve("POST", "/api/v1/password/reset/confirm", "", `{"token": "`+token+`", "new_password": "short"}`).Code)
+
+	rr := api.serve("POST", "/api/v1/password/reset/confirm", "", `{"token": "`+token+`", "new_password": "battery staple"}`)
+	assert.Equal(t, http.StatusOK, rr.Code, rr.Body.String())
+	assert.Equal(t, http.StatusBadRequest, api.serve("POST", "/api/v1/password/reset/confirm", "", `{"token": "`+token+`", "new_password": "another staple"}`).Code, "tokens are single use")
+	assert.Equal(t, http.StatusOK, api.login("pete@example.com", "battery staple").Code, "resetting unlocks the account")
+	assert.Equal(t, http.StatusUnauthorized, api.serve("PUT", "/api/v1/user/password", signupToken, `{"current_password": "battery staple", "new_password": "another staple"}`).Code, "resetting revokes older tokens")
+
+	api.serve("POST", "/api/v1/password/reset", "", `{"email": "pete@example.com"}`)
+	api.now = api.now.Add(auth.DefaultResetTTL)
+	rr = api.serve("POST", "/api/v1/password/reset/confirm", "", `{"token": "`+api.notifier.tokens["pete@example.com"]+`", "new_password": "another staple"}`)
+	assert.Equal(t, http.StatusBadRequest, rr.Code, "tokens expire")
+}
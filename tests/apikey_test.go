@@ -0,0 +1,87 @@
+package tests
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"rag-demo/pkg/auth"
+	"rag-demo/pkg/handlers"
+	"rag-demo/types"
+	"strings"
+	"testing"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAPIKeys(t *testing.T) {
+	alice := types.User{UserID: uuid.New(), Name: "alice"}
+	bob := types.User{UserID: uuid.New(), Name: "bob"}
+	users := newFakeUserGateway(alice, bob)
+	authService := auth.NewAuthService(users, nil)
+	keys := newFakeAPIKeyGateway()
+	apiKeyService := auth.NewAPIKeyService(keys, users)
+
+	router := chi.NewRouter()
+	router.Use(handlers.RequireAuth(authService, apiKeyService))
+	router.Post("/api/v1/user/apikey", handlers.HandleCreateAPIKey(apiKeyService))
+	router.Get("/api/v1/user/apikey", handlers.HandleListAPIKeys(apiKeyService))
+	router.Delete("/api/v1/user/apikey/{id}", handlers.HandleDeleteAPIKey(apiKeyService))
+	router.Get("/api/v1/user", handlers.HandleGetUser(authService))
+
+	tokens := map[uuid.UUID]string{}
+	for _, user := range []types.User{alice, bob} {
+		token, err := authService.GenerateJWT(context.Background(), user)
+		if err != nil {
+			t.Fatalf("GenerateJWT failed: %v", err)
+		}
+		tokens[user.UserID] = token
+	}
+	serve := func(method, path, body string, setup func(req *http.Request)) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, path, strings.NewReader(body))
+		setup(req)
+		rr := httptest.NewRecorder()
+		router.ServeHTTP(rr, req)
+		return rr
+	}
+	withToken := func(user types.User) func(req *http.Request) {
+		return func(req *http.Request) { req.Header.Set("access-token", "Bearer "+tokens[user.UserID]) }
+	}
+	withKey := func(key string) func(req *http.Request) {
+		return func(req *http.Request) { req.Header.Set("x-api-key", key) }
+	}
+
+	rr := serve("POST", "/api/v1/user/apikey", `{"name": "nightly import"}`, withToken(alice))
+	assert.Equal(t, http.StatusCreated, rr.Code, rr.Body.String())
+	var created types.NewAPIKey
+	json.NewDecoder(rr.Body).Decode(&created)
+	assert.True(t, strings.HasPrefix(created.Key, created.Prefix), "the prefix is the start of the key")
+	stored := keys.keys[created.ID]
+	assert.NotEmpty(t, stored.KeyHash)
+	assert.NotEqual(t, created.Key, stored.KeyHash, "only the hash is stored")
+	assert.NotContains(t, rr.Body.String(), stored.KeyHash, "the hash isn't returned")
+
+	assert.Equal(t, http.StatusBadRequest, serve("POST", "/api/v1/user/apikey", `{}`, withToken(alice)).Code)
+
+	rr = serve("GET", "/api/v1/user", "", withKey(created.Key))
+	assert.Equal(t, http.StatusOK, rr.Code, "the key authenticates as its user")
+	assert.Contains(t, rr.Body.String(), alice.UserID.String())
+
+	assert.Equal(t, http.StatusForbidden, serve("POST", "/api/v1/user/apikey", `{"name": "more"}`, withKey(created.Key)).Code, "keys can't create keys")
+	assert.Equal(t, http.StatusUnauthorized, serve("GET", "/api/v1/user", "", withKey("rag_made-up")).Code)
+	assert.Equal(t, http.StatusUnauthorized, serve("GET", "/api/v1/user", "", withKey("made-up")).Code)
+
+	rr = serve("GET", "/api/v1/user/apikey", "", withToken(alice))
+	assert.Equal(t, http.StatusOK, rr.Code)
+	assert.Contains(t, rr.Body.String(), created.Prefix)
+	assert.NotContains(t, rr.Body.String(), created.Key, "listed keys don't include the key")
+	assert.Equal(t, "[]\n", serve("GET", "/api/v1/user/apikey", "", withToken(bob)).Body.String())
+
+	path := "/api/v1/user/apikey/" + created.ID.String()
+	assert.Equal(t, http.StatusNotFound, serve("DELETE", path, "", withToken(bob)).Code, "users can't delete the keys of others")
+	assert.Equal(t, http.StatusOK, serve("DELETE", path, "", withToken(alice)).Code)
+	assert.Equal(t, http.StatusUnauthorized, serve("GET", "/api/v1/user", "", withKey(created.Key)).Code, "deleted keys are refused")
+	assert.Equal(t, http.StatusNotFound, serve("DELETE", path, "", withToken(alice)).Code)
+}
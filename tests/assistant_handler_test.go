@@ -0,0 +1,124 @@
+package tests
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"rag-demo/pkg/assistant"
+	"rag-demo/pkg/handlers"
+	"rag-demo/types"
+	"testing"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+)
+
+func newAssistantTestRouter(assistants ...types.Assistant) (*chi.Mux, *fakeAssistantGateway) {
+	gateway := newFakeAssistantGateway(assistants...)
+	assistantService := assistant.NewAssistantService(gateway, newFakeKbaseGateway(), nil)
+
+	router := chi.NewRouter()
+	router.Post("/api/v1/assistant", handlers.HandleCreateAssistant(assistantService))
+	router.Get("/api/v1/assistant", handlers.HandleListAssistants(assistantService))
+	router.Get("/api/v1/assistant/{id}", handlers.HandleGetAssistant(assistantService))
+	router.Put("/api/v1/assistant/{id}", handlers.HandleUpdateAssistant(assistantService))
+	router.Delete("/api/v1/assistant/{id}", handlers.HandleDeleteAssistant(assistantService))
+	return router, gateway
+}
+
+func newAssistantKbaseTestRouter(gateway *fakeAssistantGateway, kbases *fakeKbaseGateway) *chi.Mux {
+	assistantService := assistant.NewAssistantService(gateway, kbases, nil)
+
+	router := chi.NewRouter()
+	router.Get("/api/v1/assistant/{id}/kbase", handlers.HandleListAssistantKbases(assistantService))
+	router.Put("/api/v1/assistant/{id}/kbase/{kbase_id}", handlers.HandleAttachKbase(assistantService))
+	router.Delete("/api/v1/assistant/{id}/kbase/{kbase_id}", handlers.HandleDetachKbase(assistantService))
+	return router
+}
+
+func serveJSON(router http.Handler, method string, url string, payload interface{}) *httptest.ResponseRecorder {
+	var body bytes.Buffer
+	if payload != nil {
+		json.NewEncoder(&body).Encode(payload)
+	}
+	req := httptest.NewRequest(method, url, &body)
+	req.Header.Set("Content-Type", "application/json")
+	rr := httptest.NewRecorder()
+	router.ServeHTTP(rr, req)
+	return rr
+}
+
+func TestAssistantHandlersLifecycle(t *testing.T) {
+	router, gateway := newAssistantTestRouter()
+
+	rr := serveJSON(router, "POST", "/api/v1/assistant", types.NewAssistantRequest{
+		Name:          "travel",
+		Model:         "anthropic.claude-3-haiku-20240307-v1:0",
+		Type:          "rag",
+		SystemPrompts: "You are a travel insurance assistant.",
+		Metadata:      &types.Metadata{Title: "Travel", Prompts: []string{"Is lost luggage covered?"}},
+	})
+	assert.Equal(t, http.StatusCreated, rr.Code, rr.Body.String())
+	var created types.Assistant
+	json.NewDecoder(rr.Body).Decode(&created)
+	assert.NotEqual(t, uuid.Nil, created.ID)
+	assert.Contains(t, gateway.assistants, created.ID)
+
+	rr = serveJSON(router, "GET", "/api/v1/assistant/"+created.ID.String(), nil)
+	assert.Equal(t, http.StatusOK, rr.Code)
+
+	rr = serveJSON(router, "PUT", "/api/v1/assistant/"+created.ID.String(), types.NewAssistantRequest{
+		Name:  "travel",
+		Model: "anthropic.claude-3-5-sonnet-20240620-v1:0",
+		Type:  "rag",
+	})
+	assert.Equal(t, http.StatusOK, rr.Code, "keeping its own name is not a conflict: %s", rr.Body.String())
+	assert.Equal(t, "anthropic.claude-3-5-sonnet-20240620-v1:0", gateway.assistants[created.ID].Model)
+
+	rr = serveJSON(router, "GET", "/api/v1/assistant", nil)
+	var list types.AssistantList
+	json.NewDecoder(rr.Body).Decode(&list)
+	assert.Len(t, list.Assistants, 1)
+
+	rr = serveJSON(router, "DELETE", "/api/v1/assistant/"+created.ID.String(), nil)
+	assert.Equal(t, http.StatusOK, rr.Code)
+	rr = serveJSON(router, "GET", "/api/v1/assistant/"+created.ID.String(), nil)
+	assert.Equal(t, http.StatusNotFound, rr.Code)
+	rr = serveJSON(router, "DELETE", "/api/v1/assistant/"+created.ID.String(), nil)
+	assert.Equal(t, http.StatusNotFound, rr.Code)
+}
+
+func TestAssistantHandlersValidation(t *testing.T) {
+	existing := types.Assistant{ID: uuid.New(), Name: "travel", Model: "anthropic.claude-3-haiku-20240307-v1:0", Type: "rag"}
+	router, _ := newAssistantTestRouter(existing)
+
+	valid := types.NewAssistantRequest{Name: "health", Model: "anthropic.claude-3-haiku-20240307-v1:0", Type: "rag"}
+
+	duplicate := valid
+	duplicate.Name = "travel"
+	rr := serveJSON(router, "POST", "/api/v1/assistant", duplicate)
+	assert.Equal(t, http.StatusConflict, rr.Code)
+
+	unsupported := valid
+	unsupported.Model = "openai.gpt-4"
+	rr = serveJSON(router, "POST", "/api/v1/assistant", unsupported)
+	assert.Equal(t, http.StatusBadRequest, rr.Code)
+
+	badPrompts := valid
+	badPrompts.Metadata = &types.Metadata{Prompts: []string{"How do I claim?", "how do I claim?"}}
+	rr = serveJSON(router, "POST", "/api/v1/assistant", badPrompts)
+	assert.Equal(t, http.StatusBadRequest, rr.Code)
+
+	missingName := valid
+	missingName.Name = ""
+	rr = serveJSON(router, "POST", "/api/v1/assistant", missingName)
+	assert.Equal(t, http.StatusBadRequest, rr.Code)
+
+	rr = serveJSON(router, "PUT", "/api/v1/assistant/"+uuid.New().String(), valid)
+	assert.Equal(t, http.StatusNotFound, rr.Code)
+
+	rr = serveJSON(router, "POST", "/api/v1/assistant", valid)
+	assert.Equal(t, http.StatusCreated, rr.Code)
+}
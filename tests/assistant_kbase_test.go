@@ -0,0 +1,76 @@
+package tests
+
+import (
+	"context"
+	"net/http"
+	"rag-demo/pkg/search"
+	"rag-demo/types"
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRetrieverSearchLinked(t *testing.T) {
+	policies, faq := uuid.New(), uuid.New()
+	matches := append(fakeMatches(policies), fakeMatches(faq)...)
+	retriever := search.NewRetriever(&fakeEmbedder{}, &fakeEmbeddingsGateway{matches: matches}, newFakeKbaseGateway(types.Kbase{ID: policies}, types.Kbase{ID: faq}), nil)
+
+	strict := 0.85
+	result, err := retriever.SearchLinked(context.Background(), "Is lost luggage covered?", []types.AssistantKbase{
+		{KbaseID: policies, TopK: 2, Weight: 1},
+		{KbaseID: faq, TopK: 5, MinSimilarity: &strict, Weight: 2},
+	})
+
+	assert.Nil(t, err)
+	assert.Equal(t, types.SearchOutcomeOK, result.Outcome)
+	assert.Len(t, result.Hits, 3, "two chunks from policies by top-k, one from faq above its link threshold")
+	assert.Equal(t, faq, result.Hits[0].KbaseID, "the weighted faq hit ranks first")
+	assert.Equal(t, policies, result.Hits[1].KbaseID)
+	assert.Equal(t, 0, result.Hits[1].ChunkID)
+	assert.Equal(t, 10, result.Hits[2].ChunkID)
+
+	none := 0.99
+	result, err = retriever.SearchLinked(context.Background(), "What is the capital of France?", []types.AssistantKbase{{KbaseID: policies, MinSimilarity: &none}})
+	assert.Nil(t, err)
+	assert.Equal(t, types.SearchOutcomeNoRelevantContext, result.Outcome)
+	assert.Empty(t, result.Hits)
+}
+
+func TestAssistantKbaseHandlers(t *testing.T) {
+	existing := types.Assistant{ID: uuid.New(), Name: "travel", Model: "anthropic.claude-3-haiku-20240307-v1:0", Type: "rag"}
+	kbaseID := uuid.New()
+	gateway := newFakeAssistantGateway(existing)
+	router := newAssistantKbaseTestRouter(gateway, newFakeKbaseGateway(types.Kbase{ID: kbaseID, Name: "policies"}))
+
+	url := "/api/v1/assistant/" + existing.ID.String() + "/kbase/" + kbaseID.String()
+	weight := 2.0
+	rr := serveJSON(router, "PUT", url, types.AttachKbaseRequest{Weight: &weight})
+	assert.Equal(t, http.StatusOK, rr.Code, rr.Body.String())
+	links := gateway.links[existing.ID]
+	assert.Len(t, links, 1)
+	assert.Equal(t, search.DefaultTopK, links[0].TopK, "an unset top-k uses the default")
+	assert.Equal(t, 2.0, links[0].Weight)
+
+	rr = serveJSON(router, "PUT", url, types.AttachKbaseRequest{TopK: 8})
+	assert.Equal(t, http.StatusOK, rr.Code)
+	assert.Len(t, gateway.links[existing.ID], 1, "attaching again updates the link")
+	assert.Equal(t, 8, gateway.links[existing.ID][0].TopK)
+
+	rr = serveJSON(router, "GET", "/api/v1/assistant/"+existing.ID.String()+"/kbase", nil)
+	assert.Equal(t, http.StatusOK, rr.Code)
+	assert.Contains(t, rr.Body.String(), kbaseID.String())
+
+	rr = serveJSON(router, "PUT", "/api/v1/assistant/"+existing.ID.String()+"/kbase/"+uuid.New().String(), types.AttachKbaseRequest{})
+	assert.Equal(t, http.StatusNotFound, rr.Code, "unknown kbase")
+	rr = serveJSON(router, "PUT", "/api/v1/assistant/"+uuid.New().String()+"/kbase/"+kbaseID.String(), types.AttachKbaseRequest{})
+	assert.Equal(t, http.StatusNotFound, rr.Code, "unknown assistant")
+	rr = serveJSON(router, "PUT", url, types.AttachKbaseRequest{TopK: 500})
+	assert.Equal(t, http.StatusBadRequest, rr.Code)
+
+	rr = serveJSON(router, "DELETE", url, nil)
+	assert.Equal(t, http.StatusOK, rr.Code)
+	assert.Empty(t, gateway.links[existing.ID])
+	rr = serveJSON(router, "DELETE", url, nil)
+	assert.Equal(t, http.StatusNotFound, rr.Code)
+}
@@ -62,7 +62,7 @@ func TestCreateUser(t *testing.T) {
     resultCh := make(types.ResultChannel)
 
     userGateway := db.NewUserTableGateway(testDBPool)
-    authService := auth.NewAuthService(userGateway)
+    authService := auth.NewAuthService(userGateway, nil)
 
     wg.Add(1)
     go authService.CreateUser(ctx, "testuser", resultCh, &wg)
@@ -99,7 +99,7 @@ func TestGetUser(t *testing.T) {
     defer testDBPool.Close()
 
     userGateway := db.NewUserTableGateway(testDBPool)
-    authService := auth.NewAuthService(userGateway)
+    authService := auth.NewAuthService(userGateway, nil)
 
     newUser := types.User{
         UserID: uuid.New(),
@@ -149,11 +149,13 @@ func TestCreateUserHandler(t *testing.T) {
     defer testDBPool.Close()
 
     userGateway := db.NewUserTableGateway(testDBPool)
-    authService := auth.NewAuthService(userGateway)
+    authService := auth.NewAuthService(userGateway, nil)
 
-    router.Post("/api/v1/user", handlers.HandleCreateUser(authService))
+    accountService := auth.NewAccountService(db.NewCredentialTableGateway(testDBPool), userGateway, auth.NewLogNotifier())
 
-    newUser := types.NewUserRequest{Name: "testuser"}
+    router.Post("/api/v1/user", handlers.HandleCreateUser(authService, accountService))
+
+    newUser := types.NewUserRequest{Name: "testuser", Email: uuid.NewString() + "@example.com", Password: "correct horse"}
     body, _ := json.Marshal(newUser)
     req, err := http.NewRequest("POST", "/api/v1/user", bytes.NewBuffer(body))
     if err != nil {
@@ -222,9 +224,10 @@ func TestGetUserHandler(t *testing.T) {
     defer testDBPool.Close()
 
     userGateway := db.NewUserTableGateway(testDBPool)
-    authService := auth.NewAuthService(userGateway)
+    authService := auth.NewAuthService(userGateway, nil)
 
-    router.Get("/api/v1/user/{userID}", handlers.HandleGetUser(authService))
+    router.Use(handlers.RequireAuth(authService, nil))
+    router.Get("/api/v1/user", handlers.HandleGetUser(authService))
 
     newUser := types.User{
         UserID: uuid.New(),
@@ -236,10 +239,16 @@ func TestGetUserHandler(t *testing.T) {
         t.Errorf("Failed to create test user: %v", err)
     }
 
-    req, err := http.NewRequest("GET", "/api/v1/user/"+newUser.UserID.String(), nil)
+    token, err := authService.GenerateJWT(context.Background(), newUser)
+    if err != nil {
+        t.Fatalf("GenerateJWT failed: %v", err)
+    }
+
+    req, err := http.NewRequest("GET", "/api/v1/user", nil)
     if err != nil {
         t.Fatal(err)
     }
+    req.Header.Set("access-token", "Bearer "+token)
 
     rr := httptest.NewRecorder()
     router.ServeHTTP(rr, req)
@@ -278,7 +287,7 @@ func TestValidateJWT(t *testing.T) {
     defer testDBPool.Close()
 
     userGateway := db.NewUserTableGateway(testDBPool)
-    authService := auth.NewAuthService(userGateway)
+    authService := auth.NewAuthService(userGateway, nil)
 
     // Create a test user
     testUser := types.User{
@@ -29,7 +29,7 @@ func TestGenerateJWT(t *testing.T) {
     godotenv.Load("../.env")
 
     userGateway := db.NewUserTableGateway(dbPool)
-    authService := auth.NewAuthService(userGateway)
+    authService := auth.NewAuthService(userGateway, nil)
 
     user := types.User{
         UserID: uuid.New(),
@@ -53,7 +53,7 @@ func TestValidateJWT2(t *testing.T) {
     godotenv.Load("../.env")
 
     userGateway := db.NewUserTableGateway(dbPool)
-    authService := auth.NewAuthService(userGateway)
+    authService := auth.NewAuthService(userGateway, nil)
 
     user := types.User{
         UserID: uuid.New(),
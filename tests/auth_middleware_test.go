@@ -0,0 +1,52 @@
+package tests
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"rag-demo/pkg/auth"
+	"rag-demo/pkg/handlers"
+	"rag-demo/types"
+	"testing"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRequireAuth(t *testing.T) {
+	user := types.User{UserID: uuid.New(), Name: "middleware user"}
+	authService := auth.NewAuthService(newFakeUserGateway(user), nil)
+	token, err := authService.GenerateJWT(context.Background(), user)
+	if err != nil {
+		t.Fatalf("GenerateJWT failed: %v", err)
+	}
+
+	router := chi.NewRouter()
+	router.Use(handlers.RequireAuth(authService, nil))
+	router.Get("/whoami", func(w http.ResponseWriter, r *http.Request) {
+		current, _ := auth.UserFrom(r.Context())
+		json.NewEncoder(w).Encode(current)
+	})
+
+	serve := func(setup func(req *http.Request)) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("GET", "/whoami", nil)
+		setup(req)
+		rr := httptest.NewRecorder()
+		router.ServeHTTP(rr, req)
+		return rr
+	}
+
+	rr := serve(func(req *http.Request) { req.Header.Set("access-token", "Bearer "+token) })
+	assert.Equal(t, http.StatusOK, rr.Code, rr.Body.String())
+	var current types.User
+	json.NewDecoder(rr.Body).Decode(&current)
+	assert.Equal(t, user.UserID, current.UserID, "the handler finds the token's user in the context")
+
+	rr = serve(func(req *http.Request) { req.AddCookie(&http.Cookie{Name: "access-token", Value: token}) })
+	assert.Equal(t, http.StatusOK, rr.Code, "the token may come in a cookie")
+
+	assert.Equal(t, http.StatusUnauthorized, serve(func(req *http.Request) {}).Code)
+	assert.Equal(t, http.StatusUnauthorized, serve(func(req *http.Request) { req.Header.Set("access-token", "Bearer not-a-token") }).Code)
+}
@@ -0,0 +1,142 @@
+package tests
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"rag-demo/pkg/auth"
+	"rag-demo/pkg/handlers"
+	"rag-demo/pkg/llm"
+	"rag-demo/pkg/message"
+	"rag-demo/types"
+	"strings"
+	"testing"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+)
+
+type branchingTestAPI struct {
+	router    *chi.Mux
+	model     *llm.ScriptedLLM
+	messages  *fakeMessageGateway
+	sessionID uuid.UUID
+	token     string
+}
+
+func newBranchingTestAPI(t *testing.T) *branchingTestAPI {
+	user := types.User{UserID: uuid.New(), Name: "branching user"}
+	authService := auth.NewAuthService(newFakeUserGateway(user), nil)
+	token, err := authService.GenerateJWT(context.Background(), user)
+	if err != nil {
+		t.Fatalf("GenerateJWT failed: %v", err)
+	}
+
+	assistant := types.Assistant{ID: uuid.New(), Name: "travel", Model: "anthropic.claude-3-haiku-20240307-v1:0"}
+	session := types.Session{ID: uuid.New(), UserID: user.UserID, AssistantID: assistant.ID, Active: true}
+	sessions := newFakeSessionGateway(session)
+	messages := &fakeMessageGateway{}
+	assistants := newFakeAssistantGateway(assistant)
+	model := &llm.ScriptedLLM{Reply: "An answer."}
+	memory := message.NewConversationMemory(messages, sessions, model, "", 0)
+	sessionService := message.NewSessionService(sessions, messages, assistants)
+	chatService := message.NewChatService(assistants, messages, nil, model, memory, nil, nil, nil, nil, nil, nil)
+
+	router := chi.NewRouter()
+	router.Use(handlers.RequireAuth(authService, nil))
+	router.Get("/api/v1/session/{id}", handlers.HandleGetSession(sessionService))
+	router.Post("/api/v1/session/{id}/message", handlers.HandleSendMessage(sessionService, chatService))
+	router.Post("/api/v1/session/{id}/message/{message_id}/regenerate", handlers.HandleRegenerateMessage(sessionService, chatService))
+	router.Post("/api/v1/session/{id}/message/{message_id}/edit", handlers.HandleEditMessage(sessionService, chatService))
+
+	return &branchingTestAPI{router: router, model: model, messages: messages, sessionID: session.ID, token: token}
+}
+
+func (api *branchingTestAPI) post(t *testing.T, path string, body string) types.ChatResponse {
+	rr := api.serve("POST", "/api/v1/session/"+api.sessionID.String()+path, body)
+	assert.Equal(t, http.StatusOK, rr.Code, rr.Body.String())
+	var response types.ChatResponse
+	json.NewDecoder(rr.Body).Decode(&response)
+	return response
+}
+
+func (api *branchingTestAPI) history(t *testing.T, query string) []types.Message {
+	rr := api.serve("GET", "/api/v1/session/"+api.sessionID.String()+query, "")
+	assert.Equal(t, http.StatusOK, rr.Code, rr.Body.String())
+	var history types.SessionHistory
+	json.NewDecoder(rr.Body).Decode(&history)
+	return history.Messages
+}
+
+func (api *branchingTestAPI) serve(method string, url string, body string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(method, url, strings.NewReader(body))
+	req.Header.Set("access-token", "Bearer "+api.token)
+	rr := httptest.NewRecorder()
+	api.router.ServeHTTP(rr, req)
+	return rr
+}
+
+func userMessages(messages []types.Message) []string {
+	var texts []string
+	for _, message := range messages {
+		texts = append(texts, message.UserMessage)
+	}
+	return texts
+}
+
+func TestRegenerateAndEditMessages(t *testing.T) {
+	api := newBranchingTestAPI(t)
+
+	first := api.post(t, "/message", `{"message": "Which plan covers lost luggage?"}`)
+	assert.Equal(t, uuid.Nil, first.ParentID)
+	second := api.post(t, "/message", `{"message": "What is the fee for tht?"}`)
+	assert.Equal(t, first.MessageID, second.ParentID, "a message follows the latest turn")
+
+	regenerated := api.post(t, "/message/"+second.MessageID.String()+"/regenerate", "")
+	assert.Equal(t, first.MessageID, regenerated.ParentID, "a regenerated answer is a sibling of the original")
+	request := api.model.Requests()[2]
+	assert.Equal(t, []types.LLMMessage{
+		{Role: types.LLMRoleUser, Content: "Which plan covers lost luggage?"},
+		{Role: types.LLMRoleAssistant, Content: "An answer."},
+		{Role: types.LLMRoleUser, Content: "What is the fee for tht?"},
+	}, request.Messages, "the original answer isn't part of the regenerated one's history")
+
+	history := api.history(t, "")
+	assert.Equal(t, []string{"Which plan covers lost luggage?", "What is the fee for tht?"}, userMessages(history))
+	assert.Equal(t, regenerated.MessageID, history[1].ID, "the latest branch is returned")
+	assert.Equal(t, 2, history[1].SiblingCount)
+	assert.Equal(t, []uuid.UUID{second.MessageID, regenerated.MessageID}, history[1].SiblingIDs)
+	assert.Equal(t, 1, history[0].SiblingCount)
+
+	edited := api.post(t, "/message/"+second.MessageID.String()+"/edit", `{"message": "What is the fee for that?"}`)
+	assert.Equal(t, first.MessageID, edited.ParentID)
+	history = api.history(t, "")
+	assert.Equal(t, []string{"Which plan covers lost luggage?", "What is the fee for that?"}, userMessages(history))
+	assert.Equal(t, 3, history[1].SiblingCount)
+
+	// the original branch can still be read and continued
+	history = api.history(t, "?leaf="+second.MessageID.String())
+	assert.Equal(t, second.MessageID, history[1].ID)
+	third := api.post(t, "/message", `{"message": "And for children?", "parent_id": "`+second.MessageID.String()+`"}`)
+	assert.Equal(t, second.MessageID, third.ParentID)
+	history = api.history(t, "?leaf="+second.MessageID.String())
+	assert.Equal(t, []string{"Which plan covers lost luggage?", "What is the fee for tht?", "And for children?"}, userMessages(history),
+		"a branch continues with the latest child of each turn")
+	history = api.history(t, "?leaf="+first.MessageID.String())
+	assert.Equal(t, edited.MessageID, history[1].ID, "the latest child of the first turn is the edit")
+
+	rootEdit := api.post(t, "/message/"+first.MessageID.String()+"/edit", `{"message": "Which plan covers delays?"}`)
+	assert.Equal(t, uuid.Nil, rootEdit.ParentID)
+	assert.Len(t, api.model.Requests()[len(api.model.Requests())-1].Messages, 1, "an edited first message has no history")
+	history = api.history(t, "")
+	assert.Equal(t, []string{"Which plan covers delays?"}, userMessages(history))
+	assert.Equal(t, 2, history[0].SiblingCount)
+
+	unknown := uuid.NewString()
+	assert.Equal(t, http.StatusNotFound, api.serve("POST", "/api/v1/session/"+api.sessionID.String()+"/message/"+unknown+"/regenerate", "").Code)
+	assert.Equal(t, http.StatusNotFound, api.serve("POST", "/api/v1/session/"+api.sessionID.String()+"/message", `{"message": "hi", "parent_id": "`+unknown+`"}`).Code)
+	assert.Equal(t, http.StatusNotFound, api.serve("GET", "/api/v1/session/"+api.sessionID.String()+"?leaf="+unknown, "").Code)
+	assert.Equal(t, http.StatusBadRequest, api.serve("POST", "/api/v1/session/"+api.sessionID.String()+"/message/"+first.MessageID.String()+"/edit", `{"message": ""}`).Code)
+}
@@ -0,0 +1,75 @@
+package tests
+
+import (
+	"context"
+	"rag-demo/pkg/llm"
+	"rag-demo/pkg/message"
+	"rag-demo/pkg/search"
+	"rag-demo/types"
+	"sync"
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+)
+
+func sendTestMessage(chatService message.ChatService, session types.Session, req types.MessageRequest) types.Result {
+	resultCh := make(types.ResultChannel, 1)
+	wg := &sync.WaitGroup{}
+	wg.Add(1)
+
+	go chatService.SendMessage(context.Background(), session, req, resultCh, wg)
+
+	wg.Wait()
+	return <-resultCh
+}
+
+func TestChatServiceSendMessage(t *testing.T) {
+	kbaseID := uuid.New()
+	assistant := types.Assistant{ID: uuid.New(), Name: "travel", Model: "anthropic.claude-3-haiku-20240307-v1:0", SystemPrompts: "You are a travel insurance assistant."}
+	messages := &fakeMessageGateway{}
+	generator := &llm.ScriptedLLM{Reply: "Yes, lost luggage is covered up to $500."}
+	retriever := search.NewRetriever(&fakeEmbedder{}, &fakeEmbeddingsGateway{matches: fakeMatches(kbaseID)}, newFakeKbaseGateway(types.Kbase{ID: kbaseID}), nil)
+	chatService := message.NewChatService(newFakeAssistantGateway(assistant).attach(assistant.ID, kbaseID), messages, retriever, generator, nil, nil, nil, nil, nil, nil, nil)
+
+	session := types.Session{ID: uuid.New(), UserID: uuid.New()}
+	result := sendTestMessage(chatService, session, types.MessageRequest{
+		Message:     "Is lost luggage covered?",
+		AssistantID: assistant.ID,
+	})
+
+	assert.True(t, result.Success, "SendMessage should succeed: %v", result.Error)
+	response := result.Data.(types.ChatResponse)
+	assert.Equal(t, "Yes, lost luggage is covered up to $500.", response.Answer)
+	assert.Equal(t, types.SearchOutcomeOK, response.Outcome)
+	assert.Len(t, response.Sources, 3)
+
+	assert.Len(t, messages.messages, 1, "the turn should be stored")
+	stored := messages.messages[0]
+	assert.Equal(t, response.MessageID, stored.ID)
+	assert.Equal(t, session.UserID, stored.UserID)
+	assert.Equal(t, "Is lost luggage covered?", stored.UserMessage)
+	assert.Equal(t, response.Answer, stored.AIMessage)
+}
+
+func TestChatServiceNoRelevantContext(t *testing.T) {
+	kbaseID := uuid.New()
+	strict := 0.99
+	assistant := types.Assistant{ID: uuid.New(), Name: "travel", Model: "anthropic.claude-3-haiku-20240307-v1:0"}
+	messages := &fakeMessageGateway{}
+	generator := &llm.ScriptedLLM{Reply: "a confident hallucination"}
+	retriever := search.NewRetriever(&fakeEmbedder{}, &fakeEmbeddingsGateway{matches: fakeMatches(kbaseID)}, newFakeKbaseGateway(types.Kbase{ID: kbaseID, MinSimilarity: &strict}), nil)
+	chatService := message.NewChatService(newFakeAssistantGateway(assistant).attach(assistant.ID, kbaseID), messages, retriever, generator, nil, nil, nil, nil, nil, nil, nil)
+
+	result := sendTestMessage(chatService, types.Session{ID: uuid.New(), UserID: uuid.New()}, types.MessageRequest{
+		Message:     "What is the capital of France?",
+		AssistantID: assistant.ID,
+	})
+
+	assert.True(t, result.Success, "SendMessage should succeed: %v", result.Error)
+	response := result.Data.(types.ChatResponse)
+	assert.Equal(t, types.NoRelevantContextAnswer, response.Answer)
+	assert.Equal(t, types.SearchOutcomeNoRelevantContext, response.Outcome)
+	assert.Empty(t, generator.Prompts(), "the model should not be called without relevant context")
+	assert.Len(t, messages.messages, 1)
+}
@@ -0,0 +1,95 @@
+package tests
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"rag-demo/pkg/auth"
+	"rag-demo/pkg/handlers"
+	"rag-demo/pkg/llm"
+	"rag-demo/pkg/message"
+	"rag-demo/pkg/search"
+	"rag-demo/types"
+	"strings"
+	"testing"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestStreamMessageHandler(t *testing.T) {
+	kbaseID := uuid.New()
+	assistant := types.Assistant{ID: uuid.New(), Name: "travel", Model: "anthropic.claude-3-haiku-20240307-v1:0"}
+	user := types.User{UserID: uuid.New(), Name: "stream user"}
+	authService := auth.NewAuthService(newFakeUserGateway(user), nil)
+	token, err := authService.GenerateJWT(context.Background(), user)
+	if err != nil {
+		t.Fatalf("GenerateJWT failed: %v", err)
+	}
+	session := types.Session{ID: uuid.New(), UserID: user.UserID, Active: true}
+	messages := &fakeMessageGateway{}
+	generator := &llm.ScriptedLLM{Reply: "Lost luggage is covered."}
+	retriever := search.NewRetriever(&fakeEmbedder{}, &fakeEmbeddingsGateway{matches: fakeMatches(kbaseID)}, newFakeKbaseGateway(types.Kbase{ID: kbaseID}), nil)
+	chatService := message.NewChatService(newFakeAssistantGateway(assistant).attach(assistant.ID, kbaseID), messages, retriever, generator, nil, nil, nil, nil, nil, nil, nil)
+	sessionService := message.NewSessionService(newFakeSessionGateway(session), messages, newFakeAssistantGateway(assistant))
+
+	router := chi.NewRouter()
+	router.Use(handlers.RequireAuth(authService, nil))
+	router.Post("/api/v1/session/{id}/message/stream", handlers.HandleStreamMessage(sessionService, chatService))
+
+	body, _ := json.Marshal(types.MessageRequest{Message: "Is lost luggage covered?", AssistantID: assistant.ID})
+	req, err := http.NewRequest("POST", "/api/v1/session/"+session.ID.String()+"/message/stream", bytes.NewReader(body))
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Header.Set("access-token", "Bearer "+token)
+
+	rr := httptest.NewRecorder()
+	router.ServeHTTP(rr, req)
+
+	assert.Equal(t, http.StatusOK, rr.Code)
+	assert.Equal(t, "text/event-stream", rr.Header().Get("Content-Type"))
+
+	var events []string
+	var answer strings.Builder
+	for _, block := range strings.Split(strings.TrimSpace(rr.Body.String()), "\n\n") {
+		lines := strings.SplitN(block, "\n", 2)
+		event := strings.TrimPrefix(lines[0], "event: ")
+		events = append(events, event)
+		if event == types.ChatEventToken {
+			var token map[string]string
+			json.Unmarshal([]byte(strings.TrimPrefix(lines[1], "data: ")), &token)
+			answer.WriteString(token["text"])
+		}
+	}
+
+	assert.Equal(t, []string{"sources", "token", "token", "token", "token", "usage", "citations", "done"}, events)
+	assert.Equal(t, "Lost luggage is covered.", answer.String())
+	assert.Len(t, messages.messages, 1, "the assembled answer should be stored once the stream completes")
+	assert.Equal(t, "Lost luggage is covered.", messages.messages[0].AIMessage)
+}
+
+func TestStreamMessageHandlerUnknownSession(t *testing.T) {
+	user := types.User{UserID: uuid.New(), Name: "stream user"}
+	authService := auth.NewAuthService(newFakeUserGateway(user), nil)
+	token, err := authService.GenerateJWT(context.Background(), user)
+	if err != nil {
+		t.Fatalf("GenerateJWT failed: %v", err)
+	}
+	chatService := message.NewChatService(newFakeAssistantGateway(), &fakeMessageGateway{}, nil, &llm.ScriptedLLM{}, nil, nil, nil, nil, nil, nil, nil)
+	sessionService := message.NewSessionService(newFakeSessionGateway(), &fakeMessageGateway{}, newFakeAssistantGateway())
+
+	router := chi.NewRouter()
+	router.Use(handlers.RequireAuth(authService, nil))
+	router.Post("/api/v1/session/{id}/message/stream", handlers.HandleStreamMessage(sessionService, chatService))
+
+	req, _ := http.NewRequest("POST", "/api/v1/session/"+uuid.New().String()+"/message/stream", strings.NewReader(`{"message": "hi"}`))
+	req.Header.Set("access-token", "Bearer "+token)
+	rr := httptest.NewRecorder()
+	router.ServeHTTP(rr, req)
+
+	assert.Equal(t, http.StatusNotFound, rr.Code)
+}
@@ -0,0 +1,80 @@
+package tests
+
+import (
+	"rag-demo/pkg/llm"
+	"rag-demo/pkg/message"
+	"rag-demo/pkg/search"
+	"rag-demo/types"
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestChatServiceCitations(t *testing.T) {
+	kbaseID := uuid.New()
+	contents := []string{
+		"Checked baggage that is lost by the airline is covered up to $500. Claims must be filed within 30 days.",
+		"Children under 12 travel free on family plans. They share the luggage allowance of their parents.",
+		"Cancellation is covered for illness only.",
+	}
+	var matches []types.KbaseEmbeddingMatch
+	for i, content := range contents {
+		matches = append(matches, types.KbaseEmbeddingMatch{
+			KbaseEmbedding: types.KbaseEmbedding{
+				UUID:    uuid.New(),
+				KbaseID: kbaseID,
+				ChunkID: i * 10,
+				Content: content,
+				// pages are decoded from JSON metadata, so they arrive as float64
+				Metadata: map[string]interface{}{"source": "policy.pdf", "page_start": float64(i + 3), "page_end": float64(i + 4)},
+			},
+			Distance: 0.1 * float64(i+1),
+		})
+	}
+
+	assistant := types.Assistant{ID: uuid.New(), Name: "travel", Model: "anthropic.claude-3-haiku-20240307-v1:0"}
+	messages := &fakeMessageGateway{}
+	generator := &llm.ScriptedLLM{Reply: "Lost baggage is covered up to $500 [1]. Children share their parents' luggage allowance [2, 7]. See also [1]."}
+	retriever := search.NewRetriever(&fakeEmbedder{}, &fakeEmbeddingsGateway{matches: matches}, newFakeKbaseGateway(types.Kbase{ID: kbaseID}), nil)
+	chatService := message.NewChatService(newFakeAssistantGateway(assistant).attach(assistant.ID, kbaseID), messages, retriever, generator, nil, nil, nil, nil, nil, nil, nil)
+
+	result := sendTestMessage(chatService, types.Session{ID: uuid.New(), UserID: uuid.New()}, types.MessageRequest{
+		Message:     "Is lost luggage covered for my kids?",
+		AssistantID: assistant.ID,
+	})
+	assert.True(t, result.Success, "SendMessage should succeed: %v", result.Error)
+	response := result.Data.(types.ChatResponse)
+
+	assert.Contains(t, generator.Systems()[0], `<source id="1" name="policy.pdf"`)
+	assert.Contains(t, generator.Systems()[0], `<source id="3" name="policy.pdf"`)
+
+	assert.Len(t, response.Citations, 2, "each cited source is listed once")
+	first := response.Citations[0]
+	assert.Equal(t, 1, first.Marker)
+	assert.Equal(t, kbaseID, first.KbaseID)
+	assert.Equal(t, "policy.pdf", first.Document)
+	assert.Equal(t, 0, first.ChunkID)
+	assert.Equal(t, 3, first.PageStart)
+	assert.Equal(t, 4, first.PageEnd)
+	assert.Equal(t, "Checked baggage that is lost by the airline is covered up to $500.", first.Quote)
+
+	second := response.Citations[1]
+	assert.Equal(t, 2, second.Marker)
+	assert.Equal(t, 10, second.ChunkID)
+	assert.Equal(t, "They share the luggage allowance of their parents.", second.Quote)
+
+	assert.Equal(t, []int{7}, response.InvalidCitations, "a marker without a matching source is flagged")
+	assert.Equal(t, response.Citations, messages.messages[0].Citations, "citations are stored with the message")
+}
+
+func TestChatServiceNoCitations(t *testing.T) {
+	assistant := types.Assistant{ID: uuid.New(), Name: "travel", Model: "anthropic.claude-3-haiku-20240307-v1:0"}
+	chatService := message.NewChatService(newFakeAssistantGateway(assistant), &fakeMessageGateway{}, nil, &llm.ScriptedLLM{Reply: "Hello [1]!"}, nil, nil, nil, nil, nil, nil, nil)
+
+	result := sendTestMessage(chatService, types.Session{ID: uuid.New(), UserID: uuid.New()}, types.MessageRequest{Message: "hi", AssistantID: assistant.ID})
+	assert.True(t, result.Success, "SendMessage should succeed: %v", result.Error)
+	response := result.Data.(types.ChatResponse)
+	assert.Empty(t, response.Citations)
+	assert.Equal(t, []int{1}, response.InvalidCitations, "without sources every marker is invalid")
+}
@@ -0,0 +1,115 @@
+package tests
+
+import (
+	"context"
+	"fmt"
+	"rag-demo/pkg/llm"
+	"rag-demo/pkg/message"
+	"rag-demo/pkg/search"
+	"rag-demo/types"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestChatServiceRemembersPreviousTurns(t *testing.T) {
+	assistant := types.Assistant{ID: uuid.New(), Name: "travel", Model: "anthropic.claude-3-haiku-20240307-v1:0"}
+	session := types.Session{ID: uuid.New(), UserID: uuid.New()}
+	messages := &fakeMessageGateway{}
+	sessions := newFakeSessionGateway(session)
+	generator := &llm.ScriptedLLM{Reply: "The Gold plan covers lost luggage."}
+	memory := message.NewConversationMemory(messages, sessions, generator, "", 0)
+	chatService := message.NewChatService(newFakeAssistantGateway(assistant), messages, nil, generator, memory, nil, nil, nil, nil, nil, nil)
+
+	first := sendTestMessage(chatService, session, types.MessageRequest{Message: "Which plan covers lost luggage?", AssistantID: assistant.ID})
+	assert.True(t, first.Success, "first message should succeed: %v", first.Error)
+	assert.Len(t, generator.Requests()[0].Messages, 1, "the first turn has no history")
+
+	second := sendTestMessage(chatService, session, types.MessageRequest{Message: "What about the fee for that?", AssistantID: assistant.ID})
+	assert.True(t, second.Success, "second message should succeed: %v", second.Error)
+	assert.Equal(t, []types.LLMMessage{
+		{Role: types.LLMRoleUser, Content: "Which plan covers lost luggage?"},
+		{Role: types.LLMRoleAssistant, Content: "The Gold plan covers lost luggage."},
+		{Role: types.LLMRoleUser, Content: "What about the fee for that?"},
+	}, generator.Requests()[1].Messages, "earlier turns are sent as messages")
+	assert.NotContains(t, generator.Systems()[1], "<summary>", "a history within budget has no summary")
+}
+
+func TestConversationMemorySummarisesOverBudget(t *testing.T) {
+	modelID := "anthropic.claude-3-haiku-20240307-v1:0"
+	session := types.Session{ID: uuid.New(), UserID: uuid.New()}
+	messages := &fakeMessageGateway{}
+	sessions := newFakeSessionGateway(session)
+	start := time.Now().Add(-time.Hour)
+	parentID := uuid.Nil
+	for i := 0; i < 10; i++ {
+		id := uuid.New()
+		messages.CreateMessage(context.Background(), types.Message{
+			ID:          id,
+			SessionID:   session.ID,
+			ParentID:    parentID,
+			UserMessage: fmt.Sprintf("question %d %s", i, strings.Repeat("about travel insurance ", 10)),
+			AIMessage:   fmt.Sprintf("answer %d %s", i, strings.Repeat("the policy says so ", 10)),
+			CreatedAt:   start.Add(time.Duration(i) * time.Minute),
+		})
+		parentID = id
+	}
+
+	generator := &llm.ScriptedLLM{Reply: "The user asked ten questions about travel insurance."}
+	memory := message.NewConversationMemory(messages, sessions, generator, "", 300)
+
+	history, err := memory.Load(context.Background(), session, parentID, modelID)
+	assert.Nil(t, err)
+	assert.Equal(t, "The user asked ten questions about travel insurance.", history.Summary)
+	assert.NotEmpty(t, history.Turns)
+	assert.Less(t, len(history.Turns), 10, "the oldest turns should be folded into the summary")
+	assert.True(t, strings.HasPrefix(history.Turns[len(history.Turns)-1].UserMessage, "question 9"), "the newest turn is kept verbatim")
+	assert.Contains(t, generator.Prompts()[0], "question 0")
+
+	stored, _ := sessions.GetSession(context.Background(), session.ID)
+	assert.Equal(t, history.Summary, stored.Summary)
+	assert.NotNil(t, stored.SummarizedUntil)
+
+	// the next load starts from the stored summary and only sees the unsummarised turns
+	again, err := memory.Load(context.Background(), stored, parentID, modelID)
+	assert.Nil(t, err)
+	assert.Len(t, again.Turns, len(history.Turns))
+	assert.Len(t, generator.Prompts(), 1, "a history within budget is not summarised again")
+}
+
+func TestCountTokensPerModel(t *testing.T) {
+	text := strings.Repeat("travel insurance ", 100)
+	assert.Greater(t, message.CountTokens("anthropic.claude-3-haiku-20240307-v1:0", text), message.CountTokens("amazon.titan-text-express-v1", text))
+	assert.Equal(t, 0, message.CountTokens("anthropic.claude-3-haiku-20240307-v1:0", ""))
+}
+
+func TestChatServiceRewritesFollowUpQuestion(t *testing.T) {
+	kbaseID := uuid.New()
+	assistant := types.Assistant{ID: uuid.New(), Name: "travel", Model: "anthropic.claude-3-haiku-20240307-v1:0"}
+	session := types.Session{ID: uuid.New(), UserID: uuid.New()}
+	messages := &fakeMessageGateway{}
+	generator := &llm.ScriptedLLM{
+		Reply:  "Children are covered up to $250.",
+		Routes: map[string]string{"rewrite follow-up questions": "Is lost luggage of children covered?"},
+	}
+	embedder := &fakeEmbedder{}
+	retriever := search.NewRetriever(embedder, &fakeEmbeddingsGateway{matches: fakeMatches(kbaseID)}, newFakeKbaseGateway(types.Kbase{ID: kbaseID}), nil)
+	memory := message.NewConversationMemory(messages, newFakeSessionGateway(session), generator, "", 0)
+	chatService := message.NewChatService(newFakeAssistantGateway(assistant).attach(assistant.ID, kbaseID), messages, retriever, generator, memory, search.NewQueryTransformer(generator, ""), nil, nil, nil, nil, nil)
+
+	first := sendTestMessage(chatService, session, types.MessageRequest{Message: "Is lost luggage covered?", AssistantID: assistant.ID})
+	assert.True(t, first.Success, "first message should succeed: %v", first.Error)
+	assert.Empty(t, first.Data.(types.ChatResponse).RewrittenQuery, "a first message is searched as typed")
+
+	second := sendTestMessage(chatService, session, types.MessageRequest{Message: "and for children?", AssistantID: assistant.ID})
+	assert.True(t, second.Success, "second message should succeed: %v", second.Error)
+	assert.Equal(t, "Is lost luggage of children covered?", second.Data.(types.ChatResponse).RewrittenQuery)
+	assert.Equal(t, "Is lost luggage of children covered?", embedder.texts[len(embedder.texts)-1], "retrieval should use the rewritten query")
+
+	stored := messages.messages[1]
+	assert.Equal(t, "and for children?", stored.UserMessage)
+	assert.Equal(t, "Is lost luggage of children covered?", stored.RewrittenQuery)
+}
@@ -0,0 +1,631 @@
+package tests
+
+import (
+	"context"
+	"rag-demo/types"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/pgvector/pgvector-go"
+)
+
+// In-memory fakes shared by the tests that don't need Postgres or AWS.
+
+// fakeEmbedder returns the same vector for every text.
+type fakeEmbedder struct {
+	texts []string
+}
+
+func (e *fakeEmbedder) EmbedText(ctx context.Context, text string) ([]float32, error) {
+	e.texts = append(e.texts, text)
+	return []float32{0.1, 0.2, 0.3}, nil
+}
+
+// EmbedTextTokens counts words as tokens.
+func (e *fakeEmbedder) EmbedTextTokens(ctx context.Context, text string) ([]float32, int, error) {
+	embedding, err := e.EmbedText(ctx, text)
+	return embedding, len(strings.Fields(text)), err
+}
+
+func (e *fakeEmbedder) EmbeddingModelID() string {
+	return "fake-embedding-model"
+}
+
+// fakeEmbeddingsGateway serves a fixed list of matches in memory.
+type fakeEmbeddingsGateway struct {
+	matches   []types.KbaseEmbeddingMatch
+	explained bool
+}
+
+func (g *fakeEmbeddingsGateway) CreateEmbedding(ctx context.Context, embedding types.KbaseEmbedding) (bool, error) {
+	return true, nil
+}
+
+func (g *fakeEmbeddingsGateway) SearchEmbeddings(ctx context.Context, kbaseIds []uuid.UUID, embedding pgvector.Vector, limit int) ([]types.KbaseEmbeddingMatch, error) {
+	var matches []types.KbaseEmbeddingMatch
+	for _, match := range g.matches {
+		for _, kbaseID := range kbaseIds {
+			if match.KbaseID == kbaseID {
+				matches = append(matches, match)
+				break
+			}
+		}
+	}
+	if len(matches) > limit {
+		return matches[:limit], nil
+	}
+	return matches, nil
+}
+
+func (g *fakeEmbeddingsGateway) GetChunkRange(ctx context.Context, kbaseId uuid.UUID, source string, firstChunk int, lastChunk int) ([]types.KbaseEmbedding, error) {
+	var chunks []types.KbaseEmbedding
+	for _, match := range g.matches {
+		if match.KbaseID == kbaseId && match.ChunkID >= firstChunk && match.ChunkID <= lastChunk {
+			chunks = append(chunks, match.KbaseEmbedding)
+		}
+	}
+	return chunks, nil
+}
+
+func (g *fakeEmbeddingsGateway) KeywordScores(ctx context.Context, query string, embeddingIds []uuid.UUID) (map[uuid.UUID]float64, error) {
+	scores := make(map[uuid.UUID]float64)
+	for _, id := range embeddingIds {
+		scores[id] = 0.5
+	}
+	return scores, nil
+}
+
+func (g *fakeEmbeddingsGateway) ExplainSearch(ctx context.Context, kbaseIds []uuid.UUID, embedding pgvector.Vector, limit int) (types.SQLPlanSummary, error) {
+	g.explained = true
+	return types.SQLPlanSummary{NodeType: "Limit", Nodes: []string{"Limit", "Sort", "Seq Scan"}}, nil
+}
+
+// fakeKbaseGateway keeps kbases in memory.
+type fakeKbaseGateway struct {
+	kbases map[uuid.UUID]types.Kbase
+}
+
+func newFakeKbaseGateway(kbases ...types.Kbase) *fakeKbaseGateway {
+	g := &fakeKbaseGateway{kbases: make(map[uuid.UUID]types.Kbase)}
+	for _, kbase := range kbases {
+		g.kbases[kbase.ID] = kbase
+	}
+	return g
+}
+
+func (g *fakeKbaseGateway) CreateKbase(ctx context.Context, kbase types.Kbase) (bool, error) {
+	g.kbases[kbase.ID] = kbase
+	return true, nil
+}
+
+func (g *fakeKbaseGateway) GetKbase(ctx context.Context, kbaseId uuid.UUID) (types.Kbase, error) {
+	kbase, ok := g.kbases[kbaseId]
+	if !ok {
+		return types.Kbase{}, pgx.ErrNoRows
+	}
+	return kbase, nil
+}
+
+func (g *fakeKbaseGateway) UpdateKbase(ctx context.Context, kbase types.Kbase) (bool, error) {
+	g.kbases[kbase.ID] = kbase
+	return true, nil
+}
+
+func (g *fakeKbaseGateway) DeleteKbase(ctx context.Context, kbaseId uuid.UUID) (bool, error) {
+	_, ok := g.kbases[kbaseId]
+	delete(g.kbases, kbaseId)
+	return ok, nil
+}
+
+func (g *fakeKbaseGateway) ListKbases(ctx context.Context) (types.KbaseList, error) {
+	var list types.KbaseList
+	for _, kbase := range g.kbases {
+		list.Kbases = append(list.Kbases, kbase)
+	}
+	return list, nil
+}
+
+func fakeMatches(kbaseID uuid.UUID) []types.KbaseEmbeddingMatch {
+	var matches []types.KbaseEmbeddingMatch
+	for i, distance := range []float64{0.1, 0.2, 0.4} {
+		matches = append(matches, types.KbaseEmbeddingMatch{
+			KbaseEmbedding: types.KbaseEmbedding{
+				UUID:     uuid.New(),
+				KbaseID:  kbaseID,
+				ChunkID:  i * 10,
+				Content:  "chunk",
+				Metadata: map[string]interface{}{"source": "policy.pdf"},
+			},
+			Distance: distance,
+		})
+	}
+	return matches
+}
+
+// fakeAssistantGateway keeps assistants, their kbase links and prompt versions in memory.
+type fakeAssistantGateway struct {
+	assistants map[uuid.UUID]types.Assistant
+	links      map[uuid.UUID][]types.AssistantKbase
+	versions   map[uuid.UUID][]types.PromptVersion
+}
+
+func newFakeAssistantGateway(assistants ...types.Assistant) *fakeAssistantGateway {
+	g := &fakeAssistantGateway{
+		assistants: make(map[uuid.UUID]types.Assistant),
+		links:      make(map[uuid.UUID][]types.AssistantKbase),
+		versions:   make(map[uuid.UUID][]types.PromptVersion),
+	}
+	for _, assistant := range assistants {
+		g.CreateAssistant(context.Background(), assistant)
+	}
+	return g
+}
+
+func (g *fakeAssistantGateway) CreateAssistant(ctx context.Context, assistant types.Assistant) (bool, error) {
+	assistant.PromptVersion = 1
+	g.assistants[assistant.ID] = assistant
+	g.versions[assistant.ID] = []types.PromptVersion{{AssistantID: assistant.ID, Version: 1, Template: assistant.SystemPrompts, CreatedAt: time.Now()}}
+	return true, nil
+}
+
+func (g *fakeAssistantGateway) GetAssistant(ctx context.Context, assistantId uuid.UUID) (types.Assistant, error) {
+	assistant, ok := g.assistants[assistantId]
+	if !ok {
+		return types.Assistant{}, pgx.ErrNoRows
+	}
+	return assistant, nil
+}
+
+func (g *fakeAssistantGateway) UpdateAssistant(ctx context.Context, assistant types.Assistant) (bool, error) {
+	current, ok := g.assistants[assistant.ID]
+	if !ok {
+		return false, nil
+	}
+	assistant.PromptVersion = current.PromptVersion
+	if assistant.SystemPrompts != current.SystemPrompts {
+		versions := g.versions[assistant.ID]
+		assistant.PromptVersion = versions[len(versions)-1].Version + 1
+		g.versions[assistant.ID] = append(versions, types.PromptVersion{AssistantID: assistant.ID, Version: assistant.PromptVersion, Template: assistant.SystemPrompts, CreatedAt: time.Now()})
+	}
+	g.assistants[assistant.ID] = assistant
+	return true, nil
+}
+
+func (g *fakeAssistantGateway) ListPromptVersions(ctx context.Context, assistantId uuid.UUID) ([]types.PromptVersion, error) {
+	versions := []types.PromptVersion{}
+	for i := len(g.versions[assistantId]) - 1; i >= 0; i-- {
+		versions = append(versions, g.versions[assistantId][i])
+	}
+	return versions, nil
+}
+
+func (g *fakeAssistantGateway) RollbackPrompt(ctx context.Context, assistantId uuid.UUID, version int) (bool, error) {
+	for _, v := range g.versions[assistantId] {
+		if v.Version == version {
+			assistant := g.assistants[assistantId]
+			assistant.SystemPrompts = v.Template
+			assistant.PromptVersion = v.Version
+			g.assistants[assistantId] = assistant
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+func (g *fakeAssistantGateway) GetAssistantByName(ctx context.Context, assistantName string) (types.Assistant, error) {
+	for _, assistant := range g.assistants {
+		if assistant.Name == assistantName {
+			return assistant, nil
+		}
+	}
+	return types.Assistant{}, pgx.ErrNoRows
+}
+
+func (g *fakeAssistantGateway) DeleteAssistant(ctx context.Context, assistantId uuid.UUID) (bool, error) {
+	if _, ok := g.assistants[assistantId]; !ok {
+		return false, nil
+	}
+	delete(g.assistants, assistantId)
+	return true, nil
+}
+
+func (g *fakeAssistantGateway) ListAssistants(ctx context.Context) (types.AssistantList, error) {
+	var list types.AssistantList
+	for _, assistant := range g.assistants {
+		list.Assistants = append(list.Assistants, assistant)
+	}
+	return list, nil
+}
+
+// attach links kbases to an assistant with the default retrieval settings.
+func (g *fakeAssistantGateway) attach(assistantID uuid.UUID, kbaseIDs ...uuid.UUID) *fakeAssistantGateway {
+	for _, kbaseID := range kbaseIDs {
+		g.AttachKbase(context.Background(), types.AssistantKbase{AssistantID: assistantID, KbaseID: kbaseID, TopK: 5, Weight: 1})
+	}
+	return g
+}
+
+func (g *fakeAssistantGateway) AttachKbase(ctx context.Context, link types.AssistantKbase) (bool, error) {
+	links := g.links[link.AssistantID]
+	for i, existing := range links {
+		if existing.KbaseID == link.KbaseID {
+			links[i] = link
+			return true, nil
+		}
+	}
+	g.links[link.AssistantID] = append(links, link)
+	return true, nil
+}
+
+func (g *fakeAssistantGateway) DetachKbase(ctx context.Context, assistantId uuid.UUID, kbaseId uuid.UUID) (bool, error) {
+	links := g.links[assistantId]
+	for i, existing := range links {
+		if existing.KbaseID == kbaseId {
+			g.links[assistantId] = append(links[:i], links[i+1:]...)
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+func (g *fakeAssistantGateway) ListAssistantKbases(ctx context.Context, assistantId uuid.UUID) ([]types.AssistantKbase, error) {
+	return append([]types.AssistantKbase{}, g.links[assistantId]...), nil
+}
+
+// fakeMessageGateway records stored messages in memory.
+type fakeMessageGateway struct {
+	messages []types.Message
+}
+
+func (g *fakeMessageGateway) CreateMessage(ctx context.Context, message types.Message) (bool, error) {
+	if message.CreatedAt.IsZero() {
+		message.CreatedAt = time.Now()
+	}
+	g.messages = append(g.messages, message)
+	return true, nil
+}
+
+func (g *fakeMessageGateway) ListMessages(ctx context.Context, sessionID uuid.UUID, after *time.Time) ([]types.Message, error) {
+	var list []types.Message
+	for _, message := range g.messages {
+		if message.SessionID == sessionID && (after == nil || message.CreatedAt.After(*after)) {
+			list = append(list, message)
+		}
+	}
+	return list, nil
+}
+
+func (g *fakeMessageGateway) GetMessage(ctx context.Context, messageID uuid.UUID) (types.Message, error) {
+	for _, message := range g.messages {
+		if message.ID == messageID {
+			return message, nil
+		}
+	}
+	return types.Message{}, pgx.ErrNoRows
+}
+
+// fakeFeedbackGateway keeps one rating per user and message in memory and records the summary filters.
+type fakeFeedbackGateway struct {
+	feedback []types.Feedback
+	filters  []types.FeedbackFilter
+}
+
+func (g *fakeFeedbackGateway) SaveFeedback(ctx context.Context, feedback types.Feedback) (types.Feedback, error) {
+	now := time.Now()
+	for i, existing := range g.feedback {
+		if existing.MessageID == feedback.MessageID && existing.UserID == feedback.UserID {
+			feedback.ID, feedback.CreatedAt, feedback.UpdatedAt = existing.ID, existing.CreatedAt, now
+			g.feedback[i] = feedback
+			return feedback, nil
+		}
+	}
+	feedback.CreatedAt, feedback.UpdatedAt = now, now
+	g.feedback = append(g.feedback, feedback)
+	return feedback, nil
+}
+
+func (g *fakeFeedbackGateway) SummarizeFeedback(ctx context.Context, filter types.FeedbackFilter) (types.FeedbackSummary, error) {
+	g.filters = append(g.filters, filter)
+	summary := types.FeedbackSummary{From: filter.From, To: filter.To}
+	for _, feedback := range g.feedback {
+		if filter.AssistantID != nil && feedback.AssistantID != *filter.AssistantID {
+			continue
+		}
+		if feedback.Rating == types.FeedbackRatingUp {
+			summary.Up++
+		} else {
+			summary.Down++
+		}
+	}
+	return summary, nil
+}
+
+// fakeSessionGateway keeps sessions in memory.
+type fakeSessionGateway struct {
+	sessions map[uuid.UUID]types.Session
+}
+
+// fakeUsageGateway keeps the recorded usage in memory and records the report filters.
+type fakeUsageGateway struct {
+	usage   []types.Usage
+	filters []types.UsageFilter
+}
+
+func (g *fakeUsageGateway) RecordUsage(ctx context.Context, usage types.Usage) error {
+	g.usage = append(g.usage, usage)
+	return nil
+}
+
+func (g *fakeUsageGateway) ReportUsage(ctx context.Context, filter types.UsageFilter) (types.UsageReport, error) {
+	g.filters = append(g.filters, filter)
+	report := types.UsageReport{From: filter.From, To: filter.To, GroupBy: filter.GroupBy, Groups: []types.UsageGroup{}}
+	for _, usage := range g.usage {
+		if filter.UserID != nil && usage.UserID != *filter.UserID {
+			continue
+		}
+		report.Total.Calls++
+		report.Total.InputTokens += usage.InputTokens
+		report.Total.OutputTokens += usage.OutputTokens
+		report.Total.Cost += usage.Cost
+	}
+	return report, nil
+}
+
+func newFakeSessionGateway(sessions ...types.Session) *fakeSessionGateway {
+	g := &fakeSessionGateway{sessions: make(map[uuid.UUID]types.Session)}
+	for _, session := range sessions {
+		g.sessions[session.ID] = session
+	}
+	return g
+}
+
+func (g *fakeSessionGateway) CreateSession(ctx context.Context, session types.Session) (bool, error) {
+	g.sessions[session.ID] = session
+	return true, nil
+}
+
+func (g *fakeSessionGateway) UpdateSessionSummary(ctx context.Context, sessionID uuid.UUID, summary string, summarizedUntil time.Time) (bool, error) {
+	session, ok := g.sessions[sessionID]
+	if !ok {
+		return false, nil
+	}
+	session.Summary = summary
+	session.SummarizedUntil = &summarizedUntil
+	g.sessions[sessionID] = session
+	return true, nil
+}
+
+func (g *fakeSessionGateway) ListSessions(ctx context.Context, userID uuid.UUID, limit int, offset int) ([]types.Session, int, error) {
+	var sessions []types.Session
+	for _, session := range g.sessions {
+		if session.UserID == userID {
+			sessions = append(sessions, session)
+		}
+	}
+	sort.Slice(sessions, func(i, j int) bool {
+		return sessions[i].UpdatedAt.After(sessions[j].UpdatedAt)
+	})
+	total := len(sessions)
+	if offset > total {
+		offset = total
+	}
+	sessions = sessions[offset:]
+	if len(sessions) > limit {
+		sessions = sessions[:limit]
+	}
+	return sessions, total, nil
+}
+
+func (g *fakeSessionGateway) CloseSession(ctx context.Context, sessionID uuid.UUID) (bool, error) {
+	session, ok := g.sessions[sessionID]
+	if !ok {
+		return false, nil
+	}
+	session.Active = false
+	g.sessions[sessionID] = session
+	return true, nil
+}
+
+func (g *fakeSessionGateway) GetSession(ctx context.Context, sessionID uuid.UUID) (types.Session, error) {
+	session, ok := g.sessions[sessionID]
+	if !ok {
+		return types.Session{}, pgx.ErrNoRows
+	}
+	return session, nil
+}
+
+// fakeUserGateway keeps users in memory.
+type fakeUserGateway struct {
+	users map[uuid.UUID]types.User
+}
+
+func newFakeUserGateway(users ...types.User) *fakeUserGateway {
+	g := &fakeUserGateway{users: make(map[uuid.UUID]types.User)}
+	for _, user := range users {
+		g.users[user.UserID] = user
+	}
+	return g
+}
+
+func (g *fakeUserGateway) CreateUser(ctx context.Context, user types.User) (bool, error) {
+	g.users[user.UserID] = user
+	return true, nil
+}
+
+func (g *fakeUserGateway) GetUser(ctx context.Context, userID uuid.UUID) (types.User, error) {
+	user, ok := g.users[userID]
+	if !ok {
+		return types.User{}, pgx.ErrNoRows
+	}
+	return user, nil
+}
+
+func (g *fakeUserGateway) DeleteUser(ctx context.Context, userID uuid.UUID) (bool, error) {
+	_, ok := g.users[userID]
+	delete(g.users, userID)
+	return ok, nil
+}
+
+type fakeSQLSandboxGateway struct {
+	tables  []types.TableSchema
+	result  types.SQLResult
+	queries []string
+}
+
+func (g *fakeSQLSandboxGateway) DescribeTables(ctx context.Context, allowed []string) ([]types.TableSchema, error) {
+	return g.tables, nil
+}
+
+func (g *fakeSQLSandboxGateway) RunReadOnly(ctx context.Context, query string, maxRows int, timeout time.Duration) (types.SQLResult, error) {
+	g.queries = append(g.queries, query)
+	result := g.result
+	result.Query = query
+	return result, nil
+}
+
+// fakeCredentialGateway keeps credentials and password resets in memory, creating the users of new
+// accounts in its user gateway.
+type fakeCredentialGateway struct {
+	users       *fakeUserGateway
+	credentials map[uuid.UUID]types.Credentials
+	resets      map[string]types.PasswordReset
+}
+
+func newFakeCredentialGateway(users *fakeUserGateway) *fakeCredentialGateway {
+	return &fakeCredentialGateway{users: users, credentials: make(map[uuid.UUID]types.Credentials), resets: make(map[string]types.PasswordReset)}
+}
+
+func (g *fakeCredentialGateway) CreateAccount(ctx context.Context, user types.User, credentials types.Credentials) error {
+	if _, err := g.GetCredentialsByEmail(ctx, credentials.Email); err == nil {
+		return &pgconn.PgError{Code: "23505"}
+	}
+	g.users.CreateUser(ctx, user)
+	g.credentials[user.UserID] = credentials
+	return nil
+}
+
+func (g *fakeCredentialGateway) GetCredentials(ctx context.Context, userID uuid.UUID) (types.Credentials, error) {
+	credentials, ok := g.credentials[userID]
+	if !ok {
+		return types.Credentials{}, pgx.ErrNoRows
+	}
+	return credentials, nil
+}
+
+func (g *fakeCredentialGateway) GetCredentialsByEmail(ctx context.Context, email string) (types.Credentials, error) {
+	for _, credentials := range g.credentials {
+		if credentials.Email == email {
+			return credentials, nil
+		}
+	}
+	return types.Credentials{}, pgx.ErrNoRows
+}
+
+func (g *fakeCredentialGateway) RecordFailedLogin(ctx context.Context, userID uuid.UUID, maxFailures int, lockedUntil time.Time) error {
+	credentials := g.credentials[userID]
+	credentials.FailedLogins++
+	if credentials.FailedLogins >= maxFailures {
+		credentials.FailedLogins = 0
+		credentials.LockedUntil = lockedUntil
+	}
+	g.credentials[userID] = credentials
+	return nil
+}
+
+func (g *fakeCredentialGateway) ResetFailedLogins(ctx context.Context, userID uuid.UUID) error {
+	credentials := g.credentials[userID]
+	credentials.FailedLogins = 0
+	g.credentials[userID] = credentials
+	return nil
+}
+
+func (g *fakeCredentialGateway) UpdatePassword(ctx context.Context, userID uuid.UUID, passwordHash string, changedAt time.Time) error {
+	credentials := g.credentials[userID]
+	credentials.PasswordHash = passwordHash
+	credentials.PasswordChangedAt = changedAt
+	credentials.FailedLogins = 0
+	credentials.LockedUntil = time.Time{}
+	g.credentials[userID] = credentials
+	for hash, reset := range g.resets {
+		if reset.UserID == userID {
+			delete(g.resets, hash)
+		}
+	}
+	return nil
+}
+
+func (g *fakeCredentialGateway) CreatePasswordReset(ctx context.Context, reset types.PasswordReset) error {
+	g.resets[reset.TokenHash] = reset
+	return nil
+}
+
+func (g *fakeCredentialGateway) ConsumePasswordReset(ctx context.Context, tokenHash string) (types.PasswordReset, error) {
+	reset, ok := g.resets[tokenHash]
+	if !ok {
+		return types.PasswordReset{}, pgx.ErrNoRows
+	}
+	delete(g.resets, tokenHash)
+	return reset, nil
+}
+
+// fakeNotifier keeps the password reset tokens and lockouts it is asked to send by email.
+type fakeNotifier struct {
+	tokens map[string]string
+	locked map[string]time.Time
+}
+
+func (n *fakeNotifier) SendPasswordReset(ctx context.Context, email string, token string) error {
+	n.tokens[email] = token
+	return nil
+}
+
+func (n *fakeNotifier) SendAccountLocked(ctx context.Context, email string, lockedUntil time.Time) error {
+	n.locked[email] = lockedUntil
+	return nil
+}
+
+// fakeAPIKeyGateway keeps API keys in memory.
+type fakeAPIKeyGateway struct {
+	keys map[uuid.UUID]types.APIKey
+}
+
+func newFakeAPIKeyGateway() *fakeAPIKeyGateway {
+	return &fakeAPIKeyGateway{keys: make(map[uuid.UUID]types.APIKey)}
+}
+
+func (g *fakeAPIKeyGateway) CreateAPIKey(ctx context.Context, key types.APIKey) error {
+	g.keys[key.ID] = key
+	return nil
+}
+
+func (g *fakeAPIKeyGateway) GetAPIKeyByHash(ctx context.Context, keyHash string) (types.APIKey, error) {
+	for _, key := range g.keys {
+		if key.KeyHash == keyHash {
+			return key, nil
+		}
+	}
+	return types.APIKey{}, pgx.ErrNoRows
+}
+
+func (g *fakeAPIKeyGateway) ListAPIKeys(ctx context.Context, userID uuid.UUID) ([]types.APIKey, error) {
+	keys := []types.APIKey{}
+	for _, key := range g.keys {
+		if key.UserID == userID {
+			keys = append(keys, key)
+		}
+	}
+	return keys, nil
+}
+
+func (g *fakeAPIKeyGateway) DeleteAPIKey(ctx context.Context, userID uuid.UUID, keyID uuid.UUID) (bool, error) {
+	key, ok := g.keys[keyID]
+	if !ok || key.UserID != userID {
+		return false, nil
+	}
+	delete(g.keys, keyID)
+	return true, nil
+}
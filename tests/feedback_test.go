@@ -0,0 +1,146 @@
+package tests
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"rag-demo/pkg/auth"
+	"rag-demo/pkg/handlers"
+	"rag-demo/pkg/message"
+	"rag-demo/types"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+)
+
+type feedbackTestAPI struct {
+	router   *chi.Mux
+	feedback *fakeFeedbackGateway
+	answer   types.Message
+	token    string
+	other    string
+	admin    string
+}
+
+func newFeedbackTestAPI(t *testing.T) *feedbackTestAPI {
+	user := types.User{UserID: uuid.New(), Name: "feedback user"}
+	other := types.User{UserID: uuid.New(), Name: "other user"}
+	admin := types.User{UserID: uuid.New(), Name: "admin user"}
+	t.Setenv("ADMIN_USER_IDS", admin.UserID.String())
+	authService := auth.NewAuthService(newFakeUserGateway(user, other, admin), nil)
+	token, err := authService.GenerateJWT(context.Background(), user)
+	if err != nil {
+		t.Fatalf("GenerateJWT failed: %v", err)
+	}
+	otherToken, _ := authService.GenerateJWT(context.Background(), other)
+	adminToken, _ := authService.GenerateJWT(context.Background(), admin)
+
+	kbaseID := uuid.New()
+	answer := types.Message{
+		ID:            uuid.New(),
+		SessionID:     uuid.New(),
+		UserID:        user.UserID,
+		AssistantID:   uuid.New(),
+		UserMessage:   "Is lost luggage covered?",
+		AIMessage:     "Yes, up to $500 [2].",
+		PromptVersion: 3,
+		Sources: []types.SearchHit{
+			{ChunkWindow: types.ChunkWindow{KbaseID: kbaseID, Source: "faq.pdf"}, EmbeddingID: uuid.New(), ChunkID: 4},
+			{ChunkWindow: types.ChunkWindow{KbaseID: kbaseID, Source: "policy.pdf"}, EmbeddingID: uuid.New(), ChunkID: 12},
+		},
+		Citations: []types.Citation{{Marker: 2, KbaseID: kbaseID, Document: "policy.pdf", ChunkID: 12}},
+	}
+	messages := &fakeMessageGateway{messages: []types.Message{answer}}
+	feedback := &fakeFeedbackGateway{}
+	feedbackService := message.NewFeedbackService(feedback, messages)
+
+	router := chi.NewRouter()
+	router.Use(handlers.RequireAuth(authService, nil))
+	router.Post("/api/v1/message/{id}/feedback", handlers.HandleSubmitFeedback(feedbackService))
+	router.Get("/api/v1/assistant/{id}/feedback", handlers.HandleAssistantFeedback(feedbackService))
+	router.Get("/api/v1/kbase/{id}/feedback", handlers.HandleKbaseFeedback(feedbackService))
+
+	return &feedbackTestAPI{router: router, feedback: feedback, answer: answer, token: token, other: otherToken, admin: adminToken}
+}
+
+func (api *feedbackTestAPI) serve(method string, url string, token string, body string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(method, url, strings.NewReader(body))
+	if token != "" {
+		req.Header.Set("access-token", "Bearer "+token)
+	}
+	rr := httptest.NewRecorder()
+	api.router.ServeHTTP(rr, req)
+	return rr
+}
+
+func TestSubmitFeedback(t *testing.T) {
+	api := newFeedbackTestAPI(t)
+	url := "/api/v1/message/" + api.answer.ID.String() + "/feedback"
+
+	rr := api.serve("POST", url, api.token, `{"rating": "down", "category": "outdated", "comment": "The limit is $750 now."}`)
+	assert.Equal(t, http.StatusOK, rr.Code, rr.Body.String())
+	var feedback types.Feedback
+	json.NewDecoder(rr.Body).Decode(&feedback)
+	assert.Equal(t, api.answer.ID, feedback.MessageID)
+	assert.Equal(t, api.answer.SessionID, feedback.SessionID)
+	assert.Equal(t, api.answer.AssistantID, feedback.AssistantID)
+	assert.Equal(t, 3, feedback.PromptVersion, "the feedback is linked to the prompt version that produced the answer")
+	assert.Equal(t, []types.FeedbackChunk{
+		{KbaseID: api.answer.Sources[0].KbaseID, EmbeddingID: api.answer.Sources[0].EmbeddingID, ChunkID: 4, Source: "faq.pdf"},
+		{KbaseID: api.answer.Sources[1].KbaseID, EmbeddingID: api.answer.Sources[1].EmbeddingID, ChunkID: 12, Source: "policy.pdf", Cited: true},
+	}, feedback.Chunks, "and to the retrieved chunks")
+
+	rr = api.serve("POST", url, api.token, `{"rating": "up"}`)
+	assert.Equal(t, http.StatusOK, rr.Code, rr.Body.String())
+	assert.Len(t, api.feedback.feedback, 1, "rating again replaces the earlier rating")
+	assert.Equal(t, types.FeedbackRatingUp, api.feedback.feedback[0].Rating)
+	assert.Equal(t, feedback.ID, api.feedback.feedback[0].ID)
+
+	assert.Equal(t, http.StatusUnauthorized, api.serve("POST", url, "", `{"rating": "up"}`).Code)
+	assert.Equal(t, http.StatusForbidden, api.serve("POST", url, api.other, `{"rating": "up"}`).Code)
+	assert.Equal(t, http.StatusNotFound, api.serve("POST", "/api/v1/message/"+uuid.NewString()+"/feedback", api.token, `{"rating": "up"}`).Code)
+	assert.Equal(t, http.StatusBadRequest, api.serve("POST", url, api.token, `{"rating": "meh"}`).Code)
+	assert.Equal(t, http.StatusBadRequest, api.serve("POST", url, api.token, `{"rating": "down", "category": "rude"}`).Code)
+}
+
+func TestFeedbackSummary(t *testing.T) {
+	api := newFeedbackTestAPI(t)
+	api.serve("POST", "/api/v1/message/"+api.answer.ID.String()+"/feedback", api.token, `{"rating": "down"}`)
+
+	rr := api.serve("GET", "/api/v1/assistant/"+api.answer.AssistantID.String()+"/feedback?from=2024-10-01&to=2024-10-15T12:00:00Z&interval=week&limit=5", api.admin, "")
+	assert.Equal(t, http.StatusOK, rr.Code, rr.Body.String())
+	var summary types.FeedbackSummary
+	json.NewDecoder(rr.Body).Decode(&summary)
+	assert.Equal(t, 1, summary.Down)
+	filter := api.feedback.filters[0]
+	assert.Equal(t, api.answer.AssistantID, *filter.AssistantID)
+	assert.Nil(t, filter.KbaseID)
+	assert.Equal(t, time.Date(2024, 10, 1, 0, 0, 0, 0, time.UTC), filter.From)
+	assert.Equal(t, time.Date(2024, 10, 15, 12, 0, 0, 0, time.UTC), filter.To)
+	assert.Equal(t, types.FeedbackIntervalWeek, filter.Interval)
+	assert.Equal(t, 5, filter.Limit)
+
+	kbaseID := api.answer.Sources[0].KbaseID
+	rr = api.serve("GET", "/api/v1/kbase/"+kbaseID.String()+"/feedback", api.admin, "")
+	assert.Equal(t, http.StatusOK, rr.Code, rr.Body.String())
+	filter = api.feedback.filters[1]
+	assert.Equal(t, kbaseID, *filter.KbaseID)
+	assert.Equal(t, types.FeedbackIntervalDay, filter.Interval, "summaries default to daily")
+	assert.Equal(t, message.DefaultFeedbackLimit, filter.Limit)
+	assert.Equal(t, message.DefaultFeedbackPeriod, filter.To.Sub(filter.From))
+
+	kbaseURL := "/api/v1/kbase/" + kbaseID.String() + "/feedback"
+	assert.Equal(t, http.StatusForbidden, api.serve("GET", kbaseURL, api.token, "").Code, "only admins read summaries")
+	assert.Equal(t, http.StatusForbidden, api.serve("GET", "/api/v1/assistant/"+api.answer.AssistantID.String()+"/feedback", api.token, "").Code)
+	assert.Len(t, api.feedback.filters, 2)
+
+	assert.Equal(t, http.StatusBadRequest, api.serve("GET", kbaseURL+"?interval=month", api.admin, "").Code)
+	assert.Equal(t, http.StatusBadRequest, api.serve("GET", kbaseURL+"?from=2024-10-15&to=2024-10-01", api.admin, "").Code)
+	assert.Equal(t, http.StatusBadRequest, api.serve("GET", kbaseURL+"?limit=1000", api.admin, "").Code)
+	assert.Equal(t, http.StatusBadRequest, api.serve("GET", kbaseURL+"?from=yesterday", api.admin, "").Code)
+}
@@ -0,0 +1,167 @@
+package tests
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"rag-demo/pkg/grounding"
+	"rag-demo/pkg/llm"
+	"rag-demo/pkg/message"
+	"rag-demo/pkg/search"
+	"rag-demo/types"
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+)
+
+// vectorEmbedder embeds the texts it knows with their vector and everything else with an unrelated one.
+type vectorEmbedder struct {
+	vectors map[string][]float32
+}
+
+func (e *vectorEmbedder) EmbedText(ctx context.Context, text string) ([]float32, error) {
+	if vector, ok := e.vectors[text]; ok {
+		return vector, nil
+	}
+	return []float32{0, 0, 1}, nil
+}
+
+func (e *vectorEmbedder) EmbeddingModelID() string {
+	return "fake-embedding-model"
+}
+
+const luggageAnswer = "Lost luggage is covered up to $500 [1]. Claims must be filed within 30 days [2]. Pets travel for free."
+
+func luggageSources() []types.SearchHit {
+	return []types.SearchHit{
+		{Content: "Lost or delayed luggage is covered up to $500 per trip."},
+		{Content: "Claims must be filed within 30 days of the incident."},
+	}
+}
+
+func TestGroundingSplitSentences(t *testing.T) {
+	sentences := grounding.SplitSentences("Coverage:\n- Luggage is covered up to $3.5k, e.g. suitcases. Claims take 5 days!\n1. Is it worth it? Yes.\n```\nnot. a sentence\n```\nSee the policy...  It helps")
+	assert.Equal(t, []string{
+		"Coverage:",
+		"Luggage is covered up to $3.5k, e.g. suitcases.",
+		"Claims take 5 days!",
+		"Is it worth it?",
+		"Yes.",
+		"See the policy...",
+		"It helps",
+	}, sentences)
+}
+
+func TestGroundingVerifyWithJudge(t *testing.T) {
+	model := &llm.ScriptedLLM{Reply: `Here you go: [{"sentence": 1, "supported": true}, {"sentence": 2, "supported": true}, {"sentence": 3, "supported": false, "reason": "pets aren't mentioned"}]`}
+	verifier := grounding.NewVerifier(model, nil)
+	policy := types.GroundednessPolicy{Method: types.GroundednessMethodJudge, Threshold: 0.8, Action: types.GroundednessActionAnnotate, JudgeModel: "anthropic.claude-3-sonnet-20240229-v1:0"}
+
+	result, usage, err := verifier.Verify(context.Background(), policy, "anthropic.claude-3-haiku-20240307-v1:0", luggageAnswer, luggageSources())
+	assert.Nil(t, err)
+	assert.Equal(t, 3, result.Sentences)
+	assert.InDelta(t, 2.0/3, result.Score, 1e-9)
+	assert.False(t, result.Passed)
+	assert.Equal(t, types.GroundednessActionAnnotate, result.Action)
+	assert.Equal(t, []types.UnsupportedSentence{{Index: 2, Text: "Pets travel for free.", Reason: "pets aren't mentioned"}}, result.Unsupported)
+	assert.Greater(t, usage.TotalTokens, 0, "the judge's usage is returned")
+
+	request := model.Requests()[0]
+	assert.Equal(t, "anthropic.claude-3-sonnet-20240229-v1:0", request.ModelID, "the policy's judge model is used")
+	assert.Contains(t, request.Messages[0].Content, "[2] Claims must be filed within 30 days of the incident.")
+	assert.Contains(t, request.Messages[0].Content, "1. Lost luggage is covered up to $500.", "citation markers are left out")
+
+	annotated := grounding.Apply(policy, luggageAnswer, result)
+	assert.Equal(t, luggageAnswer+"\n\nNote: the sources don't support these statements:\n- Pets travel for free.", annotated)
+
+	model = &llm.ScriptedLLM{Reply: "All of them are supported."}
+	_, _, err = grounding.NewVerifier(model, nil).Verify(context.Background(), policy, "", luggageAnswer, luggageSources())
+	assert.True(t, errors.Is(err, grounding.ErrJudgeReply))
+}
+
+func TestGroundingVerifyWithEmbeddings(t *testing.T) {
+	embedder := &vectorEmbedder{vectors: map[string][]float32{
+		"Lost or delayed luggage is covered up to $500 per trip.": {1, 0, 0},
+		"Claims must be filed within 30 days of the incident.":    {0, 1, 0},
+		"Lost luggage is covered up to $500.":                     {0.9, 0.1, 0},
+		"Claims must be filed within 30 days.":                    {0.5, 0.5, 0.1},
+	}}
+	verifier := grounding.NewVerifier(nil, embedder)
+	policy := types.GroundednessPolicy{Method: types.GroundednessMethodEmbedding, Threshold: 0.5, Action: types.GroundednessActionRefuse}
+
+	result, _, err := verifier.Verify(context.Background(), policy, "", luggageAnswer, luggageSources())
+	assert.Nil(t, err)
+	assert.Equal(t, 3, result.Sentences)
+	assert.Len(t, result.Unsupported, 1, "only the unrelated sentence is below the default similarity")
+	assert.True(t, result.Passed)
+	assert.Equal(t, luggageAnswer, grounding.Apply(policy, luggageAnswer, result))
+
+	policy.MinSimilarity = 0.9
+	result, _, err = verifier.Verify(context.Background(), policy, "", luggageAnswer, luggageSources())
+	assert.Nil(t, err)
+	assert.Len(t, result.Unsupported, 2)
+	assert.False(t, result.Passed)
+	assert.Equal(t, grounding.DefaultRefusal, grounding.Apply(policy, luggageAnswer, result))
+
+	result, _, err = verifier.Verify(context.Background(), policy, "", "Sure. Thanks!", luggageSources())
+	assert.Nil(t, err)
+	assert.Equal(t, types.Groundedness{Method: types.GroundednessMethodEmbedding, Score: 1, Passed: true}, result, "short sentences aren't checked")
+
+	_, _, err = grounding.NewVerifier(nil, nil).Verify(context.Background(), policy, "", luggageAnswer, luggageSources())
+	assert.True(t, errors.Is(err, grounding.ErrNotConfigured))
+}
+
+func TestChatServiceGroundedness(t *testing.T) {
+	kbaseID := uuid.New()
+	policy := types.GroundednessPolicy{Method: types.GroundednessMethodJudge, Threshold: 1, Action: types.GroundednessActionRefuse, RefusalMessage: "I can't back that up with our policies."}
+	assistant := types.Assistant{ID: uuid.New(), Name: "travel", Model: "anthropic.claude-3-haiku-20240307-v1:0", Groundedness: &policy}
+	messages := &fakeMessageGateway{}
+	model := &llm.ScriptedLLM{
+		Reply:  "Lost luggage is covered up to $500 [1]. Pets travel for free.",
+		Routes: map[string]string{"You check whether an answer is supported": `[{"sentence": 1, "supported": true}, {"sentence": 2, "supported": false}]`},
+	}
+	retriever := search.NewRetriever(&fakeEmbedder{}, &fakeEmbeddingsGateway{matches: fakeMatches(kbaseID)}, newFakeKbaseGateway(types.Kbase{ID: kbaseID}), nil)
+	chatService := message.NewChatService(newFakeAssistantGateway(assistant).attach(assistant.ID, kbaseID), messages, retriever, model, nil, nil, nil, nil, nil, nil, grounding.NewVerifier(model, nil))
+	session := types.Session{ID: uuid.New(), UserID: uuid.New()}
+
+	result := sendTestMessage(chatService, session, types.MessageRequest{Message: "Is lost luggage covered?", AssistantID: assistant.ID})
+	assert.True(t, result.Success, "SendMessage should succeed: %v", result.Error)
+	response := result.Data.(types.ChatResponse)
+	assert.Equal(t, "I can't back that up with our policies.", response.Answer)
+	assert.Empty(t, response.Citations, "a refused answer loses its citations")
+	assert.Equal(t, 0.5, response.Groundedness.Score)
+	assert.Equal(t, types.GroundednessActionRefuse, response.Groundedness.Action)
+	assert.Equal(t, response.Groundedness, messages.messages[0].Groundedness, "the result is stored with the message")
+	assert.Equal(t, response.Answer, messages.messages[0].AIMessage)
+
+	policy.Threshold = 0.5
+	result = sendTestMessage(chatService, session, types.MessageRequest{Message: "Is lost luggage covered?", AssistantID: assistant.ID})
+	assert.True(t, result.Success, "SendMessage should succeed: %v", result.Error)
+	response = result.Data.(types.ChatResponse)
+	assert.True(t, response.Groundedness.Passed)
+	assert.Equal(t, "Lost luggage is covered up to $500 [1]. Pets travel for free.", response.Answer)
+	assert.Len(t, response.Citations, 1)
+
+	unchecked := message.NewChatService(newFakeAssistantGateway(assistant).attach(assistant.ID, kbaseID), &fakeMessageGateway{}, retriever, model, nil, nil, nil, nil, nil, nil, nil)
+	result = sendTestMessage(unchecked, session, types.MessageRequest{Message: "Is lost luggage covered?", AssistantID: assistant.ID})
+	assert.True(t, result.Success, "SendMessage should succeed: %v", result.Error)
+	assert.Nil(t, result.Data.(types.ChatResponse).Groundedness, "without a verifier answers aren't checked")
+}
+
+func TestAssistantGroundednessValidation(t *testing.T) {
+	router, _ := newAssistantTestRouter()
+
+	create := func(policy types.GroundednessPolicy) int {
+		return serveJSON(router, "POST", "/api/v1/assistant", types.NewAssistantRequest{
+			Name:         uuid.NewString(),
+			Model:        "anthropic.claude-3-haiku-20240307-v1:0",
+			Type:         "rag",
+			Groundedness: &policy,
+		}).Code
+	}
+	assert.Equal(t, http.StatusCreated, create(types.GroundednessPolicy{Method: "embedding", Threshold: 0.7, Action: "annotate", MinSimilarity: 0.55}))
+	assert.Equal(t, http.StatusBadRequest, create(types.GroundednessPolicy{Method: "vibes", Threshold: 0.7, Action: "annotate"}))
+	assert.Equal(t, http.StatusBadRequest, create(types.GroundednessPolicy{Method: "llm", Threshold: 1.5, Action: "refuse"}))
+	assert.Equal(t, http.StatusBadRequest, create(types.GroundednessPolicy{Method: "llm", Threshold: 0.7, Action: "refuse", JudgeModel: "gpt-4"}), "the judge model must be supported")
+}
@@ -0,0 +1,196 @@
+package tests
+
+import (
+	"context"
+	"net/http"
+	"rag-demo/pkg/guardrail"
+	"rag-demo/pkg/llm"
+	"rag-demo/pkg/message"
+	"rag-demo/types"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/bedrockruntime"
+	brtypes "github.com/aws/aws-sdk-go-v2/service/bedrockruntime/types"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+)
+
+type fakeApplyGuardrail struct {
+	output *bedrockruntime.ApplyGuardrailOutput
+	inputs []*bedrockruntime.ApplyGuardrailInput
+}
+
+func (f *fakeApplyGuardrail) ApplyGuardrail(ctx context.Context, params *bedrockruntime.ApplyGuardrailInput, optFns ...func(*bedrockruntime.Options)) (*bedrockruntime.ApplyGuardrailOutput, error) {
+	f.inputs = append(f.inputs, params)
+	return f.output, nil
+}
+
+func insurancePolicy() types.GuardrailPolicy {
+	return types.GuardrailPolicy{
+		DeniedWords:   []string{"idiot"},
+		PII:           []string{"email", "credit_card"},
+		BlockedTopics: []types.GuardrailTopic{{Name: "investment advice", Keywords: []string{"stocks", "crypto"}}},
+	}
+}
+
+func TestGuardrailRules(t *testing.T) {
+	rules := guardrail.NewRules()
+	policy := insurancePolicy()
+	check := func(source string, content string) (types.GuardrailResult, string) {
+		result, checked, err := rules.Check(context.Background(), policy, source, content)
+		assert.Nil(t, err)
+		return result, checked
+	}
+
+	result, checked := check(types.GuardrailSourceInput, "Is lost luggage covered?")
+	assert.Equal(t, types.GuardrailActionNone, result.Action)
+	assert.Equal(t, "Is lost luggage covered?", checked)
+
+	result, checked = check(types.GuardrailSourceInput, "You IDIOT, answer me")
+	assert.Equal(t, types.GuardrailActionBlocked, result.Action)
+	assert.Equal(t, []types.GuardrailViolation{{Type: "denied_word", Name: "idiot"}}, result.Violations)
+	assert.Equal(t, guardrail.DefaultBlockedInputMessage, checked)
+	assert.Equal(t, checked, result.Message)
+
+	result, _ = check(types.GuardrailSourceInput, "Idiotic question, sorry")
+	assert.Equal(t, types.GuardrailActionNone, result.Action, "denied words only match whole words")
+
+	result, _ = check(types.GuardrailSourceOutput, "You should buy crypto with the payout.")
+	assert.Equal(t, []types.GuardrailViolation{{Type: "topic", Name: "investment advice"}}, result.Violations)
+	assert.Equal(t, guardrail.DefaultBlockedOutputMessage, result.Message)
+
+	result, _ = check(types.GuardrailSourceInput, "My card is 4111 1111 1111 1111")
+	assert.Equal(t, types.GuardrailActionBlocked, result.Action, "PII is blocked unless the policy masks it")
+	assert.Equal(t, []types.GuardrailViolation{{Type: "pii", Name: "credit_card"}}, result.Violations)
+
+	policy.MaskPII = true
+	result, checked = check(types.GuardrailSourceInput, "Mail jane.doe@example.com, card 4111-1111-1111-1111, order 1234 5678 9012 3456")
+	assert.Equal(t, types.GuardrailActionMasked, result.Action)
+	assert.Equal(t, "Mail [EMAIL], card [CREDIT_CARD], order 1234 5678 9012 3456", checked, "digit runs failing the card checksum are kept")
+	assert.Empty(t, result.Message)
+
+	assert.NotNil(t, guardrail.ValidatePolicy(types.GuardrailPolicy{PII: []string{"passport"}}))
+	assert.NotNil(t, guardrail.ValidatePolicy(types.GuardrailPolicy{BlockedTopics: []types.GuardrailTopic{{Name: "politics"}}}))
+	assert.NotNil(t, guardrail.ValidatePolicy(types.GuardrailPolicy{BedrockGuardrailVersion: "1"}))
+	assert.Nil(t, guardrail.ValidatePolicy(insurancePolicy()))
+}
+
+func TestGuardrailBedrock(t *testing.T) {
+	client := &fakeApplyGuardrail{output: &bedrockruntime.ApplyGuardrailOutput{
+		Action:  brtypes.GuardrailActionGuardrailIntervened,
+		Outputs: []brtypes.GuardrailOutputContent{{Text: aws.String("Call me on {PHONE}")}},
+		Assessments: []brtypes.GuardrailAssessment{{SensitiveInformationPolicy: &brtypes.GuardrailSensitiveInformationPolicyAssessment{
+			PiiEntities: []brtypes.GuardrailPiiEntityFilter{{Type: brtypes.GuardrailPiiEntityTypePhone, Action: brtypes.GuardrailSensitiveInformationPolicyActionAnonymized}},
+		}}},
+	}}
+	bedrock := guardrail.NewBedrock(client)
+
+	result, checked, err := bedrock.Check(context.Background(), types.GuardrailPolicy{}, types.GuardrailSourceInput, "Call me on 555 123 4567")
+	assert.Nil(t, err)
+	assert.Equal(t, types.GuardrailActionNone, result.Action)
+	assert.Empty(t, client.inputs, "policies without a Bedrock guardrail don't call Bedrock")
+
+	policy := types.GuardrailPolicy{BedrockGuardrailID: "gr-123"}
+	result, checked, err = bedrock.Check(context.Background(), policy, types.GuardrailSourceInput, "Call me on 555 123 4567")
+	assert.Nil(t, err)
+	assert.Equal(t, types.GuardrailActionMasked, result.Action)
+	assert.Equal(t, "Call me on {PHONE}", checked)
+	assert.Equal(t, []types.GuardrailViolation{{Type: "pii", Name: "PHONE"}}, result.Violations)
+	assert.Equal(t, "DRAFT", aws.ToString(client.inputs[0].GuardrailVersion))
+	assert.Equal(t, brtypes.GuardrailContentSourceInput, client.inputs[0].Source)
+
+	client.output = &bedrockruntime.ApplyGuardrailOutput{
+		Action:  brtypes.GuardrailActionGuardrailIntervened,
+		Outputs: []brtypes.GuardrailOutputContent{{Text: aws.String("Blocked by Bedrock.")}},
+		Assessments: []brtypes.GuardrailAssessment{{TopicPolicy: &brtypes.GuardrailTopicPolicyAssessment{
+			Topics: []brtypes.GuardrailTopic{{Name: aws.String("Investments"), Action: brtypes.GuardrailTopicPolicyActionBlocked}},
+		}}},
+	}
+	result, checked, err = bedrock.Check(context.Background(), policy, types.GuardrailSourceOutput, "Buy stocks.")
+	assert.Nil(t, err)
+	assert.Equal(t, types.GuardrailActionBlocked, result.Action)
+	assert.Equal(t, "Blocked by Bedrock.", checked, "Bedrock's blocked message is used when the policy has none")
+
+	policy.BlockedOutputMessage = "I can't give investment advice."
+	result, _, _ = bedrock.Check(context.Background(), policy, types.GuardrailSourceOutput, "Buy stocks.")
+	assert.Equal(t, "I can't give investment advice.", result.Message)
+
+	// the local rules mask first, so Bedrock only sees what they let through
+	pipeline := guardrail.NewPipeline(guardrail.NewRules(), bedrock)
+	policy.PII, policy.MaskPII = []string{"email"}, true
+	result, _, err = pipeline.Check(context.Background(), policy, types.GuardrailSourceOutput, "Write to claims@example.com to buy stocks.")
+	assert.Nil(t, err)
+	assert.Equal(t, types.GuardrailActionBlocked, result.Action)
+	assert.Equal(t, []types.GuardrailViolation{{Type: "pii", Name: "email"}, {Type: "topic", Name: "Investments"}}, result.Violations)
+	assert.Equal(t, "Write to [EMAIL] to buy stocks.", aws.ToString(client.inputs[len(client.inputs)-1].Content[0].(*brtypes.GuardrailContentBlockMemberText).Value.Text))
+}
+
+func TestChatServiceGuardrails(t *testing.T) {
+	policy := insurancePolicy()
+	policy.MaskPII = true
+	policy.BlockedInputMessage = "Let's keep it civil."
+	assistant := types.Assistant{ID: uuid.New(), Name: "travel", Model: "anthropic.claude-3-haiku-20240307-v1:0", Guardrails: &policy}
+	messages := &fakeMessageGateway{}
+	model := &llm.ScriptedLLM{Reply: "We'll refund it to card 4111 1111 1111 1111."}
+	chatService := message.NewChatService(newFakeAssistantGateway(assistant), messages, nil, model, nil, nil, nil, nil, nil, guardrail.NewRules(), nil)
+	session := types.Session{ID: uuid.New(), UserID: uuid.New()}
+
+	result := sendTestMessage(chatService, session, types.MessageRequest{Message: "You idiot, where is my refund?", AssistantID: assistant.ID})
+	assert.True(t, result.Success, "SendMessage should succeed: %v", result.Error)
+	response := result.Data.(types.ChatResponse)
+	assert.Equal(t, "Let's keep it civil.", response.Answer)
+	assert.Empty(t, model.Requests(), "a blocked message never reaches the model")
+	assert.Equal(t, types.GuardrailSourceInput, response.Guardrails[0].Source)
+	assert.Equal(t, response.Guardrails, messages.messages[0].Guardrails, "the blocked turn is recorded in the history")
+
+	result = sendTestMessage(chatService, session, types.MessageRequest{Message: "Refund to jane@example.com please", AssistantID: assistant.ID})
+	assert.True(t, result.Success, "SendMessage should succeed: %v", result.Error)
+	response = result.Data.(types.ChatResponse)
+	assert.Equal(t, []string{"Refund to [EMAIL] please"}, model.Prompts(), "masked PII never reaches the model")
+	assert.Equal(t, "Refund to [EMAIL] please", messages.messages[1].UserMessage, "nor the message history")
+	assert.Equal(t, "We'll refund it to card [CREDIT_CARD].", response.Answer)
+	assert.Len(t, response.Guardrails, 2)
+	assert.Equal(t, types.GuardrailSourceOutput, response.Guardrails[1].Source)
+}
+
+func TestChatServiceStreamGuardrails(t *testing.T) {
+	policy := insurancePolicy()
+	policy.MaskPII = true
+	assistant := types.Assistant{ID: uuid.New(), Name: "travel", Model: "anthropic.claude-3-haiku-20240307-v1:0", Guardrails: &policy}
+	model := &llm.ScriptedLLM{Reply: "We'll refund it to card 4111 1111 1111 1111."}
+	chatService := message.NewChatService(newFakeAssistantGateway(assistant), &fakeMessageGateway{}, nil, model, nil, nil, nil, nil, nil, guardrail.NewRules(), nil)
+	session := types.Session{ID: uuid.New(), UserID: uuid.New()}
+
+	eventCh := make(chan types.ChatEvent, 100)
+	go chatService.StreamMessage(context.Background(), session, types.MessageRequest{Message: "Where is my refund?", AssistantID: assistant.ID}, eventCh)
+
+	var tokens []string
+	var guardrails int
+	for event := range eventCh {
+		switch event.Event {
+		case types.ChatEventToken:
+			tokens = append(tokens, event.Data.(map[string]string)["text"])
+		case types.ChatEventGuardrail:
+			guardrails++
+		}
+	}
+	assert.Equal(t, []string{"We'll refund it to card [CREDIT_CARD]."}, tokens, "only the checked answer is streamed")
+	assert.Equal(t, 1, guardrails)
+}
+
+func TestAssistantGuardrailsValidation(t *testing.T) {
+	router, _ := newAssistantTestRouter()
+
+	create := func(policy types.GuardrailPolicy) int {
+		return serveJSON(router, "POST", "/api/v1/assistant", types.NewAssistantRequest{
+			Name:       uuid.NewString(),
+			Model:      "anthropic.claude-3-haiku-20240307-v1:0",
+			Type:       "rag",
+			Guardrails: &policy,
+		}).Code
+	}
+	assert.Equal(t, http.StatusCreated, create(insurancePolicy()))
+	assert.Equal(t, http.StatusBadRequest, create(types.GuardrailPolicy{PII: []string{"passport"}}), "unknown detectors are rejected")
+	assert.Equal(t, http.StatusBadRequest, create(types.GuardrailPolicy{BlockedTopics: []types.GuardrailTopic{{Name: "politics"}}}), "topics need keywords")
+}
@@ -0,0 +1,149 @@
+package tests
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"rag-demo/pkg/llm"
+	"rag-demo/types"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	brtypes "github.com/aws/aws-sdk-go-v2/service/bedrockruntime/types"
+	"github.com/stretchr/testify/assert"
+)
+
+func converseText(message brtypes.Message) string {
+	return message.Content[0].(*brtypes.ContentBlockMemberText).Value
+}
+
+func TestLLMConverseInputPerModelFamily(t *testing.T) {
+	temperature := float32(0.2)
+	req := types.LLMRequest{
+		System: "You are a travel insurance assistant.",
+		Messages: []types.LLMMessage{
+			{Role: types.LLMRoleUser, Content: "Is lost luggage covered?"},
+			{Role: types.LLMRoleAssistant, Content: "Yes, up to $500."},
+			{Role: types.LLMRoleUser, Content: "And for children?"},
+		},
+		Temperature:   &temperature,
+		MaxTokens:     1000,
+		StopSequences: []string{"User:"},
+	}
+
+	for _, model := range llm.SupportedModels {
+		req.ModelID = model.ID
+		input, err := llm.BuildConverseInput(req)
+		assert.Nil(t, err, model.ID)
+		assert.Equal(t, model.ID, aws.ToString(input.ModelId))
+		assert.Len(t, input.Messages, 3, model.ID)
+		assert.Equal(t, brtypes.ConversationRoleAssistant, input.Messages[1].Role)
+		assert.Equal(t, int32(1000), aws.ToInt32(input.InferenceConfig.MaxTokens))
+		assert.Equal(t, &temperature, input.InferenceConfig.Temperature)
+		assert.Equal(t, []string{"User:"}, input.InferenceConfig.StopSequences)
+
+		if model.System {
+			assert.Len(t, input.System, 1, model.ID)
+			assert.Equal(t, "Is lost luggage covered?", converseText(input.Messages[0]))
+		} else {
+			assert.Empty(t, input.System, "%s takes no system prompt", model.ID)
+			assert.Equal(t, "You are a travel insurance assistant.\n\nIs lost luggage covered?", converseText(input.Messages[0]))
+		}
+	}
+}
+
+func TestLLMConverseInputAdaptsMessages(t *testing.T) {
+	input, err := llm.BuildConverseInput(types.LLMRequest{
+		ModelID: "amazon.titan-text-lite-v1",
+		Messages: []types.LLMMessage{
+			{Role: types.LLMRoleUser, Content: "Hello"},
+			{Role: types.LLMRoleUser, Content: "Is lost luggage covered?"},
+			{Role: types.LLMRoleAssistant, Content: " "},
+		},
+		MaxTokens: 100000,
+	})
+	assert.Nil(t, err)
+	assert.Len(t, input.Messages, 1, "consecutive user messages are merged and empty ones dropped")
+	assert.Equal(t, "Hello\n\nIs lost luggage covered?", converseText(input.Messages[0]))
+	assert.Equal(t, int32(4096), aws.ToInt32(input.InferenceConfig.MaxTokens), "max tokens is capped at the model limit")
+
+	input, err = llm.BuildConverseInput(types.LLMRequest{
+		ModelID:  "anthropic.claude-3-haiku-20240307-v1:0",
+		Messages: []types.LLMMessage{{Role: types.LLMRoleUser, Content: "Hello"}},
+	})
+	assert.Nil(t, err)
+	assert.Nil(t, input.InferenceConfig, "the model defaults apply when nothing is set")
+
+	_, err = llm.BuildConverseInput(types.LLMRequest{
+		ModelID:  "anthropic.claude-3-haiku-20240307-v1:0",
+		Messages: []types.LLMMessage{{Role: types.LLMRoleAssistant, Content: "Hello"}},
+	})
+	assert.NotNil(t, err, "a conversation starting with the assistant should be rejected")
+
+	_, err = llm.BuildConverseInput(types.LLMRequest{
+		ModelID:  "anthropic.claude-3-haiku-20240307-v1:0",
+		Messages: []types.LLMMessage{{Role: "system", Content: "Hello"}},
+	})
+	assert.NotNil(t, err, "an unknown role should be rejected")
+}
+
+func TestLLMSupportedModels(t *testing.T) {
+	assert.True(t, llm.IsSupportedModel("meta.llama3-8b-instruct-v1:0"))
+	assert.False(t, llm.IsSupportedModel("openai.gpt-4"))
+
+	model, ok := llm.LookupModel("mistral.mixtral-8x7b-instruct-v0:1")
+	assert.True(t, ok)
+	assert.Equal(t, llm.FamilyMistral, model.Family)
+}
+
+func TestLLMScripted(t *testing.T) {
+	model := &llm.ScriptedLLM{
+		Reply:  "Lost luggage is covered.",
+		Routes: map[string]string{"rewrite": "lost luggage cover"},
+	}
+	req := types.LLMRequest{System: "You answer questions.", Messages: []types.LLMMessage{{Role: types.LLMRoleUser, Content: "Is lost luggage covered?"}}}
+
+	var tokens []string
+	response, err := model.ConverseStream(context.Background(), req, func(token string) error {
+		tokens = append(tokens, token)
+		return nil
+	})
+	assert.Nil(t, err)
+	assert.Equal(t, "Lost luggage is covered.", response.Text)
+	assert.Equal(t, []string{"Lost ", "luggage ", "is ", "covered."}, tokens)
+	assert.Equal(t, 4, response.Usage.OutputTokens)
+
+	rewritten, err := llm.Generate(context.Background(), model, "", "You rewrite queries.", "Is lost luggage covered?")
+	assert.Nil(t, err)
+	assert.Equal(t, "lost luggage cover", rewritten, "the reply is routed by the system prompt")
+	assert.Equal(t, []string{"You answer questions.", "You rewrite queries."}, model.Systems())
+	assert.Equal(t, []string{"Is lost luggage covered?", "Is lost luggage covered?"}, model.Prompts())
+
+	model.Err = errors.New("throttled")
+	_, err = model.Converse(context.Background(), req)
+	assert.NotNil(t, err)
+}
+
+func TestLLMConverseInputWithTools(t *testing.T) {
+	req := types.LLMRequest{
+		ModelID: "anthropic.claude-3-haiku-20240307-v1:0",
+		Messages: []types.LLMMessage{
+			{Role: types.LLMRoleUser, Content: "Is lost luggage covered?"},
+			{Role: types.LLMRoleAssistant, ToolCalls: []types.ToolCall{{ID: "t1", Name: "search_kbase", Input: json.RawMessage(`{"query":"lost luggage"}`)}}},
+			{Role: types.LLMRoleUser, ToolResults: []types.ToolResult{{ToolCallID: "t1", Content: "no passages", IsError: true}}},
+		},
+		Tools: []types.ToolSpec{{Name: "search_kbase", Description: "Search", InputSchema: json.RawMessage(`{"type":"object"}`)}},
+	}
+
+	input, err := llm.BuildConverseInput(req)
+	assert.Nil(t, err)
+	assert.Len(t, input.ToolConfig.Tools, 1)
+	toolUse := input.Messages[1].Content[0].(*brtypes.ContentBlockMemberToolUse)
+	assert.Equal(t, "t1", aws.ToString(toolUse.Value.ToolUseId))
+	toolResult := input.Messages[2].Content[0].(*brtypes.ContentBlockMemberToolResult)
+	assert.Equal(t, brtypes.ToolResultStatusError, toolResult.Value.Status)
+
+	req.ModelID = "amazon.titan-text-express-v1"
+	_, err = llm.BuildConverseInput(req)
+	assert.True(t, errors.Is(err, llm.ErrToolsUnsupported))
+}
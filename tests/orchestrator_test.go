@@ -75,7 +75,7 @@ func TestEmbeddingOrchestrator(t *testing.T) {
 
 
     // Create the orchestrator
-    orchestrator := orchestrator.NewOrchestrator(bedrockService, dbService)
+    orchestrator := orchestrator.NewOrchestrator(bedrockService, dbService, nil, nil)
 
 	err = db.RegisterType()
 	if err != nil {
@@ -0,0 +1,130 @@
+package tests
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"rag-demo/pkg/llm"
+	"rag-demo/pkg/assistant"
+	"rag-demo/pkg/handlers"
+	"rag-demo/pkg/message"
+	"rag-demo/pkg/search"
+	"rag-demo/types"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestValidatePromptTemplate(t *testing.T) {
+	assert.Nil(t, assistant.ValidatePromptTemplate(""))
+	assert.Nil(t, assistant.ValidatePromptTemplate("You help {{.UserName}} on {{.Today}} with {{.KbaseNames}}.{{if .Context}}\n{{.Context}}{{end}}"))
+
+	err := assistant.ValidatePromptTemplate("Hello {{.UserName")
+	assert.ErrorIs(t, err, assistant.ErrInvalidTemplate, "syntax errors are rejected")
+	err = assistant.ValidatePromptTemplate("Hello {{.Username}}")
+	assert.ErrorIs(t, err, assistant.ErrInvalidTemplate, "unknown variables are rejected")
+	err = assistant.ValidatePromptTemplate("{{if .Context}}{{.Context}}{{else}}{{.Bogus}}{{end}}")
+	assert.ErrorIs(t, err, assistant.ErrInvalidTemplate, "including in branches the sample doesn't take")
+	assert.Contains(t, err.Error(), ".Bogus")
+	assert.ErrorIs(t, assistant.ValidatePromptTemplate("{{with .KbaseNames}}{{else}}{{$.Bogus}}{{end}}"), assistant.ErrInvalidTemplate)
+	assert.ErrorIs(t, assistant.ValidatePromptTemplate("{{.UserName.First}}"), assistant.ErrInvalidTemplate)
+	assert.Nil(t, assistant.ValidatePromptTemplate("{{with .KbaseNames}}Sources: {{.}}{{else}}No sources for {{$.UserName}}.{{end}}"))
+	err = assistant.ValidatePromptTemplate(`{{define "x"}}{{.Bogus}}{{end}}{{if not .UserName}}{{template "x" .}}{{end}}`)
+	assert.ErrorIs(t, err, assistant.ErrInvalidTemplate, "including in defined templates")
+	assert.Contains(t, err.Error(), ".Bogus")
+	assert.Nil(t, assistant.ValidatePromptTemplate(`{{define "sources"}}{{.Context}}{{end}}{{template "sources" .}}`))
+
+	assert.True(t, assistant.UsesVariable("{{if .Context}}{{.Context}}{{end}}", "Context"))
+	assert.False(t, assistant.UsesVariable("Hello {{.UserName}}", "Context"))
+	assert.True(t, assistant.UsesVariable(`{{define "sources"}}{{.Context}}{{end}}Hello {{template "sources" .}}`, "Context"))
+}
+
+func TestAssistantPromptVersions(t *testing.T) {
+	gateway := newFakeAssistantGateway()
+	assistantService := assistant.NewAssistantService(gateway, newFakeKbaseGateway(), nil)
+	router := chi.NewRouter()
+	router.Post("/api/v1/assistant", handlers.HandleCreateAssistant(assistantService))
+	router.Put("/api/v1/assistant/{id}", handlers.HandleUpdateAssistant(assistantService))
+	router.Get("/api/v1/assistant/{id}/prompt", handlers.HandleListPromptVersions(assistantService))
+	router.Post("/api/v1/assistant/{id}/prompt/{version}/rollback", handlers.HandleRollbackPrompt(assistantService))
+
+	req := types.NewAssistantRequest{Name: "travel", Model: "anthropic.claude-3-haiku-20240307-v1:0", Type: "rag", SystemPrompts: "Help {{.UserName}}."}
+	rr := serveJSON(router, "POST", "/api/v1/assistant", req)
+	assert.Equal(t, http.StatusCreated, rr.Code, rr.Body.String())
+	var created types.Assistant
+	json.NewDecoder(rr.Body).Decode(&created)
+	assert.Equal(t, 1, created.PromptVersion)
+	url := "/api/v1/assistant/" + created.ID.String()
+
+	invalid := req
+	invalid.SystemPrompts = "Help {{.Customer}}."
+	rr = serveJSON(router, "PUT", url, invalid)
+	assert.Equal(t, http.StatusBadRequest, rr.Code)
+
+	// only a changed prompt creates a version
+	renamed := req
+	renamed.Type = "rag-v2"
+	rr = serveJSON(router, "PUT", url, renamed)
+	var updated types.Assistant
+	json.NewDecoder(rr.Body).Decode(&updated)
+	assert.Equal(t, 1, updated.PromptVersion)
+
+	reworded := req
+	reworded.SystemPrompts = "Help {{.UserName}} kindly."
+	rr = serveJSON(router, "PUT", url, reworded)
+	json.NewDecoder(rr.Body).Decode(&updated)
+	assert.Equal(t, 2, updated.PromptVersion)
+
+	rr = serveJSON(router, "GET", url+"/prompt", nil)
+	var history struct {
+		Versions []types.PromptVersion `json:"versions"`
+	}
+	json.NewDecoder(rr.Body).Decode(&history)
+	assert.Len(t, history.Versions, 2)
+	assert.Equal(t, 2, history.Versions[0].Version, "newest first")
+
+	rr = serveJSON(router, "POST", url+"/prompt/1/rollback", nil)
+	assert.Equal(t, http.StatusOK, rr.Code, rr.Body.String())
+	var rolledBack types.Assistant
+	json.NewDecoder(rr.Body).Decode(&rolledBack)
+	assert.Equal(t, 1, rolledBack.PromptVersion)
+	assert.Equal(t, "Help {{.UserName}}.", rolledBack.SystemPrompts)
+	assert.Len(t, gateway.versions[created.ID], 2, "a rollback doesn't create a version")
+
+	rr = serveJSON(router, "POST", url+"/prompt/9/rollback", nil)
+	assert.Equal(t, http.StatusNotFound, rr.Code)
+	rr = serveJSON(router, "POST", url+"/prompt/latest/rollback", nil)
+	assert.Equal(t, http.StatusBadRequest, rr.Code)
+}
+
+func TestChatServiceRendersPromptTemplate(t *testing.T) {
+	kbaseID := uuid.New()
+	user := types.User{UserID: uuid.New(), Name: "Ada"}
+	bot := types.Assistant{
+		ID:            uuid.New(),
+		Name:          "travel",
+		Model:         "anthropic.claude-3-haiku-20240307-v1:0",
+		SystemPrompts: "You help {{.UserName}} on {{.Today}} using {{.KbaseNames}}.\n{{.Context}}\nBe brief.",
+	}
+	assistants := newFakeAssistantGateway(bot)
+	assistants.AttachKbase(context.Background(), types.AssistantKbase{AssistantID: bot.ID, KbaseID: kbaseID, KbaseName: "Policies", TopK: 5, Weight: 1})
+	messages := &fakeMessageGateway{}
+	generator := &llm.ScriptedLLM{Reply: "Yes [1]."}
+	retriever := search.NewRetriever(&fakeEmbedder{}, &fakeEmbeddingsGateway{matches: fakeMatches(kbaseID)}, newFakeKbaseGateway(types.Kbase{ID: kbaseID}), nil)
+	chatService := message.NewChatService(assistants, messages, retriever, generator, nil, nil, newFakeUserGateway(user), nil, nil, nil, nil)
+
+	result := sendTestMessage(chatService, types.Session{ID: uuid.New(), UserID: user.UserID}, types.MessageRequest{Message: "Is lost luggage covered?", AssistantID: bot.ID})
+	assert.True(t, result.Success, "SendMessage should succeed: %v", result.Error)
+
+	system := generator.Systems()[0]
+	assert.True(t, strings.HasPrefix(system, "You help Ada on "+time.Now().Format("2006-01-02")+" using Policies.\n"), system)
+	assert.True(t, strings.HasSuffix(system, "</context>\nBe brief."), "the context is placed where the template puts it")
+	assert.Equal(t, 1, strings.Count(system, "<context>"), "and not appended a second time")
+
+	assert.Equal(t, 1, result.Data.(types.ChatResponse).PromptVersion)
+	assert.Equal(t, 1, messages.messages[0].PromptVersion, "the message records the prompt version that produced it")
+}
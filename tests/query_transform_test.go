@@ -0,0 +1,82 @@
+package tests
+
+import (
+	"context"
+	"rag-demo/pkg/llm"
+	"rag-demo/pkg/search"
+	"rag-demo/types"
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestQueryTransformerParaphrase(t *testing.T) {
+	generator := &llm.ScriptedLLM{Reply: "1. travel insurance exclusions\n2. What does travel insurance not cover?\n\n- what does travel insurance not cover?\n3. \"policy exclusions for trips\"\n4. extra query"}
+	transformer := search.NewQueryTransformer(generator, "")
+
+	queries, err := transformer.Paraphrase(context.Background(), "Travel insurance exclusions", 3)
+
+	assert.Nil(t, err, "Error should be nil")
+	assert.Equal(t, []string{"What does travel insurance not cover?", "policy exclusions for trips", "extra query"}, queries,
+		"list markers, quotes, duplicates and the original query should be removed")
+	assert.Len(t, generator.Prompts(), 1)
+
+	generator.Reply = "1. 2023 tax rules for travel expenses\n401k match on travel stipends\n2) 3-day trip cancellation cover"
+	queries, err = transformer.Paraphrase(context.Background(), "Travel tax rules", 3)
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"2023 tax rules for travel expenses", "401k match on travel stipends", "3-day trip cancellation cover"}, queries,
+		"numbers that are part of a query are kept")
+}
+
+func TestQueryTransformerHypotheticalDocument(t *testing.T) {
+	generator := &llm.ScriptedLLM{Reply: "  Travel insurance does not cover pre-existing conditions.  "}
+	transformer := search.NewQueryTransformer(generator, "")
+
+	document, err := transformer.HypotheticalDocument(context.Background(), "what is excluded?")
+
+	assert.Nil(t, err, "Error should be nil")
+	assert.Equal(t, "Travel insurance does not cover pre-existing conditions.", document)
+
+	generator.Reply = "   "
+	_, err = transformer.HypotheticalDocument(context.Background(), "what is excluded?")
+	assert.NotNil(t, err, "an empty hypothetical document should be an error")
+}
+
+func TestQueryTransformerStandalone(t *testing.T) {
+	generator := &llm.ScriptedLLM{Reply: "\"Is lost luggage of children covered by the Gold plan?\"\n"}
+	transformer := search.NewQueryTransformer(generator, "")
+
+	query, err := transformer.Standalone(context.Background(), "and for children?", "User: Does the Gold plan cover lost luggage?\nAssistant: Yes.\n")
+
+	assert.Nil(t, err, "Error should be nil")
+	assert.Equal(t, "Is lost luggage of children covered by the Gold plan?", query)
+	assert.Contains(t, generator.Prompts()[0], "Does the Gold plan cover lost luggage?")
+	assert.Contains(t, generator.Prompts()[0], "Latest message: and for children?")
+
+	generator.Reply = "  "
+	query, err = transformer.Standalone(context.Background(), "and for children?", "")
+	assert.Nil(t, err)
+	assert.Equal(t, "and for children?", query, "an empty rewrite falls back to the message")
+}
+
+func TestFuseRRF(t *testing.T) {
+	a := types.KbaseEmbeddingMatch{KbaseEmbedding: types.KbaseEmbedding{UUID: uuid.New(), ChunkID: 1}, Distance: 0.3}
+	b := types.KbaseEmbeddingMatch{KbaseEmbedding: types.KbaseEmbedding{UUID: uuid.New(), ChunkID: 2}, Distance: 0.2}
+	c := types.KbaseEmbeddingMatch{KbaseEmbedding: types.KbaseEmbedding{UUID: uuid.New(), ChunkID: 3}, Distance: 0.1}
+
+	bCloser := b
+	bCloser.Distance = 0.05
+
+	fused := search.FuseRRF([][]types.KbaseEmbeddingMatch{
+		{a, b},
+		{c, bCloser},
+		{bCloser},
+	}, 60)
+
+	assert.Len(t, fused, 3)
+	assert.Equal(t, b.UUID, fused[0].UUID, "a chunk found by every query should rank first")
+	assert.Equal(t, 0.05, fused[0].Distance, "the best distance should be kept")
+	assert.Equal(t, a.UUID, fused[1].UUID, "ties keep first-seen order")
+	assert.Equal(t, c.UUID, fused[2].UUID)
+}
@@ -0,0 +1,164 @@
+package tests
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"rag-demo/pkg/auth"
+	"rag-demo/pkg/handlers"
+	"rag-demo/pkg/llm"
+	"rag-demo/pkg/quota"
+	"rag-demo/types"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+)
+
+// newQuotaTestRouter serves /chat, which asks the model, and /ping behind the limiter's middleware.
+// Requests are identified by their x-subject header.
+func newQuotaTestRouter(limits map[string]quota.Limits, now *time.Time) (*chi.Mux, *quota.Limiter) {
+	limiter := quota.NewLimiter(quota.NewMemoryStore(), limits, func(r *http.Request) quota.Subject {
+		kind, id, _ := strings.Cut(r.Header.Get("x-subject"), ":")
+		return quota.Subject{Kind: kind, ID: id}
+	})
+	limiter.Now = func() time.Time { return *now }
+	model := quota.NewCountedLLM(&llm.ScriptedLLM{Reply: "one two three four five"}, limiter)
+
+	router := chi.NewRouter()
+	router.Use(limiter.Requests)
+	router.With(limiter.Tokens).Post("/chat", func(w http.ResponseWriter, r *http.Request) {
+		llm.Generate(r.Context(), model, "anthropic.claude-3-haiku-20240307-v1:0", "", "hello there")
+	})
+	router.Post("/ping", func(w http.ResponseWriter, r *http.Request) {})
+	return router, limiter
+}
+
+func quotaRequest(router http.Handler, path string, subject string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest("POST", path, nil)
+	req.Header.Set("x-subject", subject)
+	rr := httptest.NewRecorder()
+	router.ServeHTTP(rr, req)
+	return rr
+}
+
+func TestQuotaRequestsPerMinute(t *testing.T) {
+	now := time.Date(2024, 10, 29, 10, 15, 40, 0, time.UTC)
+	router, _ := newQuotaTestRouter(map[string]quota.Limits{quota.SubjectUser: {RequestsPerMinute: 2}}, &now)
+
+	rr := quotaRequest(router, "/ping", "user:alice")
+	assert.Equal(t, http.StatusOK, rr.Code)
+	assert.Equal(t, "2", rr.Header().Get("X-RateLimit-Limit"))
+	assert.Equal(t, "1", rr.Header().Get("X-RateLimit-Remaining"))
+	assert.Equal(t, "20", rr.Header().Get("X-RateLimit-Reset"))
+	assert.Empty(t, quotaRequest(router, "/chat", "user:carol").Header().Get("X-Quota-Tokens-Limit"), "unlimited quotas have no headers")
+
+	assert.Equal(t, http.StatusOK, quotaRequest(router, "/ping", "user:alice").Code)
+	rr = quotaRequest(router, "/ping", "user:alice")
+	assert.Equal(t, http.StatusTooManyRequests, rr.Code)
+	assert.Equal(t, "20", rr.Header().Get("Retry-After"))
+	assert.Equal(t, "0", rr.Header().Get("X-RateLimit-Remaining"))
+
+	assert.Equal(t, http.StatusOK, quotaRequest(router, "/ping", "user:bob").Code, "users are limited separately")
+	assert.Equal(t, http.StatusOK, quotaRequest(router, "/ping", "ip:10.0.0.1").Code)
+	assert.Equal(t, http.StatusOK, quotaRequest(router, "/ping", "ip:10.0.0.1").Code)
+	assert.Equal(t, http.StatusTooManyRequests, quotaRequest(router, "/ping", "ip:10.0.0.1").Code, "anonymous clients get the user limits")
+
+	now = now.Add(20 * time.Second)
+	assert.Equal(t, http.StatusOK, quotaRequest(router, "/ping", "user:alice").Code, "the count starts over every minute")
+}
+
+func TestQuotaTokensPerDay(t *testing.T) {
+	now := time.Date(2024, 10, 29, 22, 0, 0, 0, time.UTC)
+	router, limiter := newQuotaTestRouter(map[string]quota.Limits{quota.SubjectUser: {TokensPerDay: 12}}, &now)
+
+	// the scripted model counts 2 input and 5 output tokens per call
+	rr := quotaRequest(router, "/chat", "user:alice")
+	assert.Equal(t, http.StatusOK, rr.Code)
+	assert.Equal(t, "12", rr.Header().Get("X-Quota-Tokens-Remaining"), "the headers show the tokens left before the request")
+	assert.Empty(t, rr.Header().Get("X-RateLimit-Limit"))
+
+	rr = quotaRequest(router, "/chat", "user:alice")
+	assert.Equal(t, http.StatusOK, rr.Code)
+	assert.Equal(t, "5", rr.Header().Get("X-Quota-Tokens-Remaining"))
+
+	rr = quotaRequest(router, "/chat", "user:alice")
+	assert.Equal(t, http.StatusTooManyRequests, rr.Code, "the quota is used up, overshot by the last call")
+	assert.Equal(t, "0", rr.Header().Get("X-Quota-Tokens-Remaining"))
+	assert.Equal(t, "7200", rr.Header().Get("Retry-After"), "tokens are available again at midnight UTC")
+	assert.Equal(t, http.StatusOK, quotaRequest(router, "/chat", "user:bob").Code)
+
+	// model calls outside a limited request count for nobody
+	llm.Generate(context.Background(), quota.NewCountedLLM(&llm.ScriptedLLM{Reply: "ok"}, limiter), "anthropic.claude-3-haiku-20240307-v1:0", "", "hi")
+
+	now = now.Add(2 * time.Hour)
+	assert.Equal(t, http.StatusOK, quotaRequest(router, "/chat", "user:alice").Code)
+}
+
+func TestQuotaDocumentsPerDay(t *testing.T) {
+	now := time.Date(2024, 10, 29, 9, 0, 0, 0, time.UTC)
+	limiter := quota.NewLimiter(quota.NewMemoryStore(), map[string]quota.Limits{
+		quota.SubjectUser:   {DocumentsPerDay: 2},
+		quota.SubjectAPIKey: {DocumentsPerDay: 1},
+	}, nil)
+	limiter.Now = func() time.Time { return now }
+	alice := quota.WithSubject(context.Background(), quota.Subject{Kind: quota.SubjectUser, ID: "alice"})
+	key := quota.WithSubject(context.Background(), quota.Subject{Kind: quota.SubjectAPIKey, ID: "nightly"})
+
+	assert.NoError(t, limiter.CountDocument(alice))
+	assert.NoError(t, limiter.CountDocument(alice))
+	for i := 0; i < 2; i++ {
+		assert.ErrorIs(t, limiter.CountDocument(alice), quota.ErrDocumentQuotaExceeded)
+	}
+	assert.NoError(t, limiter.CountDocument(key), "API keys are limited separately")
+	assert.ErrorIs(t, limiter.CountDocument(key), quota.ErrDocumentQuotaExceeded, "API keys have limits of their own")
+	assert.NoError(t, limiter.CountDocument(context.Background()), "documents without a subject aren't counted")
+	assert.NoError(t, (*quota.Limiter)(nil).CountDocument(alice))
+
+	now = now.Add(15 * time.Hour)
+	assert.NoError(t, limiter.CountDocument(alice))
+	decision, err := limiter.AllowDocuments(alice, quota.Subject{Kind: quota.SubjectUser, ID: "alice"}, 0)
+	assert.NoError(t, err)
+	assert.Equal(t, 1, decision.Remaining, "refused documents weren't counted")
+}
+
+func TestQuotaSubject(t *testing.T) {
+	user := types.User{UserID: uuid.New(), Name: "quota user"}
+	authService := auth.NewAuthService(newFakeUserGateway(user), nil)
+	token, err := authService.GenerateJWT(context.Background(), user)
+	if err != nil {
+		t.Fatalf("GenerateJWT failed: %v", err)
+	}
+	apiKeyService := auth.NewAPIKeyService(newFakeAPIKeyGateway(), newFakeUserGateway(user))
+	resultCh := make(types.ResultChannel, 1)
+	wg := &sync.WaitGroup{}
+	wg.Add(1)
+	apiKeyService.CreateAPIKey(context.Background(), user.UserID, types.NewAPIKeyRequest{Name: "quota key"}, resultCh, wg)
+	key := (<-resultCh).Data.(types.NewAPIKey)
+	subject := handlers.QuotaSubject(authService, apiKeyService)
+
+	req := httptest.NewRequest("POST", "/api/v1/session", nil)
+	req.RemoteAddr = "192.0.2.7:51234"
+	assert.Equal(t, quota.Subject{Kind: quota.SubjectAnonymous, ID: "192.0.2.7"}, subject(req))
+
+	req.Header.Set("x-api-key", "rag_made-up-key")
+	assert.Equal(t, quota.SubjectAnonymous, subject(req).Kind, "unknown API keys don't escape the limits")
+
+	req.Header.Set("x-api-key", key.Key)
+	assert.Equal(t, quota.Subject{Kind: quota.SubjectAPIKey, ID: key.ID.String()}, subject(req))
+	req.Header.Del("x-api-key")
+
+	req.Header.Set("access-token", "Bearer "+token)
+	assert.Equal(t, quota.Subject{Kind: quota.SubjectUser, ID: user.UserID.String()}, subject(req))
+
+	other := types.User{UserID: uuid.New(), Name: "context user"}
+	req = req.WithContext(auth.WithUser(req.Context(), other))
+	assert.Equal(t, quota.Subject{Kind: quota.SubjectUser, ID: other.UserID.String()}, subject(req), "the authenticated user of the context comes first")
+
+	req = req.WithContext(auth.WithAPIKey(req.Context(), key.APIKey))
+	assert.Equal(t, quota.Subject{Kind: quota.SubjectAPIKey, ID: key.ID.String()}, subject(req), "requests made with an API key count against the key")
+}
@@ -0,0 +1,75 @@
+package tests
+
+import (
+	"context"
+	"rag-demo/pkg/llm"
+	"rag-demo/pkg/search"
+	"rag-demo/types"
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRetrieverExplain(t *testing.T) {
+	kbaseID := uuid.New()
+	gateway := &fakeEmbeddingsGateway{matches: fakeMatches(kbaseID)}
+	generator := &llm.ScriptedLLM{Reply: "first paraphrase\nsecond paraphrase"}
+	kbases := newFakeKbaseGateway(types.Kbase{ID: kbaseID, Name: "policies"})
+	retriever := search.NewRetriever(&fakeEmbedder{}, gateway, kbases, search.NewQueryTransformer(generator, ""))
+
+	result, err := retriever.Search(context.Background(), types.SearchRequest{
+		Query:      "what is covered?",
+		KbaseIDs:   []uuid.UUID{kbaseID},
+		TopK:       2,
+		MultiQuery: true,
+		NumQueries: 2,
+		Explain:    true,
+	})
+
+	assert.Nil(t, err, "Error should be nil")
+	assert.Equal(t, []string{"first paraphrase", "second paraphrase"}, result.GeneratedQueries)
+	assert.Len(t, result.Hits, 2)
+
+	explanation := result.Explain
+	assert.NotNil(t, explanation, "explanation should be returned")
+	assert.Equal(t, "fake-embedding-model", explanation.EmbeddingModel)
+	assert.Nil(t, explanation.SQLPlan, "the SQL plan is only returned when requested")
+	assert.False(t, gateway.explained)
+	assert.Contains(t, explanation.TimingsMs, "vector_search")
+	assert.Contains(t, explanation.TimingsMs, "total")
+
+	hit := result.Hits[0].Explain
+	assert.NotNil(t, hit)
+	assert.Equal(t, 0.1, hit.VectorDistance)
+	assert.Equal(t, 0.5, hit.KeywordScore)
+	assert.Len(t, hit.RankContributions, 3, "every query should have found the best chunk")
+	assert.Equal(t, "query", hit.RankContributions[0].Kind)
+	assert.InDelta(t, 3.0/61.0, hit.FusedScore, 1e-9)
+	assert.Nil(t, hit.RerankerScore)
+}
+
+func TestRetrieverExplainSQLPlan(t *testing.T) {
+	kbaseID := uuid.New()
+	gateway := &fakeEmbeddingsGateway{matches: fakeMatches(kbaseID)}
+	kbases := newFakeKbaseGateway(types.Kbase{ID: kbaseID, Name: "policies"})
+	retriever := search.NewRetriever(&fakeEmbedder{}, gateway, kbases, nil)
+
+	result, err := retriever.Search(context.Background(), types.SearchRequest{
+		Query:          "what is covered?",
+		KbaseIDs:       []uuid.UUID{kbaseID},
+		Explain:        true,
+		IncludeSQLPlan: true,
+	})
+
+	assert.Nil(t, err, "Error should be nil")
+	assert.True(t, gateway.explained)
+	assert.Equal(t, "Limit", result.Explain.SQLPlan.NodeType)
+
+	_, err = retriever.Search(context.Background(), types.SearchRequest{
+		Query:    "what is covered?",
+		KbaseIDs: []uuid.UUID{kbaseID},
+		HyDE:     true,
+	})
+	assert.NotNil(t, err, "HyDE without a transformer should be an error")
+}
@@ -0,0 +1,44 @@
+package tests
+
+import (
+	"context"
+	"rag-demo/pkg/search"
+	"rag-demo/types"
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDefaultMinSimilarity(t *testing.T) {
+	assert.Equal(t, 0.35, search.DefaultMinSimilarity("amazon.titan-embed-g1-text-02", "cosine"))
+	assert.Equal(t, 0.3, search.DefaultMinSimilarity("unknown-model", "cosine"), "models without a default of their own should use the fallback")
+}
+
+func TestRetrieverRelevanceThresholds(t *testing.T) {
+	ctx := context.Background()
+	kbaseID := uuid.New()
+	// similarities 0.9, 0.8 and 0.6
+	gateway := &fakeEmbeddingsGateway{matches: fakeMatches(kbaseID)}
+
+	strict := 0.85
+	kbases := newFakeKbaseGateway(types.Kbase{ID: kbaseID, Name: "policies", MinSimilarity: &strict})
+	retriever := search.NewRetriever(&fakeEmbedder{}, gateway, kbases, nil)
+
+	result, err := retriever.Search(ctx, types.SearchRequest{Query: "fees", KbaseIDs: []uuid.UUID{kbaseID}})
+	assert.Nil(t, err, "Error should be nil")
+	assert.Equal(t, types.SearchOutcomeOK, result.Outcome)
+	assert.Len(t, result.Hits, 1, "the kbase threshold should drop less similar chunks")
+	assert.InDelta(t, 0.9, result.Hits[0].Similarity, 1e-9)
+
+	lenient := 0.5
+	result, err = retriever.Search(ctx, types.SearchRequest{Query: "fees", KbaseIDs: []uuid.UUID{kbaseID}, MinSimilarity: &lenient})
+	assert.Nil(t, err, "Error should be nil")
+	assert.Len(t, result.Hits, 3, "the request threshold should override the kbase threshold")
+
+	impossible := 0.95
+	result, err = retriever.Search(ctx, types.SearchRequest{Query: "fees", KbaseIDs: []uuid.UUID{kbaseID}, MinSimilarity: &impossible})
+	assert.Nil(t, err, "Error should be nil")
+	assert.Equal(t, types.SearchOutcomeNoRelevantContext, result.Outcome)
+	assert.Empty(t, result.Hits)
+}
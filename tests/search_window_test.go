@@ -0,0 +1,68 @@
+package tests
+
+import (
+	"rag-demo/pkg/search"
+	"rag-demo/types"
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+)
+
+func windowMatch(kbaseID uuid.UUID, source string, chunkID int, distance float64) types.KbaseEmbeddingMatch {
+	return types.KbaseEmbeddingMatch{
+		KbaseEmbedding: types.KbaseEmbedding{
+			KbaseID:  kbaseID,
+			ChunkID:  chunkID,
+			Metadata: map[string]interface{}{"source": source},
+		},
+		Distance: distance,
+	}
+}
+
+func TestMergeWindows(t *testing.T) {
+	kbaseID := uuid.New()
+
+	matches := []types.KbaseEmbeddingMatch{
+		windowMatch(kbaseID, "a.pdf", 7, 0.1),
+		windowMatch(kbaseID, "a.pdf", 5, 0.2),
+		windowMatch(kbaseID, "a.pdf", 20, 0.3),
+		windowMatch(kbaseID, "b.pdf", 5, 0.4),
+		// same chunk indexed twice
+		windowMatch(kbaseID, "b.pdf", 5, 0.5),
+	}
+
+	windows := search.MergeWindows(matches, 1)
+
+	assert.Len(t, windows, 3, "overlapping windows of a.pdf should be merged")
+
+	assert.Equal(t, "a.pdf", windows[0].Source)
+	assert.Equal(t, 4, windows[0].ChunkStart)
+	assert.Equal(t, 8, windows[0].ChunkEnd)
+	assert.Equal(t, []int{5, 7}, windows[0].MatchedChunks)
+	assert.Equal(t, 0.1, windows[0].Distance)
+
+	assert.Equal(t, "a.pdf", windows[1].Source)
+	assert.Equal(t, 19, windows[1].ChunkStart)
+	assert.Equal(t, 21, windows[1].ChunkEnd)
+
+	assert.Equal(t, "b.pdf", windows[2].Source)
+	assert.Equal(t, []int{5}, windows[2].MatchedChunks)
+	assert.Equal(t, 0.4, windows[2].Distance)
+}
+
+func TestMergeWindowsWithoutWindow(t *testing.T) {
+	kbaseID := uuid.New()
+
+	matches := []types.KbaseEmbeddingMatch{
+		windowMatch(kbaseID, "a.pdf", 1, 0.2),
+		windowMatch(kbaseID, "a.pdf", 0, 0.3),
+	}
+
+	windows := search.MergeWindows(matches, 0)
+
+	assert.Len(t, windows, 2, "adjacent chunks should not be merged without a window")
+	assert.Equal(t, 1, windows[0].ChunkStart)
+	assert.Equal(t, 0, windows[1].ChunkStart)
+	assert.Equal(t, 0, windows[1].ChunkEnd)
+}
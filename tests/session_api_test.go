@@ -0,0 +1,173 @@
+package tests
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"rag-demo/pkg/llm"
+	"rag-demo/pkg/auth"
+	"rag-demo/pkg/handlers"
+	"rag-demo/pkg/message"
+	"rag-demo/types"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+)
+
+type sessionTestAPI struct {
+	router    *chi.Mux
+	sessions  *fakeSessionGateway
+	messages  *fakeMessageGateway
+	assistant types.Assistant
+	user      types.User
+	token     string
+	other     string
+}
+
+func newSessionTestAPI(t *testing.T, sessions ...types.Session) *sessionTestAPI {
+	user := types.User{UserID: uuid.New(), Name: "session user"}
+	other := types.User{UserID: uuid.New(), Name: "other user"}
+	assistant := types.Assistant{ID: uuid.New(), Name: "travel", Model: "anthropic.claude-3-haiku-20240307-v1:0"}
+
+	authService := auth.NewAuthService(newFakeUserGateway(user, other), nil)
+	token, err := authService.GenerateJWT(context.Background(), user)
+	if err != nil {
+		t.Fatalf("GenerateJWT failed: %v", err)
+	}
+	otherToken, _ := authService.GenerateJWT(context.Background(), other)
+
+	for i := range sessions {
+		sessions[i].UserID = user.UserID
+	}
+	sessionGateway := newFakeSessionGateway(sessions...)
+	messages := &fakeMessageGateway{}
+	assistants := newFakeAssistantGateway(assistant)
+	sessionService := message.NewSessionService(sessionGateway, messages, assistants)
+	chatService := message.NewChatService(assistants, messages, nil, &llm.ScriptedLLM{Reply: "Hello there"}, nil, nil, nil, nil, nil, nil, nil)
+
+	router := chi.NewRouter()
+	router.Use(handlers.RequireAuth(authService, nil))
+	router.Post("/api/v1/session", handlers.HandleCreateSession(sessionService))
+	router.Get("/api/v1/session", handlers.HandleListSessions(sessionService))
+	router.Get("/api/v1/session/{id}", handlers.HandleGetSession(sessionService))
+	router.Post("/api/v1/session/{id}/close", handlers.HandleCloseSession(sessionService))
+	router.Post("/api/v1/session/{id}/message", handlers.HandleSendMessage(sessionService, chatService))
+
+	return &sessionTestAPI{
+		router:    router,
+		sessions:  sessionGateway,
+		messages:  messages,
+		assistant: assistant,
+		user:      user,
+		token:     token,
+		other:     otherToken,
+	}
+}
+
+func (api *sessionTestAPI) serve(method string, url string, token string, body string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(method, url, strings.NewReader(body))
+	if token != "" {
+		req.Header.Set("access-token", "Bearer "+token)
+	}
+	rr := httptest.NewRecorder()
+	api.router.ServeHTTP(rr, req)
+	return rr
+}
+
+func TestCreateSessionBoundToAssistant(t *testing.T) {
+	api := newSessionTestAPI(t)
+
+	// a user_id in the body is ignored: sessions belong to the user of the access token
+	rr := api.serve("POST", "/api/v1/session", api.token, `{"user_id": "`+uuid.New().String()+`", "assistant_id": "`+api.assistant.ID.String()+`", "title": " Lost luggage "}`)
+	assert.Equal(t, http.StatusOK, rr.Code, rr.Body.String())
+	var session types.Session
+	json.NewDecoder(rr.Body).Decode(&session)
+	assert.Equal(t, api.user.UserID, session.UserID)
+	assert.Equal(t, api.assistant.ID, session.AssistantID)
+	assert.Equal(t, "Lost luggage", session.Title)
+	assert.True(t, session.Active)
+
+	// the bound assistant answers without the message naming it
+	rr = api.serve("POST", "/api/v1/session/"+session.ID.String()+"/message", api.token, `{"message": "hi"}`)
+	assert.Equal(t, http.StatusOK, rr.Code, rr.Body.String())
+	assert.Equal(t, api.assistant.ID, api.messages.messages[0].AssistantID)
+
+	rr = api.serve("POST", "/api/v1/session", api.token, `{"assistant_id": "`+uuid.New().String()+`"}`)
+	assert.Equal(t, http.StatusNotFound, rr.Code)
+	assert.Equal(t, http.StatusUnauthorized, api.serve("POST", "/api/v1/session", "", `{}`).Code)
+}
+
+func TestListSessionsPaginated(t *testing.T) {
+	start := time.Now()
+	var sessions []types.Session
+	for i := 0; i < 5; i++ {
+		sessions = append(sessions, types.Session{ID: uuid.New(), Active: true, UpdatedAt: start.Add(time.Duration(i) * time.Minute)})
+	}
+	api := newSessionTestAPI(t, sessions...)
+
+	rr := api.serve("GET", "/api/v1/session?limit=2&offset=1", api.token, "")
+	assert.Equal(t, http.StatusOK, rr.Code, rr.Body.String())
+	var page types.SessionList
+	json.NewDecoder(rr.Body).Decode(&page)
+	assert.Equal(t, 5, page.Total)
+	assert.Equal(t, 2, page.Limit)
+	assert.Equal(t, 1, page.Offset)
+	assert.Len(t, page.Sessions, 2)
+	assert.Equal(t, sessions[3].ID, page.Sessions[0].ID, "most recently active first")
+	assert.Equal(t, sessions[2].ID, page.Sessions[1].ID)
+
+	rr = api.serve("GET", "/api/v1/session", api.other, "")
+	json.NewDecoder(rr.Body).Decode(&page)
+	assert.Equal(t, 0, page.Total, "sessions are listed per user")
+	assert.NotNil(t, page.Sessions)
+
+	assert.Equal(t, http.StatusBadRequest, api.serve("GET", "/api/v1/session?limit=ten", api.token, "").Code)
+	assert.Equal(t, http.StatusUnauthorized, api.serve("GET", "/api/v1/session", "", "").Code)
+}
+
+func TestGetSessionWithHistory(t *testing.T) {
+	session := types.Session{ID: uuid.New(), Active: true}
+	api := newSessionTestAPI(t, session)
+	url := "/api/v1/session/" + session.ID.String()
+
+	api.serve("POST", url+"/message", api.token, `{"message": "first", "assistant_id": "`+api.assistant.ID.String()+`"}`)
+	api.serve("POST", url+"/message", api.token, `{"message": "second", "assistant_id": "`+api.assistant.ID.String()+`"}`)
+
+	rr := api.serve("GET", url, api.token, "")
+	assert.Equal(t, http.StatusOK, rr.Code, rr.Body.String())
+	var history types.SessionHistory
+	json.NewDecoder(rr.Body).Decode(&history)
+	assert.Equal(t, session.ID, history.Session.ID)
+	assert.Len(t, history.Messages, 2)
+	assert.Equal(t, "first", history.Messages[0].UserMessage)
+	assert.Equal(t, "second", history.Messages[1].UserMessage)
+
+	assert.Equal(t, http.StatusForbidden, api.serve("GET", url, api.other, "").Code)
+	assert.Equal(t, http.StatusForbidden, api.serve("POST", url+"/message", api.other, `{"message": "third"}`).Code, "only the owner can post to a session")
+	assert.Equal(t, http.StatusNotFound, api.serve("GET", "/api/v1/session/"+uuid.New().String(), api.token, "").Code)
+}
+
+func TestCloseSessionBlocksMessages(t *testing.T) {
+	session := types.Session{ID: uuid.New(), Active: true}
+	api := newSessionTestAPI(t, session)
+	url := "/api/v1/session/" + session.ID.String()
+
+	assert.Equal(t, http.StatusForbidden, api.serve("POST", url+"/close", api.other, "").Code)
+	assert.True(t, api.sessions.sessions[session.ID].Active)
+
+	rr := api.serve("POST", url+"/close", api.token, "")
+	assert.Equal(t, http.StatusOK, rr.Code, rr.Body.String())
+	assert.False(t, api.sessions.sessions[session.ID].Active)
+
+	rr = api.serve("POST", url+"/message", api.token, `{"message": "hi", "assistant_id": "`+api.assistant.ID.String()+`"}`)
+	assert.Equal(t, http.StatusConflict, rr.Code)
+	assert.Empty(t, api.messages.messages)
+
+	// the history stays readable after closing
+	assert.Equal(t, http.StatusOK, api.serve("GET", url, api.token, "").Code)
+}
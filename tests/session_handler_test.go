@@ -6,6 +6,7 @@ import (
 	"encoding/json"
 	"net/http"
 	"net/http/httptest"
+	"rag-demo/pkg/auth"
 	"rag-demo/pkg/db"
 	"rag-demo/pkg/handlers"
 	"rag-demo/pkg/message"
@@ -26,8 +27,10 @@ func TestCreateSessionHandler(t *testing.T) {
 
     userGateway := db.NewUserTableGateway(testDBPool)
     sessionGateway := db.NewSessionTableGateway(testDBPool)
-    sessionService := message.NewSessionService(sessionGateway)
+    sessionService := message.NewSessionService(sessionGateway, db.NewMessageTableGateway(testDBPool), db.NewAssistantTableGateway(testDBPool))
 
+    authService := auth.NewAuthService(userGateway, nil)
+    router.Use(handlers.RequireAuth(authService, nil))
     router.Post("/api/v1/session", handlers.HandleCreateSession(sessionService))
 
     // Create a test user
@@ -41,10 +44,13 @@ func TestCreateSessionHandler(t *testing.T) {
         t.Fatalf("Failed to create test user: %v", err)
     }
 
-    newSessionRequest := types.NewSessionRequest{
-        UserID: newUser.UserID,
+    token, err := authService.GenerateJWT(context.Background(), newUser)
+    if err != nil {
+        t.Fatalf("GenerateJWT failed: %v", err)
     }
 
+    newSessionRequest := types.NewSessionRequest{}
+
     body, err := json.Marshal(newSessionRequest)
     if err != nil {
         t.Fatalf("Failed to marshal new session request: %v", err)
@@ -55,6 +61,7 @@ func TestCreateSessionHandler(t *testing.T) {
         t.Fatal(err)
     }
     req.Header.Set("Content-Type", "application/json")
+    req.Header.Set("access-token", "Bearer "+token)
 
     rr := httptest.NewRecorder()
     router.ServeHTTP(rr, req)
@@ -33,7 +33,7 @@ func TestSessionService_CreateSession(t *testing.T) {
     godotenv.Load("../.env")
 
     sessionGateway := db.NewSessionTableGateway(dbPool)
-    sessionService := message.NewSessionService(sessionGateway)
+    sessionService := message.NewSessionService(sessionGateway, db.NewMessageTableGateway(dbPool), db.NewAssistantTableGateway(dbPool))
 
     userGateway := db.NewUserTableGateway(dbPool)
 
@@ -54,7 +54,7 @@ func TestSessionService_CreateSession(t *testing.T) {
 	wg := &sync.WaitGroup{}
 	wg.Add(1)
 
-    sessionService.CreateSession(ctx, testUser.UserID, resultCh, wg)
+    sessionService.CreateSession(ctx, testUser.UserID, types.NewSessionRequest{}, resultCh, wg)
 
 	wg.Wait()           
 	result := <-resultCh 
@@ -81,7 +81,7 @@ func TestSessionService_GetSession(t *testing.T) {
 	godotenv.Load("../.env")
 
 	sessionGateway := db.NewSessionTableGateway(dbPool)
-	sessionService := message.NewSessionService(sessionGateway)
+	sessionService := message.NewSessionService(sessionGateway, db.NewMessageTableGateway(dbPool), db.NewAssistantTableGateway(dbPool))
 
 	userGateway := db.NewUserTableGateway(dbPool)
 
@@ -103,7 +103,7 @@ func TestSessionService_GetSession(t *testing.T) {
 	wg := &sync.WaitGroup{}
 	wg.Add(1)
 
-	sessionService.CreateSession(ctx, testUser.UserID, resultCh, wg)
+	sessionService.CreateSession(ctx, testUser.UserID, types.NewSessionRequest{}, resultCh, wg)
 
 	wg.Wait()            
 	result := <-resultCh  
@@ -0,0 +1,154 @@
+package tests
+
+import (
+	"context"
+	"errors"
+	"rag-demo/pkg/llm"
+	"rag-demo/pkg/message"
+	"rag-demo/pkg/textsql"
+	"rag-demo/types"
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+)
+
+func salesTables() []types.TableSchema {
+	return []types.TableSchema{
+		{Schema: "sales", Name: "orders", Columns: []types.ColumnSchema{{Name: "id", Type: "integer"}, {Name: "customer_id", Type: "integer"}, {Name: "total", Type: "numeric", Nullable: true}}},
+		{Schema: "sales", Name: "customers", Columns: []types.ColumnSchema{{Name: "id", Type: "integer"}, {Name: "Name", Type: "text"}}},
+	}
+}
+
+func TestTextSQLValidateSelect(t *testing.T) {
+	allowed := []string{
+		"SELECT count(*) FROM sales.orders",
+		"select c.\"Name\", sum(o.total) from sales.customers c join sales.orders o on o.customer_id = c.id group by 1 order by 2 desc limit 5;",
+		"WITH big AS (SELECT * FROM sales.orders WHERE total > 100) SELECT count(*) FROM big",
+		"SELECT extract(year FROM now()), 'DELETE FROM x; --' FROM sales.orders a, sales.customers b -- DROP TABLE sales.orders",
+		"SELECT * FROM (SELECT id FROM sales.orders) AS o(id), generate_series(1, 3)",
+		"SELECT $$; DELETE$$ FROM sales.orders",
+		"WITH q AS (TABLE sales.orders) SELECT count(*) FROM q",
+		"SELECT * FROM (TABLE sales.customers) c, (VALUES (1), (2)) v(n)",
+		"SELECT \"table\" FROM sales.orders",
+	}
+	for _, query := range allowed {
+		assert.Nil(t, textsql.ValidateSelect(query, salesTables()), query)
+	}
+
+	notReadOnly := []string{
+		"",
+		"DELETE FROM sales.orders",
+		"SELECT 1; DROP TABLE sales.orders",
+		"WITH gone AS (DELETE FROM sales.orders RETURNING *) SELECT * FROM gone",
+		"SELECT * INTO sales.copy FROM sales.orders",
+		"SELECT * FROM sales.orders FOR UPDATE",
+		"SELECT * FROM sales.orders FOR SHARE",
+		"SELECT pg_sleep(10)",
+		"SELECT pg_catalog.pg_read_file('/etc/passwd')",
+		"SELECT set_config('statement_timeout', '0', false)",
+		"SELECT * FROM sales.orders WHERE id = $1",
+		"SELECT 'unterminated FROM sales.orders",
+		"SELECT (1 FROM sales.orders",
+		"COPY sales.orders TO '/tmp/orders'",
+		"SET statement_timeout = 0",
+	}
+	for _, query := range notReadOnly {
+		assert.True(t, errors.Is(textsql.ValidateSelect(query, salesTables()), textsql.ErrNotReadOnly), query)
+	}
+
+	notAllowed := []string{
+		"SELECT * FROM sales.invoices",
+		"SELECT * FROM orders",
+		"SELECT * FROM pg_authid",
+		"SELECT * FROM sales.orders o JOIN pg_catalog.pg_authid a ON true",
+		"SELECT * FROM sales.orders, information_schema.tables",
+		"SELECT * FROM (pg_catalog.pg_user CROSS JOIN sales.orders)",
+		"SELECT id FROM sales.orders WHERE id IN (SELECT 1 FROM public.secrets)",
+		"SELECT a, pg_user AS x FROM pg_user",
+		"WITH q AS (TABLE secret.payroll) SELECT * FROM q",
+		"SELECT EXISTS (TABLE secret.payroll)",
+		"SELECT (WITH q AS (TABLE pg_catalog.pg_roles) SELECT json_agg(q) FROM q)",
+		"SELECT id FROM sales.orders UNION TABLE ONLY secret.payroll",
+		"SELECT * FROM (TABLE secret.payroll) p",
+	}
+	for _, query := range notAllowed {
+		assert.True(t, errors.Is(textsql.ValidateSelect(query, salesTables()), textsql.ErrTableNotAllowed), query)
+	}
+}
+
+func TestTextSQLAnswerRetriesRejectedQueries(t *testing.T) {
+	sandbox := &fakeSQLSandboxGateway{
+		tables: salesTables(),
+		result: types.SQLResult{Columns: []types.SQLColumn{{Name: "count", Type: "int8"}}, Rows: [][]interface{}{{int64(42)}}, RowCount: 1},
+	}
+	model := &llm.ScriptedLLM{Script: []types.LLMResponse{
+		{Text: "```sql\nDELETE FROM sales.orders\n```"},
+		{Text: "```sql\nSELECT count(*) FROM sales.orders;\n```"},
+		{Text: "There are 42 orders."},
+	}}
+	service := textsql.NewService(model, sandbox, textsql.Config{Tables: []string{"sales.*"}})
+
+	var received []types.SQLResult
+	var streamed string
+	result, summary, err := service.Answer(context.Background(), types.LLMRequest{
+		ModelID:  "anthropic.claude-3-haiku-20240307-v1:0",
+		System:   "You answer questions about sales.",
+		Messages: []types.LLMMessage{{Role: types.LLMRoleUser, Content: "How many orders are there?"}},
+	}, func(result types.SQLResult) {
+		received = append(received, result)
+	}, func(token string) error {
+		streamed += token
+		return nil
+	})
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"SELECT count(*) FROM sales.orders"}, sandbox.queries, "only the valid query runs, without its semicolon")
+	assert.Equal(t, []types.SQLResult{result}, received)
+	assert.Equal(t, "There are 42 orders.", summary.Text)
+	assert.Equal(t, summary.Text, streamed)
+	assert.Equal(t, 5+6+4, summary.Usage.OutputTokens, "the usage adds up every model call")
+
+	requests := model.Requests()
+	assert.Contains(t, requests[0].System, "You answer questions about sales.")
+	assert.Contains(t, requests[0].System, `sales.customers (id integer NOT NULL, "Name" text NOT NULL)`)
+	retry := requests[1].Messages
+	assert.Len(t, retry, 3)
+	assert.Contains(t, retry[2].Content, "must start with SELECT or WITH", "the model is told why its query was rejected")
+	assert.Contains(t, requests[2].Messages[0].Content, "count\n42\n(1 rows)", "the result is shown to the model for the summary")
+
+	model = &llm.ScriptedLLM{Reply: "DROP TABLE sales.orders"}
+	service = textsql.NewService(model, sandbox, textsql.Config{Tables: []string{"sales.*"}})
+	_, _, err = service.Answer(context.Background(), types.LLMRequest{Messages: []types.LLMMessage{{Role: types.LLMRoleUser, Content: "Drop the orders"}}}, nil, nil)
+	assert.True(t, errors.Is(err, textsql.ErrQueryRejected))
+	assert.Len(t, model.Requests(), 2, "a rejected query is retried once")
+}
+
+func TestChatServiceTextToSQL(t *testing.T) {
+	assistant := types.Assistant{ID: uuid.New(), Name: "sales", Model: "anthropic.claude-3-haiku-20240307-v1:0", Type: types.AssistantTypeTextToSQL}
+	messages := &fakeMessageGateway{}
+	sandbox := &fakeSQLSandboxGateway{
+		tables: salesTables(),
+		result: types.SQLResult{Columns: []types.SQLColumn{{Name: "count", Type: "int8"}}, Rows: [][]interface{}{{int64(42)}}, RowCount: 1},
+	}
+	model := &llm.ScriptedLLM{Script: []types.LLMResponse{
+		{Text: "SELECT count(*) FROM sales.orders"},
+		{Text: "There are 42 orders."},
+	}}
+	chatService := message.NewChatService(newFakeAssistantGateway(assistant), messages, nil, model, nil, nil, nil, nil,
+		textsql.NewService(model, sandbox, textsql.Config{Tables: []string{"sales.*"}}), nil, nil)
+
+	result := sendTestMessage(chatService, types.Session{ID: uuid.New(), UserID: uuid.New()}, types.MessageRequest{Message: "How many orders are there?", AssistantID: assistant.ID})
+	assert.True(t, result.Success, "SendMessage should succeed: %v", result.Error)
+	response := result.Data.(types.ChatResponse)
+	assert.Equal(t, "There are 42 orders.", response.Answer)
+	assert.Equal(t, "SELECT count(*) FROM sales.orders", response.SQL.Query)
+	assert.Equal(t, [][]interface{}{{int64(42)}}, response.SQL.Rows)
+
+	stored := messages.messages[0].SQL
+	assert.Equal(t, "SELECT count(*) FROM sales.orders", stored.Query)
+	assert.Nil(t, stored.Rows, "the rows aren't stored with the message")
+
+	unconfigured := message.NewChatService(newFakeAssistantGateway(assistant), &fakeMessageGateway{}, nil, model, nil, nil, nil, nil, nil, nil, nil)
+	result = sendTestMessage(unconfigured, types.Session{ID: uuid.New(), UserID: uuid.New()}, types.MessageRequest{Message: "How many orders are there?", AssistantID: assistant.ID})
+	assert.True(t, errors.Is(result.Error, textsql.ErrNotConfigured))
+}
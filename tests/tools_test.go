@@ -0,0 +1,171 @@
+package tests
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"rag-demo/pkg/llm"
+	"rag-demo/pkg/message"
+	"rag-demo/pkg/search"
+	"rag-demo/pkg/tools"
+	"rag-demo/types"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+)
+
+func weatherTool() tools.Tool {
+	return tools.Tool{
+		Name:        "get_weather",
+		Description: "Returns the weather forecast for a city.",
+		Schema:      json.RawMessage(`{"type":"object","properties":{"city":{"type":"string"},"days":{"type":"integer"}},"required":["city"]}`),
+		Handler: func(ctx context.Context, input json.RawMessage) (string, error) {
+			var args struct {
+				City string `json:"city"`
+			}
+			json.Unmarshal(input, &args)
+			return "Sunny in " + args.City, nil
+		},
+	}
+}
+
+func toolCall(id string, name string, input string) types.ToolCall {
+	return types.ToolCall{ID: id, Name: name, Input: json.RawMessage(input)}
+}
+
+func TestToolRegistry(t *testing.T) {
+	registry := tools.NewRegistry()
+	assert.Nil(t, registry.Register(weatherTool()))
+	assert.True(t, registry.Known("get_weather"))
+	assert.True(t, registry.Known(tools.KbaseSearch), "the built-in tools are always known")
+	assert.False(t, registry.Known("send_email"))
+
+	err := registry.Register(weatherTool())
+	assert.True(t, errors.Is(err, tools.ErrInvalidTool), "a tool can only be registered once")
+
+	invalid := []tools.Tool{
+		{Name: "get weather", Description: "d", Schema: json.RawMessage(`{"type":"object"}`), Handler: weatherTool().Handler},
+		{Name: "no_schema", Description: "d", Schema: json.RawMessage(`not json`), Handler: weatherTool().Handler},
+		{Name: "not_object", Description: "d", Schema: json.RawMessage(`{"type":"string"}`), Handler: weatherTool().Handler},
+		{Name: "undeclared", Description: "d", Schema: json.RawMessage(`{"type":"object","required":["city"]}`), Handler: weatherTool().Handler},
+		{Name: "no_handler", Description: "d", Schema: json.RawMessage(`{"type":"object"}`)},
+		{Name: tools.KbaseSearch, Description: "d", Schema: json.RawMessage(`{"type":"object"}`), Handler: weatherTool().Handler},
+	}
+	for _, tool := range invalid {
+		assert.True(t, errors.Is(registry.Register(tool), tools.ErrInvalidTool), tool.Name)
+	}
+
+	specs := registry.Specs()
+	assert.Len(t, specs, 2)
+	assert.Equal(t, "get_weather", specs[0].Name)
+	assert.Equal(t, tools.KbaseSearch, specs[1].Name)
+}
+
+func TestToolAgentRunsToolCalls(t *testing.T) {
+	model := &llm.ScriptedLLM{Script: []types.LLMResponse{
+		{Text: "Let me check.", ToolCalls: []types.ToolCall{
+			toolCall("t1", "get_weather", `{"city":"Lisbon"}`),
+			toolCall("t2", "get_weather", `{"days":2}`),
+			toolCall("t3", "send_email", `{}`),
+		}},
+		{Text: "It is sunny in Lisbon."},
+	}}
+	req := types.LLMRequest{ModelID: "anthropic.claude-3-haiku-20240307-v1:0", Messages: []types.LLMMessage{{Role: types.LLMRoleUser, Content: "Weather in Lisbon?"}}}
+
+	var streamed string
+	var observed []types.ToolCallRecord
+	response, calls, err := tools.NewAgent(model, 0).Run(context.Background(), req, []tools.Tool{weatherTool()}, tools.RunOptions{
+		OnToken:    func(token string) error { streamed += token; return nil },
+		OnToolCall: func(call types.ToolCallRecord) { observed = append(observed, call) },
+	})
+	assert.Nil(t, err)
+	assert.Equal(t, "Let me check.\n\nIt is sunny in Lisbon.", response.Text)
+	assert.Equal(t, response.Text, streamed, "the streamed text matches the answer")
+	assert.Equal(t, calls, observed)
+
+	assert.Len(t, calls, 3)
+	assert.Equal(t, "Sunny in Lisbon", calls[0].Output)
+	assert.Contains(t, calls[1].Error, "missing required property city", "the input is checked against the schema")
+	assert.Contains(t, calls[2].Error, "unknown tool")
+
+	requests := model.Requests()
+	assert.Len(t, requests, 2)
+	assert.Equal(t, "get_weather", requests[0].Tools[0].Name, "the tool specs are sent to the model")
+	followUp := requests[1].Messages
+	assert.Len(t, followUp, 3)
+	assert.Len(t, followUp[1].ToolCalls, 3, "the model's tool calls are replayed")
+	assert.Equal(t, []types.ToolResult{
+		{ToolCallID: "t1", Content: "Sunny in Lisbon"},
+		{ToolCallID: "t2", Content: calls[1].Error, IsError: true},
+		{ToolCallID: "t3", Content: calls[2].Error, IsError: true},
+	}, followUp[2].ToolResults)
+	assert.Len(t, req.Messages, 1, "the caller's request is not modified")
+}
+
+func TestToolAgentTimeoutAndIterationCap(t *testing.T) {
+	slow := weatherTool()
+	slow.Timeout = 10 * time.Millisecond
+	slow.Handler = func(ctx context.Context, input json.RawMessage) (string, error) {
+		<-ctx.Done()
+		return "", ctx.Err()
+	}
+
+	var script []types.LLMResponse
+	for i := 0; i < 3; i++ {
+		script = append(script, types.LLMResponse{ToolCalls: []types.ToolCall{toolCall("t", "get_weather", `{"city":"Lisbon"}`)}})
+	}
+	model := &llm.ScriptedLLM{Script: script}
+	req := types.LLMRequest{Messages: []types.LLMMessage{{Role: types.LLMRoleUser, Content: "Weather in Lisbon?"}}}
+
+	_, calls, err := tools.NewAgent(model, 2).Run(context.Background(), req, []tools.Tool{slow}, tools.RunOptions{})
+	assert.True(t, errors.Is(err, tools.ErrMaxIterations), "the model keeps calling tools: %v", err)
+	assert.Len(t, model.Requests(), 2, "the model is called at most MaxIterations times")
+	assert.Len(t, calls, 2)
+	assert.Contains(t, calls[0].Error, "timed out")
+}
+
+func TestChatServiceKbaseSearchTool(t *testing.T) {
+	kbaseID := uuid.New()
+	assistant := types.Assistant{ID: uuid.New(), Name: "travel", Model: "anthropic.claude-3-haiku-20240307-v1:0", Tools: []string{tools.KbaseSearch}}
+	messages := &fakeMessageGateway{}
+	model := &llm.ScriptedLLM{Script: []types.LLMResponse{
+		{ToolCalls: []types.ToolCall{toolCall("t1", tools.KbaseSearch, `{"query":"lost luggage cover"}`)}},
+		{Text: "Lost luggage is covered [1]."},
+	}}
+	embedder := &fakeEmbedder{}
+	retriever := search.NewRetriever(embedder, &fakeEmbeddingsGateway{matches: fakeMatches(kbaseID)}, newFakeKbaseGateway(types.Kbase{ID: kbaseID}), nil)
+	chatService := message.NewChatService(newFakeAssistantGateway(assistant).attach(assistant.ID, kbaseID), messages, retriever, model, nil, nil, nil, nil, nil, nil, nil)
+
+	result := sendTestMessage(chatService, types.Session{ID: uuid.New(), UserID: uuid.New()}, types.MessageRequest{Message: "Is lost luggage covered?", AssistantID: assistant.ID})
+	assert.True(t, result.Success, "SendMessage should succeed: %v", result.Error)
+	response := result.Data.(types.ChatResponse)
+
+	assert.Equal(t, []string{"lost luggage cover"}, embedder.texts, "the kbases are only searched when the model asks")
+	assert.Equal(t, "Lost luggage is covered [1].", response.Answer)
+	assert.Len(t, response.Sources, 3, "the passages found by the tool become the sources")
+	assert.Len(t, response.Citations, 1)
+	assert.Len(t, response.ToolCalls, 1)
+	assert.Contains(t, response.ToolCalls[0].Output, `<source id="1" name="policy.pdf"`)
+	assert.Equal(t, response.ToolCalls, messages.messages[0].ToolCalls, "tool calls are recorded on the message")
+	assert.Equal(t, tools.KbaseSearch, model.Requests()[0].Tools[0].Name)
+}
+
+func TestAssistantToolsValidation(t *testing.T) {
+	router, _ := newAssistantTestRouter()
+
+	create := func(model string, toolNames ...string) int {
+		return serveJSON(router, "POST", "/api/v1/assistant", types.NewAssistantRequest{
+			Name:  uuid.NewString(),
+			Model: model,
+			Type:  "rag",
+			Tools: toolNames,
+		}).Code
+	}
+	assert.Equal(t, http.StatusCreated, create("anthropic.claude-3-haiku-20240307-v1:0", tools.KbaseSearch))
+	assert.Equal(t, http.StatusBadRequest, create("anthropic.claude-3-haiku-20240307-v1:0", "send_email"), "unknown tools are rejected")
+	assert.Equal(t, http.StatusBadRequest, create("anthropic.claude-3-haiku-20240307-v1:0", tools.KbaseSearch, tools.KbaseSearch), "tools are listed once")
+	assert.Equal(t, http.StatusBadRequest, create("amazon.titan-text-express-v1", tools.KbaseSearch), "the model must support tool use")
+}
@@ -0,0 +1,135 @@
+package tests
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"rag-demo/pkg/auth"
+	"rag-demo/pkg/handlers"
+	"rag-demo/pkg/llm"
+	"rag-demo/pkg/message"
+	"rag-demo/pkg/search"
+	"rag-demo/pkg/usage"
+	"rag-demo/types"
+	"testing"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestUsagePrices(t *testing.T) {
+	haiku := "anthropic.claude-3-haiku-20240307-v1:0"
+	assert.InDelta(t, 0.00025+0.0025, usage.DefaultPrices.Cost(types.Usage{ModelID: haiku, InputTokens: 1000, OutputTokens: 2000}), 1e-12)
+	assert.InDelta(t, 0.015, usage.DefaultPrices.Cost(types.Usage{ModelID: usage.TextractDetectText, Pages: 10}), 1e-12)
+	assert.Zero(t, usage.DefaultPrices.Cost(types.Usage{ModelID: "unknown-model", InputTokens: 1000}), "unpriced models cost nothing")
+
+	path := filepath.Join(t.TempDir(), "prices.json")
+	os.WriteFile(path, []byte(`{"anthropic.claude-3-haiku-20240307-v1:0": {"input_per_1k": 0.001, "output_per_1k": 0.002}}`), 0o600)
+	prices, err := usage.LoadPrices(path)
+	assert.Nil(t, err)
+	assert.Equal(t, usage.Price{InputPer1K: 0.001, OutputPer1K: 0.002}, prices[haiku], "the file overrides the default price")
+	assert.Equal(t, usage.DefaultPrices[usage.TextractDetectText], prices[usage.TextractDetectText], "prices missing from the file keep their default")
+	assert.Equal(t, 0.00025, usage.DefaultPrices[haiku].InputPer1K, "loading doesn't change the defaults")
+
+	_, err = usage.LoadPrices(filepath.Join(t.TempDir(), "missing.json"))
+	assert.NotNil(t, err)
+}
+
+func TestChatServiceRecordsUsage(t *testing.T) {
+	kbaseID := uuid.New()
+	assistant := types.Assistant{ID: uuid.New(), Name: "travel", Model: "anthropic.claude-3-haiku-20240307-v1:0"}
+	session := types.Session{ID: uuid.New(), UserID: uuid.New(), AssistantID: assistant.ID}
+	usageGateway := &fakeUsageGateway{}
+	meter := usage.NewMeter(usageGateway, usage.PriceTable{
+		assistant.Model:        {InputPer1K: 0.25, OutputPer1K: 1.25},
+		"fake-embedding-model": {InputPer1K: 0.1},
+	})
+	model := usage.NewMeteredLLM(&llm.ScriptedLLM{Reply: "The Gold plan covers lost luggage [1]."}, meter)
+	embedder := usage.NewMeteredEmbedder(&fakeEmbedder{}, meter)
+	retriever := search.NewRetriever(embedder, &fakeEmbeddingsGateway{matches: fakeMatches(kbaseID)}, newFakeKbaseGateway(types.Kbase{ID: kbaseID}), nil)
+	chatService := message.NewChatService(newFakeAssistantGateway(assistant).attach(assistant.ID, kbaseID), &fakeMessageGateway{}, retriever, model, nil, nil, nil, nil, nil, nil, nil)
+
+	result := sendTestMessage(chatService, session, types.MessageRequest{Message: "Which plan covers lost luggage?"})
+	assert.True(t, result.Success, "message should succeed: %v", result.Error)
+	response := result.Data.(types.ChatResponse)
+
+	if assert.Len(t, usageGateway.usage, 2) {
+		scope := types.UsageScope{UserID: session.UserID, SessionID: session.ID, AssistantID: assistant.ID}
+		embedding, generation := usageGateway.usage[0], usageGateway.usage[1]
+
+		assert.Equal(t, types.UsageKindEmbedding, embedding.Kind)
+		assert.Equal(t, "fake-embedding-model", embedding.ModelID)
+		assert.Equal(t, 5, embedding.InputTokens)
+		assert.InDelta(t, 0.0005, embedding.Cost, 1e-12)
+		assert.Equal(t, scope, embedding.UsageScope)
+
+		assert.Equal(t, types.UsageKindGeneration, generation.Kind)
+		assert.Equal(t, assistant.Model, generation.ModelID)
+		assert.Equal(t, response.Usage.InputTokens, generation.InputTokens)
+		assert.Equal(t, response.Usage.OutputTokens, generation.OutputTokens)
+		assert.InDelta(t, float64(generation.InputTokens)*0.00025+float64(generation.OutputTokens)*0.00125, generation.Cost, 1e-12)
+		assert.Equal(t, scope, generation.UsageScope)
+		assert.NotEqual(t, embedding.ID, generation.ID)
+	}
+}
+
+func TestUsageReportHandler(t *testing.T) {
+	user := types.User{UserID: uuid.New(), Name: "usage user"}
+	admin := types.User{UserID: uuid.New(), Name: "usage admin"}
+	t.Setenv("ADMIN_USER_IDS", admin.UserID.String())
+	authService := auth.NewAuthService(newFakeUserGateway(user, admin), nil)
+	usageGateway := &fakeUsageGateway{usage: []types.Usage{
+		{UsageScope: types.UsageScope{UserID: user.UserID}, InputTokens: 100, OutputTokens: 10, Cost: 0.5},
+		{UsageScope: types.UsageScope{UserID: admin.UserID}, InputTokens: 200, OutputTokens: 20, Cost: 1},
+	}}
+	router := chi.NewRouter()
+	router.Use(handlers.RequireAuth(authService, nil))
+	router.Get("/api/v1/usage", handlers.HandleUsageReport(usage.NewUsageService(usageGateway)))
+
+	report := func(as types.User, query string) *httptest.ResponseRecorder {
+		token, err := authService.GenerateJWT(context.Background(), as)
+		if err != nil {
+			t.Fatalf("GenerateJWT failed: %v", err)
+		}
+		req := httptest.NewRequest("GET", "/api/v1/usage"+query, nil)
+		req.Header.Set("access-token", "Bearer "+token)
+		rr := httptest.NewRecorder()
+		router.ServeHTTP(rr, req)
+		return rr
+	}
+
+	rr := report(user, "")
+	assert.Equal(t, http.StatusOK, rr.Code, rr.Body.String())
+	var own types.UsageReport
+	json.NewDecoder(rr.Body).Decode(&own)
+	assert.Equal(t, 1, own.Total.Calls, "users only see their own usage")
+	assert.Equal(t, 0.5, own.Total.Cost)
+	assert.Equal(t, types.UsageGroupDay, own.GroupBy)
+	filter := usageGateway.filters[0]
+	assert.Equal(t, user.UserID, *filter.UserID)
+	assert.WithinDuration(t, filter.To.Add(-usage.DefaultReportPeriod), filter.From, time.Second)
+
+	assert.Equal(t, http.StatusForbidden, report(user, "?user_id="+admin.UserID.String()).Code)
+	assert.Equal(t, http.StatusBadRequest, report(user, "?group_by=month").Code)
+	assert.Equal(t, http.StatusBadRequest, report(user, "?assistant_id=nope").Code)
+	assert.Equal(t, http.StatusBadRequest, report(user, "?from=2024-10-20&to=2024-10-01").Code)
+
+	rr = report(admin, "?group_by=assistant&from=2024-10-01&to=2024-11-01")
+	assert.Equal(t, http.StatusOK, rr.Code, rr.Body.String())
+	var all types.UsageReport
+	json.NewDecoder(rr.Body).Decode(&all)
+	assert.Equal(t, 2, all.Total.Calls, "admins see everyone's usage")
+	filter = usageGateway.filters[len(usageGateway.filters)-1]
+	assert.Nil(t, filter.UserID)
+	assert.Equal(t, types.UsageGroupAssistant, filter.GroupBy)
+	assert.Equal(t, time.Date(2024, 10, 1, 0, 0, 0, 0, time.UTC), filter.From)
+
+	rr = httptest.NewRecorder()
+	router.ServeHTTP(rr, httptest.NewRequest("GET", "/api/v1/usage", nil))
+	assert.Equal(t, http.StatusUnauthorized, rr.Code)
+}
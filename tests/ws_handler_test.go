@@ -0,0 +1,270 @@
+package tests
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"rag-demo/pkg/llm"
+	"rag-demo/pkg/auth"
+	"rag-demo/pkg/handlers"
+	"rag-demo/pkg/message"
+	"rag-demo/pkg/quota"
+	"rag-demo/types"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/google/uuid"
+	"github.com/gorilla/websocket"
+	"github.com/stretchr/testify/assert"
+)
+
+// blockingGenerator streams one token and then waits until the request is cancelled.
+type blockingGenerator struct {
+	llm.ScriptedLLM
+}
+
+func (g *blockingGenerator) ConverseStream(ctx context.Context, req types.LLMRequest, onToken func(token string) error) (types.LLMResponse, error) {
+	if err := onToken("Thinking"); err != nil {
+		return types.LLMResponse{}, err
+	}
+	<-ctx.Done()
+	return types.LLMResponse{}, ctx.Err()
+}
+
+type wsTestServer struct {
+	server      *httptest.Server
+	authService auth.AuthService
+	users       *fakeUserGateway
+	session     types.Session
+	sessions    *fakeSessionGateway
+	assistant   types.Assistant
+	token       string
+	hub         *handlers.SessionHub
+	messages    *fakeMessageGateway
+}
+
+func newWSTestServer(t *testing.T, model llm.LLM) *wsTestServer {
+	return newWSTestServerWithLimits(t, model, quota.Limits{})
+}
+
+// newWSTestServerWithLimits serves the socket behind quota middleware with the given user limits, as
+// main does.
+func newWSTestServerWithLimits(t *testing.T, model llm.LLM, limits quota.Limits) *wsTestServer {
+	user := types.User{UserID: uuid.New(), Name: "ws user"}
+	session := types.Session{ID: uuid.New(), UserID: user.UserID, Active: true}
+	assistant := types.Assistant{ID: uuid.New(), Name: "travel", Model: "anthropic.claude-3-haiku-20240307-v1:0"}
+
+	users := newFakeUserGateway(user)
+	authService := auth.NewAuthService(users, nil)
+	token, err := authService.GenerateJWT(context.Background(), user)
+	if err != nil {
+		t.Fatalf("GenerateJWT failed: %v", err)
+	}
+	messages := &fakeMessageGateway{}
+	sessions := newFakeSessionGateway(session)
+	sessionService := message.NewSessionService(sessions, messages, newFakeAssistantGateway(assistant))
+	limiter := quota.NewLimiter(quota.NewMemoryStore(), map[string]quota.Limits{quota.SubjectUser: limits}, handlers.QuotaSubject(authService, nil))
+	chatService := message.NewChatService(newFakeAssistantGateway(assistant), messages, nil, quota.NewCountedLLM(model, limiter), nil, nil, nil, nil, nil, nil, nil)
+	hub := handlers.NewSessionHub()
+
+	router := chi.NewRouter()
+	router.Use(limiter.Requests)
+	router.Use(handlers.RequireAuth(authService, nil))
+	router.With(limiter.Tokens).Get("/api/v1/session/{id}/ws", handlers.HandleSessionWebSocket(sessionService, chatService, hub, limiter))
+
+	return &wsTestServer{
+		server:      httptest.NewServer(router),
+		authService: authService,
+		users:       users,
+		session:     session,
+		sessions:    sessions,
+		assistant:   assistant,
+		token:       token,
+		hub:         hub,
+		messages:    messages,
+	}
+}
+
+func (s *wsTestServer) dial(token string) (*websocket.Conn, *http.Response, error) {
+	url := "ws" + strings.TrimPrefix(s.server.URL, "http") + "/api/v1/session/" + s.session.ID.String() + "/ws"
+	header := http.Header{}
+	if token != "" {
+		header.Set("access-token", "Bearer "+token)
+	}
+	return websocket.DefaultDialer.Dial(url, header)
+}
+
+// readUntil reads frames until one of the given type arrives and returns the types seen on the way.
+func readUntil(t *testing.T, conn *websocket.Conn, msgType string) ([]string, types.WSServerMessage) {
+	var seen []string
+	conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	for {
+		var msg types.WSServerMessage
+		if err := conn.ReadJSON(&msg); err != nil {
+			t.Fatalf("failed reading %q frame: %v", msgType, err)
+		}
+		seen = append(seen, msg.Type)
+		if msg.Type == msgType {
+			return seen, msg
+		}
+	}
+}
+
+func TestSessionWebSocketMessage(t *testing.T) {
+	s := newWSTestServer(t, &llm.ScriptedLLM{Reply: "Hello there"})
+	defer s.server.Close()
+
+	conn, _, err := s.dial(s.token)
+	if err != nil {
+		t.Fatalf("dial failed: %v", err)
+	}
+	defer conn.Close()
+
+	readUntil(t, conn, types.WSTypeReady)
+
+	err = conn.WriteJSON(types.WSClientMessage{Type: types.WSTypeMessage, ID: "m1", Message: "hi", AssistantID: s.assistant.ID})
+	assert.Nil(t, err)
+
+	seen, done := readUntil(t, conn, types.ChatEventDone)
+	assert.Equal(t, "m1", done.ID)
+	assert.Equal(t, types.WSTypeTyping, seen[0])
+	assert.Equal(t, types.ChatEventSources, seen[1])
+	assert.Contains(t, seen, types.ChatEventToken)
+	assert.Equal(t, types.ChatEventUsage, seen[len(seen)-3])
+	assert.Equal(t, types.ChatEventCitations, seen[len(seen)-2])
+
+	_, typing := readUntil(t, conn, types.WSTypeTyping)
+	assert.Equal(t, false, typing.Data.(map[string]interface{})["typing"])
+
+	assert.Len(t, s.messages.messages, 1)
+	assert.Equal(t, "Hello there", s.messages.messages[0].AIMessage)
+}
+
+func TestSessionWebSocketCancel(t *testing.T) {
+	s := newWSTestServer(t, &blockingGenerator{})
+	defer s.server.Close()
+
+	conn, _, err := s.dial(s.token)
+	if err != nil {
+		t.Fatalf("dial failed: %v", err)
+	}
+	defer conn.Close()
+
+	readUntil(t, conn, types.WSTypeReady)
+
+	conn.WriteJSON(types.WSClientMessage{Type: types.WSTypeMessage, ID: "m1", Message: "hi", AssistantID: s.assistant.ID})
+	readUntil(t, conn, types.ChatEventToken)
+
+	conn.WriteJSON(types.WSClientMessage{Type: types.WSTypeMessage, ID: "m2", Message: "again", AssistantID: s.assistant.ID})
+	_, busy := readUntil(t, conn, types.ChatEventError)
+	assert.Equal(t, "m2", busy.ID, "a second message should be rejected while one is generating")
+
+	conn.WriteJSON(types.WSClientMessage{Type: types.WSTypeCancel, ID: "m1"})
+	seen, cancelled := readUntil(t, conn, types.WSTypeCancelled)
+	assert.Equal(t, "m1", cancelled.ID)
+	assert.NotContains(t, seen, types.ChatEventError)
+	assert.Empty(t, s.messages.messages, "a cancelled answer should not be stored")
+}
+
+func TestSessionWebSocketQuota(t *testing.T) {
+	// opening the socket is the first request of the minute, so one message fits
+	s := newWSTestServerWithLimits(t, &llm.ScriptedLLM{Reply: "Hello there"}, quota.Limits{RequestsPerMinute: 2})
+	defer s.server.Close()
+
+	conn, _, err := s.dial(s.token)
+	if err != nil {
+		t.Fatalf("dial failed: %v", err)
+	}
+	defer conn.Close()
+	readUntil(t, conn, types.WSTypeReady)
+
+	conn.WriteJSON(types.WSClientMessage{Type: types.WSTypeMessage, ID: "m1", Message: "hi", AssistantID: s.assistant.ID})
+	readUntil(t, conn, types.ChatEventDone)
+	readUntil(t, conn, types.WSTypeTyping)
+
+	conn.WriteJSON(types.WSClientMessage{Type: types.WSTypeMessage, ID: "m2", Message: "again", AssistantID: s.assistant.ID})
+	_, limited := readUntil(t, conn, types.ChatEventError)
+	assert.Equal(t, "m2", limited.ID)
+	data := limited.Data.(map[string]interface{})
+	assert.Equal(t, "rate limit exceeded", data["error"], "messages on an open socket count as requests")
+	assert.Greater(t, data["retry_after"], float64(0))
+	assert.Len(t, s.messages.messages, 1, "the limited message isn't answered")
+
+	// the tokens of the first answer use up the day's quota
+	s = newWSTestServerWithLimits(t, &llm.ScriptedLLM{Reply: "Hello there"}, quota.Limits{TokensPerDay: 1})
+	defer s.server.Close()
+	conn, _, err = s.dial(s.token)
+	if err != nil {
+		t.Fatalf("dial failed: %v", err)
+	}
+	defer conn.Close()
+	readUntil(t, conn, types.WSTypeReady)
+
+	conn.WriteJSON(types.WSClientMessage{Type: types.WSTypeMessage, ID: "m1", Message: "hi", AssistantID: s.assistant.ID})
+	readUntil(t, conn, types.ChatEventDone)
+	conn.WriteJSON(types.WSClientMessage{Type: types.WSTypeMessage, ID: "m2", Message: "again", AssistantID: s.assistant.ID})
+	_, limited = readUntil(t, conn, types.ChatEventError)
+	assert.Equal(t, "daily token quota exceeded", limited.Data.(map[string]interface{})["error"])
+	assert.Len(t, s.messages.messages, 1)
+}
+
+func TestSessionWebSocketNotice(t *testing.T) {
+	s := newWSTestServer(t, &llm.ScriptedLLM{})
+	defer s.server.Close()
+
+	conn, _, err := s.dial(s.token)
+	if err != nil {
+		t.Fatalf("dial failed: %v", err)
+	}
+	defer conn.Close()
+
+	readUntil(t, conn, types.WSTypeReady)
+
+	s.hub.Notify(s.session.ID, map[string]string{"document": "policy.pdf", "status": "indexed"})
+	_, notice := readUntil(t, conn, types.WSTypeNotice)
+	assert.Equal(t, "indexed", notice.Data.(map[string]interface{})["status"])
+}
+
+func TestSessionWebSocketUnauthorized(t *testing.T) {
+	s := newWSTestServer(t, &llm.ScriptedLLM{})
+	defer s.server.Close()
+
+	_, resp, err := s.dial("")
+	assert.NotNil(t, err)
+	assert.Equal(t, http.StatusUnauthorized, resp.StatusCode)
+
+	// a valid token for a different user must not open someone else's session
+	other := types.User{UserID: uuid.New(), Name: "other"}
+	s.users.CreateUser(context.Background(), other)
+	otherToken, _ := s.authService.GenerateJWT(context.Background(), other)
+	_, resp, err = s.dial(otherToken)
+	assert.NotNil(t, err)
+	assert.Equal(t, http.StatusForbidden, resp.StatusCode)
+}
+
+func TestSessionWebSocketClosedSession(t *testing.T) {
+	s := newWSTestServer(t, &llm.ScriptedLLM{Reply: "Hello there"})
+	defer s.server.Close()
+
+	conn, _, err := s.dial(s.token)
+	if err != nil {
+		t.Fatalf("dial failed: %v", err)
+	}
+	defer conn.Close()
+
+	readUntil(t, conn, types.WSTypeReady)
+
+	// closed through the REST endpoint while the socket stays open
+	s.sessions.CloseSession(context.Background(), s.session.ID)
+	conn.WriteJSON(types.WSClientMessage{Type: types.WSTypeMessage, ID: "m1", Message: "hi", AssistantID: s.assistant.ID})
+	_, closed := readUntil(t, conn, types.ChatEventError)
+	assert.Equal(t, "m1", closed.ID)
+	assert.Equal(t, "session is closed", closed.Data.(map[string]interface{})["error"])
+	assert.Empty(t, s.messages.messages)
+
+	_, resp, err := s.dial(s.token)
+	assert.NotNil(t, err)
+	assert.Equal(t, http.StatusConflict, resp.StatusCode)
+}
@@ -0,0 +1,40 @@
+package types
+
+import (
+	"context"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// APIKey lets scripts call the API as a user without an access token. Only the hash of the key is
+// stored; Prefix is kept so users can tell their keys apart.
+type APIKey struct {
+	ID        uuid.UUID `json:"id"`
+	UserID    uuid.UUID `json:"user_id"`
+	Name      string    `json:"name"`
+	Prefix    string    `json:"prefix"`
+	KeyHash   string    `json:"-"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// NewAPIKey is a created API key with the key itself, which is only ever returned once.
+type NewAPIKey struct {
+	APIKey
+	Key string `json:"key"`
+}
+
+// represents the payload for creating an API key
+type NewAPIKeyRequest struct {
+	Name string `json:"name" validate:"required,max=100"`
+}
+
+// APIKeyTableGateway defines the interface for the api_key table.
+type APIKeyTableGateway interface {
+	CreateAPIKey(ctx context.Context, key APIKey) error
+	// GetAPIKeyByHash returns the key of the hash; an unknown hash is pgx.ErrNoRows
+	GetAPIKeyByHash(ctx context.Context, keyHash string) (APIKey, error)
+	ListAPIKeys(ctx context.Context, userID uuid.UUID) ([]APIKey, error)
+	// DeleteAPIKey deletes a key of the user and reports whether there was one
+	DeleteAPIKey(ctx context.Context, userID uuid.UUID, keyID uuid.UUID) (bool, error)
+}
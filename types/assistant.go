@@ -3,6 +3,7 @@ package types
 import (
     "github.com/google/uuid"
 	"context"
+	"time"
 )
 
 // Metadata represents additional information for an assistant. Used for UI purposes.
@@ -20,10 +21,51 @@ type Assistant struct {
     Model         string            `json:"model"`    // Model used by the assistant
     // KbaseID       *uuid.UUID        `json:"kbase_id,omitempty"`
     Type          string            `json:"type"` // Type of the assistant (e.g., travel_assistant, txt-to-sql)
-    SystemPrompts string 			`json:"system_prompts"`
+    SystemPrompts string 			`json:"system_prompts"` // text/template rendered per turn, see assistant.PromptVariables
+    PromptVersion int               `json:"prompt_version"` // version of SystemPrompts in the assistant's prompt history
+    Tools         []string          `json:"tools,omitempty"` // names of the registered tools the model may call
+    Guardrails    *GuardrailPolicy  `json:"guardrails,omitempty"` // content controls on messages and answers
+    Groundedness  *GroundednessPolicy `json:"groundedness,omitempty"` // checks answers against their sources
     Metadata      *Metadata         `json:"metadata,omitempty"`
 }
 
+// PromptVersion is an immutable revision of an assistant's system prompt template.
+type PromptVersion struct {
+    AssistantID uuid.UUID `json:"assistant_id"`
+    Version     int       `json:"version"`
+    Template    string    `json:"template"`
+    CreatedAt   time.Time `json:"created_at"`
+}
+
+// NewAssistantRequest represents the payload for creating or replacing an assistant.
+type NewAssistantRequest struct {
+    Name          string    `json:"name" validate:"required,max=255"`
+    Model         string    `json:"model" validate:"required,max=255"`
+    Type          string    `json:"type" validate:"required,max=255"`
+    SystemPrompts string    `json:"system_prompts"`
+    Tools         []string  `json:"tools,omitempty" validate:"max=20,dive,max=64"`
+    Guardrails    *GuardrailPolicy `json:"guardrails,omitempty"`
+    Groundedness  *GroundednessPolicy `json:"groundedness,omitempty"`
+    Metadata      *Metadata `json:"metadata,omitempty"`
+}
+
+// AssistantKbase links a kbase to an assistant, with the retrieval settings used when the assistant answers.
+type AssistantKbase struct {
+    AssistantID   uuid.UUID `json:"assistant_id"`
+    KbaseID       uuid.UUID `json:"kbase_id"`
+    KbaseName     string    `json:"kbase_name,omitempty"`
+    TopK          int       `json:"top_k"`                    // chunks retrieved from this kbase per question
+    MinSimilarity *float64  `json:"min_similarity,omitempty"` // overrides the kbase's relevance threshold
+    Weight        float64   `json:"weight"`                   // multiplies the similarity when ranking hits across kbases
+}
+
+// AttachKbaseRequest represents the payload for attaching a kbase to an assistant or changing the link's settings.
+type AttachKbaseRequest struct {
+    TopK          int      `json:"top_k" validate:"gte=0,lte=50"`
+    MinSimilarity *float64 `json:"min_similarity,omitempty" validate:"omitempty,gte=0,lte=1"`
+    Weight        *float64 `json:"weight,omitempty" validate:"omitempty,gt=0,lte=10"`
+}
+
 // AssistantList holds a collection of assistants.
 type AssistantList struct {
     Assistants []Assistant `json:"assistants"` // List of assistants
@@ -34,5 +76,11 @@ type AssistantTableGateway interface {
 	GetAssistant(ctx context.Context, assistantId uuid.UUID) (Assistant, error)
 	UpdateAssistant(ctx context.Context, assistant Assistant) (bool, error)
     ListAssistants(ctx context.Context) (AssistantList, error)
-	// GetAssistantByName(ctx context.Context, assistantName string) (Session, error)
+	GetAssistantByName(ctx context.Context, assistantName string) (Assistant, error)
+	DeleteAssistant(ctx context.Context, assistantId uuid.UUID) (bool, error)
+	AttachKbase(ctx context.Context, link AssistantKbase) (bool, error)
+	DetachKbase(ctx context.Context, assistantId uuid.UUID, kbaseId uuid.UUID) (bool, error)
+	ListAssistantKbases(ctx context.Context, assistantId uuid.UUID) ([]AssistantKbase, error)
+	ListPromptVersions(ctx context.Context, assistantId uuid.UUID) ([]PromptVersion, error)
+	RollbackPrompt(ctx context.Context, assistantId uuid.UUID, version int) (bool, error)
 }
\ No newline at end of file
@@ -0,0 +1,66 @@
+package types
+
+import (
+	"context"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Credentials are the email and password login of a user. They are kept apart from User so the
+// password hash never ends up in a response.
+type Credentials struct {
+	UserID            uuid.UUID
+	Email             string
+	PasswordHash      string
+	FailedLogins      int
+	LockedUntil       time.Time // zero unless the account is locked
+	PasswordChangedAt time.Time
+}
+
+// PasswordReset is an outstanding password reset of a user. Only the hash of its token is stored.
+type PasswordReset struct {
+	TokenHash string
+	UserID    uuid.UUID
+	ExpiresAt time.Time
+}
+
+// represents the payload for logging in with an email and password
+type LoginRequest struct {
+	Email    string `json:"email" validate:"required"`
+	Password string `json:"password" validate:"required"`
+}
+
+// represents the payload for changing the authenticated user's password
+type ChangePasswordRequest struct {
+	CurrentPassword string `json:"current_password" validate:"required"`
+	NewPassword     string `json:"new_password" validate:"required,min=8,max=72"`
+}
+
+// represents the payload for asking for a password reset token by email
+type PasswordResetRequest struct {
+	Email string `json:"email" validate:"required,email"`
+}
+
+// represents the payload for setting a new password with a reset token
+type ResetPasswordRequest struct {
+	Token       string `json:"token" validate:"required"`
+	NewPassword string `json:"new_password" validate:"required,min=8,max=72"`
+}
+
+// CredentialTableGateway defines the interface for the credentials and password reset tables.
+type CredentialTableGateway interface {
+	// CreateAccount creates the user and its credentials together
+	CreateAccount(ctx context.Context, user User, credentials Credentials) error
+	GetCredentials(ctx context.Context, userID uuid.UUID) (Credentials, error)
+	GetCredentialsByEmail(ctx context.Context, email string) (Credentials, error)
+	// RecordFailedLogin counts a failed login; the failure that reaches maxFailures locks the account
+	// until lockedUntil and starts the count over
+	RecordFailedLogin(ctx context.Context, userID uuid.UUID, maxFailures int, lockedUntil time.Time) error
+	ResetFailedLogins(ctx context.Context, userID uuid.UUID) error
+	// UpdatePassword replaces the password hash, unlocks the account and drops its outstanding resets
+	UpdatePassword(ctx context.Context, userID uuid.UUID, passwordHash string, changedAt time.Time) error
+	CreatePasswordReset(ctx context.Context, reset PasswordReset) error
+	// ConsumePasswordReset deletes the reset of the token hash and returns it, so each token is used once
+	ConsumePasswordReset(ctx context.Context, tokenHash string) (PasswordReset, error)
+}
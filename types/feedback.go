@@ -0,0 +1,108 @@
+package types
+
+import (
+	"context"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Ratings a user can give an answer.
+const (
+	FeedbackRatingUp   = "up"
+	FeedbackRatingDown = "down"
+)
+
+// Periods feedback summaries are bucketed by.
+const (
+	FeedbackIntervalDay  = "day"
+	FeedbackIntervalWeek = "week"
+)
+
+// NewFeedbackRequest is a user's rating of an answer.
+type NewFeedbackRequest struct {
+	Rating   string `json:"rating" validate:"required,oneof=up down"`
+	Category string `json:"category,omitempty" validate:"omitempty,oneof=inaccurate incomplete irrelevant unsupported outdated harmful other"`
+	Comment  string `json:"comment,omitempty" validate:"max=2000"`
+}
+
+// Feedback is a user's rating of an answer, linked to what produced it: the message, the assistant's
+// prompt version and the chunks retrieved for it. A user has one rating per message; rating again
+// replaces it.
+type Feedback struct {
+	ID            uuid.UUID       `json:"feedback_id"`
+	MessageID     uuid.UUID       `json:"message_id"`
+	UserID        uuid.UUID       `json:"user_id"`
+	SessionID     uuid.UUID       `json:"session_id"`
+	AssistantID   uuid.UUID       `json:"assistant_id"`
+	Rating        string          `json:"rating"`
+	Category      string          `json:"category,omitempty"`
+	Comment       string          `json:"comment,omitempty"`
+	PromptVersion int             `json:"prompt_version,omitempty"`
+	Chunks        []FeedbackChunk `json:"chunks,omitempty"`
+	CreatedAt     time.Time       `json:"created_at"`
+	UpdatedAt     time.Time       `json:"updated_at"`
+}
+
+// FeedbackChunk is a chunk that was retrieved for a rated answer.
+type FeedbackChunk struct {
+	KbaseID     uuid.UUID `json:"kbase_id"`
+	EmbeddingID uuid.UUID `json:"embedding_id"`
+	ChunkID     int       `json:"chunk_id"`
+	Source      string    `json:"source"`
+	Cited       bool      `json:"cited"` // the answer cited the passage holding the chunk
+}
+
+// FeedbackFilter selects the feedback a summary covers. Feedback on an assistant's answers is selected
+// by AssistantID, feedback on answers that used a kbase's chunks by KbaseID.
+type FeedbackFilter struct {
+	AssistantID *uuid.UUID
+	KbaseID     *uuid.UUID
+	From        time.Time
+	To          time.Time
+	Interval    string // FeedbackIntervalDay or FeedbackIntervalWeek
+	Limit       int    // questions and documents listed
+}
+
+// FeedbackSummary aggregates the feedback on answers of an assistant or answers based on a kbase.
+type FeedbackSummary struct {
+	From             time.Time           `json:"from"`
+	To               time.Time           `json:"to"`
+	Up               int                 `json:"up"`
+	Down             int                 `json:"down"`
+	SatisfactionRate float64             `json:"satisfaction_rate"` // share of up votes, 0 without votes
+	Series           []FeedbackPeriod    `json:"series"`
+	Categories       map[string]int      `json:"categories"` // down votes by category
+	Questions        []DownvotedQuestion `json:"questions"`  // most down-voted questions first
+	Documents        []DownvotedDocument `json:"documents"`  // documents whose chunks were used by the most down-voted answers first
+}
+
+// FeedbackPeriod is the feedback given in one day or week.
+type FeedbackPeriod struct {
+	Start            time.Time `json:"start"`
+	Up               int       `json:"up"`
+	Down             int       `json:"down"`
+	SatisfactionRate float64   `json:"satisfaction_rate"`
+}
+
+// DownvotedQuestion is a question whose answers were voted down, matched ignoring case and surrounding space.
+type DownvotedQuestion struct {
+	Question    string    `json:"question"`
+	Down        int       `json:"down"`
+	Up          int       `json:"up"`
+	LastVotedAt time.Time `json:"last_voted_at"`
+}
+
+// DownvotedDocument is a source document whose chunks were retrieved for answers that were voted down.
+type DownvotedDocument struct {
+	KbaseID uuid.UUID `json:"kbase_id"`
+	Source  string    `json:"source"`
+	Down    int       `json:"down"`
+	Cited   int       `json:"cited"` // down-voted answers that cited the document
+}
+
+type FeedbackTableGateway interface {
+	// SaveFeedback stores the user's rating of the message, replacing an earlier one, and returns it as stored
+	SaveFeedback(ctx context.Context, feedback Feedback) (Feedback, error)
+	SummarizeFeedback(ctx context.Context, filter FeedbackFilter) (FeedbackSummary, error)
+}
@@ -0,0 +1,40 @@
+package types
+
+// How an answer's sentences are checked against the sources.
+const (
+	GroundednessMethodJudge     = "llm"       // a model judges whether the passages support each sentence
+	GroundednessMethodEmbedding = "embedding" // a sentence is supported when it is similar enough to a passage
+)
+
+// What happens to an answer whose groundedness score is below the policy's threshold.
+const (
+	GroundednessActionRefuse   = "refuse"   // the answer is replaced by a refusal
+	GroundednessActionAnnotate = "annotate" // the unsupported sentences are listed after the answer
+)
+
+// GroundednessPolicy has an assistant's answers checked against the passages they were based on.
+type GroundednessPolicy struct {
+	Method         string  `json:"method" validate:"required,oneof=llm embedding"`
+	Threshold      float64 `json:"threshold" validate:"gte=0,lte=1"` // minimum share of sentences the sources must support
+	Action         string  `json:"action" validate:"required,oneof=refuse annotate"`
+	JudgeModel     string  `json:"judge_model,omitempty" validate:"max=255"`        // judges with the llm method; the assistant's model when empty
+	MinSimilarity  float64 `json:"min_similarity,omitempty" validate:"gte=0,lte=1"` // embedding method; grounding.DefaultMinSimilarity when 0
+	RefusalMessage string  `json:"refusal_message,omitempty" validate:"max=1000"`   // replaces refused answers; grounding.DefaultRefusal when empty
+}
+
+// Groundedness is how well the sources support an answer.
+type Groundedness struct {
+	Method      string                `json:"method"`
+	Score       float64               `json:"score"`     // share of the checked sentences the sources support, 1 when none was checked
+	Sentences   int                   `json:"sentences"` // sentences checked; very short ones are skipped
+	Unsupported []UnsupportedSentence `json:"unsupported,omitempty"`
+	Passed      bool                  `json:"passed"`           // the score reached the policy's threshold
+	Action      string                `json:"action,omitempty"` // what was done to the answer when it didn't pass
+}
+
+// UnsupportedSentence is a sentence of an answer the sources don't support.
+type UnsupportedSentence struct {
+	Index  int    `json:"index"` // position among the answer's sentences, from 0
+	Text   string `json:"text"`
+	Reason string `json:"reason,omitempty"` // the judge's explanation, with the llm method
+}
@@ -0,0 +1,51 @@
+package types
+
+// Where a guardrail check runs: on the user's message before it reaches the model, or on the answer.
+const (
+	GuardrailSourceInput  = "input"
+	GuardrailSourceOutput = "output"
+)
+
+// What a guardrail did to the checked content.
+const (
+	GuardrailActionNone    = "none"
+	GuardrailActionMasked  = "masked"  // sensitive parts were replaced, the rest went through
+	GuardrailActionBlocked = "blocked" // the content was replaced by the policy's blocked message
+)
+
+// GuardrailPolicy is an assistant's content controls, applied to every user message and answer.
+// The local rules run first; a Bedrock guardrail, when set, then checks what they let through.
+type GuardrailPolicy struct {
+	DeniedWords   []string         `json:"denied_words,omitempty" validate:"max=500,dive,min=1,max=100"` // blocked as whole words, ignoring case
+	PII           []string         `json:"pii,omitempty" validate:"max=10,dive,max=32"`                  // detectors to run, see guardrail.Detectors
+	MaskPII       bool             `json:"mask_pii,omitempty"`                                           // replace detected PII with its type instead of blocking
+	BlockedTopics []GuardrailTopic `json:"blocked_topics,omitempty" validate:"max=50,dive"`
+
+	BedrockGuardrailID      string `json:"bedrock_guardrail_id,omitempty" validate:"max=255"`
+	BedrockGuardrailVersion string `json:"bedrock_guardrail_version,omitempty" validate:"max=16"` // DRAFT when empty
+
+	BlockedInputMessage  string `json:"blocked_input_message,omitempty" validate:"max=1000"`  // answer given instead of answering a blocked message
+	BlockedOutputMessage string `json:"blocked_output_message,omitempty" validate:"max=1000"` // replaces a blocked answer
+}
+
+// GuardrailTopic is a subject the assistant must not discuss, recognised by its keywords.
+type GuardrailTopic struct {
+	Name     string   `json:"name" validate:"required,max=100"`
+	Keywords []string `json:"keywords" validate:"required,max=100,dive,min=1,max=100"`
+}
+
+// GuardrailResult is what a guardrail found in a message or answer. Results of checks that
+// intervened are recorded with the message.
+type GuardrailResult struct {
+	Source     string               `json:"source"`
+	Action     string               `json:"action"`
+	Violations []GuardrailViolation `json:"violations,omitempty"`
+	Message    string               `json:"message,omitempty"` // the blocked message shown instead, when blocked
+}
+
+// GuardrailViolation is one rule a message or answer broke. The matched text isn't kept, as it may
+// be the PII the rule protects.
+type GuardrailViolation struct {
+	Type string `json:"type"` // denied_word, pii, topic, or the Bedrock policy that intervened
+	Name string `json:"name"` // the word, detector or topic
+}
@@ -10,9 +10,25 @@ type Document struct {
 type DocumentText struct {
 	Name   string
 	Chunks []string
+	// Pages holds the page range of each chunk when the extractor knows it, parallel to Chunks
+	Pages []PageRange
+	// PageCount is the number of pages Textract processed, 0 for text that wasn't extracted by it
+	PageCount int
+}
+
+// PageRange is the first and last page, 1-based, that a chunk of text was extracted from.
+type PageRange struct {
+	Start int
+	End   int
 }
 
 type TitanEmbeddingInput struct {
 	// must use camelcase for AWS here
 	InputText string `json:"inputText"`
-}
\ No newline at end of file
+}
+
+// TitanEmbeddingOutput is the response of the Titan embedding model.
+type TitanEmbeddingOutput struct {
+	Embedding           []float32 `json:"embedding"`
+	InputTextTokenCount int       `json:"inputTextTokenCount"`
+}
@@ -12,11 +12,13 @@ type Kbase struct {
     ID            uuid.UUID         `json:"id"`
     Name          string            `json:"name"`     // Name of the knowledge base
     Description   string            `json:"description"`    // Model used by the assistant
+    MinSimilarity *float64          `json:"min_similarity,omitempty"` // overrides the embedding model's default relevance threshold
 }
 
 type NewKbaseRequest struct {
-    Name        string `json:"name"`
-    Description string `json:"description"`
+    Name          string   `json:"name"`
+    Description   string   `json:"description"`
+    MinSimilarity *float64 `json:"min_similarity,omitempty" validate:"omitempty,gte=0,lte=1"`
 }
 
 
@@ -46,4 +48,8 @@ type KbaseTableGateway interface {
 type KbaseEmbeddingsTableGateway interface {
     CreateEmbedding(ctx context.Context, embedding KbaseEmbedding) (bool, error)
     // GetEmbedding(ctx context.Context, uuid uuid.UUID) (KbaseEmbedding, error)
+    SearchEmbeddings(ctx context.Context, kbaseIds []uuid.UUID, embedding pgvector.Vector, limit int) ([]KbaseEmbeddingMatch, error)
+    GetChunkRange(ctx context.Context, kbaseId uuid.UUID, source string, firstChunk int, lastChunk int) ([]KbaseEmbedding, error)
+    KeywordScores(ctx context.Context, query string, embeddingIds []uuid.UUID) (map[uuid.UUID]float64, error)
+    ExplainSearch(ctx context.Context, kbaseIds []uuid.UUID, embedding pgvector.Vector, limit int) (SQLPlanSummary, error)
 }
@@ -1,10 +1,79 @@
 package types 
 
 import (
+	"encoding/json"
+
 	"github.com/google/uuid"
 )
 
+// MessageRequest represents the payload for sending a chat message to a session.
 type MessageRequest struct {
-	Message string `json:"message"`
+	Message string `json:"message" validate:"required,max=4000"`
 	Session_id uuid.UUID `json:"session_id"`
-}
\ No newline at end of file
+	// AssistantID selects the assistant whose model, system prompt and attached kbases answer the message.
+	// It is only needed for sessions that aren't bound to an assistant; a bound session always uses its own.
+	AssistantID uuid.UUID `json:"assistant_id"`
+	// ParentID is the turn the message follows, to continue the conversation on another branch. The
+	// latest turn of the session is followed when it is nil, and a pointer to uuid.Nil starts a new root.
+	ParentID *uuid.UUID `json:"parent_id,omitempty"`
+}
+
+// EditMessageRequest is the corrected text of a user's message; it is answered on a new branch.
+type EditMessageRequest struct {
+	Message string `json:"message" validate:"required,max=4000"`
+}
+
+const (
+	LLMRoleUser      = "user"
+	LLMRoleAssistant = "assistant"
+)
+
+// LLMMessage is one turn of a conversation sent to a chat model. Assistant turns can request tool calls;
+// the user turn that follows carries their results.
+type LLMMessage struct {
+	Role        string       `json:"role"` // LLMRoleUser or LLMRoleAssistant
+	Content     string       `json:"content"`
+	ToolCalls   []ToolCall   `json:"tool_calls,omitempty"`
+	ToolResults []ToolResult `json:"tool_results,omitempty"`
+}
+
+// ToolSpec describes a tool a chat model may call.
+type ToolSpec struct {
+	Name        string          `json:"name"`
+	Description string          `json:"description"`
+	InputSchema json.RawMessage `json:"input_schema"` // JSON schema of the tool's input object
+}
+
+// ToolCall is a tool invocation requested by a chat model.
+type ToolCall struct {
+	ID    string          `json:"id"`
+	Name  string          `json:"name"`
+	Input json.RawMessage `json:"input"`
+}
+
+// ToolResult is the output of a ToolCall returned to the model.
+type ToolResult struct {
+	ToolCallID string `json:"tool_call_id"`
+	Content    string `json:"content"`
+	IsError    bool   `json:"is_error,omitempty"`
+}
+
+// LLMRequest is a chat model call in the same shape for every model family; providers adapt it to
+// what the model accepts.
+type LLMRequest struct {
+	ModelID       string
+	System        string
+	Messages      []LLMMessage
+	Temperature   *float32 // nil uses the model's default
+	MaxTokens     int      // 0 uses the model's default
+	StopSequences []string
+	Tools         []ToolSpec // tools the model may call; only models that support tool use accept them
+}
+
+// LLMResponse is the text a chat model generated for an LLMRequest.
+type LLMResponse struct {
+	Text       string
+	StopReason string     // e.g. end_turn, max_tokens, stop_sequence or tool_use
+	ToolCalls  []ToolCall // tools the model wants run before it answers
+	Usage      TokenUsage
+}
@@ -0,0 +1,116 @@
+package types
+
+import (
+	"context"
+	"encoding/json"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Message is one chat turn: the user's message and the assistant's answer.
+type Message struct {
+	ID             uuid.UUID         `json:"message_id"`
+	SessionID      uuid.UUID         `json:"session_id"`
+	ParentID       uuid.UUID         `json:"parent_id"` // the turn this one follows, uuid.Nil for a first turn
+	UserID         uuid.UUID         `json:"user_id"`
+	AssistantID    uuid.UUID         `json:"assistant_id"`
+	UserMessage    string            `json:"user_message"`
+	RewrittenQuery string            `json:"rewritten_query,omitempty"` // standalone query used for retrieval when UserMessage was a follow-up
+	AIMessage      string            `json:"ai_message"`
+	Sources        []SearchHit       `json:"sources,omitempty"`
+	Citations      []Citation        `json:"citations,omitempty"`
+	PromptVersion  int               `json:"prompt_version,omitempty"` // version of the assistant's system prompt that produced AIMessage
+	ToolCalls      []ToolCallRecord  `json:"tool_calls,omitempty"`
+	SQL            *SQLResult        `json:"sql,omitempty"`        // query a text-to-SQL assistant ran, stored without its rows
+	Guardrails     []GuardrailResult `json:"guardrails,omitempty"` // checks that masked or blocked the message or answer
+	Groundedness   *Groundedness     `json:"groundedness,omitempty"`
+	CreatedAt      time.Time         `json:"created_at"`
+	// SiblingIDs are the turns sharing ParentID, this one included, oldest first; set when reading history
+	SiblingIDs   []uuid.UUID `json:"sibling_ids,omitempty"`
+	SiblingCount int         `json:"sibling_count,omitempty"`
+}
+
+// ChatResponse is returned to the client after a message has been answered.
+type ChatResponse struct {
+	MessageID        uuid.UUID         `json:"message_id"`
+	SessionID        uuid.UUID         `json:"session_id"`
+	ParentID         uuid.UUID         `json:"parent_id"` // the turn the message follows, uuid.Nil for a first turn
+	Answer           string            `json:"answer"`
+	Outcome          string            `json:"outcome,omitempty"` // search outcome, empty when no kbase was searched
+	RewrittenQuery   string            `json:"rewritten_query,omitempty"`
+	Sources          []SearchHit       `json:"sources"`
+	Citations        []Citation        `json:"citations"`
+	InvalidCitations []int             `json:"invalid_citations,omitempty"` // markers that don't refer to a provided source
+	PromptVersion    int               `json:"prompt_version,omitempty"`
+	ToolCalls        []ToolCallRecord  `json:"tool_calls,omitempty"`
+	SQL              *SQLResult        `json:"sql,omitempty"`          // query and result of a text-to-SQL assistant; Answer summarises it
+	Guardrails       []GuardrailResult `json:"guardrails,omitempty"`   // checks that masked or blocked the message or Answer
+	Groundedness     *Groundedness     `json:"groundedness,omitempty"` // set when the assistant checks its answers against the sources
+	Usage            *TokenUsage       `json:"usage,omitempty"`
+}
+
+// ToolCallRecord is a tool call made while answering a message.
+type ToolCallRecord struct {
+	Name       string          `json:"name"`
+	Input      json.RawMessage `json:"input"`
+	Output     string          `json:"output,omitempty"`
+	Error      string          `json:"error,omitempty"` // set instead of Output when the call failed or timed out
+	DurationMs int64           `json:"duration_ms"`
+}
+
+// Citation links an [n] marker in an answer to the passage it cites.
+type Citation struct {
+	Marker     int       `json:"marker"`
+	KbaseID    uuid.UUID `json:"kbase_id"`
+	Document   string    `json:"document"`
+	ChunkID    int       `json:"chunk_id"`
+	ChunkStart int       `json:"chunk_start"`
+	ChunkEnd   int       `json:"chunk_end"`
+	PageStart  int       `json:"page_start,omitempty"` // 0 when the document has no page data
+	PageEnd    int       `json:"page_end,omitempty"`
+	Quote      string    `json:"quote"`
+}
+
+// TokenUsage is the number of tokens a model call consumed.
+type TokenUsage struct {
+	InputTokens  int `json:"input_tokens"`
+	OutputTokens int `json:"output_tokens"`
+	TotalTokens  int `json:"total_tokens"`
+}
+
+// Add returns the sum of u and other, for calls made up of several model requests.
+func (u TokenUsage) Add(other TokenUsage) TokenUsage {
+	return TokenUsage{
+		InputTokens:  u.InputTokens + other.InputTokens,
+		OutputTokens: u.OutputTokens + other.OutputTokens,
+		TotalTokens:  u.TotalTokens + other.TotalTokens,
+	}
+}
+
+// Server-sent event names used when streaming an answer.
+const (
+	ChatEventToken        = "token"
+	ChatEventSources      = "sources"
+	ChatEventCitations    = "citations"
+	ChatEventUsage        = "usage"
+	ChatEventToolCall     = "tool_call"
+	ChatEventSQL          = "sql"
+	ChatEventGuardrail    = "guardrail"
+	ChatEventGroundedness = "groundedness"
+	ChatEventDone         = "done"
+	ChatEventError        = "error"
+)
+
+// ChatEvent is one event of a streamed answer.
+type ChatEvent struct {
+	Event string
+	Data  interface{}
+}
+
+type MessageTableGateway interface {
+	CreateMessage(ctx context.Context, message Message) (bool, error)
+	// ListMessages returns the session's messages created after the given time, oldest first; a nil after lists all
+	ListMessages(ctx context.Context, sessionID uuid.UUID, after *time.Time) ([]Message, error)
+	GetMessage(ctx context.Context, messageID uuid.UUID) (Message, error)
+}
@@ -0,0 +1,21 @@
+package types
+
+import (
+	"context"
+	"time"
+)
+
+// QuotaCounter names one count of a subject's use, e.g. the requests of a user in one minute. Counters
+// are kept until ExpiresAt, the end of their window.
+type QuotaCounter struct {
+	Subject     string
+	Name        string
+	WindowStart time.Time
+	ExpiresAt   time.Time
+}
+
+// QuotaStore keeps the quota counters.
+type QuotaStore interface {
+	// Add adds n, which may be negative, to the counter and returns its new count; an n of 0 reads it
+	Add(ctx context.Context, counter QuotaCounter, n int) (int, error)
+}
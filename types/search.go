@@ -0,0 +1,109 @@
+package types
+
+import (
+	"github.com/google/uuid"
+)
+
+// SearchRequest represents the payload for searching one or more knowledge bases.
+type SearchRequest struct {
+	Query    string      `json:"query" validate:"required"`
+	KbaseIDs []uuid.UUID `json:"kbase_ids" validate:"required,min=1"`
+	TopK     int         `json:"top_k,omitempty" validate:"gte=0,lte=50"`
+	// Window is the number of neighbouring chunks (chunk_id ± Window) returned around each match.
+	Window int `json:"window,omitempty" validate:"gte=0,lte=10"`
+	// MultiQuery searches with LLM-generated paraphrases of the query as well and fuses the results.
+	MultiQuery bool `json:"multi_query,omitempty"`
+	NumQueries int  `json:"num_queries,omitempty" validate:"gte=0,lte=5"`
+	// HyDE embeds a generated hypothetical answer instead of the query itself.
+	HyDE bool `json:"hyde,omitempty"`
+	// MinSimilarity drops chunks less similar than this, overriding the kbase and embedding model defaults.
+	MinSimilarity *float64 `json:"min_similarity,omitempty" validate:"omitempty,gte=0,lte=1"`
+	// Explain attaches scores, applied filters and stage timings to the result for debugging.
+	Explain bool `json:"explain,omitempty"`
+	// IncludeSQLPlan adds the Postgres plan of the vector query to the explanation. Only set for admins.
+	IncludeSQLPlan bool `json:"-"`
+}
+
+// KbaseEmbeddingMatch is a stored chunk returned by a similarity search.
+type KbaseEmbeddingMatch struct {
+	KbaseEmbedding
+	Distance float64 `json:"distance"` // cosine distance to the query embedding
+}
+
+// ChunkWindow is a contiguous run of chunks from one source document, built from one or more matches.
+type ChunkWindow struct {
+	KbaseID       uuid.UUID `json:"kbase_id"`
+	Source        string    `json:"source"`
+	ChunkStart    int       `json:"chunk_start"`
+	ChunkEnd      int       `json:"chunk_end"`
+	MatchedChunks []int     `json:"matched_chunks"`
+	Distance      float64   `json:"distance"` // best distance among the matched chunks
+}
+
+// SearchHit is a passage returned to the caller. Without a window it is a single chunk.
+type SearchHit struct {
+	ChunkWindow
+	EmbeddingID uuid.UUID       `json:"embedding_id"` // kbase_embeddings uuid of the best matching chunk
+	ChunkID     int             `json:"chunk_id"`     // best matching chunk in the passage
+	Content     string          `json:"content"`
+	PageStart   int             `json:"page_start,omitempty"` // pages of the passage, 0 when the document has no page data
+	PageEnd     int             `json:"page_end,omitempty"`
+	Similarity  float64         `json:"similarity"` // 1 - cosine distance of the best matching chunk
+	Explain     *HitExplanation `json:"explain,omitempty"`
+}
+
+const (
+	// SearchOutcomeOK means at least one chunk passed the relevance threshold.
+	SearchOutcomeOK = "ok"
+	// SearchOutcomeNoRelevantContext means chunks were found but none was similar enough to the query.
+	SearchOutcomeNoRelevantContext = "no_relevant_context"
+)
+
+// NoRelevantContextAnswer is returned instead of a generated answer when retrieval found nothing relevant.
+const NoRelevantContextAnswer = "I don't know. I couldn't find anything relevant to your question in the available documents."
+
+// SearchResult holds the passages found for a query, best match first.
+type SearchResult struct {
+	Outcome              string             `json:"outcome"`
+	Query                string             `json:"query"`
+	GeneratedQueries     []string           `json:"generated_queries,omitempty"`
+	HypotheticalDocument string             `json:"hypothetical_document,omitempty"`
+	Hits                 []SearchHit        `json:"hits"`
+	Explain              *SearchExplanation `json:"explain,omitempty"`
+}
+
+// RankContribution is the reciprocal rank fusion score one query contributed to a hit.
+type RankContribution struct {
+	Kind  string  `json:"kind"` // query, hyde or paraphrase
+	Query string  `json:"query"`
+	Rank  int     `json:"rank"` // 1-based rank of the chunk in this query's results
+	Score float64 `json:"score"`
+}
+
+// HitExplanation breaks down how a hit was scored.
+type HitExplanation struct {
+	VectorDistance    float64            `json:"vector_distance"`
+	KeywordScore      float64            `json:"keyword_score"` // Postgres ts_rank of the best chunk against the query
+	RankContributions []RankContribution `json:"rank_contributions"`
+	FusedScore        float64            `json:"fused_score"`
+	RerankerScore     *float64           `json:"reranker_score"` // null when no reranker ran
+}
+
+// SQLPlanSummary condenses the Postgres EXPLAIN output of the vector query.
+type SQLPlanSummary struct {
+	NodeType  string   `json:"node_type"`
+	TotalCost float64  `json:"total_cost"`
+	PlanRows  int      `json:"plan_rows"`
+	Nodes     []string `json:"nodes"`             // every node in the plan, depth first
+	Indexes   []string `json:"indexes,omitempty"` // indexes the planner chose
+}
+
+// SearchExplanation describes how a search was executed.
+type SearchExplanation struct {
+	EmbeddingModel string                 `json:"embedding_model"`
+	DistanceMetric string                 `json:"distance_metric"`
+	Reranker       string                 `json:"reranker"`
+	Filters        map[string]interface{} `json:"filters"`
+	TimingsMs      map[string]float64     `json:"timings_ms"`
+	SQLPlan        *SQLPlanSummary        `json:"sql_plan,omitempty"`
+}
@@ -2,21 +2,51 @@ package types
 
 import (
 	"context"
+	"time"
+
 	"github.com/google/uuid"
 )
 
 // represents the session object in the database
 type Session struct {
-	ID uuid.UUID  `json:"session_id"`
-	UserID uuid.UUID `json:"user_id"`
+	ID          uuid.UUID `json:"session_id"`
+	UserID      uuid.UUID `json:"user_id"`
+	AssistantID uuid.UUID `json:"assistant_id"` // uuid.Nil for sessions started before sessions were bound to an assistant
+	Title       string    `json:"title"`
+	Active      bool      `json:"active"` // closed sessions don't accept new messages
+	// Summary condenses the turns up to SummarizedUntil that no longer fit the history budget
+	Summary         string     `json:"summary,omitempty"`
+	SummarizedUntil *time.Time `json:"summarized_until,omitempty"`
+	CreatedAt       time.Time  `json:"created_at"`
+	UpdatedAt       time.Time  `json:"updated_at"`
 }
 
-// represents the payload for starting a new session for a user
+// represents the payload for starting a new session for the authenticated user
 type NewSessionRequest struct {
-	UserID uuid.UUID `json:"user_id"`
+	AssistantID uuid.UUID `json:"assistant_id"`
+	Title       string    `json:"title" validate:"max=255"`
+}
+
+// SessionList is one page of a user's sessions, most recently active first.
+type SessionList struct {
+	Sessions []Session `json:"sessions"`
+	Total    int       `json:"total"`
+	Limit    int       `json:"limit"`
+	Offset   int       `json:"offset"`
+}
+
+// SessionHistory is a session with the messages of one branch of its conversation, oldest first.
+// Regenerated answers and edited messages start new branches; the siblings of each message are
+// the first messages of the other branches.
+type SessionHistory struct {
+	Session  Session   `json:"session"`
+	Messages []Message `json:"messages"`
 }
 
 type SessionTableGateway interface {
 	CreateSession(ctx context.Context, session Session) (bool, error)
 	GetSession(ctx context.Context, sessionID uuid.UUID) (Session, error)
-}
\ No newline at end of file
+	ListSessions(ctx context.Context, userID uuid.UUID, limit int, offset int) ([]Session, int, error)
+	CloseSession(ctx context.Context, sessionID uuid.UUID) (bool, error)
+	UpdateSessionSummary(ctx context.Context, sessionID uuid.UUID, summary string, summarizedUntil time.Time) (bool, error)
+}
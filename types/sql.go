@@ -0,0 +1,48 @@
+package types
+
+import (
+	"context"
+	"time"
+)
+
+// AssistantTypeTextToSQL assistants answer by querying the text-to-SQL database instead of searching kbases.
+const AssistantTypeTextToSQL = "txt-to-sql"
+
+// TableSchema describes a table or view a text-to-SQL assistant may query.
+type TableSchema struct {
+	Schema  string         `json:"schema"`
+	Name    string         `json:"name"`
+	Columns []ColumnSchema `json:"columns"`
+}
+
+// ColumnSchema describes a column of a TableSchema.
+type ColumnSchema struct {
+	Name     string `json:"name"`
+	Type     string `json:"type"`
+	Nullable bool   `json:"nullable"`
+}
+
+// SQLColumn is a column of a query result.
+type SQLColumn struct {
+	Name string `json:"name"`
+	Type string `json:"type"`
+}
+
+// SQLResult is a query a text-to-SQL assistant ran and the rows it returned.
+type SQLResult struct {
+	Query      string          `json:"query"`
+	Columns    []SQLColumn     `json:"columns"`
+	Rows       [][]interface{} `json:"rows,omitempty"` // not stored with the message
+	RowCount   int             `json:"row_count"`
+	Truncated  bool            `json:"truncated"` // the query returned more than the row limit
+	DurationMs int64           `json:"duration_ms"`
+}
+
+// SQLSandboxGateway reads the text-to-SQL database. Implementations must only ever run queries in
+// read-only transactions.
+type SQLSandboxGateway interface {
+	// DescribeTables lists the columns of the allowed tables; entries are "schema.table" or "schema.*"
+	DescribeTables(ctx context.Context, allowed []string) ([]TableSchema, error)
+	// RunReadOnly runs a single SELECT in a read-only transaction, returning at most maxRows rows
+	RunReadOnly(ctx context.Context, query string, maxRows int, timeout time.Duration) (SQLResult, error)
+}
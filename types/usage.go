@@ -0,0 +1,91 @@
+package types
+
+import (
+	"context"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Kinds of metered calls.
+const (
+	UsageKindGeneration = "generation" // a chat model call, priced by input and output tokens
+	UsageKindEmbedding  = "embedding"  // an embedding model call, priced by input tokens
+	UsageKindTextract   = "textract"   // a Textract text detection job, priced by page
+)
+
+// What usage reports are grouped by.
+const (
+	UsageGroupUser      = "user"
+	UsageGroupSession   = "session"
+	UsageGroupAssistant = "assistant"
+	UsageGroupKbase     = "kbase"
+	UsageGroupDay       = "day"
+	UsageGroupModel     = "model"
+)
+
+// UsageScope attributes metered calls to what they were made for. Chat calls are attributed to the
+// user, session and assistant of the message; ingestion calls to the kbase. uuid.Nil ids are unattributed.
+type UsageScope struct {
+	UserID      uuid.UUID `json:"user_id"`
+	SessionID   uuid.UUID `json:"session_id"`
+	AssistantID uuid.UUID `json:"assistant_id"`
+	KbaseID     uuid.UUID `json:"kbase_id"`
+}
+
+// Usage is one metered call with its cost in US dollars, priced when it was made.
+type Usage struct {
+	ID uuid.UUID `json:"usage_id"`
+	UsageScope
+	Kind         string    `json:"kind"`
+	ModelID      string    `json:"model_id"` // the Bedrock model id, or the Textract API for page usage
+	InputTokens  int       `json:"input_tokens"`
+	OutputTokens int       `json:"output_tokens"`
+	Pages        int       `json:"pages"`
+	Cost         float64   `json:"cost"`
+	CreatedAt    time.Time `json:"created_at"`
+}
+
+// UsageFilter selects the usage a report covers; nil ids don't filter.
+type UsageFilter struct {
+	UserID      *uuid.UUID
+	SessionID   *uuid.UUID
+	AssistantID *uuid.UUID
+	KbaseID     *uuid.UUID
+	From        time.Time
+	To          time.Time
+	GroupBy     string // UsageGroupUser, UsageGroupSession, UsageGroupAssistant, UsageGroupKbase, UsageGroupDay or UsageGroupModel
+}
+
+// UsageReport totals the filtered usage and breaks it down by the filter's grouping.
+type UsageReport struct {
+	From    time.Time    `json:"from"`
+	To      time.Time    `json:"to"`
+	GroupBy string       `json:"group_by"`
+	Total   UsageTotals  `json:"total"`
+	Groups  []UsageGroup `json:"groups"` // by day oldest first, otherwise most expensive first
+}
+
+// UsageGroup is the usage of one user, session, assistant, kbase, day or model. Key is the id, the
+// day as YYYY-MM-DD or the model id; it is empty for usage that isn't attributed to one.
+type UsageGroup struct {
+	Key string `json:"key"`
+	UsageTotals
+}
+
+// UsageTotals sums metered calls.
+type UsageTotals struct {
+	Calls          int     `json:"calls"`
+	InputTokens    int     `json:"input_tokens"`
+	OutputTokens   int     `json:"output_tokens"`
+	Pages          int     `json:"pages"`
+	Cost           float64 `json:"cost"`
+	GenerationCost float64 `json:"generation_cost"`
+	EmbeddingCost  float64 `json:"embedding_cost"`
+	TextractCost   float64 `json:"textract_cost"`
+}
+
+type UsageTableGateway interface {
+	RecordUsage(ctx context.Context, usage Usage) error
+	ReportUsage(ctx context.Context, filter UsageFilter) (UsageReport, error)
+}
@@ -15,7 +15,9 @@ type User struct {
 
 // NewUserRequest represents the payload for creating a new user.
 type NewUserRequest struct {
-	Name string `json:"name" validate:"required"`
+	Name     string `json:"name" validate:"required"`
+	Email    string `json:"email" validate:"required,email,max=254"`
+	Password string `json:"password" validate:"required,min=8,max=72"`
 }
 
 // UserTableGateway defines the interface for user-related database operations.
@@ -0,0 +1,35 @@
+package types
+
+import (
+	"github.com/google/uuid"
+)
+
+// Message types of the session WebSocket protocol. Streamed answer events reuse the ChatEvent names.
+const (
+	// client to server
+	WSTypeMessage = "message"
+	WSTypeCancel  = "cancel"
+	WSTypeTyping  = "typing"
+
+	// server to client
+	WSTypeReady     = "ready"
+	WSTypeCancelled = "cancelled"
+	WSTypeNotice    = "notice"
+)
+
+// WSClientMessage is a frame sent by the client over the session WebSocket.
+type WSClientMessage struct {
+	Type string `json:"type"`
+	// ID is chosen by the client for a message and echoed on every event of its answer; cancel uses it too.
+	ID          string    `json:"id,omitempty"`
+	Message     string    `json:"message,omitempty"`
+	AssistantID uuid.UUID `json:"assistant_id,omitempty"`
+	Typing      bool      `json:"typing,omitempty"`
+}
+
+// WSServerMessage is a frame sent by the server over the session WebSocket.
+type WSServerMessage struct {
+	Type string      `json:"type"`
+	ID   string      `json:"id,omitempty"`
+	Data interface{} `json:"data,omitempty"`
+}